@@ -0,0 +1,72 @@
+// Command analytics-backfill rebuilds the analytics rollup tables from
+// email_messages and email_events.
+//
+// Usage:
+//
+//	go run ./cmd/analytics-backfill              # rebuild everything
+//	go run ./cmd/analytics-backfill -since 2024-06-01
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/db"
+	"backend/internal/repositories"
+
+	"github.com/rs/zerolog"
+)
+
+func main() {
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+	since := flag.String("since", "", "rebuild buckets from this day (YYYY-MM-DD, UTC); empty rebuilds everything")
+	flag.Parse()
+
+	if err := run(logger, *since); err != nil {
+		logger.Fatal().
+			Err(err).
+			Str("event", "analytics.backfill.failed").
+			Msg("Analytics backfill failed")
+	}
+}
+
+// run rebuilds the rollups from the start of since's day onwards
+func run(logger zerolog.Logger, since string) error {
+	var from time.Time
+	if since != "" {
+		parsed, err := time.Parse("2006-01-02", since)
+		if err != nil {
+			return fmt.Errorf("invalid -since %q: %w", since, err)
+		}
+		from = parsed
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := db.InitDB(cfg.DatabaseURL); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	logger.Info().
+		Str("event", "analytics.backfill.start").
+		Time("since", from).
+		Msg("Rebuilding analytics rollups")
+
+	started := time.Now()
+	if err := repositories.NewAnalyticsRollupRepository().Rebuild(context.Background(), from); err != nil {
+		return err
+	}
+
+	logger.Info().
+		Str("event", "analytics.backfill.done").
+		Dur("duration", time.Since(started)).
+		Msg("Analytics rollups rebuilt")
+	return nil
+}
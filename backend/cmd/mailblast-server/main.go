@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"backend/internal/cache"
+	"backend/internal/campaigns"
+	"backend/internal/config"
+	"backend/internal/contacts"
+	"backend/internal/db"
+	"backend/internal/dkim"
+	"backend/internal/email"
+	"backend/internal/queue"
+	"backend/internal/repositories"
+	"backend/internal/smtppool"
+	"backend/internal/templates"
+	"backend/internal/webhooks"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+// shutdownTimeout bounds how long in-flight requests and jobs get to finish
+const shutdownTimeout = 30 * time.Second
+
+func main() {
+	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
+
+	if err := run(logger); err != nil {
+		logger.Fatal().
+			Err(err).
+			Str("event", "server.failed").
+			Msg("Server exited with error")
+	}
+}
+
+// run wires every dependency, serves HTTP and blocks until SIGINT/SIGTERM
+func run(logger zerolog.Logger) error {
+	cfg, err := config.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if err := db.InitDB(cfg.DatabaseURL); err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+
+	if err := queue.InitRedis(cfg.RedisAddr); err != nil {
+		return fmt.Errorf("failed to initialize redis: %w", err)
+	}
+
+	// Signs mail relayed through our SMTP servers with the sending domain's DKIM key
+	dkimSigner := dkim.NewKeySigner(dkim.NewRepository())
+
+	// Sends mail of the in-process queue and of the Redis queue consumer, so
+	// both share its provider routing and circuit breakers
+	sender, err := email.NewSender(context.Background(), cfg.EmailSender, dkimSigner)
+	if err != nil {
+		return err
+	}
+
+	// In-process queue for POST /emails/send
+	emailRepo := repositories.NewEmailRepository()
+	failedJobRepo := repositories.NewFailedJobRepository()
+	emailQueue := email.NewQueue(getEnvInt("EMAIL_QUEUE_WORKERS", 4), sender, emailRepo, failedJobRepo)
+	retryPolicy := email.DefaultRetryPolicy()
+	retryPolicy.MaxAttempts = getEnvInt("EMAIL_SEND_MAX_ATTEMPTS", retryPolicy.MaxAttempts)
+	emailQueue.SetRetryPolicy(retryPolicy)
+	emailQueue.Start()
+
+	// Versioned templates rendered by campaigns and POST /emails/send
+	templateService := templates.NewService(templates.NewRepository())
+
+	// Sends scheduled campaigns through the in-process queue
+	dispatcher := campaigns.NewDispatcher(
+		campaigns.NewRepository(),
+		contacts.NewRepository(db.DB),
+		emailRepo,
+		emailQueue,
+		time.Duration(getEnvInt("CAMPAIGN_DISPATCH_INTERVAL_SECONDS", 30))*time.Second,
+	)
+	dispatcher.SetTemplates(templateService)
+	dispatcher.Start(context.Background())
+
+	// Forgets Idempotency-Keys of POST /emails/send once they expire; it
+	// stops with purgeCtx, before shutdown closes the database
+	idempotencyRepo := repositories.NewIdempotencyRepository()
+	purgeCtx, stopPurge := context.WithCancel(context.Background())
+	defer stopPurge()
+	purgeDone := make(chan struct{})
+	go func() {
+		defer close(purgeDone)
+		purgeIdempotencyKeys(purgeCtx, logger, idempotencyRepo, time.Hour)
+	}()
+
+	// Delivers email events to client webhook endpoints
+	webhookRepo := webhooks.NewRepository()
+	webhookDispatcher := webhooks.NewDispatcher(
+		webhookRepo,
+		time.Duration(getEnvInt("WEBHOOK_DISPATCH_INTERVAL_SECONDS", 5))*time.Second,
+	)
+	webhookRetry := webhooks.DefaultRetryPolicy()
+	webhookRetry.MaxAttempts = getEnvInt("WEBHOOK_MAX_ATTEMPTS", webhookRetry.MaxAttempts)
+	webhookDispatcher.SetRetryPolicy(webhookRetry)
+	webhookDispatcher.Start(context.Background())
+
+	// Durable Redis queue consumer for POST /send-email and batch jobs
+	consumer := queue.NewConsumer(queue.Queue, queue.ConsumerConfig{
+		Concurrency:       cfg.QueueConcurrency,
+		VisibilityTimeout: cfg.QueueVisibilityTimeout,
+		MaxAttempts:       cfg.QueueMaxAttempts,
+	}, failedJobRepo)
+	if worker, err := queue.NewEmailWorker(sender, cfg.MailFromAddress, cfg.MailFromName); err != nil {
+		// Jobs stay in Redis until an instance with MAIL_FROM_ADDRESS set consumes them
+		logger.Warn().
+			Err(err).
+			Str("event", "queue.consumer.disabled").
+			Msg("Redis email consumer disabled")
+	} else {
+		consumer.Handle(queue.JobTypeSendEmail, worker.ProcessEmailJob)
+		consumer.Start(context.Background())
+	}
+
+	app := fiber.New(fiber.Config{
+		AppName:               "mailblast-server",
+		DisableStartupMessage: true,
+		ReadTimeout:           15 * time.Second,
+		WriteTimeout:          15 * time.Second,
+		// Bodies over the default BodyLimit are streamed; bodyLimit decides
+		// which routes read them
+		StreamRequestBody: true,
+	})
+	registerRoutes(app, &dependencies{
+		emailRepo:       emailRepo,
+		failedJobRepo:   failedJobRepo,
+		emailQueue:      emailQueue,
+		idempotency:     idempotencyRepo,
+		analyticsCache:  cache.NewAnalyticsCache(newCacheStore(cfg.AnalyticsCache)),
+		webhookService:  webhooks.NewService(webhookRepo, webhookDispatcher),
+		templateService: templateService,
+	})
+
+	// Serve until the listener fails or a shutdown signal arrives
+	serverErr := make(chan error, 1)
+	go func() {
+		addr := fmt.Sprintf(":%d", cfg.AppPort)
+		logger.Info().
+			Str("event", "server.start").
+			Str("addr", addr).
+			Msg("HTTP server listening")
+		serverErr <- app.Listen(addr)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-serverErr:
+		if err != nil {
+			return fmt.Errorf("http server failed: %w", err)
+		}
+	case sig := <-signals:
+		logger.Info().
+			Str("event", "server.shutdown").
+			Str("signal", sig.String()).
+			Msg("Shutdown signal received")
+	}
+
+	return shutdown(logger, app, dispatcher, webhookDispatcher, emailQueue, consumer, func() {
+		stopPurge()
+		<-purgeDone
+	})
+}
+
+// shutdown stops accepting requests, drains workers and closes connections
+// stopTasks stops the background tasks that use the database
+func shutdown(logger zerolog.Logger, app *fiber.App, dispatcher *campaigns.Dispatcher, webhookDispatcher *webhooks.Dispatcher, emailQueue *email.Queue, consumer *queue.Consumer, stopTasks func()) error {
+	var firstErr error
+
+	if err := app.ShutdownWithTimeout(shutdownTimeout); err != nil {
+		logger.Error().
+			Err(err).
+			Str("event", "server.shutdown.http_failed").
+			Msg("Failed to shut down HTTP server cleanly")
+		firstErr = err
+	}
+
+	// Wait for in-flight sends, but never longer than the shutdown timeout.
+	// Redis jobs that do not finish are redelivered once their lease expires.
+	stopped := make(chan struct{})
+	go func() {
+		// The dispatcher feeds emailQueue, so it must stop first
+		dispatcher.Stop()
+		emailQueue.Stop()
+		consumer.Stop()
+		webhookDispatcher.Stop()
+		stopTasks()
+		// Workers are done with their pooled SMTP connections
+		smtppool.Shared().Close()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		logger.Warn().
+			Str("event", "server.shutdown.queue_timeout").
+			Msg("Email workers did not drain before timeout")
+	}
+
+	if queue.Queue != nil {
+		if err := queue.Queue.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if sqlDB, err := db.DB.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	logger.Info().
+		Str("event", "server.stopped").
+		Msg("Server stopped")
+
+	return firstErr
+}
+
+// newCacheStore returns the analytics cache store for the configured backend
+func newCacheStore(backend string) cache.Cache {
+	if backend == "memory" {
+		return cache.NewMemoryCache()
+	}
+	return cache.NewRedisCache(queue.Queue, "analytics_cache")
+}
+
+// purgeIdempotencyKeys deletes expired idempotency keys every interval until ctx is done
+func purgeIdempotencyKeys(ctx context.Context, logger zerolog.Logger, repo repositories.IdempotencyRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := repo.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error().
+				Err(err).
+				Str("event", "email.idempotency.purge_failed").
+				Msg("Failed to delete expired idempotency keys")
+			continue
+		}
+		if deleted > 0 {
+			logger.Info().
+				Str("event", "email.idempotency.purged").
+				Int64("deleted", deleted).
+				Msg("Deleted expired idempotency keys")
+		}
+	}
+}
+
+// getEnvInt reads a positive integer from the environment with a default
+func getEnvInt(key string, defaultValue int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"backend/internal/cache"
+	"backend/internal/campaigns"
+	"backend/internal/config"
+	"backend/internal/contacts"
+	"backend/internal/db"
+	"backend/internal/dkim"
+	"backend/internal/email"
+	"backend/internal/handlers"
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/queue"
+	"backend/internal/repositories"
+	"backend/internal/services"
+	"backend/internal/templates"
+	"backend/internal/tracking"
+	"backend/internal/users"
+	"backend/internal/webhooks"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// dependencies holds the long-lived components shared by route handlers
+type dependencies struct {
+	emailRepo       repositories.EmailRepository
+	failedJobRepo   repositories.FailedJobRepository
+	emailQueue      *email.Queue
+	idempotency     repositories.IdempotencyRepository
+	analyticsCache  *cache.AnalyticsCache
+	webhookService  webhooks.Service
+	templateService templates.Service
+}
+
+// registerRoutes registers every HTTP route on the app
+func registerRoutes(app *fiber.App, deps *dependencies) {
+	app.Use(middleware.MetricsMiddleware())
+	app.Use(middleware.BodyLimit(bodyLimit))
+
+	// Health and monitoring
+	app.Get("/health", handleHealth)
+	app.Get("/health/live", handleHealth)
+	app.Get("/health/ready", handleReady)
+	app.Get("/metrics", handlers.NewMetricsHandler().GetMetrics)
+
+	// Tracking (public, rate-limited per IP)
+	messageTracker := tracking.NewMessageTracker(deps.emailRepo)
+	messageTracker.SetCacheInvalidator(deps.analyticsCache)
+	messageTracker.SetEventPublisher(deps.webhookService)
+	trackingHandler := handlers.NewTrackingHandler(services.NewTrackingService(deps.emailRepo), messageTracker, config.AppConfig.TrackingSecret)
+	trackingHandler.AcceptUnsignedLinks(config.AppConfig.TrackingUnsignedBefore, deps.emailRepo)
+	track := app.Group("/track", middleware.RateLimitMiddleware(100, time.Minute))
+	track.Get("/open/*", trackingHandler.TrackOpen)
+	track.Get("/click/:messageId", trackingHandler.TrackClick)
+
+	// SES events delivered through SNS
+	snsHandler := handlers.NewSNSHandler(services.NewSNSService(config.AppConfig.SNSVerify), deps.emailRepo, messageTracker)
+	app.Post("/webhooks/ses", snsHandler.HandleSNSWebhook)
+
+	registerAPIRoutes(app, deps)
+}
+
+// bodyLimit returns the largest request body a route accepts
+// Only POST /emails/send carries attachments; other routes keep Fiber's default.
+func bodyLimit(c *fiber.Ctx) int {
+	path := strings.TrimSuffix(strings.ToLower(c.Path()), "/")
+	if c.Method() == fiber.MethodPost && (path == "/emails/send" || path == "/api/emails/send") {
+		return email.MaxSendRequestSize
+	}
+	return fiber.DefaultBodyLimit
+}
+
+// apiHandlers groups the handlers and middleware behind the REST API
+type apiHandlers struct {
+	requireAuth fiber.Handler
+	authLimit   fiber.Handler
+	users       *users.Handler
+	contacts    *contacts.Handler
+	campaigns   *campaigns.Handler
+	analytics   *handlers.AnalyticsHandler
+	sendEmail   *email.SendEmailHandler
+	email       *handlers.EmailHandler
+	failedJobs  *handlers.FailedJobHandler
+	webhooks    *webhooks.Handler
+	dkimKeys    *dkim.Handler
+	templates   *templates.Handler
+}
+
+// registerAPIRoutes registers the authenticated REST API. It is served both at
+// the root (used by the frontend) and under /api (used by the smoke tests).
+func registerAPIRoutes(app *fiber.App, deps *dependencies) {
+	userService := users.NewService(users.NewRepository())
+	owners := repositories.NewOwnershipRepository()
+	sendEmail := email.NewSendEmailHandler(deps.emailQueue, deps.emailRepo, deps.idempotency)
+	sendEmail.SetIdempotencyTTL(config.AppConfig.IdempotencyKeyTTL)
+	sendEmail.SetTemplates(deps.templateService)
+	sendEmail.SetOwners(owners)
+
+	api := &apiHandlers{
+		requireAuth: middleware.AuthMiddleware(userService),
+		authLimit:   middleware.RateLimitMiddleware(20, time.Minute),
+		users:       users.NewHandler(userService),
+		contacts:    contacts.NewHandler(contacts.NewService(contacts.NewRepository(db.DB))),
+		campaigns:   campaigns.NewHandler(campaigns.NewService(campaigns.NewRepository(), deps.templateService)),
+		analytics:   handlers.NewAnalyticsHandler(services.NewAnalyticsService(repositories.NewAnalyticsRepository(), deps.analyticsCache)),
+		sendEmail:   sendEmail,
+		email:       handlers.NewEmailHandler(owners),
+		failedJobs:  handlers.NewFailedJobHandler(services.NewFailedJobService(deps.failedJobRepo, failedJobRequeuers(deps))),
+		webhooks:    webhooks.NewHandler(deps.webhookService),
+		dkimKeys:    dkim.NewHandler(dkim.NewService(dkim.NewRepository())),
+		templates:   templates.NewHandler(deps.templateService),
+	}
+
+	api.register(app)
+	api.register(app.Group("/api"))
+}
+
+// register mounts the API handlers on a single router
+func (h *apiHandlers) register(router fiber.Router) {
+	requireAuth := h.requireAuth
+
+	// Authentication (public, rate-limited to slow down credential stuffing)
+	router.Post("/users/auth", h.authLimit, h.users.Authenticate)
+	router.Post("/users/refresh", h.authLimit, h.users.RefreshToken)
+
+	// Users
+	router.Get("/users/me", requireAuth, h.users.GetMe)
+	usersGroup := router.Group("/users", requireAuth, middleware.RequireAdmin())
+	usersGroup.Post("/", h.users.Create)
+	usersGroup.Get("/", h.users.List)
+	usersGroup.Get("/client/:clientId", h.users.GetByClient)
+	usersGroup.Get("/:id", h.users.GetByID)
+	usersGroup.Put("/:id", h.users.Update)
+	usersGroup.Delete("/:id", h.users.Delete)
+
+	// Contacts
+	contactsGroup := router.Group("/contacts", requireAuth, middleware.RequireClientOrAdmin())
+	contactsGroup.Post("/", h.contacts.Create)
+	contactsGroup.Get("/", h.contacts.List)
+	contactsGroup.Get("/:id", h.contacts.GetByID)
+	contactsGroup.Put("/:id", h.contacts.Update)
+	contactsGroup.Delete("/:id", h.contacts.Delete)
+
+	// Campaigns
+	campaignsGroup := router.Group("/campaigns", requireAuth, middleware.RequireClientOrAdmin())
+	campaignsGroup.Post("/", h.campaigns.Create)
+	campaignsGroup.Get("/", h.campaigns.List)
+	campaignsGroup.Get("/client/:clientId", h.campaigns.GetByClient)
+	campaignsGroup.Get("/:id", h.campaigns.GetByID)
+	campaignsGroup.Put("/:id", h.campaigns.Update)
+	campaignsGroup.Delete("/:id", h.campaigns.Delete)
+	campaignsGroup.Post("/:id/schedule", h.campaigns.Schedule)
+
+	// Templates with immutable numbered versions
+	templatesGroup := router.Group("/templates", requireAuth, middleware.RequireClientOrAdmin())
+	templatesGroup.Post("/", h.templates.CreateTemplate)
+	templatesGroup.Get("/", h.templates.ListTemplates)
+	templatesGroup.Get("/:id", h.templates.GetTemplate)
+	templatesGroup.Put("/:id", h.templates.UpdateTemplate)
+	templatesGroup.Delete("/:id", h.templates.DeleteTemplate)
+	templatesGroup.Post("/:id/versions", h.templates.CreateVersion)
+	templatesGroup.Get("/:id/versions", h.templates.ListVersions)
+	templatesGroup.Get("/:id/versions/:version", h.templates.GetVersion)
+	templatesGroup.Post("/:id/render", h.templates.RenderTemplate)
+
+	// Analytics
+	analyticsGroup := router.Group("/analytics", requireAuth, middleware.RequireClientOrAdmin())
+	analyticsGroup.Get("/overview", h.analytics.GetOverview)
+	analyticsGroup.Get("/timeline", h.analytics.GetTimeline)
+	analyticsGroup.Get("/top-links", h.analytics.GetTopLinks)
+	analyticsGroup.Get("/events/:messageId", h.analytics.GetEmailEvents)
+	analyticsGroup.Get("/messages", h.analytics.GetEmailMessages)
+	analyticsGroup.Get("/campaigns/:id", h.analytics.GetCampaignStats)
+
+	// Email sending
+	router.Post("/emails/send", requireAuth, middleware.RequireClientOrAdmin(), h.sendEmail.HandleSendEmail)
+	router.Post("/send-email", requireAuth, middleware.RequireClientOrAdmin(), h.email.SendEmail)
+
+	// Outbound webhooks (/webhooks is taken by the public SES receiver)
+	webhookEndpointsGroup := router.Group("/webhook-endpoints", requireAuth, middleware.RequireClientOrAdmin())
+	webhookEndpointsGroup.Post("/", h.webhooks.CreateEndpoint)
+	webhookEndpointsGroup.Get("/", h.webhooks.ListEndpoints)
+	webhookEndpointsGroup.Get("/:id", h.webhooks.GetEndpoint)
+	webhookEndpointsGroup.Put("/:id", h.webhooks.UpdateEndpoint)
+	webhookEndpointsGroup.Delete("/:id", h.webhooks.DeleteEndpoint)
+	webhookEndpointsGroup.Post("/:id/rotate-secret", h.webhooks.RotateSecret)
+	webhookEndpointsGroup.Get("/:id/deliveries", h.webhooks.ListEndpointDeliveries)
+	webhookDeliveriesGroup := router.Group("/webhook-deliveries", requireAuth, middleware.RequireClientOrAdmin())
+	webhookDeliveriesGroup.Get("/", h.webhooks.ListDeliveries)
+	webhookDeliveriesGroup.Get("/:id", h.webhooks.GetDelivery)
+	webhookDeliveriesGroup.Post("/:id/replay", h.webhooks.Replay)
+
+	// DKIM signing keys of client sending domains
+	dkimKeysGroup := router.Group("/dkim-keys", requireAuth, middleware.RequireClientOrAdmin())
+	dkimKeysGroup.Post("/", h.dkimKeys.CreateKey)
+	dkimKeysGroup.Get("/", h.dkimKeys.ListKeys)
+	dkimKeysGroup.Get("/:id", h.dkimKeys.GetKey)
+	dkimKeysGroup.Post("/:id/activate", h.dkimKeys.ActivateKey)
+	dkimKeysGroup.Delete("/:id", h.dkimKeys.DeleteKey)
+
+	// Dead-letter queue administration
+	failedJobsGroup := router.Group("/admin/failed-jobs", requireAuth, middleware.RequireAdmin())
+	failedJobsGroup.Get("/", h.failedJobs.List)
+	failedJobsGroup.Delete("/", h.failedJobs.Purge)
+	failedJobsGroup.Get("/:id", h.failedJobs.GetByID)
+	failedJobsGroup.Post("/:id/requeue", h.failedJobs.Requeue)
+	failedJobsGroup.Delete("/:id", h.failedJobs.Delete)
+}
+
+// failedJobRequeuers maps each failed_jobs queue to the function that requeues its jobs
+func failedJobRequeuers(deps *dependencies) map[string]services.JobRequeuer {
+	return map[string]services.JobRequeuer{
+		models.FailedJobQueueRedis: func(ctx context.Context, job *models.FailedJob) error {
+			return queue.EnqueueJob(job.JobType, job.Payload)
+		},
+		models.FailedJobQueueMemory: func(ctx context.Context, job *models.FailedJob) error {
+			return deps.emailQueue.Requeue(ctx, job.Payload)
+		},
+	}
+}
+
+// handleHealth handles GET /health and GET /health/live
+func handleHealth(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// handleReady handles GET /health/ready by pinging PostgreSQL and Redis
+func handleReady(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), 2*time.Second)
+	defer cancel()
+
+	checks := fiber.Map{
+		"database": "ok",
+		"redis":    "ok",
+	}
+	ready := true
+
+	if sqlDB, err := db.DB.DB(); err != nil || sqlDB.PingContext(ctx) != nil {
+		checks["database"] = "unavailable"
+		ready = false
+	}
+	if queue.Queue == nil || queue.Queue.Ping(ctx).Err() != nil {
+		checks["redis"] = "unavailable"
+		ready = false
+	}
+
+	status := fiber.StatusOK
+	if !ready {
+		status = fiber.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"ready":  ready,
+		"checks": checks,
+	})
+}
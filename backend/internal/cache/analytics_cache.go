@@ -1,110 +1,162 @@
 package cache
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 
 	"backend/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
 )
 
+// allClientsScope holds results that are not filtered by client
+const allClientsScope = "all"
+
 // AnalyticsCache provides caching for analytics queries
+// Results are stored per client scope and keyed by their query parameters, so
+// new events of a client only invalidate that client's results (and the
+// unfiltered ones). Store errors are logged and treated as cache misses.
 type AnalyticsCache struct {
-	overviewCache *CacheEntry
-	timelineCache map[string]*CacheEntry // key: range string
-	topLinksCache *CacheEntry
-	overviewTTL   time.Duration
-	timelineTTL   time.Duration
-	topLinksTTL   time.Duration
+	store       Cache
+	overviewTTL time.Duration
+	timelineTTL time.Duration
+	topLinksTTL time.Duration
 }
 
-// CacheEntry represents a cached value with expiration
-type CacheEntry struct {
-	Data      interface{}
-	ExpiresAt time.Time
-}
-
-// NewAnalyticsCache creates a new analytics cache
-func NewAnalyticsCache() *AnalyticsCache {
+// NewAnalyticsCache creates a new analytics cache on top of store
+func NewAnalyticsCache(store Cache) *AnalyticsCache {
 	return &AnalyticsCache{
-		timelineCache: make(map[string]*CacheEntry),
-		overviewTTL:   5 * time.Minute,  // Cache overview for 5 minutes
-		timelineTTL:   2 * time.Minute,  // Cache timeline for 2 minutes
-		topLinksTTL:   10 * time.Minute, // Cache top links for 10 minutes
+		store:       store,
+		overviewTTL: 5 * time.Minute,  // Cache overview for 5 minutes
+		timelineTTL: 2 * time.Minute,  // Cache timeline for 2 minutes
+		topLinksTTL: 10 * time.Minute, // Cache top links for 10 minutes
 	}
 }
 
-// GetOverview returns cached overview stats if available and not expired
-func (c *AnalyticsCache) GetOverview() (*repositories.OverviewStats, bool) {
-	if c.overviewCache == nil {
-		return nil, false
+// clientScope returns the scope of results for a client (nil for all clients)
+func clientScope(clientID *uuid.UUID) string {
+	if clientID == nil {
+		return allClientsScope
 	}
+	return "client:" + clientID.String()
+}
 
-	if time.Now().After(c.overviewCache.ExpiresAt) {
-		c.overviewCache = nil
-		return nil, false
+// filterKey returns the cache key of a query with the given filter and parameters
+// The client is part of the scope, not the key.
+func filterKey(name string, filter repositories.AnalyticsFilter, params ...string) string {
+	parts := append([]string{name}, params...)
+	if filter.CampaignID != nil {
+		parts = append(parts, "campaign="+filter.CampaignID.String())
 	}
-
-	stats, ok := c.overviewCache.Data.(*repositories.OverviewStats)
-	return stats, ok
+	if filter.ContactID != nil {
+		parts = append(parts, "contact="+filter.ContactID.String())
+	}
+	return strings.Join(parts, "|")
 }
 
-// SetOverview caches overview stats
-func (c *AnalyticsCache) SetOverview(stats *repositories.OverviewStats) {
-	c.overviewCache = &CacheEntry{
-		Data:      stats,
-		ExpiresAt: time.Now().Add(c.overviewTTL),
+// get decodes the cached value of a query into dest
+// It returns the generation to pass to set when the value is missing.
+func (c *AnalyticsCache) get(ctx context.Context, filter repositories.AnalyticsFilter, key string, dest interface{}) (Generation, bool) {
+	data, gen, ok, err := c.store.Get(ctx, clientScope(filter.ClientID), key)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("event", "analytics.cache.get_failed").
+			Str("key", key).
+			Msg("Failed to read analytics cache")
+		return noGeneration, false
+	}
+	if !ok {
+		return gen, false
+	}
+	if err := json.Unmarshal(data, dest); err != nil {
+		log.Warn().
+			Err(err).
+			Str("event", "analytics.cache.decode_failed").
+			Str("key", key).
+			Msg("Failed to decode cached analytics")
+		return gen, false
 	}
+	return gen, true
 }
 
-// GetTimeline returns cached timeline stats if available and not expired
-func (c *AnalyticsCache) GetTimeline(rangeStr string) ([]repositories.TimelineStat, bool) {
-	entry, exists := c.timelineCache[rangeStr]
-	if !exists {
-		return nil, false
+// set caches the result of a query for ttl in the generation its get returned
+func (c *AnalyticsCache) set(ctx context.Context, filter repositories.AnalyticsFilter, key string, gen Generation, value interface{}, ttl time.Duration) {
+	if gen == noGeneration {
+		return
 	}
-
-	if time.Now().After(entry.ExpiresAt) {
-		delete(c.timelineCache, rangeStr)
-		return nil, false
+	data, err := json.Marshal(value)
+	if err == nil {
+		err = c.store.Set(ctx, clientScope(filter.ClientID), key, gen, data, ttl)
+	}
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("event", "analytics.cache.set_failed").
+			Str("key", key).
+			Msg("Failed to write analytics cache")
 	}
-
-	stats, ok := entry.Data.([]repositories.TimelineStat)
-	return stats, ok
 }
 
-// SetTimeline caches timeline stats
-func (c *AnalyticsCache) SetTimeline(rangeStr string, stats []repositories.TimelineStat) {
-	c.timelineCache[rangeStr] = &CacheEntry{
-		Data:      stats,
-		ExpiresAt: time.Now().Add(c.timelineTTL),
+// GetOverview returns cached overview stats if available and not expired, and
+// the generation to pass to SetOverview otherwise
+func (c *AnalyticsCache) GetOverview(ctx context.Context, filter repositories.AnalyticsFilter) (*repositories.OverviewStats, Generation, bool) {
+	var stats repositories.OverviewStats
+	gen, ok := c.get(ctx, filter, filterKey("overview", filter), &stats)
+	if !ok {
+		return nil, gen, false
 	}
+	return &stats, gen, true
 }
 
-// GetTopLinks returns cached top links if available and not expired
-func (c *AnalyticsCache) GetTopLinks() ([]repositories.TopLink, bool) {
-	if c.topLinksCache == nil {
-		return nil, false
-	}
+// SetOverview caches overview stats loaded after GetOverview returned gen
+func (c *AnalyticsCache) SetOverview(ctx context.Context, filter repositories.AnalyticsFilter, gen Generation, stats *repositories.OverviewStats) {
+	c.set(ctx, filter, filterKey("overview", filter), gen, stats, c.overviewTTL)
+}
 
-	if time.Now().After(c.topLinksCache.ExpiresAt) {
-		c.topLinksCache = nil
-		return nil, false
+// GetTimeline returns cached timeline stats if available and not expired, and
+// the generation to pass to SetTimeline otherwise
+func (c *AnalyticsCache) GetTimeline(ctx context.Context, rangeStr string, filter repositories.AnalyticsFilter) ([]repositories.TimelineStat, Generation, bool) {
+	var stats []repositories.TimelineStat
+	gen, ok := c.get(ctx, filter, filterKey("timeline", filter, rangeStr), &stats)
+	if !ok {
+		return nil, gen, false
 	}
+	return stats, gen, true
+}
 
-	links, ok := c.topLinksCache.Data.([]repositories.TopLink)
-	return links, ok
+// SetTimeline caches timeline stats loaded after GetTimeline returned gen
+func (c *AnalyticsCache) SetTimeline(ctx context.Context, rangeStr string, filter repositories.AnalyticsFilter, gen Generation, stats []repositories.TimelineStat) {
+	c.set(ctx, filter, filterKey("timeline", filter, rangeStr), gen, stats, c.timelineTTL)
 }
 
-// SetTopLinks caches top links
-func (c *AnalyticsCache) SetTopLinks(links []repositories.TopLink) {
-	c.topLinksCache = &CacheEntry{
-		Data:      links,
-		ExpiresAt: time.Now().Add(c.topLinksTTL),
+// GetTopLinks returns cached top links if available and not expired, and the
+// generation to pass to SetTopLinks otherwise
+func (c *AnalyticsCache) GetTopLinks(ctx context.Context, limit int, filter repositories.AnalyticsFilter) ([]repositories.TopLink, Generation, bool) {
+	var links []repositories.TopLink
+	gen, ok := c.get(ctx, filter, filterKey("top_links", filter, fmt.Sprint(limit)), &links)
+	if !ok {
+		return nil, gen, false
 	}
+	return links, gen, true
+}
+
+// SetTopLinks caches top links loaded after GetTopLinks returned gen
+func (c *AnalyticsCache) SetTopLinks(ctx context.Context, limit int, filter repositories.AnalyticsFilter, gen Generation, links []repositories.TopLink) {
+	c.set(ctx, filter, filterKey("top_links", filter, fmt.Sprint(limit)), gen, links, c.topLinksTTL)
 }
 
-// Invalidate clears all cache entries
-func (c *AnalyticsCache) Invalidate() {
-	c.overviewCache = nil
-	c.topLinksCache = nil
-	c.timelineCache = make(map[string]*CacheEntry)
+// InvalidateClient drops the cached results of a client and the unfiltered results
+// A nil clientID only drops the unfiltered results.
+func (c *AnalyticsCache) InvalidateClient(ctx context.Context, clientID *uuid.UUID) error {
+	if clientID != nil {
+		if err := c.store.Invalidate(ctx, clientScope(clientID)); err != nil {
+			return err
+		}
+	}
+	return c.store.Invalidate(ctx, allClientsScope)
 }
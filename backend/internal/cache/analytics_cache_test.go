@@ -1,17 +1,34 @@
 package cache
 
 import (
+	"context"
+	"sync"
 	"testing"
 	"time"
 
 	"backend/internal/repositories"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 )
 
+// newTestRedisCache returns a Redis cache backed by a miniredis server
+func newTestRedisCache(t *testing.T) (*RedisCache, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewRedisCache(client, "analytics_cache"), server
+}
+
 func TestAnalyticsCache_Overview(t *testing.T) {
-	cache := NewAnalyticsCache()
+	ctx := context.Background()
+	cache := NewAnalyticsCache(NewMemoryCache())
+	filter := repositories.AnalyticsFilter{}
 
 	// Initially empty
-	stats, ok := cache.GetOverview()
+	stats, gen, ok := cache.GetOverview(ctx, filter)
 	if ok {
 		t.Error("Expected cache to be empty initially")
 	}
@@ -23,12 +40,12 @@ func TestAnalyticsCache_Overview(t *testing.T) {
 		OpenRate:       0.5,
 		ClickRate:      0.1,
 	}
-	cache.SetOverview(stats)
+	cache.SetOverview(ctx, filter, gen, stats)
 
 	// Should retrieve from cache
-	cached, ok := cache.GetOverview()
+	cached, _, ok := cache.GetOverview(ctx, filter)
 	if !ok {
-		t.Error("Expected to retrieve from cache")
+		t.Fatal("Expected to retrieve from cache")
 	}
 	if cached.TotalSent != 100 {
 		t.Errorf("Expected TotalSent 100, got %d", cached.TotalSent)
@@ -36,38 +53,217 @@ func TestAnalyticsCache_Overview(t *testing.T) {
 }
 
 func TestAnalyticsCache_Timeline(t *testing.T) {
-	cache := NewAnalyticsCache()
+	ctx := context.Background()
+	cache := NewAnalyticsCache(NewMemoryCache())
+	filter := repositories.AnalyticsFilter{}
 
 	// Set cache
 	stats := []repositories.TimelineStat{
 		{Date: "2025-02-01", Sent: 10, Delivered: 9},
 	}
-	cache.SetTimeline("7d", stats)
+	_, gen, _ := cache.GetTimeline(ctx, "7d", filter)
+	cache.SetTimeline(ctx, "7d", filter, gen, stats)
 
 	// Should retrieve from cache
-	cached, ok := cache.GetTimeline("7d")
+	cached, _, ok := cache.GetTimeline(ctx, "7d", filter)
 	if !ok {
 		t.Error("Expected to retrieve from cache")
 	}
 	if len(cached) != 1 {
 		t.Errorf("Expected 1 item, got %d", len(cached))
 	}
+
+	// Other ranges are separate entries
+	if _, _, ok := cache.GetTimeline(ctx, "30d", filter); ok {
+		t.Error("Expected 30d timeline to be missing")
+	}
 }
 
 func TestAnalyticsCache_Expiration(t *testing.T) {
-	cache := NewAnalyticsCache()
+	ctx := context.Background()
+	cache := NewAnalyticsCache(NewMemoryCache())
+	filter := repositories.AnalyticsFilter{}
 
 	// Set cache with very short TTL
 	cache.overviewTTL = 1 * time.Millisecond
 	stats := &repositories.OverviewStats{TotalSent: 100}
-	cache.SetOverview(stats)
+	cache.SetOverview(ctx, filter, 0, stats)
 
 	// Wait for expiration
 	time.Sleep(10 * time.Millisecond)
 
 	// Should not retrieve expired cache
-	_, ok := cache.GetOverview()
+	_, _, ok := cache.GetOverview(ctx, filter)
 	if ok {
 		t.Error("Expected cache to be expired")
 	}
 }
+
+func TestAnalyticsCache_KeyedPerClientAndFilter(t *testing.T) {
+	ctx := context.Background()
+	cache := NewAnalyticsCache(NewMemoryCache())
+	clientA, clientB, campaignID := uuid.New(), uuid.New(), uuid.New()
+
+	cache.SetOverview(ctx, repositories.AnalyticsFilter{ClientID: &clientA}, 0, &repositories.OverviewStats{TotalSent: 1})
+	cache.SetOverview(ctx, repositories.AnalyticsFilter{ClientID: &clientA, CampaignID: &campaignID}, 0, &repositories.OverviewStats{TotalSent: 2})
+
+	if cached, _, ok := cache.GetOverview(ctx, repositories.AnalyticsFilter{ClientID: &clientA}); !ok || cached.TotalSent != 1 {
+		t.Errorf("expected client A overview, got %+v", cached)
+	}
+	if cached, _, ok := cache.GetOverview(ctx, repositories.AnalyticsFilter{ClientID: &clientA, CampaignID: &campaignID}); !ok || cached.TotalSent != 2 {
+		t.Errorf("expected client A campaign overview, got %+v", cached)
+	}
+	if _, _, ok := cache.GetOverview(ctx, repositories.AnalyticsFilter{ClientID: &clientB}); ok {
+		t.Error("expected client B overview to be missing")
+	}
+	if _, _, ok := cache.GetOverview(ctx, repositories.AnalyticsFilter{}); ok {
+		t.Error("expected unfiltered overview to be missing")
+	}
+}
+
+func TestAnalyticsCache_InvalidateClient(t *testing.T) {
+	stores := map[string]func(t *testing.T) Cache{
+		"memory": func(t *testing.T) Cache { return NewMemoryCache() },
+		"redis": func(t *testing.T) Cache {
+			store, _ := newTestRedisCache(t)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := NewAnalyticsCache(newStore(t))
+			clientA, clientB := uuid.New(), uuid.New()
+			filterA := repositories.AnalyticsFilter{ClientID: &clientA}
+			filterB := repositories.AnalyticsFilter{ClientID: &clientB}
+			all := repositories.AnalyticsFilter{}
+
+			for _, filter := range []repositories.AnalyticsFilter{filterA, filterB, all} {
+				_, gen, _ := cache.GetTopLinks(ctx, 10, filter)
+				cache.SetTopLinks(ctx, 10, filter, gen, []repositories.TopLink{{URL: "https://example.com", ClickCount: 1}})
+			}
+
+			if err := cache.InvalidateClient(ctx, &clientA); err != nil {
+				t.Fatalf("InvalidateClient failed: %v", err)
+			}
+
+			if _, _, ok := cache.GetTopLinks(ctx, 10, filterA); ok {
+				t.Error("expected client A entry to be invalidated")
+			}
+			if _, _, ok := cache.GetTopLinks(ctx, 10, all); ok {
+				t.Error("expected unfiltered entry to be invalidated")
+			}
+			if links, _, ok := cache.GetTopLinks(ctx, 10, filterB); !ok || len(links) != 1 {
+				t.Errorf("expected client B entry to survive, got %v", links)
+			}
+
+			// Entries loaded after invalidation are served again
+			_, gen, _ := cache.GetTopLinks(ctx, 10, filterA)
+			cache.SetTopLinks(ctx, 10, filterA, gen, []repositories.TopLink{})
+			if _, _, ok := cache.GetTopLinks(ctx, 10, filterA); !ok {
+				t.Error("expected new client A entry to be cached")
+			}
+		})
+	}
+}
+
+func TestAnalyticsCache_DropsValuesLoadedBeforeInvalidation(t *testing.T) {
+	stores := map[string]func(t *testing.T) Cache{
+		"memory": func(t *testing.T) Cache { return NewMemoryCache() },
+		"redis": func(t *testing.T) Cache {
+			store, _ := newTestRedisCache(t)
+			return store
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := NewAnalyticsCache(newStore(t))
+			clientID := uuid.New()
+			filter := repositories.AnalyticsFilter{ClientID: &clientID}
+
+			// A miss, then an event arrives while the result is being loaded
+			_, gen, ok := cache.GetOverview(ctx, filter)
+			if ok {
+				t.Fatal("expected a miss")
+			}
+			if err := cache.InvalidateClient(ctx, &clientID); err != nil {
+				t.Fatalf("InvalidateClient failed: %v", err)
+			}
+			cache.SetOverview(ctx, filter, gen, &repositories.OverviewStats{TotalSent: 1})
+
+			if stale, _, ok := cache.GetOverview(ctx, filter); ok {
+				t.Errorf("expected the result loaded before the event to be dropped, got %+v", stale)
+			}
+		})
+	}
+}
+
+func TestRedisCache_SharedAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestRedisCache(t)
+	other := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer other.Close()
+
+	first := NewAnalyticsCache(store)
+	second := NewAnalyticsCache(NewRedisCache(other, "analytics_cache"))
+	filter := repositories.AnalyticsFilter{}
+
+	first.SetOverview(ctx, filter, 0, &repositories.OverviewStats{TotalSent: 7})
+	cached, _, ok := second.GetOverview(ctx, filter)
+	if !ok || cached.TotalSent != 7 {
+		t.Fatalf("expected overview written by the other instance, got %+v", cached)
+	}
+
+	if err := second.InvalidateClient(ctx, nil); err != nil {
+		t.Fatalf("InvalidateClient failed: %v", err)
+	}
+	_, gen, ok := first.GetOverview(ctx, filter)
+	if ok {
+		t.Error("expected invalidation to reach the other instance")
+	}
+
+	// Values expire with their TTL
+	first.SetOverview(ctx, filter, gen, &repositories.OverviewStats{TotalSent: 7})
+	server.FastForward(first.overviewTTL + time.Second)
+	if _, _, ok := first.GetOverview(ctx, filter); ok {
+		t.Error("expected overview to expire")
+	}
+}
+
+func TestRedisCache_ErrorsAreMisses(t *testing.T) {
+	ctx := context.Background()
+	store, server := newTestRedisCache(t)
+	cache := NewAnalyticsCache(store)
+	server.Close()
+
+	cache.SetOverview(ctx, repositories.AnalyticsFilter{}, 0, &repositories.OverviewStats{})
+	if _, _, ok := cache.GetOverview(ctx, repositories.AnalyticsFilter{}); ok {
+		t.Error("expected a miss when Redis is down")
+	}
+}
+
+func TestMemoryCache_ConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	cache := NewAnalyticsCache(NewMemoryCache())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clientID := uuid.New()
+			filter := repositories.AnalyticsFilter{ClientID: &clientID}
+			for j := 0; j < 50; j++ {
+				_, gen, _ := cache.GetOverview(ctx, filter)
+				cache.SetOverview(ctx, filter, gen, &repositories.OverviewStats{TotalSent: int64(j)})
+				cache.GetOverview(ctx, filter)
+				cache.GetTimeline(ctx, "7d", repositories.AnalyticsFilter{})
+				cache.InvalidateClient(ctx, &clientID)
+			}
+		}()
+	}
+	wg.Wait()
+}
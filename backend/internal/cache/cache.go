@@ -0,0 +1,27 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Generation identifies the values of a scope between two invalidations
+// Get returns the generation it read and Set stores under it, so a value
+// loaded before an invalidation is stored where it is never read again.
+type Generation int64
+
+// noGeneration is returned by a Get that failed; nothing is stored under it
+const noGeneration Generation = -1
+
+// Cache stores serialized values under a scope and a key
+// Invalidating a scope drops every key stored under it.
+type Cache interface {
+	// Get returns the value stored under scope and key, if present and not
+	// expired, and the generation of scope to pass to Set on a miss
+	Get(ctx context.Context, scope, key string) ([]byte, Generation, bool, error)
+	// Set stores a value under scope and key for ttl in generation gen; the
+	// value is dropped if scope was invalidated since
+	Set(ctx context.Context, scope, key string, gen Generation, value []byte, ttl time.Duration) error
+	// Invalidate drops every value stored under scope
+	Invalidate(ctx context.Context, scope string) error
+}
@@ -0,0 +1,74 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CacheEntry represents a cached value with expiration
+type CacheEntry struct {
+	Data      []byte
+	ExpiresAt time.Time
+}
+
+// MemoryCache is a Cache local to this process, safe for concurrent use
+type MemoryCache struct {
+	mu          sync.Mutex
+	entries     map[string]map[string]*CacheEntry // scope -> key -> entry
+	generations map[string]Generation             // scope -> invalidation count
+}
+
+// NewMemoryCache creates an empty in-memory cache
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries:     make(map[string]map[string]*CacheEntry),
+		generations: make(map[string]Generation),
+	}
+}
+
+// Get returns the value stored under scope and key, dropping it if expired
+func (c *MemoryCache) Get(ctx context.Context, scope, key string) ([]byte, Generation, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gen := c.generations[scope]
+	entry, ok := c.entries[scope][key]
+	if !ok {
+		return nil, gen, false, nil
+	}
+	if time.Now().After(entry.ExpiresAt) {
+		delete(c.entries[scope], key)
+		return nil, gen, false, nil
+	}
+	return entry.Data, gen, true, nil
+}
+
+// Set stores a value under scope and key for ttl, unless scope was
+// invalidated since generation gen
+func (c *MemoryCache) Set(ctx context.Context, scope, key string, gen Generation, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if gen != c.generations[scope] {
+		return nil
+	}
+
+	keys, ok := c.entries[scope]
+	if !ok {
+		keys = make(map[string]*CacheEntry)
+		c.entries[scope] = keys
+	}
+	keys[key] = &CacheEntry{Data: value, ExpiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+// Invalidate drops every value stored under scope
+func (c *MemoryCache) Invalidate(ctx context.Context, scope string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, scope)
+	c.generations[scope]++
+	return nil
+}
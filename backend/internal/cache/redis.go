@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisCache is a Cache shared by every instance using the same Redis
+// Each scope has a generation counter that is part of its keys; invalidating a
+// scope increments the counter, and the old keys expire on their own.
+type RedisCache struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisCache creates a Redis cache storing its keys under prefix
+func NewRedisCache(client *redis.Client, prefix string) *RedisCache {
+	return &RedisCache{client: client, prefix: prefix}
+}
+
+// generationKey returns the key holding the generation of a scope
+func (c *RedisCache) generationKey(scope string) string {
+	return fmt.Sprintf("%s:%s:gen", c.prefix, scope)
+}
+
+// generation returns the current generation of a scope
+func (c *RedisCache) generation(ctx context.Context, scope string) (Generation, error) {
+	gen, err := c.client.Get(ctx, c.generationKey(scope)).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return noGeneration, fmt.Errorf("failed to get cache generation: %w", err)
+	}
+	return Generation(gen), nil
+}
+
+// valueKey returns the key of a value in generation gen of its scope
+func (c *RedisCache) valueKey(scope string, gen Generation, key string) string {
+	return fmt.Sprintf("%s:%s:%d:%s", c.prefix, scope, gen, key)
+}
+
+// Get returns the value stored under scope and key, if present and not
+// expired, and the generation of scope it looked in
+func (c *RedisCache) Get(ctx context.Context, scope, key string) ([]byte, Generation, bool, error) {
+	gen, err := c.generation(ctx, scope)
+	if err != nil {
+		return nil, noGeneration, false, err
+	}
+
+	value, err := c.client.Get(ctx, c.valueKey(scope, gen, key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, gen, false, nil
+	}
+	if err != nil {
+		return nil, noGeneration, false, fmt.Errorf("failed to get cache value: %w", err)
+	}
+	return value, gen, true, nil
+}
+
+// Set stores a value under scope and key for ttl in generation gen
+// A value loaded before an invalidation lands in the old generation, which is
+// no longer read.
+func (c *RedisCache) Set(ctx context.Context, scope, key string, gen Generation, value []byte, ttl time.Duration) error {
+	if err := c.client.Set(ctx, c.valueKey(scope, gen, key), value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to set cache value: %w", err)
+	}
+	return nil
+}
+
+// Invalidate drops every value stored under scope by moving it to a new generation
+func (c *RedisCache) Invalidate(ctx context.Context, scope string) error {
+	if err := c.client.Incr(ctx, c.generationKey(scope)).Err(); err != nil {
+		return fmt.Errorf("failed to invalidate cache scope: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,564 @@
+package campaigns
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"backend/internal/contacts"
+	"backend/internal/email"
+	"backend/internal/models"
+	"backend/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// JobEnqueuer accepts per-recipient send jobs; *email.Queue implements it
+type JobEnqueuer interface {
+	EnqueueWait(ctx context.Context, job email.SendEmailJob) error
+}
+
+// dispatchLease is how long a sending campaign stays locked to the instance
+// dispatching it without a renewal
+const dispatchLease = 5 * time.Minute
+
+// Dispatcher sends scheduled campaigns once their send_at has passed.
+// Each tick it claims due campaigns (scheduled -> sending), enqueues one job per
+// active contact of the client, and marks campaigns whose recipients are all
+// finished as sent (at least one message handed off) or failed.
+//
+// Jobs live in the in-process queue, so a sending campaign stays locked to its
+// instance while the lock is renewed. When an instance stops or crashes, another
+// one takes over the campaign once the lock expires: it enqueues the contacts
+// that have no email message yet and re-sends the messages left queued.
+type Dispatcher struct {
+	repo      Repository
+	contacts  contacts.Repository
+	emailRepo repositories.EmailRepository
+	queue     JobEnqueuer
+	templates TemplateSource
+	interval  time.Duration
+	lease     time.Duration
+	logger    zerolog.Logger
+	wg        sync.WaitGroup
+	cancel    context.CancelFunc
+
+	mu       sync.Mutex
+	owned    map[uuid.UUID]struct{} // sending campaigns locked to this instance
+	unmarked map[uuid.UUID]int      // recipient counts of owned campaigns not yet marked dispatched
+}
+
+// NewDispatcher creates a new campaign dispatcher polling every interval
+func NewDispatcher(repo Repository, contactsRepo contacts.Repository, emailRepo repositories.EmailRepository, queue JobEnqueuer, interval time.Duration) *Dispatcher {
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	return &Dispatcher{
+		repo:      repo,
+		contacts:  contactsRepo,
+		emailRepo: emailRepo,
+		queue:     queue,
+		interval:  interval,
+		lease:     dispatchLease,
+		logger:    zerolog.New(os.Stdout).With().Timestamp().Logger(),
+		owned:     make(map[uuid.UUID]struct{}),
+		unmarked:  make(map[uuid.UUID]int),
+	}
+}
+
+// SetTemplates sets the source of the template versions campaigns render
+func (d *Dispatcher) SetTemplates(source TemplateSource) {
+	d.templates = source
+}
+
+// Start runs the dispatch loop and the lock renewal in the background
+func (d *Dispatcher) Start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+
+	d.wg.Add(1)
+	go d.renewLocks(ctx)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			d.RunOnce(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop stops the dispatch loop and waits for the current tick to finish
+func (d *Dispatcher) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.wg.Wait()
+}
+
+// renewLocks keeps the campaigns owned by this instance locked until ctx is done
+// It runs apart from the dispatch loop, which can spend a long time enqueueing.
+func (d *Dispatcher) renewLocks(ctx context.Context) {
+	defer d.wg.Done()
+
+	ticker := time.NewTicker(d.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		d.mu.Lock()
+		ids := make([]uuid.UUID, 0, len(d.owned))
+		for id := range d.owned {
+			ids = append(ids, id)
+		}
+		d.mu.Unlock()
+
+		if err := d.repo.RenewLocks(ctx, ids, d.lease); err != nil && ctx.Err() == nil {
+			d.logger.Error().
+				Err(err).
+				Str("event", "campaign.lock.renew_failed").
+				Int("campaigns", len(ids)).
+				Msg("Failed to renew campaign locks")
+		}
+	}
+}
+
+// own records that this instance holds the lock of a campaign
+func (d *Dispatcher) own(id uuid.UUID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.owned[id] = struct{}{}
+}
+
+// owns reports whether this instance holds the lock of a campaign
+func (d *Dispatcher) owns(id uuid.UUID) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.owned[id]
+	return ok
+}
+
+// release forgets the locks of campaigns that are no longer sending
+func (d *Dispatcher) release(sending []models.Campaign) {
+	still := make(map[uuid.UUID]bool, len(sending))
+	for _, campaign := range sending {
+		still[campaign.ID] = true
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id := range d.owned {
+		if !still[id] {
+			delete(d.owned, id)
+			delete(d.unmarked, id)
+		}
+	}
+}
+
+// RunOnce dispatches due campaigns, takes over campaigns whose instance went
+// away and finalizes campaigns that finished sending
+func (d *Dispatcher) RunOnce(ctx context.Context) {
+	due, err := d.repo.GetScheduledCampaigns(ctx)
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.dispatch.query_failed").
+			Msg("Failed to get scheduled campaigns")
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		d.claim(ctx, &due[i])
+	}
+
+	stale, err := d.repo.GetStaleSending(ctx)
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.reclaim.query_failed").
+			Msg("Failed to get stale sending campaigns")
+	}
+	for i := range stale {
+		if ctx.Err() != nil {
+			return
+		}
+		if d.owns(stale[i].ID) {
+			// Its lock lapsed while renewals failed, but its jobs are still in
+			// this instance's queue; renewLocks extends it again
+			continue
+		}
+		d.reclaim(ctx, &stale[i])
+	}
+
+	sending, err := d.repo.GetByStatus(ctx, "sending")
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.finalize.query_failed").
+			Msg("Failed to get sending campaigns")
+		return
+	}
+	d.release(sending)
+	for i := range sending {
+		d.retryMark(ctx, &sending[i])
+		if sending[i].Status == "sending" {
+			d.finalize(ctx, &sending[i])
+		}
+	}
+}
+
+// claim locks a due campaign to this instance and dispatches it
+func (d *Dispatcher) claim(ctx context.Context, campaign *models.Campaign) {
+	claimed, err := d.repo.ClaimForSending(ctx, campaign.ID, d.lease)
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.dispatch.claim_failed").
+			Str("campaign_id", campaign.ID.String()).
+			Msg("Failed to claim campaign")
+		return
+	}
+	if !claimed {
+		// Another instance is dispatching it
+		return
+	}
+	d.own(campaign.ID)
+	d.dispatch(ctx, campaign, nil)
+}
+
+// reclaim takes over a sending campaign whose lock expired and resumes it
+// Messages still queued were lost with the previous instance's queue, so they
+// are enqueued again along with the contacts that have no message yet.
+func (d *Dispatcher) reclaim(ctx context.Context, campaign *models.Campaign) {
+	reclaimed, err := d.repo.ReclaimSending(ctx, campaign.ID, d.lease)
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.reclaim.failed").
+			Str("campaign_id", campaign.ID.String()).
+			Msg("Failed to reclaim campaign")
+		return
+	}
+	if !reclaimed {
+		return
+	}
+
+	messages, err := d.repo.GetRecipientMessages(ctx, campaign.ID)
+	if err != nil {
+		// Not owned yet, so the lock expires again and a later tick retries
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.reclaim.messages_failed").
+			Str("campaign_id", campaign.ID.String()).
+			Msg("Failed to get campaign messages")
+		return
+	}
+
+	d.logger.Warn().
+		Str("event", "campaign.reclaim").
+		Str("campaign_id", campaign.ID.String()).
+		Int("messages", len(messages)).
+		Bool("dispatched", campaign.DispatchedAt != nil).
+		Msg("Taking over campaign from a stopped instance")
+	d.own(campaign.ID)
+	d.dispatch(ctx, campaign, messages)
+}
+
+// dispatch enqueues one job per active contact of a locked campaign
+// Contacts that already have an email message in existing are skipped unless
+// the message is still queued, in which case it is enqueued again. Once a
+// campaign is dispatched, contacts added since then are not sent to.
+func (d *Dispatcher) dispatch(ctx context.Context, campaign *models.Campaign, existing []models.EmailMessageRecord) {
+	var version *models.TemplateVersion
+	var err error
+	if campaign.TemplateID != nil {
+		if version, err = loadTemplate(ctx, d.templates, campaign); err != nil {
+			d.logger.Error().
+				Err(err).
+				Str("event", "campaign.dispatch.template_failed").
+				Str("campaign_id", campaign.ID.String()).
+				Str("template_id", campaign.TemplateID.String()).
+				Msg("Failed to load campaign template")
+			d.setStatus(ctx, campaign, "failed")
+			return
+		}
+	}
+
+	recipients, err := d.contacts.GetActiveByClientID(campaign.ClientID)
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.dispatch.contacts_failed").
+			Str("campaign_id", campaign.ID.String()).
+			Msg("Failed to load campaign recipients")
+		d.setStatus(ctx, campaign, "failed")
+		return
+	}
+	if len(recipients) == 0 && len(existing) == 0 {
+		d.logger.Warn().
+			Str("event", "campaign.dispatch.no_recipients").
+			Str("campaign_id", campaign.ID.String()).
+			Msg("Campaign has no active contacts")
+		d.setStatus(ctx, campaign, "failed")
+		return
+	}
+
+	byContact := make(map[uuid.UUID]*models.EmailMessageRecord, len(existing))
+	for i := range existing {
+		if existing[i].ContactID != nil {
+			byContact[*existing[i].ContactID] = &existing[i]
+		}
+	}
+
+	d.logger.Info().
+		Str("event", "campaign.dispatch.start").
+		Str("campaign_id", campaign.ID.String()).
+		Int("recipients", len(recipients)).
+		Int("existing", len(existing)).
+		Msg("Dispatching campaign")
+
+	// Records are still created for jobs that were being enqueued at shutdown
+	enqueueCtx := ctx
+	ctx = context.WithoutCancel(ctx)
+
+	created, requeued := 0, 0
+	for _, contact := range recipients {
+		record := byContact[contact.ID]
+		delete(byContact, contact.ID)
+		if record == nil && campaign.DispatchedAt != nil {
+			continue
+		}
+		if record != nil && record.Status != "queued" {
+			continue
+		}
+
+		if enqueueCtx.Err() != nil {
+			// Not marked dispatched: the lock expires and an instance resumes it
+			d.logger.Warn().
+				Str("event", "campaign.dispatch.interrupted").
+				Str("campaign_id", campaign.ID.String()).
+				Int("created", created).
+				Msg("Dispatch interrupted by shutdown; it resumes once the campaign lock expires")
+			return
+		}
+		if d.enqueueRecipient(ctx, enqueueCtx, campaign, version, contact, record) {
+			if record != nil {
+				requeued++
+			} else {
+				created++
+			}
+		}
+	}
+
+	// Queued messages of contacts that were deleted or are no longer active
+	// cannot be rendered again
+	for _, record := range existing {
+		if record.Status != "queued" {
+			continue
+		}
+		if record.ContactID == nil || byContact[*record.ContactID] != nil {
+			d.emailRepo.UpdateEmailStatus(ctx, record.ID, "failed")
+		}
+	}
+
+	total := len(existing) + created
+	if !d.markDispatched(ctx, campaign, total) || total == 0 {
+		return
+	}
+
+	d.logger.Info().
+		Str("event", "campaign.dispatch.done").
+		Str("campaign_id", campaign.ID.String()).
+		Int("recipients", total).
+		Int("requeued", requeued).
+		Msg("Campaign enqueued")
+}
+
+// markDispatched records that every recipient of a campaign has an email
+// message, failing the campaign when it has none
+// A campaign that cannot be marked stays owned, so its lock is renewed while its
+// jobs are in this instance's queue, and the next tick tries again.
+func (d *Dispatcher) markDispatched(ctx context.Context, campaign *models.Campaign, total int) bool {
+	if err := d.repo.MarkDispatched(ctx, campaign.ID, total); err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.dispatch.mark_failed").
+			Str("campaign_id", campaign.ID.String()).
+			Msg("Failed to mark campaign dispatched; retrying on the next tick")
+		d.mu.Lock()
+		d.unmarked[campaign.ID] = total
+		d.mu.Unlock()
+		return false
+	}
+	d.mu.Lock()
+	delete(d.unmarked, campaign.ID)
+	d.mu.Unlock()
+
+	now := time.Now()
+	campaign.DispatchedAt = &now
+	campaign.RecipientCount = total
+
+	if total == 0 {
+		d.setStatus(ctx, campaign, "failed")
+	}
+	return true
+}
+
+// retryMark marks a campaign dispatched by this instance whose mark failed
+func (d *Dispatcher) retryMark(ctx context.Context, campaign *models.Campaign) {
+	d.mu.Lock()
+	total, ok := d.unmarked[campaign.ID]
+	d.mu.Unlock()
+	if ok && campaign.DispatchedAt == nil {
+		d.markDispatched(ctx, campaign, total)
+	}
+}
+
+// enqueueRecipient enqueues the job of one contact, creating its email record
+// unless record is an existing queued message to send again
+// It returns false if no email record was created. An existing record that
+// cannot be rendered is failed, so that it does not hold the campaign in sending.
+func (d *Dispatcher) enqueueRecipient(ctx, enqueueCtx context.Context, campaign *models.Campaign, version *models.TemplateVersion, contact models.Contact, existing *models.EmailMessageRecord) bool {
+	content, err := render(campaign, version, contact)
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.recipient.render_failed").
+			Str("campaign_id", campaign.ID.String()).
+			Str("to", contact.Email).
+			Msg("Failed to render campaign template")
+		if existing != nil {
+			d.emailRepo.UpdateEmailStatus(ctx, existing.ID, "failed")
+		}
+		return false
+	}
+
+	campaignID := campaign.ID
+	contactID := contact.ID
+	clientID := campaign.ClientID
+	messageID := email.NewMessageID(campaign.FromEmail)
+	recordID := uuid.New()
+	if existing != nil {
+		messageID = existing.MessageID
+		recordID = existing.ID
+	}
+
+	record := models.EmailMessageRecord{
+		ID:         recordID,
+		MessageID:  messageID,
+		From:       campaign.FromEmail,
+		To:         contact.Email,
+		Subject:    content.subject,
+		Status:     "queued",
+		CampaignID: &campaignID,
+		ContactID:  &contactID,
+		ClientID:   &clientID,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+	if existing == nil {
+		if err := d.emailRepo.CreateEmailMessage(ctx, record); err != nil {
+			d.logger.Error().
+				Err(err).
+				Str("event", "campaign.recipient.create_failed").
+				Str("campaign_id", campaign.ID.String()).
+				Str("to", contact.Email).
+				Msg("Failed to create email record")
+			return false
+		}
+	}
+
+	htmlBody := email.PrepareHTML(content.html, messageID, campaign.InlineCSS)
+
+	job := email.SendEmailJob{
+		EmailRecord: &record,
+		CampaignID:  &campaignID,
+		From:        campaign.FromEmail,
+		To:          contact.Email,
+		Subject:     content.subject,
+		HTMLBody:    htmlBody,
+		TextBody:    content.text,
+
+		DisableAutoText: campaign.DisableAutoText,
+	}
+	if err := d.queue.EnqueueWait(enqueueCtx, job); err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.recipient.enqueue_failed").
+			Str("campaign_id", campaign.ID.String()).
+			Str("message_id", messageID).
+			Msg("Failed to enqueue campaign email")
+		if enqueueCtx.Err() == nil && !errors.Is(err, email.ErrQueueStopped) {
+			d.emailRepo.UpdateEmailStatus(ctx, record.ID, "failed")
+		}
+		// Left queued on shutdown so the instance resuming the campaign sends it
+	}
+	return true
+}
+
+// finalize marks a sending campaign as sent or failed once no recipient is queued
+func (d *Dispatcher) finalize(ctx context.Context, campaign *models.Campaign) {
+	if campaign.DispatchedAt == nil {
+		// Still being dispatched
+		return
+	}
+
+	progress, err := d.repo.GetDeliveryProgress(ctx, campaign.ID)
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.finalize.progress_failed").
+			Str("campaign_id", campaign.ID.String()).
+			Msg("Failed to get campaign progress")
+		return
+	}
+	if progress.Queued > 0 || progress.Total() < int64(campaign.RecipientCount) {
+		return
+	}
+
+	status := "sent"
+	if progress.Sent == 0 {
+		status = "failed"
+	}
+	d.setStatus(ctx, campaign, status)
+
+	d.logger.Info().
+		Str("event", "campaign.finalized").
+		Str("campaign_id", campaign.ID.String()).
+		Str("status", status).
+		Int64("sent", progress.Sent).
+		Int64("failed", progress.Failed).
+		Msg("Campaign finished sending")
+}
+
+// setStatus updates the campaign status, logging failures
+func (d *Dispatcher) setStatus(ctx context.Context, campaign *models.Campaign, status string) {
+	if err := d.repo.UpdateStatus(ctx, campaign.ID, status); err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "campaign.status.update_failed").
+			Str("campaign_id", campaign.ID.String()).
+			Str("status", status).
+			Msg("Failed to update campaign status")
+		return
+	}
+	campaign.Status = status
+}
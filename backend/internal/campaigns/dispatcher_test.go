@@ -0,0 +1,573 @@
+package campaigns
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/email"
+	"backend/internal/models"
+	"backend/internal/templates"
+
+	"github.com/google/uuid"
+)
+
+// mockRepository keeps campaigns in memory
+type mockRepository struct {
+	campaigns map[uuid.UUID]*models.Campaign
+	messages  []models.EmailMessageRecord
+	progress  DeliveryProgress
+	markErr   error
+}
+
+func newMockRepository(campaigns ...*models.Campaign) *mockRepository {
+	repo := &mockRepository{campaigns: make(map[uuid.UUID]*models.Campaign)}
+	for _, c := range campaigns {
+		repo.campaigns[c.ID] = c
+	}
+	return repo
+}
+
+func (m *mockRepository) Create(ctx context.Context, campaign *models.Campaign) error { return nil }
+
+func (m *mockRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
+	return m.campaigns[id], nil
+}
+
+func (m *mockRepository) GetAll(ctx context.Context) ([]models.Campaign, error) { return nil, nil }
+
+func (m *mockRepository) GetByClientID(ctx context.Context, clientID uuid.UUID) ([]models.Campaign, error) {
+	return nil, nil
+}
+
+func (m *mockRepository) Update(ctx context.Context, campaign *models.Campaign) error { return nil }
+
+func (m *mockRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
+	m.campaigns[id].Status = status
+	return nil
+}
+
+func (m *mockRepository) GetScheduledCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	return m.GetByStatus(ctx, "scheduled")
+}
+
+func (m *mockRepository) GetByStatus(ctx context.Context, status string) ([]models.Campaign, error) {
+	var result []models.Campaign
+	for _, c := range m.campaigns {
+		if c.Status == status {
+			result = append(result, *c)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) ClaimForSending(ctx context.Context, id uuid.UUID, lease time.Duration) (bool, error) {
+	c := m.campaigns[id]
+	if c.Status != "scheduled" {
+		return false, nil
+	}
+	lockedUntil := time.Now().Add(lease)
+	c.Status = "sending"
+	c.RecipientCount = 0
+	c.DispatchedAt = nil
+	c.LockedUntil = &lockedUntil
+	return true, nil
+}
+
+func (m *mockRepository) GetStaleSending(ctx context.Context) ([]models.Campaign, error) {
+	var result []models.Campaign
+	for _, c := range m.campaigns {
+		if c.Status == "sending" && (c.LockedUntil == nil || c.LockedUntil.Before(time.Now())) {
+			result = append(result, *c)
+		}
+	}
+	return result, nil
+}
+
+func (m *mockRepository) ReclaimSending(ctx context.Context, id uuid.UUID, lease time.Duration) (bool, error) {
+	c := m.campaigns[id]
+	if c.Status != "sending" || (c.LockedUntil != nil && c.LockedUntil.After(time.Now())) {
+		return false, nil
+	}
+	lockedUntil := time.Now().Add(lease)
+	c.LockedUntil = &lockedUntil
+	return true, nil
+}
+
+func (m *mockRepository) RenewLocks(ctx context.Context, ids []uuid.UUID, lease time.Duration) error {
+	return nil
+}
+
+func (m *mockRepository) MarkDispatched(ctx context.Context, id uuid.UUID, recipientCount int) error {
+	if m.markErr != nil {
+		return m.markErr
+	}
+	now := time.Now()
+	m.campaigns[id].RecipientCount = recipientCount
+	m.campaigns[id].DispatchedAt = &now
+	return nil
+}
+
+func (m *mockRepository) GetRecipientMessages(ctx context.Context, id uuid.UUID) ([]models.EmailMessageRecord, error) {
+	return m.messages, nil
+}
+
+func (m *mockRepository) GetDeliveryProgress(ctx context.Context, id uuid.UUID) (*DeliveryProgress, error) {
+	progress := m.progress
+	return &progress, nil
+}
+
+func (m *mockRepository) Delete(ctx context.Context, id uuid.UUID) error { return nil }
+
+// mockContacts returns a fixed list of active contacts
+type mockContacts struct {
+	active []models.Contact
+}
+
+func (m *mockContacts) GetAll() ([]models.Contact, error)                       { return m.active, nil }
+func (m *mockContacts) GetByID(id uuid.UUID) (*models.Contact, error)           { return nil, nil }
+func (m *mockContacts) Create(contact *models.Contact) error                    { return nil }
+func (m *mockContacts) Update(contact *models.Contact) error                    { return nil }
+func (m *mockContacts) Delete(id uuid.UUID) error                               { return nil }
+func (m *mockContacts) GetActiveByClientID(uuid.UUID) ([]models.Contact, error) { return m.active, nil }
+
+// mockEmailRepository records created email messages
+type mockEmailRepository struct {
+	created  []models.EmailMessageRecord
+	statuses map[uuid.UUID]string
+}
+
+func (m *mockEmailRepository) CreateEmailMessage(ctx context.Context, msg models.EmailMessageRecord) error {
+	m.created = append(m.created, msg)
+	return nil
+}
+
+func (m *mockEmailRepository) UpdateEmailStatus(ctx context.Context, id uuid.UUID, status string) error {
+	if m.statuses == nil {
+		m.statuses = make(map[uuid.UUID]string)
+	}
+	m.statuses[id] = status
+	return nil
+}
+
+func (m *mockEmailRepository) SetProvider(ctx context.Context, id uuid.UUID, provider, providerMessageID string) error {
+	return nil
+}
+
+func (m *mockEmailRepository) AddEmailEvent(ctx context.Context, event models.EmailEventRecord) error {
+	return nil
+}
+
+func (m *mockEmailRepository) GetEmailByMessageID(ctx context.Context, messageID string) (*models.EmailMessageRecord, error) {
+	return nil, nil
+}
+
+func (m *mockEmailRepository) CreateEmailEventWithMeta(ctx context.Context, emailID uuid.UUID, eventType string, meta map[string]interface{}) error {
+	return nil
+}
+
+func (m *mockEmailRepository) CheckSNSMessageIdExists(ctx context.Context, snsMessageId string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockEmailRepository) CheckOpenEventExistsToday(ctx context.Context, emailID uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func (m *mockEmailRepository) CheckClickEventExists(ctx context.Context, emailID uuid.UUID, targetURL string) (bool, error) {
+	return false, nil
+}
+
+// recordingQueue collects enqueued jobs
+type recordingQueue struct {
+	jobs []email.SendEmailJob
+}
+
+func (q *recordingQueue) EnqueueWait(ctx context.Context, job email.SendEmailJob) error {
+	q.jobs = append(q.jobs, job)
+	return nil
+}
+
+func newScheduledCampaign() *models.Campaign {
+	sendAt := time.Now().Add(-time.Minute)
+	return &models.Campaign{
+		ID:        uuid.New(),
+		ClientID:  uuid.New(),
+		Subject:   "Hello {{first_name}}",
+		Content:   `<p>Hi {{name}}</p><a href="https://example.com">Shop</a>`,
+		FromEmail: "news@example.com",
+		Status:    "scheduled",
+		SendAt:    &sendAt,
+	}
+}
+
+func TestDispatcher_EnqueuesOneJobPerContact(t *testing.T) {
+	campaign := newScheduledCampaign()
+	repo := newMockRepository(campaign)
+	emailRepo := &mockEmailRepository{}
+	queue := &recordingQueue{}
+	contactsRepo := &mockContacts{active: []models.Contact{
+		{ID: uuid.New(), Email: "ada@example.com", Name: "Ada <Lovelace>"},
+		{ID: uuid.New(), Email: "alan@example.com", Name: "Alan Turing"},
+	}}
+
+	NewDispatcher(repo, contactsRepo, emailRepo, queue, time.Minute).RunOnce(context.Background())
+
+	if campaign.Status != "sending" {
+		t.Errorf("expected status sending, got %q", campaign.Status)
+	}
+	if campaign.RecipientCount != 2 {
+		t.Errorf("expected recipient count 2, got %d", campaign.RecipientCount)
+	}
+	if len(emailRepo.created) != 2 || len(queue.jobs) != 2 {
+		t.Fatalf("expected 2 records and 2 jobs, got %d and %d", len(emailRepo.created), len(queue.jobs))
+	}
+
+	job := queue.jobs[0]
+	if job.Subject != "Hello Ada" {
+		t.Errorf("unexpected subject %q", job.Subject)
+	}
+	if !strings.Contains(job.HTMLBody, "Hi Ada &lt;Lovelace&gt;") {
+		t.Errorf("expected escaped name in body, got %q", job.HTMLBody)
+	}
+	if !strings.Contains(job.HTMLBody, "/track/click") || !strings.Contains(job.HTMLBody, "/track/open") {
+		t.Errorf("expected tracking in body, got %q", job.HTMLBody)
+	}
+	if job.CampaignID == nil || *job.CampaignID != campaign.ID {
+		t.Error("expected job to carry the campaign ID")
+	}
+	rec := emailRepo.created[0]
+	if rec.CampaignID == nil || *rec.CampaignID != campaign.ID || rec.Status != "queued" {
+		t.Errorf("unexpected email record: %+v", rec)
+	}
+	if rec.ContactID == nil || *rec.ContactID != contactsRepo.active[0].ID {
+		t.Errorf("expected record linked to contact %s, got %v", contactsRepo.active[0].ID, rec.ContactID)
+	}
+	if rec.ClientID == nil || *rec.ClientID != campaign.ClientID {
+		t.Errorf("expected record linked to client %s, got %v", campaign.ClientID, rec.ClientID)
+	}
+}
+
+// templateVersions serves template versions by template ID
+type templateVersions map[uuid.UUID]*models.TemplateVersion
+
+func (v templateVersions) GetVersion(ctx context.Context, id uuid.UUID, version int, clientID *uuid.UUID) (*models.TemplateVersion, error) {
+	if found, ok := v[id]; ok && (version == 0 || version == found.Version) {
+		return found, nil
+	}
+	return nil, templates.ErrVersionNotFound
+}
+
+func TestDispatcher_RendersTemplate(t *testing.T) {
+	templateID := uuid.New()
+	version := &models.TemplateVersion{
+		TemplateID:  templateID,
+		Version:     3,
+		Subject:     "Hi {{first_name}}, {{offer}}",
+		HTMLContent: `<p>{{name}}</p><a href="https://example.com">Shop</a>`,
+		TextContent: "{{name}} <{{email}}>",
+		Variables: models.TemplateVariables{
+			{Name: "first_name", Type: models.TemplateVariableString},
+			{Name: "name", Type: models.TemplateVariableString},
+			{Name: "offer", Type: models.TemplateVariableString, Default: "20% off"},
+		},
+	}
+	campaign := newScheduledCampaign()
+	campaign.TemplateID = &templateID
+	repo := newMockRepository(campaign)
+	queue := &recordingQueue{}
+	contactsRepo := &mockContacts{active: []models.Contact{{ID: uuid.New(), Email: "ada@example.com", Name: "Ada <Lovelace>"}}}
+
+	dispatcher := NewDispatcher(repo, contactsRepo, &mockEmailRepository{}, queue, time.Minute)
+	dispatcher.SetTemplates(templateVersions{templateID: version})
+	dispatcher.RunOnce(context.Background())
+
+	if len(queue.jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(queue.jobs))
+	}
+	job := queue.jobs[0]
+	if job.Subject != "Hi Ada, 20% off" || job.TextBody != "Ada <Lovelace> <ada@example.com>" {
+		t.Errorf("unexpected subject %q or text %q", job.Subject, job.TextBody)
+	}
+	if !strings.Contains(job.HTMLBody, "<p>Ada &lt;Lovelace&gt;</p>") || !strings.Contains(job.HTMLBody, "/track/click") {
+		t.Errorf("expected rendered and tracked body, got %q", job.HTMLBody)
+	}
+
+	// A missing template version fails the campaign
+	pinned := 2
+	campaign = newScheduledCampaign()
+	campaign.TemplateID = &templateID
+	campaign.TemplateVersion = &pinned
+	repo = newMockRepository(campaign)
+	queue = &recordingQueue{}
+
+	dispatcher = NewDispatcher(repo, contactsRepo, &mockEmailRepository{}, queue, time.Minute)
+	dispatcher.SetTemplates(templateVersions{templateID: version})
+	dispatcher.RunOnce(context.Background())
+
+	if campaign.Status != "failed" || len(queue.jobs) != 0 {
+		t.Errorf("expected failed campaign without jobs, got %q and %d jobs", campaign.Status, len(queue.jobs))
+	}
+}
+
+func TestDispatcher_InlinesCSS(t *testing.T) {
+	campaign := newScheduledCampaign()
+	campaign.Content = `<style>a { color: red } @media (max-width: 600px) { a { color: blue !important } }</style><a href="https://example.com">Shop</a>`
+	campaign.InlineCSS = true
+	repo := newMockRepository(campaign)
+	queue := &recordingQueue{}
+	contactsRepo := &mockContacts{active: []models.Contact{{ID: uuid.New(), Email: "ada@example.com"}}}
+
+	NewDispatcher(repo, contactsRepo, &mockEmailRepository{}, queue, time.Minute).RunOnce(context.Background())
+
+	if len(queue.jobs) != 1 {
+		t.Fatalf("expected 1 job, got %d", len(queue.jobs))
+	}
+	body := queue.jobs[0].HTMLBody
+	if !strings.Contains(body, `style="color: red;"`) || !strings.Contains(body, "@media (max-width: 600px)") {
+		t.Errorf("expected inlined style and kept media query, got %q", body)
+	}
+	if !strings.Contains(body, "/track/click") || !strings.Contains(body, "/track/open/") {
+		t.Errorf("expected tracked body, got %q", body)
+	}
+}
+
+func TestDispatcher_NoContactsFailsCampaign(t *testing.T) {
+	campaign := newScheduledCampaign()
+	repo := newMockRepository(campaign)
+	queue := &recordingQueue{}
+
+	NewDispatcher(repo, &mockContacts{}, &mockEmailRepository{}, queue, time.Minute).RunOnce(context.Background())
+
+	if campaign.Status != "failed" {
+		t.Errorf("expected status failed, got %q", campaign.Status)
+	}
+	if len(queue.jobs) != 0 {
+		t.Errorf("expected no jobs, got %d", len(queue.jobs))
+	}
+}
+
+func TestDispatcher_Finalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		progress DeliveryProgress
+		expected string
+	}{
+		{"Still queued", DeliveryProgress{Queued: 1, Sent: 2}, "sending"},
+		{"Records missing", DeliveryProgress{Sent: 2}, "sending"},
+		{"Delivered", DeliveryProgress{Sent: 2, Failed: 1}, "sent"},
+		{"All failed", DeliveryProgress{Failed: 3}, "failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dispatchedAt := time.Now().Add(-time.Minute)
+			lockedUntil := time.Now().Add(time.Minute)
+			campaign := newScheduledCampaign()
+			campaign.Status = "sending"
+			campaign.RecipientCount = 3
+			campaign.DispatchedAt = &dispatchedAt
+			campaign.LockedUntil = &lockedUntil
+			repo := newMockRepository(campaign)
+			repo.progress = tt.progress
+
+			NewDispatcher(repo, &mockContacts{}, &mockEmailRepository{}, &recordingQueue{}, time.Minute).RunOnce(context.Background())
+
+			if campaign.Status != tt.expected {
+				t.Errorf("expected status %q, got %q", tt.expected, campaign.Status)
+			}
+		})
+	}
+}
+
+// newStaleCampaign returns a sending campaign whose dispatch lock expired
+func newStaleCampaign() *models.Campaign {
+	lockedUntil := time.Now().Add(-time.Minute)
+	campaign := newScheduledCampaign()
+	campaign.Status = "sending"
+	campaign.LockedUntil = &lockedUntil
+	return campaign
+}
+
+func TestDispatcher_ResumesStaleCampaign(t *testing.T) {
+	campaign := newStaleCampaign()
+	sent := models.Contact{ID: uuid.New(), Email: "sent@example.com"}
+	queued := models.Contact{ID: uuid.New(), Email: "queued@example.com"}
+	missing := models.Contact{ID: uuid.New(), Email: "missing@example.com"}
+	repo := newMockRepository(campaign)
+	repo.messages = []models.EmailMessageRecord{
+		{ID: uuid.New(), MessageID: "<sent@mailblast>", ContactID: &sent.ID, Status: "sent"},
+		{ID: uuid.New(), MessageID: "<queued@mailblast>", ContactID: &queued.ID, Status: "queued"},
+	}
+	emailRepo := &mockEmailRepository{}
+	queue := &recordingQueue{}
+	contactsRepo := &mockContacts{active: []models.Contact{sent, queued, missing}}
+
+	NewDispatcher(repo, contactsRepo, emailRepo, queue, time.Minute).RunOnce(context.Background())
+
+	if len(queue.jobs) != 2 {
+		t.Fatalf("expected 2 jobs, got %d", len(queue.jobs))
+	}
+	requeued := queue.jobs[0].EmailRecord
+	if requeued.ID != repo.messages[1].ID || requeued.MessageID != "<queued@mailblast>" {
+		t.Errorf("expected the queued message to be enqueued again, got %+v", requeued)
+	}
+	if len(emailRepo.created) != 1 || emailRepo.created[0].To != missing.Email {
+		t.Errorf("expected one record for the contact without a message, got %+v", emailRepo.created)
+	}
+	if campaign.DispatchedAt == nil || campaign.RecipientCount != 3 {
+		t.Errorf("expected campaign dispatched to 3 recipients, got %v and %d", campaign.DispatchedAt, campaign.RecipientCount)
+	}
+	if !campaign.LockedUntil.After(time.Now()) {
+		t.Errorf("expected campaign to be locked again, got %v", campaign.LockedUntil)
+	}
+}
+
+func TestDispatcher_ResumeAfterDispatchOnlyRequeues(t *testing.T) {
+	dispatchedAt := time.Now().Add(-time.Hour)
+	campaign := newStaleCampaign()
+	campaign.DispatchedAt = &dispatchedAt
+	campaign.RecipientCount = 2
+	queued := models.Contact{ID: uuid.New(), Email: "queued@example.com"}
+	added := models.Contact{ID: uuid.New(), Email: "added@example.com"}
+	repo := newMockRepository(campaign)
+	repo.messages = []models.EmailMessageRecord{
+		{ID: uuid.New(), MessageID: "<queued@mailblast>", ContactID: &queued.ID, Status: "queued"},
+		{ID: uuid.New(), MessageID: "<deleted@mailblast>", Status: "queued"},
+	}
+	emailRepo := &mockEmailRepository{}
+	queue := &recordingQueue{}
+	contactsRepo := &mockContacts{active: []models.Contact{queued, added}}
+
+	NewDispatcher(repo, contactsRepo, emailRepo, queue, time.Minute).RunOnce(context.Background())
+
+	if len(queue.jobs) != 1 || queue.jobs[0].To != queued.Email {
+		t.Fatalf("expected only the queued message to be enqueued, got %d jobs", len(queue.jobs))
+	}
+	if len(emailRepo.created) != 0 {
+		t.Errorf("expected no records for contacts added after dispatch, got %+v", emailRepo.created)
+	}
+	if status := emailRepo.statuses[repo.messages[1].ID]; status != "failed" {
+		t.Errorf("expected queued message of a deleted contact to fail, got %q", status)
+	}
+	if campaign.RecipientCount != 2 {
+		t.Errorf("expected recipient count 2, got %d", campaign.RecipientCount)
+	}
+}
+
+func TestDispatcher_ResumeFailsQueuedMessageThatCannotRender(t *testing.T) {
+	templateID := uuid.New()
+	version := &models.TemplateVersion{
+		TemplateID:  templateID,
+		Version:     1,
+		Subject:     "Hello",
+		HTMLContent: "<p>{{name}}</p>",
+		Variables:   models.TemplateVariables{{Name: "name", Type: models.TemplateVariableNumber}},
+	}
+	dispatchedAt := time.Now().Add(-time.Hour)
+	campaign := newStaleCampaign()
+	campaign.TemplateID = &templateID
+	campaign.DispatchedAt = &dispatchedAt
+	campaign.RecipientCount = 1
+	queued := models.Contact{ID: uuid.New(), Email: "queued@example.com", Name: "Ada"}
+	repo := newMockRepository(campaign)
+	repo.messages = []models.EmailMessageRecord{
+		{ID: uuid.New(), MessageID: "<queued@mailblast>", ContactID: &queued.ID, Status: "queued"},
+	}
+	emailRepo := &mockEmailRepository{}
+	queue := &recordingQueue{}
+
+	dispatcher := NewDispatcher(repo, &mockContacts{active: []models.Contact{queued}}, emailRepo, queue, time.Minute)
+	dispatcher.SetTemplates(templateVersions{templateID: version})
+	dispatcher.RunOnce(context.Background())
+
+	if len(queue.jobs) != 0 {
+		t.Fatalf("expected no jobs, got %d", len(queue.jobs))
+	}
+	if status := emailRepo.statuses[repo.messages[0].ID]; status != "failed" {
+		t.Errorf("expected the queued message that cannot render to fail, got %q", status)
+	}
+}
+
+func TestDispatcher_SkipsLockedCampaign(t *testing.T) {
+	lockedUntil := time.Now().Add(time.Minute)
+	campaign := newStaleCampaign()
+	campaign.LockedUntil = &lockedUntil
+	queue := &recordingQueue{}
+	contactsRepo := &mockContacts{active: []models.Contact{{ID: uuid.New(), Email: "ada@example.com"}}}
+
+	NewDispatcher(newMockRepository(campaign), contactsRepo, &mockEmailRepository{}, queue, time.Minute).RunOnce(context.Background())
+
+	if len(queue.jobs) != 0 {
+		t.Errorf("expected no jobs for a campaign locked to another instance, got %d", len(queue.jobs))
+	}
+}
+
+// cancellingQueue cancels the dispatch after accepting a number of jobs
+type cancellingQueue struct {
+	recordingQueue
+	after  int
+	cancel context.CancelFunc
+}
+
+func (q *cancellingQueue) EnqueueWait(ctx context.Context, job email.SendEmailJob) error {
+	q.recordingQueue.EnqueueWait(ctx, job)
+	if len(q.jobs) == q.after {
+		q.cancel()
+	}
+	return nil
+}
+
+func TestDispatcher_InterruptedDispatchIsResumable(t *testing.T) {
+	campaign := newScheduledCampaign()
+	repo := newMockRepository(campaign)
+	emailRepo := &mockEmailRepository{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue := &cancellingQueue{after: 1, cancel: cancel}
+	contactsRepo := &mockContacts{active: []models.Contact{
+		{ID: uuid.New(), Email: "ada@example.com"},
+		{ID: uuid.New(), Email: "alan@example.com"},
+	}}
+
+	NewDispatcher(repo, contactsRepo, emailRepo, queue, time.Minute).RunOnce(ctx)
+
+	if len(emailRepo.created) != 1 {
+		t.Fatalf("expected 1 record before shutdown, got %d", len(emailRepo.created))
+	}
+	if campaign.Status != "sending" || campaign.DispatchedAt != nil {
+		t.Errorf("expected campaign to stay sending and undispatched, got %q and %v", campaign.Status, campaign.DispatchedAt)
+	}
+}
+
+func TestDispatcher_KeepsCampaignWhoseMarkFailed(t *testing.T) {
+	campaign := newScheduledCampaign()
+	repo := newMockRepository(campaign)
+	repo.markErr = errors.New("connection reset")
+	queue := &recordingQueue{}
+	contactsRepo := &mockContacts{active: []models.Contact{
+		{ID: uuid.New(), Email: "ada@example.com"},
+		{ID: uuid.New(), Email: "alan@example.com"},
+	}}
+	dispatcher := NewDispatcher(repo, contactsRepo, &mockEmailRepository{}, queue, time.Minute)
+
+	dispatcher.RunOnce(context.Background())
+	if len(queue.jobs) != 2 || campaign.DispatchedAt != nil {
+		t.Fatalf("expected 2 jobs and an unmarked campaign, got %d and %v", len(queue.jobs), campaign.DispatchedAt)
+	}
+
+	// The lock lapsed while the jobs are still in this instance's queue
+	expired := time.Now().Add(-time.Second)
+	campaign.LockedUntil = &expired
+	repo.markErr = nil
+	dispatcher.RunOnce(context.Background())
+
+	if len(queue.jobs) != 2 {
+		t.Errorf("expected the queued jobs not to be enqueued again, got %d jobs", len(queue.jobs))
+	}
+	if campaign.DispatchedAt == nil || campaign.RecipientCount != 2 {
+		t.Errorf("expected the mark to be retried with 2 recipients, got %v and %d", campaign.DispatchedAt, campaign.RecipientCount)
+	}
+}
@@ -28,25 +28,32 @@ func NewHandler(service Service) *Handler {
 
 // HTTPCreateCampaignRequest represents the HTTP request body for creating a campaign
 type HTTPCreateCampaignRequest struct {
-	Title       string     `json:"title"`
-	Subject     string     `json:"subject"`
-	Content     string     `json:"content"`
-	TextContent string     `json:"text_content"`
-	FromEmail   string     `json:"from_email"`
-	ClientID    string     `json:"client_id"`
-	TemplateID  *string    `json:"template_id,omitempty"`
-	SendAt      *time.Time `json:"send_at,omitempty"`
+	Title           string     `json:"title"`
+	Subject         string     `json:"subject"`
+	Content         string     `json:"content"`
+	TextContent     string     `json:"text_content"`
+	DisableAutoText bool       `json:"disable_auto_text"`
+	InlineCSS       bool       `json:"inline_css"`
+	FromEmail       string     `json:"from_email"`
+	ClientID        string     `json:"client_id"`
+	TemplateID      *string    `json:"template_id,omitempty"`
+	TemplateVersion *int       `json:"template_version,omitempty"`
+	SendAt          *time.Time `json:"send_at,omitempty"`
 }
 
 // HTTPUpdateCampaignRequest represents the HTTP request body for updating a campaign
 type HTTPUpdateCampaignRequest struct {
-	Title       *string    `json:"title,omitempty"`
-	Subject     *string    `json:"subject,omitempty"`
-	Content     *string    `json:"content,omitempty"`
-	TextContent *string    `json:"text_content,omitempty"`
-	FromEmail   *string    `json:"from_email,omitempty"`
-	Status      *string    `json:"status,omitempty"`
-	SendAt      *time.Time `json:"send_at,omitempty"`
+	Title           *string    `json:"title,omitempty"`
+	Subject         *string    `json:"subject,omitempty"`
+	Content         *string    `json:"content,omitempty"`
+	TextContent     *string    `json:"text_content,omitempty"`
+	DisableAutoText *bool      `json:"disable_auto_text,omitempty"`
+	InlineCSS       *bool      `json:"inline_css,omitempty"`
+	FromEmail       *string    `json:"from_email,omitempty"`
+	Status          *string    `json:"status,omitempty"`
+	SendAt          *time.Time `json:"send_at,omitempty"`
+	TemplateID      *string    `json:"template_id,omitempty"` // "" removes the template
+	TemplateVersion *int       `json:"template_version,omitempty"`
 }
 
 // Create handles POST /campaigns
@@ -98,14 +105,17 @@ func (h *Handler) Create(c *fiber.Ctx) error {
 
 	// Create service request
 	serviceReq := &CreateCampaignRequest{
-		Title:       req.Title,
-		Subject:     req.Subject,
-		Content:     req.Content,
-		TextContent: req.TextContent,
-		FromEmail:   req.FromEmail,
-		ClientID:    clientID,
-		TemplateID:  templateID,
-		SendAt:      req.SendAt,
+		Title:           req.Title,
+		Subject:         req.Subject,
+		Content:         req.Content,
+		TextContent:     req.TextContent,
+		DisableAutoText: req.DisableAutoText,
+		InlineCSS:       req.InlineCSS,
+		FromEmail:       req.FromEmail,
+		ClientID:        clientID,
+		TemplateID:      templateID,
+		TemplateVersion: req.TemplateVersion,
+		SendAt:          req.SendAt,
 	}
 
 	campaign, err := h.service.CreateCampaign(c.Context(), serviceReq)
@@ -193,15 +203,33 @@ func (h *Handler) Update(c *fiber.Ctx) error {
 		})
 	}
 
+	// Parse template_id if provided; an empty string removes the template
+	var templateID *uuid.UUID
+	if req.TemplateID != nil {
+		parsed := uuid.Nil
+		if *req.TemplateID != "" {
+			if parsed, err = uuid.Parse(*req.TemplateID); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"error": "invalid template_id format",
+				})
+			}
+		}
+		templateID = &parsed
+	}
+
 	// Convert HTTP request to service request
 	serviceReq := &UpdateCampaignRequest{
-		Title:       req.Title,
-		Subject:     req.Subject,
-		Content:     req.Content,
-		TextContent: req.TextContent,
-		FromEmail:   req.FromEmail,
-		Status:      req.Status,
-		SendAt:      req.SendAt,
+		Title:           req.Title,
+		Subject:         req.Subject,
+		Content:         req.Content,
+		TextContent:     req.TextContent,
+		DisableAutoText: req.DisableAutoText,
+		InlineCSS:       req.InlineCSS,
+		FromEmail:       req.FromEmail,
+		Status:          req.Status,
+		SendAt:          req.SendAt,
+		TemplateID:      templateID,
+		TemplateVersion: req.TemplateVersion,
 	}
 
 	campaign, err := h.service.UpdateCampaign(c.Context(), id, serviceReq)
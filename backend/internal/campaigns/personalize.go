@@ -0,0 +1,47 @@
+package campaigns
+
+import (
+	"html"
+	"strings"
+
+	"backend/internal/models"
+)
+
+// personalize replaces the contact merge tags in campaign content:
+// {{name}}, {{first_name}} and {{email}}. Values are HTML-escaped for HTML content.
+func personalize(content string, contact models.Contact, escapeHTML bool) string {
+	if content == "" || !strings.Contains(content, "{{") {
+		return content
+	}
+
+	values := []string{
+		"{{name}}", contact.Name,
+		"{{first_name}}", firstName(contact),
+		"{{email}}", contact.Email,
+	}
+	if escapeHTML {
+		for i := 1; i < len(values); i += 2 {
+			values[i] = html.EscapeString(values[i])
+		}
+	}
+
+	return strings.NewReplacer(values...).Replace(content)
+}
+
+// contactData returns the merge data of a contact for template rendering,
+// holding the same variables as personalize
+func contactData(contact models.Contact) map[string]interface{} {
+	return map[string]interface{}{
+		"name":       contact.Name,
+		"first_name": firstName(contact),
+		"email":      contact.Email,
+	}
+}
+
+// firstName returns the first word of the contact's name
+func firstName(contact models.Contact) string {
+	if fields := strings.Fields(contact.Name); len(fields) > 0 {
+		return fields[0]
+	}
+	return contact.Name
+}
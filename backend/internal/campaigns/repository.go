@@ -3,6 +3,7 @@ package campaigns
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"backend/internal/db"
 	"backend/internal/models"
@@ -20,9 +21,29 @@ type Repository interface {
 	Update(ctx context.Context, campaign *models.Campaign) error
 	UpdateStatus(ctx context.Context, id uuid.UUID, status string) error
 	GetScheduledCampaigns(ctx context.Context) ([]models.Campaign, error)
+	GetByStatus(ctx context.Context, status string) ([]models.Campaign, error)
+	ClaimForSending(ctx context.Context, id uuid.UUID, lease time.Duration) (bool, error)
+	GetStaleSending(ctx context.Context) ([]models.Campaign, error)
+	ReclaimSending(ctx context.Context, id uuid.UUID, lease time.Duration) (bool, error)
+	RenewLocks(ctx context.Context, ids []uuid.UUID, lease time.Duration) error
+	MarkDispatched(ctx context.Context, id uuid.UUID, recipientCount int) error
+	GetRecipientMessages(ctx context.Context, id uuid.UUID) ([]models.EmailMessageRecord, error)
+	GetDeliveryProgress(ctx context.Context, id uuid.UUID) (*DeliveryProgress, error)
 	Delete(ctx context.Context, id uuid.UUID) error
 }
 
+// DeliveryProgress counts a campaign's email messages by status
+type DeliveryProgress struct {
+	Queued int64
+	Sent   int64
+	Failed int64
+}
+
+// Total returns the number of email messages created for the campaign
+func (p *DeliveryProgress) Total() int64 {
+	return p.Queued + p.Sent + p.Failed
+}
+
 type repository struct {
 	db *gorm.DB
 }
@@ -100,6 +121,125 @@ func (r *repository) GetScheduledCampaigns(ctx context.Context) ([]models.Campai
 	return campaigns, nil
 }
 
+// GetByStatus retrieves all campaigns with the given status
+func (r *repository) GetByStatus(ctx context.Context, status string) ([]models.Campaign, error) {
+	var campaigns []models.Campaign
+	if err := r.db.WithContext(ctx).Where("status = ?", status).Order("created_at").Find(&campaigns).Error; err != nil {
+		return nil, fmt.Errorf("failed to get campaigns: %w", err)
+	}
+	return campaigns, nil
+}
+
+// ClaimForSending atomically moves a scheduled campaign to "sending", locked
+// to this instance for lease, and resets its recipient count until dispatch
+// completes. It returns false if another dispatcher claimed the campaign first.
+func (r *repository) ClaimForSending(ctx context.Context, id uuid.UUID, lease time.Duration) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&models.Campaign{}).
+		Where("id = ? AND status = ?", id, "scheduled").
+		Updates(map[string]interface{}{
+			"status":          "sending",
+			"recipient_count": 0,
+			"dispatched_at":   nil,
+			"locked_until":    r.db.NowFunc().Add(lease),
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim campaign: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// GetStaleSending retrieves sending campaigns whose dispatch lease expired
+// Their instance stopped or crashed while dispatching or sending them.
+func (r *repository) GetStaleSending(ctx context.Context) ([]models.Campaign, error) {
+	var campaigns []models.Campaign
+	if err := r.db.WithContext(ctx).
+		Where("status = ? AND (locked_until IS NULL OR locked_until < ?)", "sending", r.db.NowFunc()).
+		Order("created_at").
+		Find(&campaigns).Error; err != nil {
+		return nil, fmt.Errorf("failed to get stale campaigns: %w", err)
+	}
+	return campaigns, nil
+}
+
+// ReclaimSending atomically locks a sending campaign whose lease expired to
+// this instance. It returns false if another dispatcher reclaimed it first.
+func (r *repository) ReclaimSending(ctx context.Context, id uuid.UUID, lease time.Duration) (bool, error) {
+	now := r.db.NowFunc()
+	result := r.db.WithContext(ctx).Model(&models.Campaign{}).
+		Where("id = ? AND status = ? AND (locked_until IS NULL OR locked_until < ?)", id, "sending", now).
+		Update("locked_until", now.Add(lease))
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to reclaim campaign: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RenewLocks extends the dispatch lease of sending campaigns
+func (r *repository) RenewLocks(ctx context.Context, ids []uuid.UUID, lease time.Duration) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).Model(&models.Campaign{}).
+		Where("id IN ? AND status = ?", ids, "sending").
+		Update("locked_until", r.db.NowFunc().Add(lease)).Error; err != nil {
+		return fmt.Errorf("failed to renew campaign locks: %w", err)
+	}
+	return nil
+}
+
+// MarkDispatched records that every recipient of a campaign has an email message
+func (r *repository) MarkDispatched(ctx context.Context, id uuid.UUID, recipientCount int) error {
+	if err := r.db.WithContext(ctx).Model(&models.Campaign{}).Where("id = ?", id).
+		Updates(map[string]interface{}{
+			"recipient_count": recipientCount,
+			"dispatched_at":   r.db.NowFunc(),
+		}).Error; err != nil {
+		return fmt.Errorf("failed to mark campaign dispatched: %w", err)
+	}
+	return nil
+}
+
+// GetRecipientMessages returns the email messages already created for a campaign
+func (r *repository) GetRecipientMessages(ctx context.Context, id uuid.UUID) ([]models.EmailMessageRecord, error) {
+	var messages []models.EmailMessageRecord
+	if err := r.db.WithContext(ctx).
+		Select("id, message_id, contact_id, status").
+		Where("campaign_id = ?", id).
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("failed to get campaign messages: %w", err)
+	}
+	return messages, nil
+}
+
+// GetDeliveryProgress counts the campaign's email messages by status
+func (r *repository) GetDeliveryProgress(ctx context.Context, id uuid.UUID) (*DeliveryProgress, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := r.db.WithContext(ctx).Model(&models.EmailMessageRecord{}).
+		Select("status, COUNT(*) as count").
+		Where("campaign_id = ?", id).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to get delivery progress: %w", err)
+	}
+
+	progress := &DeliveryProgress{}
+	for _, row := range rows {
+		switch row.Status {
+		case "queued":
+			progress.Queued += row.Count
+		case "failed", "rejected", "rendering_failed":
+			progress.Failed += row.Count
+		default:
+			// sent and later SES states (delivered, bounced, ...) were handed off
+			progress.Sent += row.Count
+		}
+	}
+	return progress, nil
+}
+
 // Delete deletes a campaign
 func (r *repository) Delete(ctx context.Context, id uuid.UUID) error {
 	if err := r.db.WithContext(ctx).Delete(&models.Campaign{}, id).Error; err != nil {
@@ -27,39 +27,48 @@ type Service interface {
 }
 
 type service struct {
-	repo   Repository
-	logger zerolog.Logger
+	repo      Repository
+	templates TemplateSource
+	logger    zerolog.Logger
 }
 
 // NewService creates a new campaign service
-func NewService(repo Repository) Service {
+func NewService(repo Repository, templates TemplateSource) Service {
 	return &service{
-		repo:   repo,
-		logger: zerolog.New(os.Stdout).With().Timestamp().Logger(),
+		repo:      repo,
+		templates: templates,
+		logger:    zerolog.New(os.Stdout).With().Timestamp().Logger(),
 	}
 }
 
 // CreateCampaignRequest represents request to create a campaign
 type CreateCampaignRequest struct {
-	Title       string     `json:"title"`
-	Subject     string     `json:"subject"`
-	Content     string     `json:"content"`
-	TextContent string     `json:"text_content"`
-	FromEmail   string     `json:"from_email"`
-	ClientID    uuid.UUID  `json:"client_id"`
-	TemplateID  *uuid.UUID `json:"template_id,omitempty"`
-	SendAt      *time.Time `json:"send_at,omitempty"`
+	Title           string     `json:"title"`
+	Subject         string     `json:"subject"`
+	Content         string     `json:"content"`
+	TextContent     string     `json:"text_content"`
+	DisableAutoText bool       `json:"disable_auto_text"` // send HTML-only mail when text_content is empty
+	InlineCSS       bool       `json:"inline_css"`        // inline <style> rules into style attributes
+	FromEmail       string     `json:"from_email"`
+	ClientID        uuid.UUID  `json:"client_id"`
+	TemplateID      *uuid.UUID `json:"template_id,omitempty"`
+	TemplateVersion *int       `json:"template_version,omitempty"` // nil sends the latest version
+	SendAt          *time.Time `json:"send_at,omitempty"`
 }
 
 // UpdateCampaignRequest represents request to update a campaign
 type UpdateCampaignRequest struct {
-	Title       *string    `json:"title,omitempty"`
-	Subject     *string    `json:"subject,omitempty"`
-	Content     *string    `json:"content,omitempty"`
-	TextContent *string    `json:"text_content,omitempty"`
-	FromEmail   *string    `json:"from_email,omitempty"`
-	Status      *string    `json:"status,omitempty"`
-	SendAt      *time.Time `json:"send_at,omitempty"`
+	Title           *string    `json:"title,omitempty"`
+	Subject         *string    `json:"subject,omitempty"`
+	Content         *string    `json:"content,omitempty"`
+	TextContent     *string    `json:"text_content,omitempty"`
+	DisableAutoText *bool      `json:"disable_auto_text,omitempty"`
+	InlineCSS       *bool      `json:"inline_css,omitempty"`
+	FromEmail       *string    `json:"from_email,omitempty"`
+	Status          *string    `json:"status,omitempty"`
+	SendAt          *time.Time `json:"send_at,omitempty"`
+	TemplateID      *uuid.UUID `json:"template_id,omitempty"`      // uuid.Nil removes the template
+	TemplateVersion *int       `json:"template_version,omitempty"` // 0 sends the latest version
 }
 
 // CreateCampaign creates a new campaign
@@ -68,11 +77,14 @@ func (s *service) CreateCampaign(ctx context.Context, req *CreateCampaignRequest
 	if req.Title == "" {
 		return nil, fmt.Errorf("title is required")
 	}
-	if req.Subject == "" {
-		return nil, fmt.Errorf("subject is required")
-	}
-	if req.Content == "" {
-		return nil, fmt.Errorf("content is required")
+	// A template provides the subject and content
+	if req.TemplateID == nil {
+		if req.Subject == "" {
+			return nil, fmt.Errorf("subject is required")
+		}
+		if req.Content == "" {
+			return nil, fmt.Errorf("content is required")
+		}
 	}
 	if req.FromEmail == "" {
 		return nil, fmt.Errorf("from_email is required")
@@ -89,15 +101,23 @@ func (s *service) CreateCampaign(ctx context.Context, req *CreateCampaignRequest
 	}
 
 	campaign := &models.Campaign{
-		Title:       req.Title,
-		Subject:     req.Subject,
-		Content:     req.Content,
-		TextContent: req.TextContent,
-		FromEmail:   req.FromEmail,
-		Status:      status,
-		SendAt:      req.SendAt,
-		ClientID:    req.ClientID,
-		TemplateID:  req.TemplateID,
+		Title:           req.Title,
+		Subject:         req.Subject,
+		Content:         req.Content,
+		TextContent:     req.TextContent,
+		DisableAutoText: req.DisableAutoText,
+		InlineCSS:       req.InlineCSS,
+		FromEmail:       req.FromEmail,
+		Status:          status,
+		SendAt:          req.SendAt,
+		ClientID:        req.ClientID,
+		TemplateID:      req.TemplateID,
+	}
+	if req.TemplateVersion != nil && *req.TemplateVersion != 0 {
+		campaign.TemplateVersion = req.TemplateVersion
+	}
+	if err := s.validateTemplate(ctx, campaign); err != nil {
+		return nil, err
 	}
 
 	if err := s.repo.Create(ctx, campaign); err != nil {
@@ -157,6 +177,12 @@ func (s *service) UpdateCampaign(ctx context.Context, id uuid.UUID, req *UpdateC
 	if req.TextContent != nil {
 		campaign.TextContent = *req.TextContent
 	}
+	if req.DisableAutoText != nil {
+		campaign.DisableAutoText = *req.DisableAutoText
+	}
+	if req.InlineCSS != nil {
+		campaign.InlineCSS = *req.InlineCSS
+	}
 	if req.FromEmail != nil {
 		campaign.FromEmail = *req.FromEmail
 	}
@@ -170,6 +196,26 @@ func (s *service) UpdateCampaign(ctx context.Context, id uuid.UUID, req *UpdateC
 			campaign.Status = "scheduled"
 		}
 	}
+	if req.TemplateID != nil {
+		campaign.TemplateID = req.TemplateID
+		if *req.TemplateID == uuid.Nil {
+			campaign.TemplateID = nil
+			campaign.TemplateVersion = nil
+		}
+	}
+	if req.TemplateVersion != nil {
+		campaign.TemplateVersion = req.TemplateVersion
+		if *req.TemplateVersion == 0 {
+			campaign.TemplateVersion = nil
+		}
+	}
+
+	if campaign.TemplateID == nil && (campaign.Subject == "" || campaign.Content == "") {
+		return nil, fmt.Errorf("subject and content are required without a template")
+	}
+	if err := s.validateTemplate(ctx, campaign); err != nil {
+		return nil, err
+	}
 
 	if err := s.repo.Update(ctx, campaign); err != nil {
 		return nil, fmt.Errorf("failed to update campaign: %w", err)
@@ -223,6 +269,26 @@ func (s *service) GetScheduledCampaigns(ctx context.Context) ([]models.Campaign,
 	return s.repo.GetScheduledCampaigns(ctx)
 }
 
+// validateTemplate checks that the template version of a campaign exists for
+// its client and can be rendered for contacts
+func (s *service) validateTemplate(ctx context.Context, campaign *models.Campaign) error {
+	if campaign.TemplateID == nil {
+		if campaign.TemplateVersion != nil {
+			return fmt.Errorf("template_version requires template_id")
+		}
+		return nil
+	}
+	if campaign.TemplateVersion != nil && *campaign.TemplateVersion < 0 {
+		return fmt.Errorf("invalid template_version")
+	}
+
+	version, err := loadTemplate(ctx, s.templates, campaign)
+	if err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
+	return checkTemplate(version)
+}
+
 // writeCampaignFile writes campaign data to a JSON file
 func (s *service) writeCampaignFile(campaign *models.Campaign) error {
 	// Get storage path from environment or use default
@@ -242,19 +308,22 @@ func (s *service) writeCampaignFile(campaign *models.Campaign) error {
 
 	// Prepare campaign data for file
 	campaignData := map[string]interface{}{
-		"id":              campaign.ID.String(),
-		"title":           campaign.Title,
-		"subject":         campaign.Subject,
-		"content":         campaign.Content,
-		"text_content":    campaign.TextContent,
-		"from_email":      campaign.FromEmail,
-		"status":          campaign.Status,
-		"send_at":         nil,
-		"client_id":       campaign.ClientID.String(),
-		"template_id":     nil,
-		"recipient_count": campaign.RecipientCount,
-		"created_at":      campaign.CreatedAt.Format(time.RFC3339),
-		"updated_at":      campaign.UpdatedAt.Format(time.RFC3339),
+		"id":                campaign.ID.String(),
+		"title":             campaign.Title,
+		"subject":           campaign.Subject,
+		"content":           campaign.Content,
+		"text_content":      campaign.TextContent,
+		"disable_auto_text": campaign.DisableAutoText,
+		"inline_css":        campaign.InlineCSS,
+		"from_email":        campaign.FromEmail,
+		"status":            campaign.Status,
+		"send_at":           nil,
+		"client_id":         campaign.ClientID.String(),
+		"template_id":       nil,
+		"template_version":  nil,
+		"recipient_count":   campaign.RecipientCount,
+		"created_at":        campaign.CreatedAt.Format(time.RFC3339),
+		"updated_at":        campaign.UpdatedAt.Format(time.RFC3339),
 	}
 
 	if campaign.SendAt != nil {
@@ -263,6 +332,9 @@ func (s *service) writeCampaignFile(campaign *models.Campaign) error {
 	if campaign.TemplateID != nil {
 		campaignData["template_id"] = campaign.TemplateID.String()
 	}
+	if campaign.TemplateVersion != nil {
+		campaignData["template_version"] = *campaign.TemplateVersion
+	}
 
 	// Write JSON file
 	data, err := json.MarshalIndent(campaignData, "", "  ")
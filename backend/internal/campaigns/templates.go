@@ -0,0 +1,74 @@
+package campaigns
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"backend/internal/models"
+	"backend/internal/templates"
+
+	"github.com/google/uuid"
+)
+
+// TemplateSource returns template versions; templates.Service implements it
+type TemplateSource interface {
+	GetVersion(ctx context.Context, id uuid.UUID, version int, clientID *uuid.UUID) (*models.TemplateVersion, error)
+}
+
+// campaignContent is the subject and bodies sent to one contact
+type campaignContent struct {
+	subject string
+	html    string
+	text    string
+}
+
+// templateVersion returns the template version a campaign sends (0 for the latest)
+func templateVersion(campaign *models.Campaign) int {
+	if campaign.TemplateVersion == nil {
+		return 0
+	}
+	return *campaign.TemplateVersion
+}
+
+// loadTemplate returns the template version of a campaign for its client
+func loadTemplate(ctx context.Context, source TemplateSource, campaign *models.Campaign) (*models.TemplateVersion, error) {
+	if source == nil {
+		return nil, fmt.Errorf("templates are not available")
+	}
+	return source.GetVersion(ctx, *campaign.TemplateID, templateVersion(campaign), &campaign.ClientID)
+}
+
+// checkTemplate verifies that a template version only requires variables
+// that contacts provide
+func checkTemplate(version *models.TemplateVersion) error {
+	data := contactData(models.Contact{})
+	var missing []string
+	for _, name := range templates.RequiredVariables(version) {
+		if _, ok := data[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("template requires variables that contacts do not provide: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// render returns the content of one contact, rendered from version when the
+// campaign uses a template and personalized from the campaign otherwise
+func render(campaign *models.Campaign, version *models.TemplateVersion, contact models.Contact) (campaignContent, error) {
+	if version == nil {
+		return campaignContent{
+			subject: personalize(campaign.Subject, contact, false),
+			html:    personalize(campaign.Content, contact, true),
+			text:    personalize(campaign.TextContent, contact, false),
+		}, nil
+	}
+
+	rendered, err := templates.Render(version, contactData(contact))
+	if err != nil {
+		return campaignContent{}, err
+	}
+	return campaignContent{subject: rendered.Subject, html: rendered.HTML, text: rendered.Text}, nil
+}
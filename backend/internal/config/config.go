@@ -1,13 +1,21 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
+// devTrackingSecret signs click tracking links in development when
+// TRACKING_SECRET is unset; it is public, so it is refused elsewhere
+const devTrackingSecret = "your-tracking-secret-change-in-production"
+
 type Config struct {
+	AppEnv         string // development allows insecure defaults
 	AppPort        int
 	DatabaseURL    string
 	RedisAddr      string
@@ -15,11 +23,16 @@ type Config struct {
 	AWSAccessKeyID string
 	AWSSecretKey   string
 	// AWS SES SMTP Configuration
-	AWSSESSMTPEndpoint string
-	AWSSESSMTPPort     int
-	SESSenderEmail     string
+	AWSSESSMTPEndpoint   string
+	AWSSESSMTPPort       int
+	AWSSESSMTPEncryption string // starttls or implicit; by port when empty
+	SESSenderEmail       string
 	// Tracking Configuration
 	TrackingDomain string
+	TrackingSecret string // signs click tracking links
+	// Unsigned click tracking links of emails created before this are still
+	// accepted (zero rejects them all)
+	TrackingUnsignedBefore time.Time
 	// SNS Configuration
 	SNSVerify bool
 	// SMTP Configuration (for email sending API)
@@ -29,6 +42,19 @@ type Config struct {
 	SMTPPassword string
 	// JWT Configuration
 	JWTSecret string
+	// Redis queue consumer configuration
+	QueueConcurrency       int
+	QueueVisibilityTimeout time.Duration
+	QueueMaxAttempts       int
+	// Sender of the emails of Redis queue jobs
+	MailFromAddress string
+	MailFromName    string
+	// Analytics cache backend: redis (shared by all instances) or memory
+	AnalyticsCache string
+	// Email sender of the in-process queue: smtp, ses (SES v2 API), routing or dummy
+	EmailSender string
+	// How long Idempotency-Keys of POST /emails/send are replayed
+	IdempotencyKeyTTL time.Duration
 }
 
 var AppConfig *Config
@@ -43,20 +69,45 @@ func Load() (*Config, error) {
 	sesSMTPPort, _ := strconv.Atoi(getEnv("AWS_SES_SMTP_PORT", "587"))
 	snsVerify := getEnv("SNS_VERIFY", "false") == "true"
 	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+	queueConcurrency, _ := strconv.Atoi(getEnv("QUEUE_CONCURRENCY", "4"))
+	queueVisibilitySeconds, _ := strconv.Atoi(getEnv("QUEUE_VISIBILITY_TIMEOUT_SECONDS", "300"))
+	queueMaxAttempts, _ := strconv.Atoi(getEnv("QUEUE_MAX_ATTEMPTS", "3"))
+	idempotencyKeyTTLHours, _ := strconv.Atoi(getEnv("IDEMPOTENCY_KEY_TTL_HOURS", "24"))
+
+	appEnv := getEnv("APP_ENV", "production")
+	trackingSecret := getEnv("TRACKING_SECRET", "")
+	if trackingSecret == "" {
+		if appEnv != "development" {
+			return nil, errors.New("TRACKING_SECRET must be set (only APP_ENV=development has a default)")
+		}
+		trackingSecret = devTrackingSecret
+	}
+	var trackingUnsignedBefore time.Time
+	if value := getEnv("TRACKING_UNSIGNED_LINKS_BEFORE", ""); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRACKING_UNSIGNED_LINKS_BEFORE: %w", err)
+		}
+		trackingUnsignedBefore = parsed
+	}
 
 	config := &Config{
+		AppEnv:         appEnv,
 		AppPort:        appPort,
 		DatabaseURL:    getEnv("DATABASE_URL", ""),
-		RedisAddr:      getEnv("REDIS_ADDR", ""),
+		RedisAddr:      getEnv("REDIS_ADDR", getEnv("REDIS_URL", "")), // REDIS_URL is used by the compose files
 		AWSRegion:      getEnv("AWS_REGION", ""),
 		AWSAccessKeyID: getEnv("AWS_ACCESS_KEY_ID", ""),
 		AWSSecretKey:   getEnv("AWS_SECRET_ACCESS_KEY", ""),
 		// AWS SES SMTP
-		AWSSESSMTPEndpoint: getEnv("AWS_SES_SMTP_ENDPOINT", ""),
-		AWSSESSMTPPort:     sesSMTPPort,
-		SESSenderEmail:     getEnv("SES_SENDER_EMAIL", ""),
+		AWSSESSMTPEndpoint:   getEnv("AWS_SES_SMTP_ENDPOINT", ""),
+		AWSSESSMTPPort:       sesSMTPPort,
+		AWSSESSMTPEncryption: getEnv("AWS_SES_SMTP_ENCRYPTION", ""),
+		SESSenderEmail:       getEnv("SES_SENDER_EMAIL", ""),
 		// Tracking
-		TrackingDomain: getEnv("TRACKING_DOMAIN", "http://localhost:8080"),
+		TrackingDomain:         getEnv("TRACKING_DOMAIN", "http://localhost:8080"),
+		TrackingSecret:         trackingSecret,
+		TrackingUnsignedBefore: trackingUnsignedBefore,
 		// SNS
 		SNSVerify: snsVerify,
 		// SMTP (for email sending API)
@@ -66,6 +117,18 @@ func Load() (*Config, error) {
 		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 		// JWT
 		JWTSecret: getEnv("JWT_SECRET", "your-secret-key-change-in-production"),
+		// Queue consumer
+		QueueConcurrency:       queueConcurrency,
+		QueueVisibilityTimeout: time.Duration(queueVisibilitySeconds) * time.Second,
+		QueueMaxAttempts:       queueMaxAttempts,
+		MailFromAddress:        getEnv("MAIL_FROM_ADDRESS", ""),
+		MailFromName:           getEnv("MAIL_FROM_NAME", "MailBlast"),
+		// Analytics cache
+		AnalyticsCache: getEnv("ANALYTICS_CACHE", "redis"),
+		// Email sender
+		EmailSender: getEnv("EMAIL_SENDER", "smtp"),
+		// Idempotency keys
+		IdempotencyKeyTTL: time.Duration(idempotencyKeyTTLHours) * time.Hour,
 	}
 
 	AppConfig = config
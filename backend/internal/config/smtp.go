@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strconv"
 
+	"backend/internal/smtppool"
+
 	"github.com/joho/godotenv"
 )
 
@@ -13,7 +15,11 @@ type SMTPConfig struct {
 	Port       int
 	Username   string
 	Password   string
-	Encryption string
+	Encryption string // smtppool.Encryption* mode
+	Auth       string // smtppool.Auth* mechanism
+	CAFile     string
+	CertFile   string
+	KeyFile    string
 	FromEmail  string
 	FromName   string
 }
@@ -28,7 +34,11 @@ func LoadSMTPConfig() (SMTPConfig, error) {
 		Port:       587, // Default port
 		Username:   getEnv("MAIL_USERNAME", ""),
 		Password:   getEnv("MAIL_PASSWORD", ""),
-		Encryption: getEnv("MAIL_ENCRYPTION", "tls"),
+		Encryption: getEnv("MAIL_ENCRYPTION", ""),
+		Auth:       getEnv("MAIL_AUTH", ""),
+		CAFile:     getEnv("MAIL_CA_FILE", ""),
+		CertFile:   getEnv("MAIL_CERT_FILE", ""),
+		KeyFile:    getEnv("MAIL_KEY_FILE", ""),
 		FromEmail:  getEnv("MAIL_FROM_ADDRESS", ""),
 		FromName:   getEnv("MAIL_FROM_NAME", "MailBlast"),
 	}
@@ -42,20 +52,51 @@ func LoadSMTPConfig() (SMTPConfig, error) {
 		cfg.Port = port
 	}
 
-	// Fail fast if essential fields are empty
+	// MAIL_ENCRYPTION defaults to implicit TLS on port 465 and STARTTLS elsewhere
+	var err error
+	if cfg.Encryption, err = smtppool.ParseEncryption(cfg.Encryption, cfg.Port); err != nil {
+		return cfg, fmt.Errorf("invalid MAIL_ENCRYPTION: %w", err)
+	}
+	if cfg.Auth, err = smtppool.ParseAuth(cfg.Auth); err != nil {
+		return cfg, fmt.Errorf("invalid MAIL_AUTH: %w", err)
+	}
+
+	// Fail fast if essential fields are empty; relays without AUTH need no credentials
 	if cfg.Host == "" {
 		return cfg, fmt.Errorf("MAIL_HOST is required")
 	}
-	if cfg.Username == "" {
-		return cfg, fmt.Errorf("MAIL_USERNAME is required")
-	}
-	if cfg.Password == "" {
-		return cfg, fmt.Errorf("MAIL_PASSWORD is required")
+	if cfg.Auth != smtppool.AuthNone {
+		if cfg.Username == "" {
+			return cfg, fmt.Errorf("MAIL_USERNAME is required")
+		}
+		if cfg.Password == "" {
+			return cfg, fmt.Errorf("MAIL_PASSWORD is required")
+		}
 	}
 	if cfg.FromEmail == "" {
 		return cfg, fmt.Errorf("MAIL_FROM_ADDRESS is required")
 	}
 
+	// Load the CA and client certificate now rather than on the first send
+	if _, err := cfg.Server().TLSConfig(); err != nil {
+		return cfg, err
+	}
+
 	return cfg, nil
 }
 
+// Server returns the connection pool key of the configured SMTP server
+func (c SMTPConfig) Server() smtppool.Server {
+	return smtppool.Server{
+		Host:       c.Host,
+		Port:       c.Port,
+		Username:   c.Username,
+		Password:   c.Password,
+		Encryption: c.Encryption,
+		Auth:       c.Auth,
+		CAFile:     c.CAFile,
+		CertFile:   c.CertFile,
+		KeyFile:    c.KeyFile,
+	}
+}
+
@@ -10,6 +10,7 @@ import (
 type Repository interface {
 	GetAll() ([]models.Contact, error)
 	GetByID(id uuid.UUID) (*models.Contact, error)
+	GetActiveByClientID(clientID uuid.UUID) ([]models.Contact, error)
 	Create(contact *models.Contact) error
 	Update(contact *models.Contact) error
 	Delete(id uuid.UUID) error
@@ -44,6 +45,15 @@ func (r *contactRepository) GetByID(id uuid.UUID) (*models.Contact, error) {
 	return &contact, nil
 }
 
+// GetActiveByClientID retrieves the active (subscribed) contacts of a client
+func (r *contactRepository) GetActiveByClientID(clientID uuid.UUID) ([]models.Contact, error) {
+	var contacts []models.Contact
+	if err := r.db.Where("client_id = ? AND status = ?", clientID, "active").Order("created_at").Find(&contacts).Error; err != nil {
+		return nil, err
+	}
+	return contacts, nil
+}
+
 // Create creates a new contact
 func (r *contactRepository) Create(contact *models.Contact) error {
 	return r.db.Create(contact).Error
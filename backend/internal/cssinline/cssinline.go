@@ -0,0 +1,245 @@
+// Package cssinline moves the rules of <style> elements into the style
+// attributes of the elements they match.
+//
+// Gmail and Outlook drop <style> blocks, so designs written with stylesheets
+// only survive once inlined. Rules that cannot be expressed inline — media
+// queries and other at-rules, and selectors with pseudo-classes such as
+// :hover or pseudo-elements — are kept in a <style> element in the head.
+package cssinline
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/aymerick/douceur/css"
+	"github.com/aymerick/douceur/parser"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// SkipAttribute marks <style> elements that are left in place
+const SkipAttribute = "data-noinline"
+
+// dynamicPseudoClasses depend on user interaction or browser state and
+// cannot be resolved when sending
+var dynamicPseudoClasses = []string{
+	":hover", ":active", ":focus", ":visited", ":link", ":target", ":checked",
+}
+
+// rule is an inlinable style rule with a single selector
+type rule struct {
+	selector     cascadia.Sel
+	specificity  cascadia.Specificity
+	declarations []*css.Declaration
+}
+
+// Inline returns content with the rules of its <style> elements inlined
+// <style> elements with a media attribute or SkipAttribute, and stylesheets
+// that do not parse, are left alone. content is returned unchanged when it
+// has no <style> element or cannot be parsed.
+func Inline(content string) string {
+	if !strings.Contains(strings.ToLower(content), "<style") {
+		return content
+	}
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return content
+	}
+
+	var head, body *html.Node
+	var sheets []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Head:
+				head = n
+			case atom.Body:
+				body = n
+			case atom.Style:
+				if !hasAttr(n, "media") && !hasAttr(n, SkipAttribute) {
+					sheets = append(sheets, n)
+				}
+				return
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(doc)
+	if len(sheets) == 0 || head == nil || body == nil {
+		return content
+	}
+
+	var rules []rule
+	var kept []string
+	for _, sheet := range sheets {
+		stylesheet, err := parser.Parse(text(sheet))
+		if err != nil {
+			continue
+		}
+		for _, r := range stylesheet.Rules {
+			if r.Kind != css.QualifiedRule {
+				kept = append(kept, r.String())
+				continue
+			}
+			var keptSelectors []string
+			for _, selector := range r.Selectors {
+				// Pseudo-elements do not compile
+				sel, err := cascadia.Parse(selector)
+				if err != nil || dynamic(selector) {
+					keptSelectors = append(keptSelectors, selector)
+					continue
+				}
+				rules = append(rules, rule{
+					selector:     sel,
+					specificity:  sel.Specificity(),
+					declarations: r.Declarations,
+				})
+			}
+			if len(keptSelectors) > 0 {
+				keptRule := *r
+				keptRule.Selectors = keptSelectors
+				kept = append(kept, keptRule.String())
+			}
+		}
+		sheet.Parent.RemoveChild(sheet)
+	}
+
+	// Rules of equal specificity keep their source order
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].specificity.Less(rules[j].specificity)
+	})
+	matches := make(map[*html.Node][]*rule)
+	var elements []*html.Node
+	for i := range rules {
+		for _, n := range cascadia.QueryAll(body, rules[i].selector) {
+			if _, ok := matches[n]; !ok {
+				elements = append(elements, n)
+			}
+			matches[n] = append(matches[n], &rules[i])
+		}
+	}
+	for _, n := range elements {
+		applyRules(n, matches[n])
+	}
+
+	if len(kept) > 0 {
+		style := &html.Node{Type: html.ElementNode, Data: "style", DataAtom: atom.Style}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: "\n" + strings.Join(kept, "\n") + "\n"})
+		head.AppendChild(style)
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, doc); err != nil {
+		return content
+	}
+	return buf.String()
+}
+
+// applyRules sets the style attribute of n from the rules matching it, in
+// ascending cascade order
+// Declarations already in the attribute override the stylesheet unless the
+// stylesheet marks them !important; the resolved declarations are written
+// without !important so that media queries in the head can still override them.
+func applyRules(n *html.Node, rules []*rule) {
+	var existing []*css.Declaration
+	if style := attr(n, "style"); strings.TrimSpace(style) != "" {
+		var err error
+		// The parser drops the value of a last declaration without a semicolon
+		if existing, err = parser.ParseDeclarations(style + ";"); err != nil {
+			return
+		}
+	}
+
+	var cascade []*css.Declaration
+	for _, important := range []bool{false, true} {
+		for _, r := range rules {
+			for _, d := range r.declarations {
+				if d.Important == important {
+					cascade = append(cascade, &css.Declaration{Property: strings.ToLower(d.Property), Value: d.Value})
+				}
+			}
+		}
+		for _, d := range existing {
+			if d.Important == important {
+				cascade = append(cascade, d)
+			}
+		}
+	}
+
+	// A later declaration of a property replaces an earlier one and moves to
+	// the end, so that shorthands and longhands keep their relative order
+	var resolved []*css.Declaration
+	for _, d := range cascade {
+		for i, previous := range resolved {
+			if strings.EqualFold(previous.Property, d.Property) {
+				resolved = append(resolved[:i], resolved[i+1:]...)
+				break
+			}
+		}
+		resolved = append(resolved, d)
+	}
+
+	parts := make([]string, len(resolved))
+	for i, d := range resolved {
+		parts[i] = d.String()
+	}
+	setAttr(n, "style", strings.Join(parts, " "))
+}
+
+// dynamic reports whether a selector uses a dynamic pseudo-class
+func dynamic(selector string) bool {
+	selector = strings.ToLower(selector)
+	for _, pseudo := range dynamicPseudoClasses {
+		if strings.Contains(selector, pseudo) {
+			return true
+		}
+	}
+	return false
+}
+
+// text returns the text content of a <style> element
+func text(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			b.WriteString(child.Data)
+		}
+	}
+	return b.String()
+}
+
+// attr returns the value of an attribute of n
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasAttr reports whether n has an attribute
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// setAttr sets an attribute of n, adding it when missing
+func setAttr(n *html.Node, key, value string) {
+	for i := range n.Attr {
+		if n.Attr[i].Key == key {
+			n.Attr[i].Val = value
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: value})
+}
@@ -0,0 +1,113 @@
+package cssinline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInline_NoStyle(t *testing.T) {
+	content := `<p class="x">Hello</p>`
+	if got := Inline(content); got != content {
+		t.Errorf("expected content without <style> to be unchanged, got %q", got)
+	}
+}
+
+func TestInline(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+		reject  []string
+	}{
+		{
+			name:    "type selector",
+			content: `<style>p { color: red; }</style><p>Hi</p>`,
+			want:    []string{`<p style="color: red;">Hi</p>`},
+			reject:  []string{"<style"},
+		},
+		{
+			name:    "specificity",
+			content: `<style>#main { color: blue } p.lead { color: green } p { color: red; margin: 0 }</style><p id="main" class="lead">Hi</p>`,
+			want:    []string{`style="margin: 0; color: blue;"`},
+		},
+		{
+			name:    "source order",
+			content: `<style>.a { color: red } .b { color: blue }</style><p class="b a">Hi</p>`,
+			want:    []string{`style="color: blue;"`},
+		},
+		{
+			name:    "existing style wins",
+			content: `<style>p { color: red; padding: 4px }</style><p style="color: black">Hi</p>`,
+			want:    []string{`style="padding: 4px; color: black;"`},
+		},
+		{
+			name:    "important beats existing style",
+			content: `<style>p { color: red !important }</style><p style="color: black">Hi</p>`,
+			want:    []string{`style="color: red;"`},
+		},
+		{
+			name:    "shorthand after longhand",
+			content: `<style>p { margin-top: 5px } p.x { margin: 0 }</style><p class="x">Hi</p>`,
+			want:    []string{`style="margin-top: 5px; margin: 0;"`},
+		},
+		{
+			name:    "selector lists and descendants",
+			content: `<style>h1, td a { font-weight: bold }</style><h1>T</h1><table><tr><td><a href="/x">L</a></td></tr></table>`,
+			want:    []string{`<h1 style="font-weight: bold;">`, `<a href="/x" style="font-weight: bold;">`},
+		},
+		{
+			name:    "media queries kept in head",
+			content: `<html><head><style>p { color: red } @media (max-width: 600px) { p { color: blue !important } }</style></head><body><p>Hi</p></body></html>`,
+			want:    []string{`<p style="color: red;">`, "@media (max-width: 600px)", "color: blue !important"},
+		},
+		{
+			name:    "media queries moved from body to head",
+			content: `<body><style>@media (max-width: 600px) { .col { width: 100% } }</style><p class="col">Hi</p></body>`,
+			want:    []string{"</style></head>"},
+			reject:  []string{`<p class="col" style=`},
+		},
+		{
+			name:    "pseudo-classes kept",
+			content: `<style>a { color: red } a:hover { color: blue } p::first-line { color: green }</style><p><a href="/">L</a></p>`,
+			want:    []string{`<a href="/" style="color: red;">`, "a:hover", "p::first-line"},
+		},
+		{
+			name:    "style with media attribute left alone",
+			content: `<style media="screen">p { color: red }</style><p>Hi</p>`,
+			want:    []string{`<style media="screen">`, "<p>Hi</p>"},
+		},
+		{
+			name:    "opted out style left alone",
+			content: `<style data-noinline>p { color: red }</style><p>Hi</p>`,
+			want:    []string{"<style data-noinline>p { color: red }</style>", "<p>Hi</p>"},
+		},
+		{
+			name:    "head elements not styled",
+			content: `<style>* { margin: 0 }</style><p>Hi</p>`,
+			want:    []string{`<p style="margin: 0;">`, "<head></head>"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Inline(tt.content)
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected %q in:\n%s", want, got)
+				}
+			}
+			for _, reject := range tt.reject {
+				if strings.Contains(got, reject) {
+					t.Errorf("unexpected %q in:\n%s", reject, got)
+				}
+			}
+		})
+	}
+}
+
+func TestInline_KeepsDoctype(t *testing.T) {
+	got := Inline(`<!DOCTYPE html><html><head><style>p{color:red}</style></head><body><p>Hi</p></body></html>`)
+	if !strings.HasPrefix(got, "<!DOCTYPE html>") {
+		t.Errorf("expected doctype to be kept, got %q", got)
+	}
+}
@@ -33,7 +33,7 @@ func InitDB(databaseURL string) error {
 	}
 
 	// Auto-migrate models
-	if err = DB.AutoMigrate(&models.User{}, &models.Client{}, &models.Contact{}, &models.EmailMessageRecord{}, &models.EmailEventRecord{}, &models.Campaign{}); err != nil {
+	if err = DB.AutoMigrate(&models.User{}, &models.Client{}, &models.Contact{}, &models.EmailMessageRecord{}, &models.EmailEventRecord{}, &models.Campaign{}, &models.FailedJob{}, &models.AnalyticsHourlyRollup{}, &models.AnalyticsDailyRollup{}, &models.WebhookEndpoint{}, &models.WebhookDelivery{}, &models.WebhookDeliveryAttempt{}, &models.DKIMKey{}, &models.IdempotencyKey{}, &models.Template{}, &models.TemplateVersion{}); err != nil {
 		return err
 	}
 
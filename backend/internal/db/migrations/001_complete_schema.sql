@@ -55,10 +55,15 @@ CREATE UNIQUE INDEX IF NOT EXISTS idx_contacts_client_email_unique ON contacts(c
 CREATE TABLE IF NOT EXISTS email_messages (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     message_id TEXT NOT NULL,
+    provider_message_id TEXT,
+    provider VARCHAR(100),
     from_email TEXT NOT NULL,
     to_email TEXT NOT NULL,
     subject TEXT NOT NULL,
     status VARCHAR(50) NOT NULL DEFAULT 'queued',
+    campaign_id UUID,
+    contact_id UUID,
+    client_id UUID,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
@@ -69,6 +74,10 @@ CREATE INDEX IF NOT EXISTS idx_email_messages_status ON email_messages(status);
 CREATE INDEX IF NOT EXISTS idx_email_messages_to_email ON email_messages(to_email);
 CREATE INDEX IF NOT EXISTS idx_email_messages_from_email ON email_messages(from_email);
 CREATE INDEX IF NOT EXISTS idx_email_messages_created_at ON email_messages(created_at);
+CREATE INDEX IF NOT EXISTS idx_email_messages_campaign_status ON email_messages(campaign_id, status) WHERE campaign_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_email_messages_contact_created ON email_messages(contact_id, created_at DESC) WHERE contact_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_email_messages_client_created ON email_messages(client_id, created_at) WHERE client_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_email_messages_provider_message_id ON email_messages(provider_message_id) WHERE provider_message_id IS NOT NULL;
 
 -- Unique constraint: message_id should be unique
 CREATE UNIQUE INDEX IF NOT EXISTS idx_email_messages_message_id_unique ON email_messages(message_id);
@@ -129,12 +138,17 @@ CREATE TABLE IF NOT EXISTS campaigns (
     subject TEXT NOT NULL,
     content TEXT NOT NULL,
     text_content TEXT,
+    disable_auto_text BOOLEAN NOT NULL DEFAULT false,
+    inline_css BOOLEAN NOT NULL DEFAULT false,
     from_email TEXT NOT NULL,
     status VARCHAR(50) NOT NULL DEFAULT 'draft',
     send_at TIMESTAMP,
     client_id UUID NOT NULL,
     template_id UUID,
+    template_version INTEGER,
     recipient_count INTEGER DEFAULT 0,
+    dispatched_at TIMESTAMP,
+    locked_until TIMESTAMP,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT fk_campaigns_client FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE
@@ -150,6 +164,252 @@ CREATE INDEX IF NOT EXISTS idx_campaigns_template_id ON campaigns(template_id) W
 -- Composite index for scheduled campaigns query
 CREATE INDEX IF NOT EXISTS idx_campaigns_status_send_at ON campaigns(status, send_at) WHERE status = 'scheduled' AND send_at IS NOT NULL;
 
+-- =====================================================
+-- Table: failed_jobs
+-- Dead-letter store for jobs that exhausted their retries
+-- =====================================================
+CREATE TABLE IF NOT EXISTS failed_jobs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    queue VARCHAR(50) NOT NULL,
+    job_type VARCHAR(100) NOT NULL,
+    payload JSONB NOT NULL,
+    error_message TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    campaign_id UUID,
+    retried_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_failed_jobs_campaign FOREIGN KEY (campaign_id) REFERENCES campaigns(id) ON DELETE SET NULL
+);
+
+-- Indexes for failed_jobs
+CREATE INDEX IF NOT EXISTS idx_failed_jobs_created_at ON failed_jobs(created_at);
+CREATE INDEX IF NOT EXISTS idx_failed_jobs_campaign_id ON failed_jobs(campaign_id) WHERE campaign_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_failed_jobs_pending ON failed_jobs(created_at DESC) WHERE retried_at IS NULL;
+
+-- =====================================================
+-- Foreign keys for email_messages
+-- Added after campaigns exists; messages outlive deleted campaigns and contacts
+-- =====================================================
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_email_messages_campaign') THEN
+        ALTER TABLE email_messages ADD CONSTRAINT fk_email_messages_campaign
+            FOREIGN KEY (campaign_id) REFERENCES campaigns(id) ON DELETE SET NULL;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_email_messages_contact') THEN
+        ALTER TABLE email_messages ADD CONSTRAINT fk_email_messages_contact
+            FOREIGN KEY (contact_id) REFERENCES contacts(id) ON DELETE SET NULL;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_email_messages_client') THEN
+        ALTER TABLE email_messages ADD CONSTRAINT fk_email_messages_client
+            FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE SET NULL;
+    END IF;
+END $$;
+
+-- =====================================================
+-- Tables: analytics_hourly_rollups, analytics_daily_rollups
+-- Pre-aggregated event counts per bucket, client, campaign, event type and link.
+-- Emails without a client or campaign are counted under the nil UUID.
+-- =====================================================
+CREATE TABLE IF NOT EXISTS analytics_hourly_rollups (
+    bucket TIMESTAMP NOT NULL,
+    client_id UUID NOT NULL,
+    campaign_id UUID NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    link_url TEXT NOT NULL DEFAULT '',
+    total_count BIGINT NOT NULL DEFAULT 0,
+    unique_count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, client_id, campaign_id, event_type, link_url)
+);
+
+CREATE TABLE IF NOT EXISTS analytics_daily_rollups (
+    bucket TIMESTAMP NOT NULL,
+    client_id UUID NOT NULL,
+    campaign_id UUID NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    link_url TEXT NOT NULL DEFAULT '',
+    total_count BIGINT NOT NULL DEFAULT 0,
+    unique_count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, client_id, campaign_id, event_type, link_url)
+);
+
+-- Indexes for rollups
+CREATE INDEX IF NOT EXISTS idx_analytics_hourly_rollups_client_bucket ON analytics_hourly_rollups(client_id, bucket);
+CREATE INDEX IF NOT EXISTS idx_analytics_hourly_rollups_links ON analytics_hourly_rollups(client_id, bucket) WHERE link_url <> '';
+CREATE INDEX IF NOT EXISTS idx_analytics_daily_rollups_client_bucket ON analytics_daily_rollups(client_id, bucket);
+CREATE INDEX IF NOT EXISTS idx_analytics_daily_rollups_campaign ON analytics_daily_rollups(campaign_id);
+
+-- =====================================================
+-- Table: webhook_endpoints
+-- Client URLs receiving email events
+-- =====================================================
+CREATE TABLE IF NOT EXISTS webhook_endpoints (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    client_id UUID NOT NULL,
+    url TEXT NOT NULL,
+    description TEXT,
+    event_types JSONB NOT NULL DEFAULT '[]',
+    secret VARCHAR(100) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_webhook_endpoints_client FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_endpoints_client_id ON webhook_endpoints(client_id);
+
+-- =====================================================
+-- Table: webhook_deliveries
+-- One event to deliver to one endpoint, retried until it succeeds or fails
+-- =====================================================
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    endpoint_id UUID NOT NULL,
+    client_id UUID NOT NULL,
+    event_id UUID NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    last_response_status INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    delivered_at TIMESTAMP,
+    replay_of UUID,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_webhook_deliveries_endpoint FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoints(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_endpoint_created ON webhook_deliveries(endpoint_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_client_created ON webhook_deliveries(client_id, created_at DESC);
+
+-- =====================================================
+-- Table: webhook_delivery_attempts
+-- Log of every HTTP request made for a delivery
+-- =====================================================
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    delivery_id UUID NOT NULL,
+    attempt INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    response_status INTEGER NOT NULL DEFAULT 0,
+    response_body TEXT,
+    error TEXT,
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_webhook_delivery_attempts_delivery FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery ON webhook_delivery_attempts(delivery_id, attempt);
+
+-- =====================================================
+-- Table: dkim_keys
+-- Per-client DKIM signing keys of sending domains, one active key per domain
+-- A domain belongs to the client whose key was found published in its DNS
+-- =====================================================
+CREATE TABLE IF NOT EXISTS dkim_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    client_id UUID NOT NULL,
+    domain VARCHAR(255) NOT NULL,
+    selector VARCHAR(63) NOT NULL,
+    algorithm VARCHAR(20) NOT NULL,
+    private_key TEXT NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT false,
+    verified_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_dkim_keys_client FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_dkim_keys_client_id ON dkim_keys(client_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dkim_keys_domain_selector ON dkim_keys(domain, selector);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_dkim_keys_active_domain ON dkim_keys(domain) WHERE active;
+
+-- =====================================================
+-- Table: idempotency_keys
+-- Idempotency-Key headers of POST /emails/send and the responses replayed to retries
+-- =====================================================
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    scope VARCHAR(100) NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    request_hash VARCHAR(64) NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    response JSONB,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    locked_until TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_keys_scope_key ON idempotency_keys(scope, key);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+
+-- =====================================================
+-- Table: templates
+-- Reusable emails of a client, versioned in template_versions
+-- =====================================================
+CREATE TABLE IF NOT EXISTS templates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    client_id UUID NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    latest_version INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_templates_client FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_templates_client_name ON templates(client_id, name);
+
+-- =====================================================
+-- Table: template_versions
+-- Immutable, numbered content of templates with their variables schema
+-- =====================================================
+CREATE TABLE IF NOT EXISTS template_versions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    template_id UUID NOT NULL,
+    version INTEGER NOT NULL,
+    subject TEXT NOT NULL,
+    html_content TEXT,
+    text_content TEXT,
+    variables JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_template_versions_template FOREIGN KEY (template_id) REFERENCES templates(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_template_versions_template_version ON template_versions(template_id, version);
+
+-- Foreign keys for tables created by GORM AutoMigrate before this file runs
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_webhook_endpoints_client') THEN
+        ALTER TABLE webhook_endpoints ADD CONSTRAINT fk_webhook_endpoints_client
+            FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_webhook_deliveries_endpoint') THEN
+        ALTER TABLE webhook_deliveries ADD CONSTRAINT fk_webhook_deliveries_endpoint
+            FOREIGN KEY (endpoint_id) REFERENCES webhook_endpoints(id) ON DELETE CASCADE;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_webhook_delivery_attempts_delivery') THEN
+        ALTER TABLE webhook_delivery_attempts ADD CONSTRAINT fk_webhook_delivery_attempts_delivery
+            FOREIGN KEY (delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_dkim_keys_client') THEN
+        ALTER TABLE dkim_keys ADD CONSTRAINT fk_dkim_keys_client
+            FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_templates_client') THEN
+        ALTER TABLE templates ADD CONSTRAINT fk_templates_client
+            FOREIGN KEY (client_id) REFERENCES clients(id) ON DELETE CASCADE;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_template_versions_template') THEN
+        ALTER TABLE template_versions ADD CONSTRAINT fk_template_versions_template
+            FOREIGN KEY (template_id) REFERENCES templates(id) ON DELETE CASCADE;
+    END IF;
+END $$;
+
 -- =====================================================
 -- Idempotency Indexes
 -- =====================================================
@@ -177,6 +437,16 @@ COMMENT ON TABLE contacts IS 'Stores email contacts with status (active, unsubsc
 COMMENT ON TABLE email_messages IS 'Stores every email sent with tracking information';
 COMMENT ON TABLE email_events IS 'Stores email events: sent, delivered, open, click, bounce';
 COMMENT ON TABLE campaigns IS 'Stores email campaign information with scheduling support';
+COMMENT ON TABLE failed_jobs IS 'Stores jobs that exhausted their retries (dead-letter queue)';
+COMMENT ON TABLE analytics_hourly_rollups IS 'Hourly event counts per client, campaign, event type and link';
+COMMENT ON TABLE analytics_daily_rollups IS 'Daily event counts per client, campaign, event type and link';
+COMMENT ON TABLE webhook_endpoints IS 'Client URLs receiving email events (outbound webhooks)';
+COMMENT ON TABLE webhook_deliveries IS 'Email events to deliver to webhook endpoints, with their retry state';
+COMMENT ON TABLE webhook_delivery_attempts IS 'Every HTTP request made to deliver a webhook';
+COMMENT ON TABLE dkim_keys IS 'DKIM signing keys of client sending domains, rotated by selector';
+COMMENT ON TABLE idempotency_keys IS 'Idempotency keys of POST /emails/send with the stored response, kept until expires_at';
+COMMENT ON TABLE templates IS 'Reusable emails of a client; content lives in template_versions';
+COMMENT ON TABLE template_versions IS 'Immutable, numbered template content with its variables schema';
 
 COMMENT ON COLUMN users.email IS 'User email address (unique)';
 COMMENT ON COLUMN users.password IS 'Hashed password (never exposed in API)';
@@ -186,11 +456,34 @@ COMMENT ON COLUMN users.client_id IS 'Optional link to client (for client users)
 COMMENT ON COLUMN contacts.status IS 'Contact status: active, unsubscribed, bounced';
 COMMENT ON COLUMN email_messages.status IS 'Email status: queued, sent, failed';
 COMMENT ON COLUMN email_messages.message_id IS 'Unique Message-ID header from email';
+COMMENT ON COLUMN email_messages.provider_message_id IS 'Message ID assigned by the sending provider (SES message ID when sent through the SES API)';
+COMMENT ON COLUMN email_messages.provider IS 'Routing provider that sent the email (NULL when sent without a routing sender)';
+COMMENT ON COLUMN email_messages.campaign_id IS 'Campaign that produced this email (NULL for transactional sends)';
+COMMENT ON COLUMN email_messages.contact_id IS 'Recipient contact (NULL when the recipient is not a known contact)';
+COMMENT ON COLUMN email_messages.client_id IS 'Client the email was sent for (NULL for system emails)';
 COMMENT ON COLUMN email_events.event_type IS 'Event type: sent, delivered, open, click, bounce, failed';
 COMMENT ON COLUMN email_events.meta IS 'JSON metadata for event (error details, user agent, IP, etc.)';
 COMMENT ON COLUMN campaigns.status IS 'Campaign status: draft, scheduled, sending, sent, failed';
 COMMENT ON COLUMN campaigns.send_at IS 'Scheduled send time (NULL for immediate send)';
+COMMENT ON COLUMN campaigns.disable_auto_text IS 'Send HTML-only mail instead of generating a text part when text_content is empty';
+COMMENT ON COLUMN campaigns.inline_css IS 'Inline <style> rules into style attributes before sending; media queries stay in the head';
 COMMENT ON COLUMN campaigns.recipient_count IS 'Number of recipients for this campaign';
+COMMENT ON COLUMN campaigns.dispatched_at IS 'When every recipient had an email message created (NULL while dispatching)';
+COMMENT ON COLUMN campaigns.locked_until IS 'Dispatch lease of the sending instance; expired leases are taken over';
+COMMENT ON COLUMN campaigns.template_id IS 'Template rendered for each recipient instead of subject and content';
+COMMENT ON COLUMN campaigns.template_version IS 'Template version to send (NULL for the latest version at send time)';
+COMMENT ON COLUMN dkim_keys.verified_at IS 'When the key was first found published in DNS; verified keys own their domain';
+COMMENT ON COLUMN idempotency_keys.locked_until IS 'Lease of the first request; a retry takes over a key still in progress after it';
+COMMENT ON COLUMN template_versions.variables IS 'JSON array of declared variables: name, type, required, default';
+COMMENT ON COLUMN failed_jobs.queue IS 'Originating queue: redis, memory';
+COMMENT ON COLUMN failed_jobs.retried_at IS 'Set when the job is requeued through the admin API';
+COMMENT ON COLUMN analytics_daily_rollups.unique_count IS 'Emails whose first event of this type (or first click on this link) is in the bucket';
+COMMENT ON COLUMN analytics_daily_rollups.link_url IS 'Clicked URL for per-link click rows, empty otherwise';
+COMMENT ON COLUMN webhook_endpoints.event_types IS 'JSON array of subscribed event types; empty subscribes to all';
+COMMENT ON COLUMN webhook_endpoints.secret IS 'HMAC-SHA256 signing secret (never exposed after creation)';
+COMMENT ON COLUMN webhook_deliveries.status IS 'Delivery status: pending, succeeded, failed';
+COMMENT ON COLUMN webhook_deliveries.replay_of IS 'Delivery replayed through the API to create this one';
+COMMENT ON COLUMN webhook_deliveries.next_attempt_at IS 'When a pending delivery is next attempted (also the lease of an in-flight attempt)';
 
 -- =====================================================
 -- Migration complete
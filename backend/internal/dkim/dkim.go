@@ -0,0 +1,278 @@
+// Package dkim signs outgoing mail with the DKIM keys of the sending domains.
+//
+// Keys belong to a client and a domain and are published in DNS under
+// <selector>._domainkey.<domain>. A domain has at most one active key; keys
+// are rotated by creating a key with a new selector, publishing its record
+// and activating it. Messages are signed with rsa-sha256 or ed25519-sha256
+// (RFC 8463) and relaxed/relaxed canonicalisation.
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultHeaders are the header fields signed when present in a message
+var DefaultHeaders = []string{
+	"From", "Reply-To", "Sender", "To", "Cc", "Subject", "Date", "Message-ID",
+	"In-Reply-To", "References", "MIME-Version", "Content-Type",
+	"Content-Transfer-Encoding", "List-Unsubscribe", "List-Unsubscribe-Post",
+}
+
+// maxLineLength is where the DKIM-Signature header is folded
+const maxLineLength = 78
+
+// Options configures how a message is signed
+type Options struct {
+	Domain   string        // d= tag, the signing domain
+	Selector string        // s= tag, the DNS selector of the key
+	Key      crypto.Signer // *rsa.PrivateKey or ed25519.PrivateKey
+	Headers  []string      // header fields to sign, defaults to DefaultHeaders
+	Time     time.Time     // t= tag, defaults to now
+}
+
+// Sign returns raw with a DKIM-Signature header prepended
+// raw must be a complete message with CRLF line endings.
+func Sign(raw []byte, opts Options) ([]byte, error) {
+	if opts.Domain == "" || opts.Selector == "" {
+		return nil, errors.New("dkim: domain and selector are required")
+	}
+	algorithm, err := KeyAlgorithm(opts.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	header, body := splitMessage(raw)
+	fields := parseHeader(header)
+
+	names := opts.Headers
+	if names == nil {
+		names = DefaultHeaders
+	}
+	signed, signedNames := selectHeaders(fields, names)
+	if !containsFold(signedNames, "from") {
+		return nil, errors.New("dkim: message has no From header")
+	}
+
+	bodyHash := sha256.Sum256(canonicalBody(body))
+	t := opts.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	tags := []string{
+		"v=1",
+		"a=" + algorithm,
+		"c=relaxed/relaxed",
+		"d=" + opts.Domain,
+		"s=" + opts.Selector,
+		"t=" + strconv.FormatInt(t.Unix(), 10),
+		"h=" + strings.Join(signedNames, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}
+	field := foldTags("DKIM-Signature: ", tags)
+
+	// The signature covers the signed headers and the DKIM-Signature header
+	// itself with an empty b= tag and without its trailing CRLF
+	var data bytes.Buffer
+	for _, f := range signed {
+		data.WriteString(canonicalHeader(f))
+	}
+	data.WriteString(strings.TrimSuffix(canonicalHeader(field), "\r\n"))
+
+	digest := sha256.Sum256(data.Bytes())
+	var signature []byte
+	switch key := opts.Key.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, digest[:])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: failed to sign: %w", err)
+	}
+
+	field = strings.TrimSuffix(field, "\r\n") + foldValue(base64.StdEncoding.EncodeToString(signature), lastLineLength(field)) + "\r\n"
+
+	out := make([]byte, 0, len(field)+len(raw))
+	out = append(out, field...)
+	return append(out, raw...), nil
+}
+
+// splitMessage splits raw into its header, including the final CRLF of the
+// last field, and its body
+func splitMessage(raw []byte) (header, body []byte) {
+	if i := bytes.Index(raw, []byte("\r\n\r\n")); i >= 0 {
+		return raw[:i+2], raw[i+4:]
+	}
+	return raw, nil
+}
+
+// parseHeader splits a message header into its fields, each including its
+// continuation lines and final CRLF
+func parseHeader(header []byte) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+// fieldName returns the name of a header field
+func fieldName(field string) string {
+	if i := strings.IndexByte(field, ':'); i >= 0 {
+		return strings.TrimRight(field[:i], " \t")
+	}
+	return ""
+}
+
+// selectHeaders picks the fields to sign in h= order. Repeated names sign
+// the instances of a field from the bottom up, as RFC 6376 section 5.4.2 requires.
+func selectHeaders(fields []string, names []string) (signed []string, signedNames []string) {
+	used := make(map[int]bool)
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(fieldName(fields[i]), name) {
+				continue
+			}
+			used[i] = true
+			signed = append(signed, fields[i])
+			signedNames = append(signedNames, strings.ToLower(name))
+			break
+		}
+	}
+	return signed, signedNames
+}
+
+// containsFold reports whether list contains s, ignoring case
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalHeader applies the relaxed header canonicalisation of RFC 6376
+// section 3.4.2 to one field
+func canonicalHeader(field string) string {
+	i := strings.IndexByte(field, ':')
+	if i < 0 {
+		return field
+	}
+	name := strings.ToLower(strings.TrimRight(field[:i], " \t"))
+	value := strings.NewReplacer("\r\n", "").Replace(field[i+1:])
+	return name + ":" + strings.TrimSpace(collapseWhitespace(value)) + "\r\n"
+}
+
+// canonicalBody applies the relaxed body canonicalisation of RFC 6376
+// section 3.4.4; an empty body stays empty
+func canonicalBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(collapseWhitespace(line), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// collapseWhitespace replaces every run of spaces and tabs with one space
+func collapseWhitespace(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// foldTags writes a header field of tag=value pairs, folding between tags
+// to keep lines within maxLineLength where possible
+func foldTags(prefix string, tags []string) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	lineLength := len(prefix)
+	for i, tag := range tags {
+		if i < len(tags)-1 {
+			tag += ";"
+		}
+		if i > 0 {
+			if lineLength+1+len(tag) > maxLineLength {
+				b.WriteString("\r\n\t")
+				lineLength = 1
+			} else {
+				b.WriteByte(' ')
+				lineLength++
+			}
+		}
+		b.WriteString(tag)
+		lineLength += len(tag)
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// foldValue splits a base64 value into folded lines, the first of which
+// continues a line already lineLength long
+func foldValue(value string, lineLength int) string {
+	var b strings.Builder
+	for len(value) > 0 {
+		room := maxLineLength - lineLength
+		if room <= 0 {
+			b.WriteString("\r\n\t")
+			lineLength = 1
+			continue
+		}
+		n := min(room, len(value))
+		b.WriteString(value[:n])
+		value = value[n:]
+		lineLength += n
+	}
+	return b.String()
+}
+
+// lastLineLength returns the length of the last line of a folded field
+// without its trailing CRLF
+func lastLineLength(field string) int {
+	field = strings.TrimSuffix(field, "\r\n")
+	if i := strings.LastIndex(field, "\r\n"); i >= 0 {
+		return len(field) - i - 2
+	}
+	return len(field)
+}
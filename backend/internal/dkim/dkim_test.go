@@ -0,0 +1,285 @@
+package dkim
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/mimemsg"
+
+	msgauth "github.com/emersion/go-msgauth/dkim"
+)
+
+// testMessage is a message with folded headers, odd whitespace and trailing empty lines
+const testMessage = "From: Sender <sender@example.com>\r\n" +
+	"To: user@example.org\r\n" +
+	"Subject:   Hello\t  there,\r\n" +
+	"  folded subject\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 +0000\r\n" +
+	"Message-ID: <id@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"X-Unsigned: not signed\r\n" +
+	"\r\n" +
+	"Hello  world \t\r\n" +
+	"\r\n" +
+	"second paragraph\r\n" +
+	"\r\n" +
+	"\r\n"
+
+// localVerify verifies the signatures of a message against DNS records held in
+// memory, keyed by record name
+func localVerify(t *testing.T, message []byte, records map[string]string) []*msgauth.Verification {
+	t.Helper()
+	verifications, err := msgauth.VerifyWithOptions(bytes.NewReader(message), &msgauth.VerifyOptions{
+		LookupTXT: func(name string) ([]string, error) {
+			record, ok := records[name]
+			if !ok {
+				return nil, fmt.Errorf("no TXT record for %s", name)
+			}
+			return []string{record}, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	return verifications
+}
+
+// testKeys returns an RSA and an Ed25519 key
+func testKeys(t *testing.T) map[string]crypto.Signer {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate Ed25519 key: %v", err)
+	}
+	return map[string]crypto.Signer{AlgorithmRSA: rsaKey, AlgorithmEd25519: edKey}
+}
+
+// signAndRecords signs message and returns the DNS records that verify it
+func signAndRecords(t *testing.T, message []byte, key crypto.Signer) ([]byte, map[string]string) {
+	t.Helper()
+	signed, err := Sign(message, Options{Domain: "example.com", Selector: "s1", Key: key})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	record, err := TXTRecord(key)
+	if err != nil {
+		t.Fatalf("TXTRecord() error = %v", err)
+	}
+	return signed, map[string]string{RecordName("s1", "example.com"): record}
+}
+
+func TestSign_VerifiesWithLocalVerifier(t *testing.T) {
+	for algorithm, key := range testKeys(t) {
+		t.Run(algorithm, func(t *testing.T) {
+			signed, records := signAndRecords(t, []byte(testMessage), key)
+
+			verifications := localVerify(t, signed, records)
+			if len(verifications) != 1 {
+				t.Fatalf("verifications = %d, want 1", len(verifications))
+			}
+			v := verifications[0]
+			if v.Err != nil {
+				t.Fatalf("signature did not verify: %v\n%s", v.Err, signed)
+			}
+			if v.Domain != "example.com" {
+				t.Errorf("domain = %q, want example.com", v.Domain)
+			}
+			for _, name := range []string{"from", "to", "subject", "date", "message-id", "mime-version", "content-type"} {
+				if !containsFold(v.HeaderKeys, name) {
+					t.Errorf("%s is not signed: %v", name, v.HeaderKeys)
+				}
+			}
+			if containsFold(v.HeaderKeys, "x-unsigned") {
+				t.Errorf("x-unsigned should not be signed: %v", v.HeaderKeys)
+			}
+
+			header := string(signed[:bytes.Index(signed, []byte("\r\n\r\n"))])
+			if !strings.Contains(header, "a="+algorithm+";") || !strings.Contains(header, "c=relaxed/relaxed;") {
+				t.Errorf("unexpected DKIM-Signature header:\n%s", header)
+			}
+			for _, line := range strings.Split(header, "\r\n") {
+				if len(line) > maxLineLength {
+					t.Errorf("header line longer than %d: %q", maxLineLength, line)
+				}
+			}
+		})
+	}
+}
+
+func TestSign_VerifiesBuiltMIMEMessage(t *testing.T) {
+	msg := mimemsg.Message{
+		From:     `"Ünïcode Sender" <news@example.com>`,
+		To:       []string{"user@example.org"},
+		Subject:  strings.Repeat("Grüße aus der Ferne ", 6),
+		Headers:  map[string]string{"List-Unsubscribe": "<https://example.com/u/1>"},
+		TextBody: "Hello",
+		HTMLBody: "<p>Hello</p>",
+		Attachments: []mimemsg.Attachment{
+			{Filename: "report.pdf", Content: bytes.Repeat([]byte{0, 1, 2, 3}, 200)},
+		},
+	}
+	raw, err := msg.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+
+	for algorithm, key := range testKeys(t) {
+		t.Run(algorithm, func(t *testing.T) {
+			signed, records := signAndRecords(t, raw, key)
+			verifications := localVerify(t, signed, records)
+			if len(verifications) != 1 || verifications[0].Err != nil {
+				t.Fatalf("signature did not verify: %+v", verifications)
+			}
+			if !containsFold(verifications[0].HeaderKeys, "list-unsubscribe") {
+				t.Errorf("list-unsubscribe is not signed: %v", verifications[0].HeaderKeys)
+			}
+		})
+	}
+}
+
+func TestSign_SurvivesRelaxedChanges(t *testing.T) {
+	signed, records := signAndRecords(t, []byte(testMessage), testKeys(t)[AlgorithmRSA])
+
+	// Relays may refold headers, change whitespace and drop trailing empty lines
+	changed := bytes.Replace(signed, []byte("Subject:   Hello\t  there,\r\n  folded subject"), []byte("subject: Hello there, folded subject"), 1)
+	changed = bytes.Replace(changed, []byte("Hello  world \t\r\n"), []byte("Hello world\r\n"), 1)
+	changed = bytes.TrimSuffix(changed, []byte("\r\n\r\n"))
+
+	verifications := localVerify(t, changed, records)
+	if len(verifications) != 1 || verifications[0].Err != nil {
+		t.Fatalf("signature did not survive relaxed changes: %+v\n%s", verifications[0], changed)
+	}
+}
+
+func TestSign_DetectsTampering(t *testing.T) {
+	tests := []struct {
+		name string
+		old  string
+		new  string
+	}{
+		{"body", "second paragraph", "third paragraph"},
+		{"signed header", "To: user@example.org", "To: other@example.org"},
+	}
+
+	for algorithm, key := range testKeys(t) {
+		for _, tt := range tests {
+			t.Run(algorithm+"/"+tt.name, func(t *testing.T) {
+				signed, records := signAndRecords(t, []byte(testMessage), key)
+				tampered := bytes.Replace(signed, []byte(tt.old), []byte(tt.new), 1)
+
+				verifications := localVerify(t, tampered, records)
+				if len(verifications) != 1 || verifications[0].Err == nil {
+					t.Fatal("tampered message verified")
+				}
+			})
+		}
+	}
+}
+
+func TestSign_UnsignedHeaderChangesStillVerify(t *testing.T) {
+	signed, records := signAndRecords(t, []byte(testMessage), testKeys(t)[AlgorithmEd25519])
+	changed := bytes.Replace(signed, []byte("X-Unsigned: not signed"), []byte("X-Unsigned: changed"), 1)
+
+	verifications := localVerify(t, changed, records)
+	if len(verifications) != 1 || verifications[0].Err != nil {
+		t.Fatalf("signature did not verify: %+v", verifications[0])
+	}
+}
+
+func TestSign_SignsLastInstanceOfRepeatedHeader(t *testing.T) {
+	message := "From: a@example.com\r\nTo: first@example.org\r\nTo: second@example.org\r\n\r\nbody\r\n"
+	signed, err := Sign([]byte(message), Options{
+		Domain:   "example.com",
+		Selector: "s1",
+		Key:      testKeys(t)[AlgorithmEd25519],
+		Headers:  []string{"From", "To"},
+		Time:     time.Unix(1700000000, 0),
+	})
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if !strings.Contains(string(signed), "t=1700000000;") || !strings.Contains(string(signed), "h=from:to;") {
+		t.Errorf("unexpected DKIM-Signature header:\n%s", signed)
+	}
+
+	_, selected := selectHeaders(parseHeader([]byte(message)), []string{"To", "To", "To"})
+	if len(selected) != 2 {
+		t.Errorf("selected %v, want both To headers once", selected)
+	}
+	fields, _ := selectHeaders(parseHeader([]byte(message)), []string{"To"})
+	if fields[0] != "To: second@example.org\r\n" {
+		t.Errorf("signed %q, want the last To header", fields[0])
+	}
+}
+
+func TestSign_RejectsInvalidInput(t *testing.T) {
+	key := testKeys(t)[AlgorithmEd25519]
+
+	tests := []struct {
+		name    string
+		message string
+		opts    Options
+	}{
+		{"no selector", testMessage, Options{Domain: "example.com", Key: key}},
+		{"no key", testMessage, Options{Domain: "example.com", Selector: "s1"}},
+		{"no From", "To: a@example.org\r\n\r\nbody\r\n", Options{Domain: "example.com", Selector: "s1", Key: key}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Sign([]byte(tt.message), tt.opts); err == nil {
+				t.Error("Sign() error = nil")
+			}
+		})
+	}
+}
+
+func TestCanonicalHeader(t *testing.T) {
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"Subject: Hello\r\n", "subject:Hello\r\n"},
+		{"SUBJECT :  a \t b  \r\n", "subject:a b\r\n"},
+		{"Subject: first\r\n\tsecond \r\n", "subject:first second\r\n"},
+		{"X-Empty:\r\n", "x-empty:\r\n"},
+	}
+
+	for _, tt := range tests {
+		if got := canonicalHeader(tt.field); got != tt.want {
+			t.Errorf("canonicalHeader(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestCanonicalBody(t *testing.T) {
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"", ""},
+		{"\r\n\r\n", ""},
+		{"a  b \t\r\n", "a b\r\n"},
+		{"line\r\n\r\n\r\n", "line\r\n"},
+		{"no trailing newline", "no trailing newline\r\n"},
+		{" leading\r\n\r\nkept blank line\r\n", " leading\r\n\r\nkept blank line\r\n"},
+	}
+
+	for _, tt := range tests {
+		if got := string(canonicalBody([]byte(tt.body))); got != tt.want {
+			t.Errorf("canonicalBody(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package dkim
+
+import (
+	"errors"
+	"os"
+
+	"backend/internal/middleware"
+	"backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// Handler handles DKIM key HTTP requests
+type Handler struct {
+	service Service
+	logger  zerolog.Logger
+}
+
+// NewHandler creates a new DKIM key handler
+func NewHandler(service Service) *Handler {
+	return &Handler{
+		service: service,
+		logger:  zerolog.New(os.Stdout).With().Timestamp().Logger(),
+	}
+}
+
+// HTTPKeyRequest represents the HTTP request body for creating a key
+type HTTPKeyRequest struct {
+	KeyRequest
+	ClientID string `json:"client_id"` // admins only
+}
+
+// keyResponse is a key with the DNS record that publishes it
+type keyResponse struct {
+	*models.DKIMKey
+	DNSName   string `json:"dns_name"`
+	DNSRecord string `json:"dns_record"`
+}
+
+// errNoClient is returned when a non-admin user is not linked to a client
+var errNoClient = errors.New("user is not linked to a client")
+
+// errInvalidID is returned when the :id route parameter is not a UUID
+var errInvalidID = errors.New("invalid id")
+
+// clientScope returns the client whose keys the user may access (nil for admins)
+func clientScope(c *fiber.Ctx) (*uuid.UUID, error) {
+	if middleware.IsAdmin(c) {
+		return nil, nil
+	}
+	clientID := middleware.ClientIDFromContext(c)
+	if clientID == nil {
+		return nil, errNoClient
+	}
+	return clientID, nil
+}
+
+// CreateKey handles POST /dkim-keys
+func (h *Handler) CreateKey(c *fiber.Ctx) error {
+	var req HTTPKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	scope, err := clientScope(c)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.create_failed")
+	}
+	var clientID uuid.UUID
+	if scope != nil {
+		clientID = *scope
+	} else {
+		if clientID, err = uuid.Parse(req.ClientID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "client_id is required",
+			})
+		}
+	}
+
+	key, err := h.service.CreateKey(c.Context(), clientID, &req.KeyRequest)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.create_failed")
+	}
+
+	response, err := newKeyResponse(key)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.create_failed")
+	}
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// ListKeys handles GET /dkim-keys?client_id= (client_id for admins only)
+func (h *Handler) ListKeys(c *fiber.Ctx) error {
+	scope, err := clientScope(c)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.list_failed")
+	}
+	if scope == nil && c.Query("client_id") != "" {
+		clientID, err := uuid.Parse(c.Query("client_id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid client_id",
+			})
+		}
+		scope = &clientID
+	}
+
+	keys, err := h.service.ListKeys(c.Context(), scope)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.list_failed")
+	}
+
+	responses := make([]keyResponse, 0, len(keys))
+	for i := range keys {
+		response, err := newKeyResponse(&keys[i])
+		if err != nil {
+			return h.handleError(c, err, "dkim.key.list_failed")
+		}
+		responses = append(responses, response)
+	}
+
+	return c.JSON(fiber.Map{
+		"keys": responses,
+	})
+}
+
+// GetKey handles GET /dkim-keys/:id
+func (h *Handler) GetKey(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.get_failed")
+	}
+
+	key, err := h.service.GetKey(c.Context(), id, scope)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.get_failed")
+	}
+
+	response, err := newKeyResponse(key)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.get_failed")
+	}
+	return c.JSON(response)
+}
+
+// ActivateKey handles POST /dkim-keys/:id/activate
+func (h *Handler) ActivateKey(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.activate_failed")
+	}
+
+	key, err := h.service.ActivateKey(c.Context(), id, scope)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.activate_failed")
+	}
+
+	h.logger.Info().
+		Str("event", "dkim.key.activated").
+		Str("key_id", key.ID.String()).
+		Str("domain", key.Domain).
+		Str("selector", key.Selector).
+		Msg("DKIM key activated")
+
+	response, err := newKeyResponse(key)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.activate_failed")
+	}
+	return c.JSON(response)
+}
+
+// DeleteKey handles DELETE /dkim-keys/:id
+func (h *Handler) DeleteKey(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "dkim.key.delete_failed")
+	}
+
+	if err := h.service.DeleteKey(c.Context(), id, scope); err != nil {
+		return h.handleError(c, err, "dkim.key.delete_failed")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// newKeyResponse adds the DNS record of key
+func newKeyResponse(key *models.DKIMKey) (keyResponse, error) {
+	name, value, err := DNSRecord(key)
+	if err != nil {
+		return keyResponse{}, err
+	}
+	return keyResponse{DKIMKey: key, DNSName: name, DNSRecord: value}, nil
+}
+
+// parseRequest returns the :id route parameter and the caller's client scope
+func (h *Handler) parseRequest(c *fiber.Ctx) (uuid.UUID, *uuid.UUID, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, nil, errInvalidID
+	}
+	scope, err := clientScope(c)
+	return id, scope, err
+}
+
+// handleError maps service errors to HTTP responses
+func (h *Handler) handleError(c *fiber.Ctx, err error, event string) error {
+	switch {
+	case errors.Is(err, errInvalidID), errors.Is(err, ErrInvalidKey):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, errNoClient):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrKeyNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrDomainTaken), errors.Is(err, ErrRecordNotPublished):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.logger.Error().
+		Err(err).
+		Str("event", event).
+		Msg("DKIM key request failed")
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "internal server error",
+	})
+}
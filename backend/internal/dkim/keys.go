@@ -0,0 +1,138 @@
+package dkim
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend/internal/models"
+)
+
+// Signing algorithms (a= tag)
+const (
+	AlgorithmRSA     = "rsa-sha256"
+	AlgorithmEd25519 = "ed25519-sha256"
+)
+
+// rsaKeyBits is the size of generated RSA keys
+const rsaKeyBits = 2048
+
+// ErrInvalidKey is returned when a private key cannot be parsed or is not supported
+var ErrInvalidKey = errors.New("invalid DKIM key")
+
+// GenerateKey creates a private key for algorithm
+func GenerateKey(algorithm string) (crypto.Signer, error) {
+	switch algorithm {
+	case AlgorithmRSA:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate RSA key: %w", err)
+		}
+		return key, nil
+	case AlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidKey, algorithm)
+	}
+}
+
+// KeyAlgorithm returns the signing algorithm of key
+func KeyAlgorithm(key crypto.Signer) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return AlgorithmRSA, nil
+	case ed25519.PrivateKey:
+		return AlgorithmEd25519, nil
+	default:
+		return "", fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, key)
+	}
+}
+
+// MarshalPrivateKey encodes key as a PKCS #8 PEM block
+func MarshalPrivateKey(key crypto.Signer) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// ParsePrivateKey decodes a PKCS #8 or PKCS #1 PEM private key
+func ParsePrivateKey(data string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(data)))
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM block found", ErrInvalidKey)
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: unexpected PEM block %q", ErrInvalidKey, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, key)
+	}
+	if _, err := KeyAlgorithm(signer); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// TXTRecord returns the DNS TXT record that publishes the public half of key
+func TXTRecord(key crypto.Signer) (string, error) {
+	var keyType string
+	var public []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to marshal public key: %w", err)
+		}
+		keyType, public = "rsa", der
+	case ed25519.PrivateKey:
+		// RFC 8463 publishes the raw 32 byte key
+		keyType, public = "ed25519", key.Public().(ed25519.PublicKey)
+	default:
+		return "", fmt.Errorf("%w: unsupported key type %T", ErrInvalidKey, key)
+	}
+	return "v=DKIM1; k=" + keyType + "; p=" + base64.StdEncoding.EncodeToString(public), nil
+}
+
+// RecordName returns the DNS name a key's TXT record is published under
+func RecordName(selector, domain string) string {
+	return selector + "._domainkey." + domain
+}
+
+// DNSRecord returns the DNS name and TXT record of a stored key
+func DNSRecord(key *models.DKIMKey) (name, value string, err error) {
+	signer, err := ParsePrivateKey(key.PrivateKey)
+	if err != nil {
+		return "", "", err
+	}
+	value, err = TXTRecord(signer)
+	if err != nil {
+		return "", "", err
+	}
+	return RecordName(key.Selector, key.Domain), value, nil
+}
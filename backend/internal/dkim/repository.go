@@ -0,0 +1,135 @@
+package dkim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrKeyNotFound is returned when a DKIM key does not exist
+var ErrKeyNotFound = errors.New("dkim key not found")
+
+// Repository defines the DKIM key repository interface
+type Repository interface {
+	CreateKey(ctx context.Context, key *models.DKIMKey) error
+	GetKey(ctx context.Context, id uuid.UUID) (*models.DKIMKey, error)
+	ListKeys(ctx context.Context, clientID *uuid.UUID) ([]models.DKIMKey, error)
+	ListDomainKeys(ctx context.Context, domain string) ([]models.DKIMKey, error)
+	GetActiveKey(ctx context.Context, domain string) (*models.DKIMKey, error)
+	ActivateKey(ctx context.Context, key *models.DKIMKey) error
+	DeleteKey(ctx context.Context, id uuid.UUID) error
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a new DKIM key repository
+func NewRepository() Repository {
+	return &repository{
+		db: db.DB,
+	}
+}
+
+// CreateKey stores a new key
+func (r *repository) CreateKey(ctx context.Context, key *models.DKIMKey) error {
+	if err := r.db.WithContext(ctx).Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create dkim key: %w", err)
+	}
+	return nil
+}
+
+// GetKey retrieves a key by ID
+func (r *repository) GetKey(ctx context.Context, id uuid.UUID) (*models.DKIMKey, error) {
+	var key models.DKIMKey
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get dkim key: %w", err)
+	}
+	return &key, nil
+}
+
+// ListKeys returns the keys of a client, or of every client when clientID is nil
+func (r *repository) ListKeys(ctx context.Context, clientID *uuid.UUID) ([]models.DKIMKey, error) {
+	query := r.db.WithContext(ctx).Order("domain ASC, created_at ASC")
+	if clientID != nil {
+		query = query.Where("client_id = ?", *clientID)
+	}
+
+	var keys []models.DKIMKey
+	if err := query.Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list dkim keys: %w", err)
+	}
+	return keys, nil
+}
+
+// ListDomainKeys returns every key of a domain
+func (r *repository) ListDomainKeys(ctx context.Context, domain string) ([]models.DKIMKey, error) {
+	var keys []models.DKIMKey
+	if err := r.db.WithContext(ctx).
+		Where("domain = ?", domain).
+		Order("created_at ASC").
+		Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list dkim keys of domain: %w", err)
+	}
+	return keys, nil
+}
+
+// GetActiveKey returns the key a domain's mail is signed with
+func (r *repository) GetActiveKey(ctx context.Context, domain string) (*models.DKIMKey, error) {
+	var key models.DKIMKey
+	if err := r.db.WithContext(ctx).Where("domain = ? AND active = ?", domain, true).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get active dkim key: %w", err)
+	}
+	return &key, nil
+}
+
+// ActivateKey makes key the active key of its domain, stores its VerifiedAt
+// and deactivates the other keys of the domain
+func (r *repository) ActivateKey(ctx context.Context, key *models.DKIMKey) error {
+	now := time.Now()
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.DKIMKey{}).
+			Where("domain = ? AND id <> ? AND active = ?", key.Domain, key.ID, true).
+			Updates(map[string]interface{}{"active": false, "updated_at": now}).Error; err != nil {
+			return fmt.Errorf("failed to deactivate dkim keys: %w", err)
+		}
+
+		result := tx.Model(&models.DKIMKey{}).
+			Where("id = ?", key.ID).
+			Updates(map[string]interface{}{"active": true, "verified_at": key.VerifiedAt, "updated_at": now})
+		if result.Error != nil {
+			return fmt.Errorf("failed to activate dkim key: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrKeyNotFound
+		}
+		key.Active = true
+		key.UpdatedAt = now
+		return nil
+	})
+}
+
+// DeleteKey deletes a key
+func (r *repository) DeleteKey(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.DKIMKey{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete dkim key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package dkim
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrDomainTaken is returned when another client has a verified key for a domain
+var ErrDomainTaken = errors.New("domain belongs to another client")
+
+// ErrRecordNotPublished is returned when a key is activated before its DNS
+// record is published
+var ErrRecordNotPublished = errors.New("dkim record is not published")
+
+// dnsTimeout bounds the TXT lookup of a key's record
+const dnsTimeout = 5 * time.Second
+
+// labelPattern matches one DNS label of a domain or selector
+var labelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Service defines the DKIM key service interface
+// Methods taking a clientID only see that client's keys; a nil clientID
+// (admins) sees every client.
+type Service interface {
+	CreateKey(ctx context.Context, clientID uuid.UUID, req *KeyRequest) (*models.DKIMKey, error)
+	ListKeys(ctx context.Context, clientID *uuid.UUID) ([]models.DKIMKey, error)
+	GetKey(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.DKIMKey, error)
+	ActivateKey(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.DKIMKey, error)
+	DeleteKey(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) error
+}
+
+// KeyRequest holds the fields of a key to create
+// A key is generated unless PrivateKey is set.
+type KeyRequest struct {
+	Domain     string `json:"domain"`
+	Selector   string `json:"selector"`
+	Algorithm  string `json:"algorithm"`   // rsa-sha256 (default) or ed25519-sha256, ignored on import
+	PrivateKey string `json:"private_key"` // PEM key to import
+}
+
+type service struct {
+	repo      Repository
+	lookupTXT func(ctx context.Context, name string) ([]string, error)
+}
+
+// NewService creates a new DKIM key service
+func NewService(repo Repository) Service {
+	return &service{
+		repo:      repo,
+		lookupTXT: net.DefaultResolver.LookupTXT,
+	}
+}
+
+// CreateKey generates or imports a key for a domain of the client
+// Keys are created inactive; ActivateKey checks that their DNS record is
+// published first. A domain whose key another client verified is refused.
+func (s *service) CreateKey(ctx context.Context, clientID uuid.UUID, req *KeyRequest) (*models.DKIMKey, error) {
+	domain := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(req.Domain), "."))
+	selector := strings.ToLower(strings.TrimSpace(req.Selector))
+	if !validName(domain) || !strings.Contains(domain, ".") {
+		return nil, fmt.Errorf("%w: invalid domain %q", ErrInvalidKey, req.Domain)
+	}
+	if !validName(selector) {
+		return nil, fmt.Errorf("%w: invalid selector %q", ErrInvalidKey, req.Selector)
+	}
+
+	existing, err := s.repo.ListDomainKeys(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if ownedByOther(existing, clientID) {
+		return nil, ErrDomainTaken
+	}
+	for _, key := range existing {
+		if key.Selector == selector {
+			return nil, fmt.Errorf("%w: selector %q is already used by %s", ErrInvalidKey, selector, domain)
+		}
+	}
+
+	var signer crypto.Signer
+	if req.PrivateKey != "" {
+		signer, err = ParsePrivateKey(req.PrivateKey)
+	} else {
+		algorithm := req.Algorithm
+		if algorithm == "" {
+			algorithm = AlgorithmRSA
+		}
+		signer, err = GenerateKey(algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	algorithm, err := KeyAlgorithm(signer)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := MarshalPrivateKey(signer)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &models.DKIMKey{
+		ID:         uuid.New(),
+		ClientID:   clientID,
+		Domain:     domain,
+		Selector:   selector,
+		Algorithm:  algorithm,
+		PrivateKey: privateKey,
+	}
+	if err := s.repo.CreateKey(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListKeys returns the keys visible to clientID
+func (s *service) ListKeys(ctx context.Context, clientID *uuid.UUID) ([]models.DKIMKey, error) {
+	return s.repo.ListKeys(ctx, clientID)
+}
+
+// GetKey returns a key; keys of other clients are reported as not found
+func (s *service) GetKey(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.DKIMKey, error) {
+	key, err := s.repo.GetKey(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if clientID != nil && key.ClientID != *clientID {
+		return nil, ErrKeyNotFound
+	}
+	return key, nil
+}
+
+// ActivateKey rotates a domain to key once its DNS record is published; the
+// previously active key stays stored, inactive, until it is deleted
+// Publishing the record proves control of the domain, so the first verified
+// key makes the domain its client's.
+func (s *service) ActivateKey(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.DKIMKey, error) {
+	key, err := s.GetKey(ctx, id, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if key.Active {
+		return key, nil
+	}
+
+	if err := s.verifyRecord(ctx, key); err != nil {
+		return nil, err
+	}
+	existing, err := s.repo.ListDomainKeys(ctx, key.Domain)
+	if err != nil {
+		return nil, err
+	}
+	if ownedByOther(existing, key.ClientID) {
+		return nil, ErrDomainTaken
+	}
+
+	now := time.Now()
+	if key.VerifiedAt == nil {
+		key.VerifiedAt = &now
+	}
+	key.UpdatedAt = now
+	if err := s.repo.ActivateKey(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// DeleteKey deletes a key; deleting the active key leaves the domain unsigned
+func (s *service) DeleteKey(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) error {
+	if _, err := s.GetKey(ctx, id, clientID); err != nil {
+		return err
+	}
+	return s.repo.DeleteKey(ctx, id)
+}
+
+// verifyRecord checks that a TXT record with the public key of key is
+// published under its DNS name
+func (s *service) verifyRecord(ctx context.Context, key *models.DKIMKey) error {
+	name, record, err := DNSRecord(key)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, dnsTimeout)
+	defer cancel()
+	published, err := s.lookupTXT(ctx, name)
+	if err != nil {
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			return fmt.Errorf("%w: no TXT record at %s", ErrRecordNotPublished, name)
+		}
+		return fmt.Errorf("failed to look up %s: %w", name, err)
+	}
+
+	want := recordTag(record, "p")
+	for _, txt := range published {
+		if recordTag(txt, "p") == want {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: the TXT record at %s does not hold the key", ErrRecordNotPublished, name)
+}
+
+// recordTag returns the value of a tag of a DKIM TXT record without whitespace
+func recordTag(record, name string) string {
+	for _, tag := range strings.Split(record, ";") {
+		tagName, value, ok := strings.Cut(tag, "=")
+		if ok && strings.TrimSpace(tagName) == name {
+			return strings.Join(strings.Fields(value), "")
+		}
+	}
+	return ""
+}
+
+// ownedByOther reports whether a client other than clientID has a verified key among keys
+func ownedByOther(keys []models.DKIMKey, clientID uuid.UUID) bool {
+	for _, key := range keys {
+		if key.ClientID != clientID && key.VerifiedAt != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// validName reports whether name is a dot separated list of DNS labels
+func validName(name string) bool {
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !labelPattern.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
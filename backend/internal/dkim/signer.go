@@ -0,0 +1,128 @@
+package dkim
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	netmail "net/mail"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MessageSigner signs built MIME messages on behalf of the client sending
+// them; *KeySigner implements it
+type MessageSigner interface {
+	SignMessage(ctx context.Context, clientID *uuid.UUID, raw []byte) ([]byte, error)
+}
+
+// keyCacheTTL is how long a domain's active key is cached, and so how long
+// an activation takes to reach every sender
+const keyCacheTTL = time.Minute
+
+// cachedKey is the active key of a domain, or nil when it has none
+type cachedKey struct {
+	clientID uuid.UUID
+	selector string
+	signer   crypto.Signer
+	expires  time.Time
+}
+
+// KeySigner signs messages with the active key of their From domain
+type KeySigner struct {
+	repo  Repository
+	ttl   time.Duration
+	now   func() time.Time
+	mu    sync.Mutex
+	cache map[string]cachedKey
+}
+
+// NewKeySigner creates a KeySigner reading keys from repo
+func NewKeySigner(repo Repository) *KeySigner {
+	return &KeySigner{
+		repo:  repo,
+		ttl:   keyCacheTTL,
+		now:   time.Now,
+		cache: make(map[string]cachedKey),
+	}
+}
+
+// SignMessage returns raw with a DKIM-Signature header when the domain of its
+// From address has an active key of clientID, and raw unchanged otherwise
+// Mail of other clients, or without a client, is never signed with a
+// domain's key, so a client cannot send signed mail as someone else's domain.
+func (s *KeySigner) SignMessage(ctx context.Context, clientID *uuid.UUID, raw []byte) ([]byte, error) {
+	if clientID == nil {
+		return raw, nil
+	}
+	domain, err := fromDomain(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.activeKey(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if key.signer == nil || key.clientID != *clientID {
+		return raw, nil
+	}
+
+	return Sign(raw, Options{
+		Domain:   domain,
+		Selector: key.selector,
+		Key:      key.signer,
+		Time:     s.now(),
+	})
+}
+
+// activeKey returns the cached active key of domain, loading it when missing or expired
+func (s *KeySigner) activeKey(ctx context.Context, domain string) (cachedKey, error) {
+	now := s.now()
+	s.mu.Lock()
+	key, ok := s.cache[domain]
+	s.mu.Unlock()
+	if ok && now.Before(key.expires) {
+		return key, nil
+	}
+
+	key = cachedKey{expires: now.Add(s.ttl)}
+	stored, err := s.repo.GetActiveKey(ctx, domain)
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+	case err != nil:
+		return cachedKey{}, err
+	default:
+		if key.signer, err = ParsePrivateKey(stored.PrivateKey); err != nil {
+			return cachedKey{}, fmt.Errorf("dkim key %s: %w", stored.ID, err)
+		}
+		key.clientID = stored.ClientID
+		key.selector = stored.Selector
+	}
+
+	s.mu.Lock()
+	s.cache[domain] = key
+	s.mu.Unlock()
+	return key, nil
+}
+
+// fromDomain returns the lower-cased domain of the From address of a message
+func fromDomain(raw []byte) (string, error) {
+	msg, err := netmail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", fmt.Errorf("dkim: failed to parse message: %w", err)
+	}
+	from, err := netmail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return "", fmt.Errorf("dkim: invalid From header: %w", err)
+	}
+	at := strings.LastIndexByte(from.Address, '@')
+	if at < 0 {
+		return "", fmt.Errorf("dkim: invalid From address %q", from.Address)
+	}
+	return strings.ToLower(from.Address[at+1:]), nil
+}
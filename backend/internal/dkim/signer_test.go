@@ -0,0 +1,147 @@
+package dkim
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// publishedRecords returns the DNS records of every key in repo
+func publishedRecords(t *testing.T, repo *mockRepository) map[string]string {
+	t.Helper()
+	keys, _ := repo.ListKeys(context.Background(), nil)
+	records := make(map[string]string)
+	for i := range keys {
+		name, value, err := DNSRecord(&keys[i])
+		if err != nil {
+			t.Fatalf("DNSRecord() error = %v", err)
+		}
+		records[name] = value
+	}
+	return records
+}
+
+// signedSelector signs testMessage for clientID and returns the selector of the verified signature
+func signedSelector(t *testing.T, signer *KeySigner, repo *mockRepository, clientID uuid.UUID) string {
+	t.Helper()
+	signed, err := signer.SignMessage(context.Background(), &clientID, []byte(testMessage))
+	if err != nil {
+		t.Fatalf("SignMessage() error = %v", err)
+	}
+	verifications := localVerify(t, signed, publishedRecords(t, repo))
+	if len(verifications) != 1 || verifications[0].Err != nil {
+		t.Fatalf("signature did not verify: %+v", verifications)
+	}
+	field := string(signed[:bytes.IndexByte(signed, '\n')])
+	for _, selector := range []string{"s1", "s2"} {
+		if bytes.Contains([]byte(field), []byte("s="+selector+";")) {
+			return selector
+		}
+	}
+	t.Fatalf("no known selector in %q", field)
+	return ""
+}
+
+func TestKeySigner_LeavesMessagesOfDomainsWithoutKeysUnsigned(t *testing.T) {
+	signer := NewKeySigner(newMockRepository())
+	clientID := uuid.New()
+
+	signed, err := signer.SignMessage(context.Background(), &clientID, []byte(testMessage))
+	if err != nil {
+		t.Fatalf("SignMessage() error = %v", err)
+	}
+	if string(signed) != testMessage {
+		t.Errorf("message without key was changed:\n%s", signed)
+	}
+}
+
+func TestKeySigner_SignsWithActiveKeyAndFollowsRotation(t *testing.T) {
+	repo := newMockRepository()
+	dns := fakeDNS{}
+	svc := newTestService(repo, dns)
+	clientID := uuid.New()
+	createActiveKey(t, svc, dns, clientID, &KeyRequest{Domain: "example.com", Selector: "s1"})
+	next, err := svc.CreateKey(context.Background(), clientID, &KeyRequest{Domain: "example.com", Selector: "s2", Algorithm: AlgorithmEd25519})
+	if err != nil {
+		t.Fatalf("CreateKey() error = %v", err)
+	}
+	dns.publish(t, next)
+
+	now := time.Now()
+	signer := NewKeySigner(repo)
+	signer.now = func() time.Time { return now }
+
+	if got := signedSelector(t, signer, repo, clientID); got != "s1" {
+		t.Errorf("selector = %s, want s1", got)
+	}
+
+	// The cached key is used until it expires
+	if _, err := svc.ActivateKey(context.Background(), next.ID, &clientID); err != nil {
+		t.Fatalf("ActivateKey() error = %v", err)
+	}
+	if got := signedSelector(t, signer, repo, clientID); got != "s1" {
+		t.Errorf("selector = %s, want cached s1", got)
+	}
+	if repo.gets != 1 {
+		t.Errorf("GetActiveKey called %d times, want 1", repo.gets)
+	}
+
+	now = now.Add(keyCacheTTL)
+	if got := signedSelector(t, signer, repo, clientID); got != "s2" {
+		t.Errorf("selector = %s, want s2 after rotation", got)
+	}
+}
+
+func TestKeySigner_MatchesFromDomainCaseInsensitively(t *testing.T) {
+	repo := newMockRepository()
+	dns := fakeDNS{}
+	clientID := uuid.New()
+	createActiveKey(t, newTestService(repo, dns), dns, clientID, &KeyRequest{Domain: "example.com", Selector: "s1", Algorithm: AlgorithmEd25519})
+
+	message := bytes.Replace([]byte(testMessage), []byte("sender@example.com"), []byte("Sender@EXAMPLE.com"), 1)
+	signed, err := NewKeySigner(repo).SignMessage(context.Background(), &clientID, message)
+	if err != nil {
+		t.Fatalf("SignMessage() error = %v", err)
+	}
+	verifications := localVerify(t, signed, publishedRecords(t, repo))
+	if len(verifications) != 1 || verifications[0].Err != nil {
+		t.Fatalf("signature did not verify: %+v", verifications)
+	}
+}
+
+func TestKeySigner_SignsOnlyForTheKeysClient(t *testing.T) {
+	repo := newMockRepository()
+	dns := fakeDNS{}
+	createActiveKey(t, newTestService(repo, dns), dns, uuid.New(), &KeyRequest{Domain: "example.com", Selector: "s1", Algorithm: AlgorithmEd25519})
+	signer := NewKeySigner(repo)
+
+	other := uuid.New()
+	for name, clientID := range map[string]*uuid.UUID{"another client": &other, "no client": nil} {
+		signed, err := signer.SignMessage(context.Background(), clientID, []byte(testMessage))
+		if err != nil {
+			t.Fatalf("SignMessage() for %s error = %v", name, err)
+		}
+		if string(signed) != testMessage {
+			t.Errorf("message of %s was signed:\n%s", name, signed)
+		}
+	}
+}
+
+func TestKeySigner_ReportsInvalidMessagesAndKeys(t *testing.T) {
+	repo := newMockRepository()
+	clientID := uuid.New()
+	repo.keys[uuid.New()] = &models.DKIMKey{ClientID: clientID, Domain: "example.com", Selector: "s1", PrivateKey: "corrupt", Active: true}
+	signer := NewKeySigner(repo)
+
+	if _, err := signer.SignMessage(context.Background(), &clientID, []byte("To: a@example.org\r\n\r\nbody\r\n")); err == nil {
+		t.Error("SignMessage() without From error = nil")
+	}
+	if _, err := signer.SignMessage(context.Background(), &clientID, []byte(testMessage)); err == nil {
+		t.Error("SignMessage() with a corrupt key error = nil")
+	}
+}
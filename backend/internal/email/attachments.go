@@ -0,0 +1,60 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+
+	"backend/internal/mimemsg"
+)
+
+// Attachment is a file attached to an email, or an inline part its HTML
+// references as cid:<ContentID>. Content is base64 encoded in JSON.
+type Attachment = mimemsg.Attachment
+
+// Attachment size limits; SES accepts messages up to 40 MB after encoding
+const (
+	MaxAttachmentSize      = 10 << 20 // bytes per attachment or inline part
+	MaxTotalAttachmentSize = 25 << 20 // bytes across all attachments and inline parts of an email
+	MaxAttachments         = 20       // attachments and inline parts per email
+)
+
+// MaxSendRequestSize is the body limit that lets POST /emails/send carry
+// base64 attachments up to MaxTotalAttachmentSize next to the HTML and text bodies
+const MaxSendRequestSize = MaxTotalAttachmentSize*4/3 + 4<<20
+
+// ErrAttachmentTooLarge is returned when attachments exceed the size limits
+var ErrAttachmentTooLarge = errors.New("attachment too large")
+
+// ValidateAttachments checks the size limits of the attachments and inline
+// parts of an email; inline parts also need a Content-ID
+func ValidateAttachments(attachments, inline []Attachment) error {
+	if len(attachments)+len(inline) > MaxAttachments {
+		return fmt.Errorf("at most %d attachments and inline parts are allowed", MaxAttachments)
+	}
+
+	total := 0
+	for _, list := range [][]Attachment{attachments, inline} {
+		for _, a := range list {
+			if a.Filename == "" {
+				return fmt.Errorf("attachment filename is required")
+			}
+			if len(a.Content) == 0 {
+				return fmt.Errorf("attachment %s is empty", a.Filename)
+			}
+			if len(a.Content) > MaxAttachmentSize {
+				return fmt.Errorf("%w: %s exceeds %d MB", ErrAttachmentTooLarge, a.Filename, MaxAttachmentSize>>20)
+			}
+			total += len(a.Content)
+		}
+	}
+	for _, a := range inline {
+		if a.ContentID == "" {
+			return fmt.Errorf("inline part %s needs a content_id", a.Filename)
+		}
+	}
+	if total > MaxTotalAttachmentSize {
+		return fmt.Errorf("%w: attachments exceed %d MB in total", ErrAttachmentTooLarge, MaxTotalAttachmentSize>>20)
+	}
+
+	return nil
+}
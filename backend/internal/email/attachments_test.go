@@ -0,0 +1,91 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestValidateAttachments(t *testing.T) {
+	small := []byte("data")
+	tests := []struct {
+		name        string
+		attachments []Attachment
+		inline      []Attachment
+		tooLarge    bool
+		valid       bool
+	}{
+		{"None", nil, nil, false, true},
+		{"Attachment and inline image", []Attachment{{Filename: "a.pdf", Content: small}}, []Attachment{{Filename: "logo.png", Content: small, ContentID: "logo"}}, false, true},
+		{"Missing filename", []Attachment{{Content: small}}, nil, false, false},
+		{"Empty content", []Attachment{{Filename: "a.pdf"}}, nil, false, false},
+		{"Inline without content ID", nil, []Attachment{{Filename: "logo.png", Content: small}}, false, false},
+		{"Attachment too large", []Attachment{{Filename: "big.bin", Content: make([]byte, MaxAttachmentSize+1)}}, nil, true, false},
+		{"Total too large", []Attachment{
+			{Filename: "1.bin", Content: make([]byte, MaxAttachmentSize)},
+			{Filename: "2.bin", Content: make([]byte, MaxAttachmentSize)},
+			{Filename: "3.bin", Content: make([]byte, MaxAttachmentSize)},
+		}, nil, true, false},
+		{"Too many", make([]Attachment, MaxAttachments+1), nil, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateAttachments(tt.attachments, tt.inline)
+			if (err == nil) != tt.valid {
+				t.Fatalf("ValidateAttachments() error = %v, want valid=%v", err, tt.valid)
+			}
+			if errors.Is(err, ErrAttachmentTooLarge) != tt.tooLarge {
+				t.Errorf("ValidateAttachments() error = %v, want ErrAttachmentTooLarge=%v", err, tt.tooLarge)
+			}
+		})
+	}
+}
+
+// recordingSender records the messages it sends
+type recordingSender struct {
+	messages []EmailMessage
+}
+
+func (s *recordingSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	s.messages = append(s.messages, msg)
+	return nil
+}
+
+func TestQueue_SendsAttachments(t *testing.T) {
+	sender := &recordingSender{}
+	q := NewQueue(1, sender, newMockEmailRepository(), nil)
+
+	job := SendEmailJob{
+		EmailRecord: &models.EmailMessageRecord{ID: uuid.New(), MessageID: "<test@example.com>"},
+		From:        "sender@example.com",
+		To:          "user@example.com",
+		Subject:     "Invoice",
+		HTMLBody:    `<img src="cid:logo">`,
+		Attachments: []Attachment{{Filename: "invoice.pdf", Content: []byte("%PDF")}},
+		Inline:      []Attachment{{Filename: "logo.png", Content: []byte("png"), ContentID: "logo"}},
+	}
+	q.processJob(job, 0)
+
+	if len(sender.messages) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(sender.messages))
+	}
+	raw, err := buildMIMEEmail(sender.messages[0])
+	if err != nil {
+		t.Fatalf("Failed to build MIME email: %v", err)
+	}
+	for _, want := range []string{"multipart/mixed", "multipart/related", "Content-ID: <logo>", "filename=invoice.pdf"} {
+		if !bytes.Contains(raw, []byte(want)) {
+			t.Errorf("MIME email missing %q", want)
+		}
+	}
+	if !strings.Contains(string(raw), "Message-ID: <test@example.com>") {
+		t.Error("MIME email missing the job's Message-ID")
+	}
+}
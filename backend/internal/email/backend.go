@@ -0,0 +1,48 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"backend/internal/dkim"
+)
+
+// NewSender returns the email sender of an EMAIL_SENDER backend
+// SMTP senders DKIM-sign with signer; SES signs with its own Easy DKIM.
+func NewSender(ctx context.Context, backend string, signer dkim.MessageSigner) (EmailSender, error) {
+	switch backend {
+	case "ses":
+		sesCfg, err := NewSESConfigFromEnv()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SES config: %w", err)
+		}
+		sender, err := NewSESSender(ctx, sesCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SES sender: %w", err)
+		}
+		return sender, nil
+	case "smtp":
+		smtpCfg, err := NewSmtpConfigFromEnv()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SMTP config: %w", err)
+		}
+		sender := NewSmtpSender(smtpCfg)
+		sender.SetSigner(signer)
+		return sender, nil
+	case "routing":
+		routingCfg, err := LoadRoutingConfig(os.Getenv("EMAIL_ROUTING_FILE"))
+		if err != nil {
+			return nil, err
+		}
+		sender, err := NewRoutingSenderFromConfig(ctx, routingCfg, signer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create routing sender: %w", err)
+		}
+		return sender, nil
+	case "dummy":
+		return NewDummySender(), nil
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_SENDER %q (expected smtp, ses, routing or dummy)", backend)
+	}
+}
@@ -1,6 +1,7 @@
 package email
 
 import (
+	"context"
 	"log"
 )
 
@@ -17,3 +18,22 @@ func (d *DummyMailer) SendEmail(to, subject, htmlBody, from string) error {
 	log.Printf("[DUMMY EMAIL] To: %s | Subject: %s | From: %s", to, subject, from)
 	return nil
 }
+
+// DummySender adapts a DummyMailer to EmailSender
+type DummySender struct {
+	mailer *DummyMailer
+}
+
+// NewDummySender creates an EmailSender that only logs emails
+func NewDummySender() *DummySender {
+	return &DummySender{mailer: NewDummyMailer()}
+}
+
+// SendEmail logs msg through the DummyMailer
+func (s *DummySender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	body := msg.HTMLBody
+	if body == "" {
+		body = msg.TextBody
+	}
+	return s.mailer.SendEmail(msg.To, msg.Subject, body, msg.From)
+}
@@ -0,0 +1,236 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"regexp"
+
+	"backend/internal/smtppool"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/smithy-go"
+)
+
+// SMTP protocol steps reported in SMTPError.Op
+const (
+	SMTPOpConnect  = smtppool.OpConnect
+	SMTPOpStartTLS = smtppool.OpStartTLS
+	SMTPOpAuth     = smtppool.OpAuth
+	SMTPOpMail     = smtppool.OpMail
+	SMTPOpRcpt     = smtppool.OpRcpt
+	SMTPOpData     = smtppool.OpData
+	SMTPOpWrite    = smtppool.OpWrite
+	SMTPOpClose    = smtppool.OpClose
+)
+
+// enhancedStatusPattern matches an RFC 3463 enhanced status code at the start of a reply
+var enhancedStatusPattern = regexp.MustCompile(`^([245]\.\d{1,3}\.\d{1,3})\s*`)
+
+// SMTPError is returned by the SMTP senders when a protocol step fails
+// Code is 0 when the failure happened below SMTP (DNS, TCP, TLS, timeouts).
+type SMTPError struct {
+	Op           string // protocol step, see SMTPOp* constants
+	Code         int    // SMTP reply code, e.g. 421 or 550
+	EnhancedCode string // RFC 3463 enhanced status code, e.g. "5.1.1"
+	Message      string // server reply text without the enhanced code
+	Err          error  // underlying error
+}
+
+// NewSMTPError wraps err from the given protocol step, extracting the reply codes
+func NewSMTPError(op string, err error) *SMTPError {
+	smtpErr := &SMTPError{
+		Op:      op,
+		Message: err.Error(),
+		Err:     err,
+	}
+
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) {
+		smtpErr.Code = protoErr.Code
+		smtpErr.Message = protoErr.Msg
+		if m := enhancedStatusPattern.FindStringSubmatch(protoErr.Msg); m != nil {
+			smtpErr.EnhancedCode = m[1]
+			smtpErr.Message = protoErr.Msg[len(m[0]):]
+		}
+	}
+
+	return smtpErr
+}
+
+// fromPoolError converts a *smtppool.Error returned by the connection pool to
+// an *SMTPError; other errors are returned as is
+func fromPoolError(err error) error {
+	var poolErr *smtppool.Error
+	if errors.As(err, &poolErr) {
+		return NewSMTPError(poolErr.Op, poolErr.Err)
+	}
+	return err
+}
+
+// Error implements the error interface
+func (e *SMTPError) Error() string {
+	if e.Code == 0 {
+		return fmt.Sprintf("smtp %s: %v", e.Op, e.Err)
+	}
+	if e.EnhancedCode != "" {
+		return fmt.Sprintf("smtp %s: %d %s %s", e.Op, e.Code, e.EnhancedCode, e.Message)
+	}
+	return fmt.Sprintf("smtp %s: %d %s", e.Op, e.Code, e.Message)
+}
+
+// Unwrap returns the underlying error
+func (e *SMTPError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether retrying the send later may succeed:
+// 4xx replies and network failures are transient, 5xx are not. Other failures
+// without a reply code (certificate verification, unsupported AUTH mechanisms,
+// configuration errors) do not go away on their own.
+func (e *SMTPError) Temporary() bool {
+	if e.Code == 0 {
+		return networkError(e.Err)
+	}
+	return e.Code >= 400 && e.Code < 500
+}
+
+// networkError reports whether err is a network failure: DNS, TCP, timeouts or
+// a dropped connection, but not a rejected certificate
+func networkError(err error) bool {
+	var certErr *tls.CertificateVerificationError
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &certErr) || errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &invalidErr) {
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// sesTransientCodes are SES error codes that clear up on their own
+var sesTransientCodes = map[string]bool{
+	"TooManyRequestsException": true,
+	"LimitExceededException":   true,
+	"Throttling":               true,
+	"ThrottlingException":      true,
+}
+
+// SESError is returned by SESSender when an SES API call fails
+// StatusCode is 0 when no response was received (DNS, TCP, TLS, timeouts).
+type SESError struct {
+	Code       string // SES error code, e.g. MessageRejected
+	StatusCode int    // HTTP status of the API response
+	Message    string // error message without the code
+	Err        error  // underlying error
+}
+
+// NewSESError wraps an SES API error, extracting the error code and HTTP status
+func NewSESError(err error) *SESError {
+	sesErr := &SESError{
+		Message: err.Error(),
+		Err:     err,
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		sesErr.Code = apiErr.ErrorCode()
+		sesErr.Message = apiErr.ErrorMessage()
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		sesErr.StatusCode = respErr.HTTPStatusCode()
+	}
+
+	return sesErr
+}
+
+// Error implements the error interface
+func (e *SESError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("ses: %v", e.Err)
+	}
+	return fmt.Sprintf("ses: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Unwrap returns the underlying error
+func (e *SESError) Unwrap() error {
+	return e.Err
+}
+
+// Temporary reports whether retrying the send later may succeed:
+// throttling and 5xx responses are transient, other 4xx responses are not.
+func (e *SESError) Temporary() bool {
+	if e.StatusCode == 0 {
+		return IsTransient(e.Err)
+	}
+	return sesTransientCodes[e.Code] || e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// IsTransient reports whether err is worth retrying
+// Errors that are not SMTP, network or timeout errors (e.g. validation) are permanent.
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var smtpErr *SMTPError
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Temporary()
+	}
+
+	var sesErr *SESError
+	if errors.As(err, &sesErr) {
+		return sesErr.Temporary()
+	}
+
+	return networkError(err) || errors.Is(err, ErrNoProviderAvailable)
+}
+
+// smtpErrorMeta describes err for the meta column of an email event
+func smtpErrorMeta(err error) map[string]interface{} {
+	meta := map[string]interface{}{
+		"error":     err.Error(),
+		"transient": IsTransient(err),
+	}
+
+	var smtpErr *SMTPError
+	if errors.As(err, &smtpErr) {
+		meta["smtp_op"] = smtpErr.Op
+		if smtpErr.Code != 0 {
+			meta["smtp_code"] = smtpErr.Code
+		}
+		if smtpErr.EnhancedCode != "" {
+			meta["enhanced_status"] = smtpErr.EnhancedCode
+		}
+	}
+
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		meta["provider"] = providerErr.Provider
+	}
+
+	var sesErr *SESError
+	if errors.As(err, &sesErr) {
+		if sesErr.Code != "" {
+			meta["ses_error_code"] = sesErr.Code
+		}
+		if sesErr.StatusCode != 0 {
+			meta["http_status"] = sesErr.StatusCode
+		}
+	}
+
+	return meta
+}
@@ -0,0 +1,125 @@
+package email
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"backend/internal/smtppool"
+)
+
+func TestNewSMTPError_ParsesReplyCodes(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		code         int
+		enhancedCode string
+		message      string
+		transient    bool
+	}{
+		{"Greylisting", &textproto.Error{Code: 421, Msg: "4.7.0 Try again later"}, 421, "4.7.0", "Try again later", true},
+		{"Mailbox full", &textproto.Error{Code: 452, Msg: "4.2.2 Mailbox full"}, 452, "4.2.2", "Mailbox full", true},
+		{"No such user", &textproto.Error{Code: 550, Msg: "5.1.1 No such user"}, 550, "5.1.1", "No such user", false},
+		{"No enhanced code", &textproto.Error{Code: 554, Msg: "Transaction failed"}, 554, "", "Transaction failed", false},
+		{"Wrapped reply", fmt.Errorf("rcpt: %w", &textproto.Error{Code: 451, Msg: "4.3.0 Local error"}), 451, "4.3.0", "Local error", true},
+		{"Network error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, 0, "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			smtpErr := NewSMTPError(SMTPOpRcpt, tt.err)
+
+			if smtpErr.Code != tt.code {
+				t.Errorf("expected code %d, got %d", tt.code, smtpErr.Code)
+			}
+			if smtpErr.EnhancedCode != tt.enhancedCode {
+				t.Errorf("expected enhanced code %q, got %q", tt.enhancedCode, smtpErr.EnhancedCode)
+			}
+			if tt.message != "" && smtpErr.Message != tt.message {
+				t.Errorf("expected message %q, got %q", tt.message, smtpErr.Message)
+			}
+			if IsTransient(smtpErr) != tt.transient {
+				t.Errorf("expected transient=%v for %v", tt.transient, smtpErr)
+			}
+			if !errors.Is(smtpErr, tt.err) {
+				t.Error("expected SMTPError to unwrap to the original error")
+			}
+		})
+	}
+}
+
+func TestFromPoolError(t *testing.T) {
+	reply := &textproto.Error{Code: 550, Msg: "5.1.1 No such user"}
+	err := fromPoolError(&smtppool.Error{Op: smtppool.OpRcpt, Err: reply})
+
+	var smtpErr *SMTPError
+	if !errors.As(err, &smtpErr) {
+		t.Fatalf("expected *SMTPError, got %T", err)
+	}
+	if smtpErr.Op != SMTPOpRcpt || smtpErr.Code != 550 || smtpErr.EnhancedCode != "5.1.1" {
+		t.Errorf("unexpected SMTPError %+v", smtpErr)
+	}
+
+	if err := fromPoolError(smtppool.ErrPoolClosed); err != smtppool.ErrPoolClosed {
+		t.Errorf("expected other errors to be returned as is, got %v", err)
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"Nil", nil, false},
+		{"Validation error", errors.New("to address is required"), false},
+		{"Deadline exceeded", context.DeadlineExceeded, true},
+		{"Wrapped SMTP 5xx", fmt.Errorf("send: %w", NewSMTPError(SMTPOpData, &textproto.Error{Code: 552, Msg: "5.3.4 Message too big"})), false},
+		{"Wrapped SMTP 4xx", fmt.Errorf("send: %w", NewSMTPError(SMTPOpMail, &textproto.Error{Code: 450, Msg: "4.1.8 Sender domain unresolved"})), true},
+		{"Dropped connection", NewSMTPError(SMTPOpData, io.EOF), true},
+		{"Connect timeout", NewSMTPError(SMTPOpConnect, &net.OpError{Op: "dial", Net: "tcp", Err: context.DeadlineExceeded}), true},
+		{"Untrusted certificate", NewSMTPError(SMTPOpStartTLS, &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), false},
+		{"Expired certificate", NewSMTPError(SMTPOpConnect, x509.CertificateInvalidError{Reason: x509.Expired}), false},
+		{"No supported AUTH mechanism", NewSMTPError(SMTPOpAuth, errors.New(`no supported AUTH mechanism in "XOAUTH2"`)), false},
+		{"Configuration error", NewSMTPError(SMTPOpConnect, errors.New("failed to read SMTP CA file: no such file")), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsTransient(tt.err); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+
+	tests := []struct {
+		attempt int
+		window  time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{3, 4 * time.Second},
+		{4, 5 * time.Second}, // capped
+		{10, 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		for i := 0; i < 50; i++ {
+			delay := policy.Backoff(tt.attempt)
+			if delay < tt.window/2 || delay > tt.window {
+				t.Fatalf("attempt %d: delay %v outside [%v, %v]", tt.attempt, delay, tt.window/2, tt.window)
+			}
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package email
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
+	"backend/internal/middleware"
+	"backend/internal/mimemsg"
 	"backend/internal/models"
 	"backend/internal/repositories"
 
@@ -16,37 +20,83 @@ import (
 
 // SendEmailHandler handles email sending requests
 type SendEmailHandler struct {
-	queue     *Queue
-	emailRepo repositories.EmailRepository
-	logger    zerolog.Logger
+	queue          *Queue
+	emailRepo      repositories.EmailRepository
+	idempotency    repositories.IdempotencyRepository
+	idempotencyTTL time.Duration
+	// idempotencyLease is how long a reservation holds its key between renewals
+	idempotencyLease time.Duration
+	templates        TemplateSource
+	owners           repositories.OwnershipRepository
+	logger           zerolog.Logger
 }
 
 // NewSendEmailHandler creates a new email sending handler
-func NewSendEmailHandler(queue *Queue, emailRepo repositories.EmailRepository) *SendEmailHandler {
+// Idempotency-Key headers are ignored when idempotency is nil.
+func NewSendEmailHandler(queue *Queue, emailRepo repositories.EmailRepository, idempotency repositories.IdempotencyRepository) *SendEmailHandler {
 	return &SendEmailHandler{
-		queue:     queue,
-		emailRepo: emailRepo,
-		logger:    zerolog.New(os.Stdout).With().Timestamp().Logger(),
+		queue:            queue,
+		emailRepo:        emailRepo,
+		idempotency:      idempotency,
+		idempotencyTTL:   DefaultIdempotencyTTL,
+		idempotencyLease: defaultIdempotencyLease,
+		logger:           zerolog.New(os.Stdout).With().Timestamp().Logger(),
 	}
 }
 
+// SetOwners sets the repository that checks campaign_id and contact_id belong
+// to the sending client
+func (h *SendEmailHandler) SetOwners(owners repositories.OwnershipRepository) {
+	h.owners = owners
+}
+
 // SendEmailRequest represents the request body
 type SendEmailRequest struct {
-	From   string   `json:"from"`
-	To     []string `json:"to"`
-	Subject string  `json:"subject"`
-	HTML   string   `json:"html"`
-	Text   string   `json:"text"`
+	From       string   `json:"from"`
+	To         []string `json:"to"`
+	Subject    string   `json:"subject"`
+	HTML       string   `json:"html"`
+	Text       string   `json:"text"`
+	ClientID   string   `json:"client_id,omitempty"`   // admins only; client users send for their own client
+	CampaignID string   `json:"campaign_id,omitempty"` // optional campaign to attribute the email to
+	ContactID  string   `json:"contact_id,omitempty"`  // optional recipient contact, single recipient only
+
+	Attachments []Attachment `json:"attachments,omitempty"` // base64 content, see MaxAttachmentSize
+	Inline      []Attachment `json:"inline,omitempty"`      // images referenced from html as cid:<content_id>
+
+	// Merge data: with either set, merge tags in subject, html and text are
+	// rendered for every recipient, see the mergetags package
+	Recipients []Recipient            `json:"recipients,omitempty"` // sent in addition to to[], each with its own data
+	Data       map[string]interface{} `json:"data,omitempty"`       // shared by all recipients
+
+	// Template rendered for every recipient in place of subject, html and text
+	TemplateID      string `json:"template_id,omitempty"`
+	TemplateVersion int    `json:"template_version,omitempty"` // 0 for the latest version
+
+	InlineCSS bool `json:"inline_css,omitempty"` // inline <style> rules of html into style attributes
+}
+
+// sendLinks holds the campaign, contact and client an email is attributed to
+type sendLinks struct {
+	CampaignID *uuid.UUID
+	ContactID  *uuid.UUID
+	ClientID   *uuid.UUID
 }
 
 // SendEmailResponse represents the response
+// Status is ok when every recipient was queued, partial when some were and
+// failed when none were; Errors lists the recipients that were not queued.
 type SendEmailResponse struct {
-	Status     string   `json:"status"`
-	Queued     int      `json:"queued"`
-	MessageIDs []string `json:"message_ids"`
+	Status          string           `json:"status"`
+	Queued          int              `json:"queued"`
+	MessageIDs      []string         `json:"message_ids"`
+	Errors          []RecipientError `json:"errors,omitempty"`
+	TemplateVersion int              `json:"template_version,omitempty"` // template version that was rendered
 }
 
 // HandleSendEmail handles POST /emails/send
+// With an Idempotency-Key header a retried request gets the stored response
+// of the first one instead of sending again.
 func (h *SendEmailHandler) HandleSendEmail(c *fiber.Ctx) error {
 	var req SendEmailRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -57,9 +107,53 @@ func (h *SendEmailHandler) HandleSendEmail(c *fiber.Ctx) error {
 
 	// Validate input
 	if err := h.validateRequest(&req); err != nil {
+		status := fiber.StatusBadRequest
+		if errors.Is(err, ErrAttachmentTooLarge) {
+			status = fiber.StatusRequestEntityTooLarge
+		}
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	links, status, err := h.resolveLinks(c, &req)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	template, status, err := h.loadTemplate(c.Context(), &req, links)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	replay, reserved, err := h.reserveIdempotencyKey(c, &req)
+	switch {
+	case errors.Is(err, ErrIdempotencyKeyReused), errors.Is(err, ErrIdempotencyKeyInProgress):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, errInvalidIdempotencyKey):
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": err.Error(),
 		})
+	case err != nil:
+		h.logger.Error().
+			Err(err).
+			Str("event", "email.idempotency.reserve_failed").
+			Msg("Failed to reserve idempotency key")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to process idempotency key",
+		})
+	case replay != nil:
+		return h.replayIdempotentResponse(c, replay)
+	}
+	var hold *idempotencyHold
+	if reserved != nil {
+		hold = h.holdIdempotencyKey(reserved)
 	}
 
 	ctx := c.Context()
@@ -67,49 +161,70 @@ func (h *SendEmailHandler) HandleSendEmail(c *fiber.Ctx) error {
 	queuedCount := 0
 
 	// Process each recipient
-	for _, recipient := range req.To {
+	var recipientErrors []RecipientError
+	for _, recipient := range req.recipients() {
+		// A retry took the key over and sends the request itself
+		if hold.Lost() {
+			recipientErrors = append(recipientErrors, RecipientError{Email: recipient.Email, Error: repositories.ErrIdempotencyKeyLost.Error()})
+			continue
+		}
+		// Render merge tags; a recipient whose data does not fit is skipped
+		content, err := req.render(recipient, template)
+		if err != nil {
+			recipientErrors = append(recipientErrors, RecipientError{Email: recipient.Email, Error: err.Error()})
+			continue
+		}
 		// Generate unique Message-ID
 		messageID := h.generateMessageID(req.From)
+		content.HTML = PrepareHTML(content.HTML, messageID, req.InlineCSS)
 
 		// Create email record
 		emailRecord := models.EmailMessageRecord{
-			ID:        uuid.New(),
-			MessageID: messageID,
-			From:      req.From,
-			To:        recipient,
-			Subject:   req.Subject,
-			Status:    "queued",
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+			ID:         uuid.New(),
+			MessageID:  messageID,
+			From:       req.From,
+			To:         recipient.Email,
+			Subject:    content.Subject,
+			Status:     "queued",
+			CampaignID: links.CampaignID,
+			ContactID:  links.ContactID,
+			ClientID:   links.ClientID,
+			CreatedAt:  time.Now(),
+			UpdatedAt:  time.Now(),
 		}
 
 		// Insert into database
 		if err := h.emailRepo.CreateEmailMessage(ctx, emailRecord); err != nil {
 			h.logger.Error().
 				Err(err).
-				Str("recipient", recipient).
+				Str("recipient", recipient.Email).
 				Msg("Failed to create email record")
+			recipientErrors = append(recipientErrors, RecipientError{Email: recipient.Email, Error: "failed to create email record"})
 			continue
 		}
 
 		// Create email job
 		job := SendEmailJob{
 			EmailRecord: &emailRecord,
+			CampaignID:  links.CampaignID,
 			From:        req.From,
-			To:          recipient,
-			Subject:     req.Subject,
-			HTMLBody:    req.HTML,
-			TextBody:    req.Text,
+			To:          recipient.Email,
+			Subject:     content.Subject,
+			HTMLBody:    content.HTML,
+			TextBody:    content.Text,
+			Attachments: req.Attachments,
+			Inline:      req.Inline,
 		}
 
 		// Enqueue job
 		if err := h.queue.Enqueue(job); err != nil {
 			h.logger.Error().
 				Err(err).
-				Str("recipient", recipient).
+				Str("recipient", recipient.Email).
 				Msg("Failed to enqueue email job")
 			// Update status to failed
 			h.emailRepo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
+			recipientErrors = append(recipientErrors, RecipientError{Email: recipient.Email, Error: "failed to queue email"})
 			continue
 		}
 
@@ -119,8 +234,8 @@ func (h *SendEmailHandler) HandleSendEmail(c *fiber.Ctx) error {
 		h.logger.Info().
 			Str("event", "email.queued").
 			Str("message_id", messageID).
-			Str("to", recipient).
-			Str("subject", req.Subject).
+			Str("to", recipient.Email).
+			Str("subject", content.Subject).
 			Msg("Email queued for sending")
 	}
 
@@ -129,6 +244,26 @@ func (h *SendEmailHandler) HandleSendEmail(c *fiber.Ctx) error {
 		Status:     "ok",
 		Queued:     queuedCount,
 		MessageIDs: messageIDs,
+		Errors:     recipientErrors,
+	}
+	if template != nil {
+		response.TemplateVersion = template.Version
+	}
+	if len(recipientErrors) > 0 {
+		response.Status = "partial"
+		if queuedCount == 0 {
+			response.Status = "failed"
+		}
+	}
+	// Nothing was queued, e.g. because the queue was full: a retry with the
+	// key sends instead of replaying the failure
+	hold.Stop()
+	switch {
+	case reserved == nil:
+	case queuedCount == 0:
+		h.releaseIdempotencyKey(ctx, reserved)
+	default:
+		h.completeIdempotencyKey(ctx, reserved, fiber.StatusOK, response)
 	}
 
 	return c.Status(fiber.StatusOK).JSON(response)
@@ -137,8 +272,8 @@ func (h *SendEmailHandler) HandleSendEmail(c *fiber.Ctx) error {
 // validateRequest validates the send email request
 func (h *SendEmailHandler) validateRequest(req *SendEmailRequest) error {
 	// Validate to[] cannot be empty
-	if len(req.To) == 0 {
-		return fmt.Errorf("to[] cannot be empty")
+	if len(req.To) == 0 && len(req.Recipients) == 0 {
+		return fmt.Errorf("to[] or recipients[] is required")
 	}
 
 	// Validate from must be a valid email
@@ -149,14 +284,20 @@ func (h *SendEmailHandler) validateRequest(req *SendEmailRequest) error {
 		return fmt.Errorf("from must be a valid email address")
 	}
 
-	// Validate subject required
-	if req.Subject == "" {
-		return fmt.Errorf("subject is required")
+	// A template provides the subject and bodies
+	if err := req.validateTemplate(); err != nil {
+		return err
 	}
+	if req.TemplateID == "" {
+		// Validate subject required
+		if req.Subject == "" {
+			return fmt.Errorf("subject is required")
+		}
 
-	// Validate html OR text required
-	if req.HTML == "" && req.Text == "" {
-		return fmt.Errorf("html or text is required")
+		// Validate html OR text required
+		if req.HTML == "" && req.Text == "" {
+			return fmt.Errorf("html or text is required")
+		}
 	}
 
 	// Validate each recipient email
@@ -165,23 +306,124 @@ func (h *SendEmailHandler) validateRequest(req *SendEmailRequest) error {
 			return fmt.Errorf("invalid email address in to[]: %s", email)
 		}
 	}
+	for _, recipient := range req.Recipients {
+		if !isValidEmail(recipient.Email) {
+			return fmt.Errorf("invalid email address in recipients[]: %s", recipient.Email)
+		}
+	}
+
+	// Merge tag syntax errors are the same for every recipient
+	if req.personalized() {
+		if err := req.validateMergeTags(); err != nil {
+			return err
+		}
+	}
 
-	return nil
+	// Inline images are only referenced from HTML (checked when loading templates)
+	if len(req.Inline) > 0 && req.HTML == "" && req.TemplateID == "" {
+		return fmt.Errorf("inline parts require html")
+	}
+
+	return ValidateAttachments(req.Attachments, req.Inline)
 }
 
-// generateMessageID generates a unique RFC-compliant Message-ID
-func (h *SendEmailHandler) generateMessageID(from string) string {
-	// Extract domain from from address
-	domain := "mailer.local"
-	if idx := strings.LastIndex(from, "@"); idx != -1 {
-		domain = from[idx+1:]
+// resolveLinks parses the optional campaign and contact IDs and determines the client
+// Client users always send for their own client; admins may pass client_id.
+// On error it also returns the HTTP status to respond with.
+func (h *SendEmailHandler) resolveLinks(c *fiber.Ctx, req *SendEmailRequest) (*sendLinks, int, error) {
+	links := &sendLinks{}
+	var err error
+
+	if links.CampaignID, err = parseOptionalUUID(req.CampaignID, "campaign_id"); err != nil {
+		return nil, fiber.StatusBadRequest, err
+	}
+	if links.ContactID, err = parseOptionalUUID(req.ContactID, "contact_id"); err != nil {
+		return nil, fiber.StatusBadRequest, err
+	}
+	if links.ContactID != nil && len(req.recipients()) != 1 {
+		return nil, fiber.StatusBadRequest, fmt.Errorf("contact_id requires exactly one recipient")
+	}
+
+	requested, err := parseOptionalUUID(req.ClientID, "client_id")
+	if err != nil {
+		return nil, fiber.StatusBadRequest, err
+	}
+	links.ClientID = middleware.ClientIDFromContext(c)
+	if requested != nil {
+		switch {
+		case middleware.IsAdmin(c):
+			links.ClientID = requested
+		case links.ClientID == nil || *links.ClientID != *requested:
+			return nil, fiber.StatusForbidden, fmt.Errorf("cannot send on behalf of another client")
+		}
+	}
+
+	if status, err := h.checkOwners(c, links); err != nil {
+		return nil, status, err
+	}
+
+	return links, fiber.StatusOK, nil
+}
+
+// checkOwners rejects a campaign or contact of another client as not found
+// Admins sending without a client may link any campaign or contact.
+func (h *SendEmailHandler) checkOwners(c *fiber.Ctx, links *sendLinks) (int, error) {
+	if h.owners == nil || (links.ClientID == nil && middleware.IsAdmin(c)) {
+		return fiber.StatusOK, nil
+	}
+
+	checks := []struct {
+		name      string
+		id        *uuid.UUID
+		belongsTo func(context.Context, uuid.UUID, uuid.UUID) (bool, error)
+	}{
+		{"campaign", links.CampaignID, h.owners.CampaignBelongsTo},
+		{"contact", links.ContactID, h.owners.ContactBelongsTo},
+	}
+	for _, check := range checks {
+		if check.id == nil {
+			continue
+		}
+		ok := false
+		var err error
+		if links.ClientID != nil {
+			ok, err = check.belongsTo(c.Context(), *check.id, *links.ClientID)
+		}
+		if err != nil {
+			h.logger.Error().
+				Err(err).
+				Str("event", "email.send.owner_check_failed").
+				Str(check.name+"_id", check.id.String()).
+				Msg("Failed to check the owner of a linked record")
+			return fiber.StatusInternalServerError, fmt.Errorf("failed to check %s", check.name)
+		}
+		if !ok {
+			return fiber.StatusNotFound, fmt.Errorf("%s not found", check.name)
+		}
 	}
+	return fiber.StatusOK, nil
+}
 
-	// Generate UUID for unique part
-	uniqueID := uuid.New().String()
+// parseOptionalUUID parses value as a UUID, returning nil for an empty value
+func parseOptionalUUID(value, field string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s format", field)
+	}
+	return &id, nil
+}
 
-	// Format: <unique-id@domain>
-	return fmt.Sprintf("<%s@%s>", uniqueID, domain)
+// generateMessageID generates a unique RFC-compliant Message-ID
+func (h *SendEmailHandler) generateMessageID(from string) string {
+	return NewMessageID(from)
+}
+
+// NewMessageID generates a unique RFC-compliant Message-ID in the sender's domain
+func NewMessageID(from string) string {
+	return mimemsg.NewMessageID(from)
 }
 
 // isValidEmail performs basic email validation
@@ -209,4 +451,3 @@ func isValidEmail(email string) bool {
 
 	return true
 }
-
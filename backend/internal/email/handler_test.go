@@ -0,0 +1,76 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// fakeOwnershipRepository knows the client of each campaign and contact
+type fakeOwnershipRepository struct {
+	owners map[uuid.UUID]uuid.UUID
+}
+
+func (f *fakeOwnershipRepository) CampaignBelongsTo(ctx context.Context, campaignID, clientID uuid.UUID) (bool, error) {
+	owner, ok := f.owners[campaignID]
+	return ok && owner == clientID, nil
+}
+
+func (f *fakeOwnershipRepository) ContactBelongsTo(ctx context.Context, contactID, clientID uuid.UUID) (bool, error) {
+	owner, ok := f.owners[contactID]
+	return ok && owner == clientID, nil
+}
+
+func TestHandleSendEmail_RejectsRecordsOfAnotherClient(t *testing.T) {
+	sender, other := uuid.New(), uuid.New()
+	ownCampaign, otherCampaign := uuid.New(), uuid.New()
+	ownContact, otherContact := uuid.New(), uuid.New()
+
+	queue := NewQueue(1, nil, newMockEmailRepository(), nil)
+	handler := NewSendEmailHandler(queue, newMockEmailRepository(), nil)
+	handler.SetOwners(&fakeOwnershipRepository{owners: map[uuid.UUID]uuid.UUID{
+		ownCampaign:   sender,
+		otherCampaign: other,
+		ownContact:    sender,
+		otherContact:  other,
+	}})
+	app := serveSendEmail(handler)
+
+	tests := []struct {
+		name     string
+		campaign uuid.UUID
+		contact  uuid.UUID
+		want     int
+	}{
+		{"own campaign and contact", ownCampaign, ownContact, fiber.StatusOK},
+		{"campaign of another client", otherCampaign, ownContact, fiber.StatusNotFound},
+		{"contact of another client", ownCampaign, otherContact, fiber.StatusNotFound},
+		{"unknown contact", ownCampaign, uuid.New(), fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"from":"news@example.com","to":["a@example.org"],"subject":"Hi","text":"Hello","campaign_id":%q,"contact_id":%q}`,
+				tt.campaign, tt.contact)
+			req := httptest.NewRequest("POST", "/emails/send", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Client", sender.String())
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() error = %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+	if len(queue.jobs) != 1 {
+		t.Errorf("queued %d jobs, want only the one of the own campaign", len(queue.jobs))
+	}
+}
@@ -0,0 +1,224 @@
+package email
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"backend/internal/middleware"
+	"backend/internal/models"
+	"backend/internal/repositories"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// IdempotencyKeyHeader makes a send safe to retry: requests repeating a
+	// key within the retention window get the first response back
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayHeader is set to true on replayed responses
+	IdempotentReplayHeader = "Idempotent-Replayed"
+	// DefaultIdempotencyTTL is how long keys are kept by default
+	DefaultIdempotencyTTL = 24 * time.Hour
+
+	// defaultIdempotencyLease is how long the first request of a key holds it
+	// without renewing it; a retry after that takes the key over instead of
+	// getting 409, so a key whose request died is not stuck until it expires
+	defaultIdempotencyLease = 5 * time.Minute
+
+	maxIdempotencyKeyLength = 255
+)
+
+var (
+	// ErrIdempotencyKeyReused is returned when a key is sent with a different request
+	ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+	// ErrIdempotencyKeyInProgress is returned while the first request of a key is being processed
+	ErrIdempotencyKeyInProgress = errors.New("a request with this idempotency key is still in progress")
+
+	errInvalidIdempotencyKey = errors.New("invalid " + IdempotencyKeyHeader)
+)
+
+// SetIdempotencyTTL sets how long Idempotency-Keys are replayed
+func (h *SendEmailHandler) SetIdempotencyTTL(ttl time.Duration) {
+	if ttl > 0 {
+		h.idempotencyTTL = ttl
+	}
+}
+
+// reserveIdempotencyKey claims the request's Idempotency-Key
+// It returns the stored key of an earlier request to replay instead, or the
+// new reservation to complete; both are nil when the request carries no key.
+func (h *SendEmailHandler) reserveIdempotencyKey(c *fiber.Ctx, req *SendEmailRequest) (replay, reserved *models.IdempotencyKey, err error) {
+	key := c.Get(IdempotencyKeyHeader)
+	if key == "" || h.idempotency == nil {
+		return nil, nil, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, nil, fmt.Errorf("%w: at most %d characters are allowed", errInvalidIdempotencyKey, maxIdempotencyKeyLength)
+	}
+
+	hash, err := requestHash(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	reserved = &models.IdempotencyKey{
+		ID:          uuid.New(),
+		Scope:       idempotencyScope(c),
+		Key:         key,
+		RequestHash: hash,
+		CreatedAt:   now,
+		LockedUntil: now.Add(h.idempotencyLease),
+		ExpiresAt:   now.Add(h.idempotencyTTL),
+	}
+
+	existing, err := h.idempotency.Reserve(c.Context(), reserved)
+	switch {
+	case err != nil:
+		return nil, nil, err
+	case existing == nil:
+		return nil, reserved, nil
+	case existing.RequestHash != hash:
+		return nil, nil, ErrIdempotencyKeyReused
+	case existing.StatusCode == 0:
+		return nil, nil, ErrIdempotencyKeyInProgress
+	default:
+		return existing, nil, nil
+	}
+}
+
+// idempotencyHold keeps a reserved key's lease while its request runs
+type idempotencyHold struct {
+	done chan struct{}
+	lost atomic.Bool
+}
+
+// holdIdempotencyKey renews the lease of reserved until the returned hold is
+// stopped, so that a retry cannot take over a request that is still sending
+func (h *SendEmailHandler) holdIdempotencyKey(reserved *models.IdempotencyKey) *idempotencyHold {
+	hold := &idempotencyHold{done: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(h.idempotencyLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-hold.done:
+				return
+			case <-ticker.C:
+				// Not the request's context: it is recycled once the handler returns
+				err := h.idempotency.Renew(context.Background(), reserved.ID, time.Now().Add(h.idempotencyLease))
+				switch {
+				case errors.Is(err, repositories.ErrIdempotencyKeyLost):
+					hold.lost.Store(true)
+					h.logger.Warn().
+						Str("event", "email.idempotency.lease_lost").
+						Str("idempotency_key", reserved.Key).
+						Msg("Idempotency key was taken over by a retry")
+					return
+				case err != nil:
+					// Retried on the next tick; the lease outlasts two failures
+					h.logger.Error().
+						Err(err).
+						Str("event", "email.idempotency.renew_failed").
+						Str("idempotency_key", reserved.Key).
+						Msg("Failed to renew idempotency key")
+				}
+			}
+		}
+	}()
+	return hold
+}
+
+// Lost reports whether a retry took the key over, after which the request
+// must not send any more
+func (hold *idempotencyHold) Lost() bool {
+	return hold != nil && hold.lost.Load()
+}
+
+// Stop stops renewing the lease
+func (hold *idempotencyHold) Stop() {
+	if hold != nil {
+		close(hold.done)
+	}
+}
+
+// completeIdempotencyKey stores the response of a reserved key
+// When it cannot be stored the key is released so that a retry sends again
+// rather than waiting for the reservation to expire. A key that was taken
+// over belongs to the retry and is left alone.
+func (h *SendEmailHandler) completeIdempotencyKey(ctx context.Context, reserved *models.IdempotencyKey, status int, response interface{}) {
+	body, err := json.Marshal(response)
+	if err == nil {
+		err = h.idempotency.Complete(ctx, reserved.ID, status, body)
+	}
+	if err == nil {
+		return
+	}
+	if errors.Is(err, repositories.ErrIdempotencyKeyLost) {
+		h.logger.Warn().
+			Str("event", "email.idempotency.lease_lost").
+			Str("idempotency_key", reserved.Key).
+			Msg("Idempotency key was taken over by a retry; response not stored")
+		return
+	}
+
+	h.logger.Error().
+		Err(err).
+		Str("event", "email.idempotency.complete_failed").
+		Str("idempotency_key", reserved.Key).
+		Msg("Failed to store idempotent response")
+	h.releaseIdempotencyKey(ctx, reserved)
+}
+
+// releaseIdempotencyKey deletes a reserved key without storing a response, so
+// that a retry with the key sends again
+func (h *SendEmailHandler) releaseIdempotencyKey(ctx context.Context, reserved *models.IdempotencyKey) {
+	if err := h.idempotency.Release(ctx, reserved.ID); err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("event", "email.idempotency.release_failed").
+			Str("idempotency_key", reserved.Key).
+			Msg("Failed to release idempotency key")
+	}
+}
+
+// replayIdempotentResponse sends the stored response of a key
+func (h *SendEmailHandler) replayIdempotentResponse(c *fiber.Ctx, stored *models.IdempotencyKey) error {
+	h.logger.Info().
+		Str("event", "email.idempotency.replayed").
+		Str("idempotency_key", stored.Key).
+		Msg("Replaying response of idempotent send")
+
+	c.Set(IdempotentReplayHeader, "true")
+	c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	return c.Status(stored.StatusCode).Send(stored.Response)
+}
+
+// idempotencyScope returns the scope keys are unique in: the client of the
+// authenticated user, or the user itself for admins without a client
+func idempotencyScope(c *fiber.Ctx) string {
+	if clientID := middleware.ClientIDFromContext(c); clientID != nil {
+		return "client:" + clientID.String()
+	}
+	if userID, ok := c.Locals("user_id").(uuid.UUID); ok {
+		return "user:" + userID.String()
+	}
+	return "anonymous"
+}
+
+// requestHash returns the hex SHA-256 of the parsed request, so that
+// formatting differences of a retried body do not count as a different request
+func requestHash(req *SendEmailRequest) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash request: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
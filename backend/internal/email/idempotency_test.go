@@ -0,0 +1,365 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/repositories"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// memoryIdempotencyRepository keeps idempotency keys in memory
+type memoryIdempotencyRepository struct {
+	mu          sync.Mutex
+	keys        map[string]*models.IdempotencyKey // by scope and key
+	completeErr error
+}
+
+func newMemoryIdempotencyRepository() *memoryIdempotencyRepository {
+	return &memoryIdempotencyRepository{keys: make(map[string]*models.IdempotencyKey)}
+}
+
+func (m *memoryIdempotencyRepository) Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := key.Scope + "/" + key.Key
+	now := time.Now()
+	if existing, ok := m.keys[id]; ok && existing.ExpiresAt.After(now) &&
+		(existing.StatusCode != 0 || existing.LockedUntil.After(now) || existing.RequestHash != key.RequestHash) {
+		stored := *existing
+		return &stored, nil
+	}
+	stored := *key
+	m.keys[id] = &stored
+	return nil, nil
+}
+
+func (m *memoryIdempotencyRepository) Complete(ctx context.Context, id uuid.UUID, statusCode int, response []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.completeErr != nil {
+		return m.completeErr
+	}
+	for _, key := range m.keys {
+		if key.ID == id && key.StatusCode == 0 {
+			key.StatusCode = statusCode
+			key.Response = response
+			return nil
+		}
+	}
+	return repositories.ErrIdempotencyKeyLost
+}
+
+func (m *memoryIdempotencyRepository) Renew(ctx context.Context, id uuid.UUID, lockedUntil time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.keys {
+		if key.ID == id && key.StatusCode == 0 {
+			key.LockedUntil = lockedUntil
+			return nil
+		}
+	}
+	return repositories.ErrIdempotencyKeyLost
+}
+
+// get returns a copy of the stored key
+func (m *memoryIdempotencyRepository) get(scope, key string) (models.IdempotencyKey, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.keys[scope+"/"+key]
+	if !ok {
+		return models.IdempotencyKey{}, false
+	}
+	return *stored, true
+}
+
+func (m *memoryIdempotencyRepository) Release(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, key := range m.keys {
+		if key.ID == id {
+			delete(m.keys, name)
+		}
+	}
+	return nil
+}
+
+func (m *memoryIdempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	return 0, nil
+}
+
+// newSendTestApp serves HandleSendEmail with an unstarted queue
+func newSendTestApp(repo *memoryIdempotencyRepository) (*fiber.App, *Queue) {
+	queue := NewQueue(1, nil, newMockEmailRepository(), nil)
+	return serveSendEmail(NewSendEmailHandler(queue, newMockEmailRepository(), repo)), queue
+}
+
+// serveSendEmail serves handler for a client user whose client is taken
+// from the X-Client header
+func serveSendEmail(handler *SendEmailHandler) *fiber.App {
+	app := fiber.New()
+	app.Post("/emails/send", func(c *fiber.Ctx) error {
+		clientID := uuid.MustParse(c.Get("X-Client"))
+		c.Locals("user", &models.User{ID: uuid.New(), Role: "client", ClientID: &clientID})
+		return c.Next()
+	}, handler.HandleSendEmail)
+	return app
+}
+
+// postSend posts body with an Idempotency-Key for client
+func postSend(t *testing.T, app *fiber.App, client uuid.UUID, key, body string) (int, SendEmailResponse, bool) {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/emails/send", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Client", client.String())
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	var response SendEmailResponse
+	if resp.StatusCode == fiber.StatusOK {
+		if err := json.Unmarshal(data, &response); err != nil {
+			t.Fatalf("invalid response %s: %v", data, err)
+		}
+	}
+	return resp.StatusCode, response, resp.Header.Get(IdempotentReplayHeader) == "true"
+}
+
+const idempotentBody = `{"from":"news@example.com","to":["a@example.org","b@example.org"],"subject":"Hi","text":"Hello"}`
+
+func TestHandleSendEmail_ReplaysIdempotentRequests(t *testing.T) {
+	app, queue := newSendTestApp(newMemoryIdempotencyRepository())
+	client := uuid.New()
+
+	status, first, replayed := postSend(t, app, client, "key-1", idempotentBody)
+	if status != fiber.StatusOK || first.Queued != 2 || replayed {
+		t.Fatalf("first send = %d %+v replayed=%v, want 2 queued", status, first, replayed)
+	}
+
+	// The same body with different formatting is the same request
+	retry := strings.Replace(idempotentBody, `","to"`, `", "to"`, 1)
+	status, second, replayed := postSend(t, app, client, "key-1", retry)
+	if status != fiber.StatusOK || !replayed {
+		t.Fatalf("retry = %d replayed=%v, want a replayed 200", status, replayed)
+	}
+	if strings.Join(second.MessageIDs, ",") != strings.Join(first.MessageIDs, ",") {
+		t.Errorf("replayed message IDs = %v, want %v", second.MessageIDs, first.MessageIDs)
+	}
+	if len(queue.jobs) != 2 {
+		t.Errorf("queued jobs = %d, want 2", len(queue.jobs))
+	}
+}
+
+func TestHandleSendEmail_IdempotencyConflicts(t *testing.T) {
+	repo := newMemoryIdempotencyRepository()
+	app, queue := newSendTestApp(repo)
+	client := uuid.New()
+
+	postSend(t, app, client, "key-1", idempotentBody)
+	changed := strings.Replace(idempotentBody, `"Hi"`, `"Hello"`, 1)
+	if status, _, _ := postSend(t, app, client, "key-1", changed); status != fiber.StatusConflict {
+		t.Errorf("reused key with another body = %d, want 409", status)
+	}
+
+	// A key whose first request has not completed yet
+	var req SendEmailRequest
+	json.Unmarshal([]byte(idempotentBody), &req)
+	hash, _ := requestHash(&req)
+	repo.Reserve(context.Background(), &models.IdempotencyKey{
+		ID: uuid.New(), Scope: "client:" + client.String(), Key: "key-2", RequestHash: hash,
+		LockedUntil: time.Now().Add(time.Minute), ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if status, _, _ := postSend(t, app, client, "key-2", idempotentBody); status != fiber.StatusConflict {
+		t.Errorf("key in progress = %d, want 409", status)
+	}
+
+	if status, _, _ := postSend(t, app, client, strings.Repeat("k", maxIdempotencyKeyLength+1), idempotentBody); status != fiber.StatusBadRequest {
+		t.Errorf("oversized key = %d, want 400", status)
+	}
+	if len(queue.jobs) != 2 {
+		t.Errorf("queued jobs = %d, want 2", len(queue.jobs))
+	}
+}
+
+func TestHandleSendEmail_TakesOverStaleReservation(t *testing.T) {
+	repo := newMemoryIdempotencyRepository()
+	app, queue := newSendTestApp(repo)
+	client := uuid.New()
+
+	// The first request of the key died before completing it
+	var req SendEmailRequest
+	json.Unmarshal([]byte(idempotentBody), &req)
+	hash, _ := requestHash(&req)
+	repo.Reserve(context.Background(), &models.IdempotencyKey{
+		ID: uuid.New(), Scope: "client:" + client.String(), Key: "key-1", RequestHash: hash,
+		LockedUntil: time.Now().Add(-time.Second), ExpiresAt: time.Now().Add(time.Hour),
+	})
+
+	// Only the same request may take the key over
+	changed := strings.Replace(idempotentBody, `"Hi"`, `"Hello"`, 1)
+	if status, _, _ := postSend(t, app, client, "key-1", changed); status != fiber.StatusConflict {
+		t.Errorf("stale key with another body = %d, want 409", status)
+	}
+
+	status, first, replayed := postSend(t, app, client, "key-1", idempotentBody)
+	if status != fiber.StatusOK || first.Queued != 2 || replayed {
+		t.Fatalf("retry of stale key = %d %+v replayed=%v, want 2 queued", status, first, replayed)
+	}
+	if _, _, replayed := postSend(t, app, client, "key-1", idempotentBody); !replayed {
+		t.Error("response of the taken over key was not replayed")
+	}
+	if len(queue.jobs) != 2 {
+		t.Errorf("queued jobs = %d, want 2", len(queue.jobs))
+	}
+}
+
+func TestHandleSendEmail_IdempotencyKeysAreScoped(t *testing.T) {
+	repo := newMemoryIdempotencyRepository()
+	app, queue := newSendTestApp(repo)
+	client := uuid.New()
+
+	// Keys are per client
+	postSend(t, app, client, "key-1", idempotentBody)
+	if _, _, replayed := postSend(t, app, uuid.New(), "key-1", idempotentBody); replayed {
+		t.Error("key of another client was replayed")
+	}
+
+	// Requests without a key always send
+	postSend(t, app, client, "", idempotentBody)
+	postSend(t, app, client, "", idempotentBody)
+
+	// Expired keys send again
+	for _, key := range repo.keys {
+		key.ExpiresAt = time.Now().Add(-time.Second)
+	}
+	if _, _, replayed := postSend(t, app, client, "key-1", idempotentBody); replayed {
+		t.Error("expired key was replayed")
+	}
+
+	if len(queue.jobs) != 10 {
+		t.Errorf("queued jobs = %d, want 10", len(queue.jobs))
+	}
+}
+
+func TestHandleSendEmail_ReleasesKeyWhenResponseIsNotStored(t *testing.T) {
+	repo := newMemoryIdempotencyRepository()
+	repo.completeErr = errors.New("database is down")
+	app, _ := newSendTestApp(repo)
+	client := uuid.New()
+
+	if status, _, _ := postSend(t, app, client, "key-1", idempotentBody); status != fiber.StatusOK {
+		t.Fatalf("send = %d, want 200", status)
+	}
+	if len(repo.keys) != 0 {
+		t.Errorf("keys = %d, want the reservation released", len(repo.keys))
+	}
+}
+
+func TestHandleSendEmail_RetriesKeyWhenNothingWasQueued(t *testing.T) {
+	repo := newMemoryIdempotencyRepository()
+	app, queue := newSendTestApp(repo)
+	client := uuid.New()
+
+	// Fill the queue
+	for len(queue.jobs) < cap(queue.jobs) {
+		queue.jobs <- SendEmailJob{}
+	}
+	status, first, _ := postSend(t, app, client, "key-1", idempotentBody)
+	if status != fiber.StatusOK || first.Status != "failed" || first.Queued != 0 {
+		t.Fatalf("send to a full queue = %d %+v, want failed", status, first)
+	}
+
+	// Once the queue has room, the retry sends rather than replaying the failure
+	for len(queue.jobs) > 0 {
+		<-queue.jobs
+	}
+	status, second, replayed := postSend(t, app, client, "key-1", idempotentBody)
+	if status != fiber.StatusOK || replayed || second.Queued != 2 {
+		t.Fatalf("retry = %d %+v replayed=%v, want 2 queued", status, second, replayed)
+	}
+	if len(queue.jobs) != 2 {
+		t.Errorf("queued jobs = %d, want 2", len(queue.jobs))
+	}
+
+	// The successful response is replayed
+	if _, _, replayed := postSend(t, app, client, "key-1", idempotentBody); !replayed {
+		t.Error("expected the response of the successful send to be replayed")
+	}
+}
+
+func TestHoldIdempotencyKey_RenewsLease(t *testing.T) {
+	repo := newMemoryIdempotencyRepository()
+	handler := NewSendEmailHandler(nil, newMockEmailRepository(), repo)
+	handler.idempotencyLease = 30 * time.Millisecond
+
+	reserved := &models.IdempotencyKey{
+		ID: uuid.New(), Scope: "client:1", Key: "key-1",
+		LockedUntil: time.Now().Add(handler.idempotencyLease), ExpiresAt: time.Now().Add(time.Hour),
+	}
+	repo.Reserve(context.Background(), reserved)
+
+	hold := handler.holdIdempotencyKey(reserved)
+	time.Sleep(100 * time.Millisecond)
+	hold.Stop()
+
+	stored, _ := repo.get("client:1", "key-1")
+	if !stored.LockedUntil.After(time.Now()) {
+		t.Errorf("locked until %v, want the lease renewed", stored.LockedUntil)
+	}
+	if hold.Lost() {
+		t.Error("hold lost a key nobody took over")
+	}
+}
+
+func TestHoldIdempotencyKey_KeyTakenOverByRetry(t *testing.T) {
+	repo := newMemoryIdempotencyRepository()
+	handler := NewSendEmailHandler(nil, newMockEmailRepository(), repo)
+	handler.idempotencyLease = 30 * time.Millisecond
+
+	first := &models.IdempotencyKey{
+		ID: uuid.New(), Scope: "client:1", Key: "key-1",
+		LockedUntil: time.Now().Add(-time.Second), ExpiresAt: time.Now().Add(time.Hour),
+	}
+	repo.Reserve(context.Background(), first)
+	hold := handler.holdIdempotencyKey(first)
+	defer hold.Stop()
+
+	// A retry takes over the expired reservation
+	repo.Release(context.Background(), first.ID)
+	retry := &models.IdempotencyKey{
+		ID: uuid.New(), Scope: "client:1", Key: "key-1",
+		LockedUntil: time.Now().Add(time.Minute), ExpiresAt: time.Now().Add(time.Hour),
+	}
+	repo.Reserve(context.Background(), retry)
+
+	deadline := time.Now().Add(time.Second)
+	for !hold.Lost() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !hold.Lost() {
+		t.Fatal("hold did not notice the key was taken over")
+	}
+
+	// The first request neither completes nor releases the retry's key
+	handler.completeIdempotencyKey(context.Background(), first, fiber.StatusOK, SendEmailResponse{Status: "ok"})
+	stored, ok := repo.get("client:1", "key-1")
+	if !ok || stored.ID != retry.ID || stored.StatusCode != 0 {
+		t.Errorf("stored key = %+v (found %v), want the retry's reservation untouched", stored, ok)
+	}
+}
@@ -1,57 +1,174 @@
 package email
 
 import (
+	"bytes"
 	"encoding/base64"
 	"fmt"
-	"regexp"
+	"io"
 	"strings"
-)
 
-var (
-	// Regex to match href attributes in anchor tags
-	hrefRegex = regexp.MustCompile(`(?i)<a\s+([^>]*\s+)?href=["']([^"']+)["']([^>]*)>([^<]*)</a>`)
+	"backend/internal/config"
+	"backend/internal/cssinline"
+	"backend/internal/linksign"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
-// RewriteLinks rewrites all links in HTML to use click tracking
-func RewriteLinks(htmlBody, messageID, trackingDomain string) string {
+// NoTrackAttribute opts an <a> or <area> element out of click tracking
+const NoTrackAttribute = "data-notrack"
+
+// RewriteLinks rewrites the http and https links of <a> and <area> elements
+// in HTML to use click tracking
+// The HTML is tokenized, so links wrapping images or other markup are
+// rewritten too, while links inside comments and scripts are not. Entity
+// encoded hrefs are decoded before tracking. Links marked with
+// NoTrackAttribute, links to the click tracker and other schemes such as
+// mailto: are left alone; everything but rewritten tags is copied verbatim.
+// Each tracked link is signed with secret, which the click tracker verifies
+// before redirecting.
+func RewriteLinks(htmlBody, messageID, trackingDomain, secret string) string {
 	if htmlBody == "" || messageID == "" {
 		return htmlBody
 	}
 
 	// Remove angle brackets from messageID if present
 	cleanMessageID := strings.Trim(messageID, "<>")
+	tracker := clickTracker{
+		prefix:    fmt.Sprintf("%s/track/click/%s?url=", strings.TrimSuffix(trackingDomain, "/"), cleanMessageID),
+		messageID: cleanMessageID,
+		secret:    secret,
+	}
+
+	var out bytes.Buffer
+	out.Grow(len(htmlBody) + len(htmlBody)/4)
+	z := html.NewTokenizer(strings.NewReader(htmlBody))
+	for {
+		tt := z.Next()
+		start := out.Len()
+		out.Write(z.Raw())
 
-	// Find all href links and replace them
-	rewritten := hrefRegex.ReplaceAllStringFunc(htmlBody, func(match string) string {
-		// Extract href URL
-		hrefMatch := regexp.MustCompile(`(?i)href=["']([^"']+)["']`).FindStringSubmatch(match)
-		if len(hrefMatch) < 2 {
-			return match // Return original if no href found
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				return htmlBody
+			}
+			return out.String()
+		case html.StartTagToken, html.SelfClosingTagToken:
+		default:
+			continue
+		}
+
+		// TagName lowercases the tokenizer's buffer, so the raw tag is
+		// written before looking at it
+		name, hasAttr := z.TagName()
+		tag := atom.Lookup(name)
+		if !hasAttr || (tag != atom.A && tag != atom.Area) {
+			continue
+		}
+		token := html.Token{Type: tt, DataAtom: tag, Data: tag.String()}
+		for more := true; more; {
+			var key, val []byte
+			key, val, more = z.TagAttr()
+			token.Attr = append(token.Attr, html.Attribute{Key: string(key), Val: string(val)})
+		}
+		if tracker.trackLink(&token) {
+			out.Truncate(start)
+			out.WriteString(token.String())
 		}
+	}
+}
 
-		originalURL := hrefMatch[1]
+// clickTracker builds the click tracking links of a message
+type clickTracker struct {
+	prefix    string
+	messageID string
+	secret    string
+}
 
-		// Skip if already a tracking URL or mailto/tel links
-		if strings.Contains(originalURL, "/track/click/") ||
-			strings.HasPrefix(originalURL, "mailto:") ||
-			strings.HasPrefix(originalURL, "tel:") ||
-			strings.HasPrefix(originalURL, "#") {
-			return match
+// trackLink points the href of a link at the click tracker, reporting
+// whether it was rewritten
+func (c clickTracker) trackLink(token *html.Token) bool {
+	href := -1
+	for i, attr := range token.Attr {
+		switch attr.Key {
+		case NoTrackAttribute:
+			return false
+		case "href":
+			if href < 0 {
+				href = i
+			}
 		}
+	}
+	if href < 0 {
+		return false
+	}
 
-		// Encode URL using base64 URL encoding
-		encodedURL := base64.URLEncoding.EncodeToString([]byte(originalURL))
+	originalURL := strings.TrimSpace(token.Attr[href].Val)
+	if !trackable(originalURL) {
+		return false
+	}
 
-		// Build tracking URL with base64 encoded destination
-		trackingURL := fmt.Sprintf("%s/track/click/%s?url=%s",
-			strings.TrimSuffix(trackingDomain, "/"),
-			cleanMessageID,
-			encodedURL)
+	// Encode URL using base64 URL encoding
+	token.Attr[href].Val = c.prefix + base64.URLEncoding.EncodeToString([]byte(originalURL)) +
+		"&sig=" + linksign.Sign(c.secret, c.messageID, originalURL)
+	return true
+}
 
-		// Replace href in the match
-		newMatch := regexp.MustCompile(`(?i)href=["'][^"']+["']`).ReplaceAllString(match, fmt.Sprintf(`href="%s"`, trackingURL))
-		return newMatch
-	})
+// trackable reports whether the click tracker can redirect to a link
+// Only http and https targets pass its URL validation.
+func trackable(link string) bool {
+	if strings.Contains(link, "/track/click/") {
+		return false
+	}
+	scheme, _, ok := strings.Cut(link, ":")
+	return ok && (strings.EqualFold(scheme, "http") || strings.EqualFold(scheme, "https"))
+}
 
-	return rewritten
+// AddTracking rewrites links for click tracking and appends the open tracking pixel
+func AddTracking(htmlBody, messageID, trackingDomain, secret string) string {
+	if htmlBody == "" || messageID == "" {
+		return htmlBody
+	}
+
+	// Rewrite links for click tracking
+	htmlBody = RewriteLinks(htmlBody, messageID, trackingDomain, secret)
+
+	// Add tracking pixel
+	cleanMessageID := strings.Trim(messageID, "<>")
+	trackingPixel := fmt.Sprintf(
+		`<img src="%s/track/open/%s.png" width="1" height="1" style="display:none;" />`,
+		strings.TrimSuffix(trackingDomain, "/"),
+		cleanMessageID,
+	)
+	return htmlBody + trackingPixel
+}
+
+// PrepareHTML readies the HTML body of one message for sending
+// The rules of its <style> elements are inlined first when inlineCSS is set,
+// then click and open tracking are added with the configured tracking domain.
+func PrepareHTML(htmlBody, messageID string, inlineCSS bool) string {
+	if htmlBody == "" {
+		return htmlBody
+	}
+	if inlineCSS {
+		htmlBody = cssinline.Inline(htmlBody)
+	}
+	return AddTracking(htmlBody, messageID, trackingDomain(), trackingSecret())
+}
+
+// trackingDomain returns the base URL used for open and click tracking
+func trackingDomain() string {
+	if config.AppConfig != nil && config.AppConfig.TrackingDomain != "" {
+		return config.AppConfig.TrackingDomain
+	}
+	return "http://localhost:8080"
+}
+
+// trackingSecret returns the secret that signs click tracking links
+func trackingSecret() string {
+	if config.AppConfig != nil {
+		return config.AppConfig.TrackingSecret
+	}
+	return ""
 }
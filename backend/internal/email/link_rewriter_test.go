@@ -0,0 +1,206 @@
+package email
+
+import (
+	"encoding/base64"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"backend/internal/linksign"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	testMessageID      = "<abc-123@mailblast>"
+	testTrackingDomain = "https://t.example.com/"
+	testTrackingSecret = "test-secret"
+)
+
+// trackedLink returns the click tracking URL of target, escaped for an attribute
+func trackedLink(target string) string {
+	return "https://t.example.com/track/click/abc-123@mailblast?url=" + base64.URLEncoding.EncodeToString([]byte(target)) +
+		"&amp;sig=" + linksign.Sign(testTrackingSecret, "abc-123@mailblast", target)
+}
+
+func TestRewriteLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "plain link",
+			body: `<p><a href="https://example.com/a" class="btn">Shop</a></p>`,
+			want: `<p><a href="` + trackedLink("https://example.com/a") + `" class="btn">Shop</a></p>`,
+		},
+		{
+			name: "image link",
+			body: `<a href="https://example.com/b"><img src="banner.png" alt="Sale"></a>`,
+			want: `<a href="` + trackedLink("https://example.com/b") + `"><img src="banner.png" alt="Sale"></a>`,
+		},
+		{
+			name: "nested markup",
+			body: `<a href='https://example.com/c'><span><b>Buy</b> now</span></a>`,
+			want: `<a href="` + trackedLink("https://example.com/c") + `"><span><b>Buy</b> now</span></a>`,
+		},
+		{
+			name: "area",
+			body: `<map name="m"><area shape="rect" coords="0,0,10,10" href="https://example.com/d"/></map>`,
+			want: `<map name="m"><area shape="rect" coords="0,0,10,10" href="` + trackedLink("https://example.com/d") + `"/></map>`,
+		},
+		{
+			name: "entity encoded URL",
+			body: `<a href="https://example.com/e?a=1&amp;b=2&#38;c=3">E</a>`,
+			want: `<a href="` + trackedLink("https://example.com/e?a=1&b=2&c=3") + `">E</a>`,
+		},
+		{
+			name: "unquoted and upper case",
+			body: `<A HREF=HTTPS://example.com/f TARGET=_blank>F</A>`,
+			want: `<a href="` + trackedLink("HTTPS://example.com/f") + `" target="_blank">F</A>`,
+		},
+		{
+			name: "several links on one line",
+			body: `<a href="https://example.com/1">1</a> | <a href="https://example.com/2">2</a>`,
+			want: `<a href="` + trackedLink("https://example.com/1") + `">1</a> | <a href="` + trackedLink("https://example.com/2") + `">2</a>`,
+		},
+		{
+			name: "opted out",
+			body: `<a href="https://example.com/g" data-notrack>G</a>`,
+			want: `<a href="https://example.com/g" data-notrack>G</a>`,
+		},
+		{
+			name: "other schemes",
+			body: `<a href="mailto:a@example.com">M</a><a href="tel:+1">T</a><a href="#top">A</a><a href="javascript:void(0)">J</a><a href="/relative">R</a><a>N</a>`,
+			want: `<a href="mailto:a@example.com">M</a><a href="tel:+1">T</a><a href="#top">A</a><a href="javascript:void(0)">J</a><a href="/relative">R</a><a>N</a>`,
+		},
+		{
+			name: "already tracked",
+			body: `<a href="https://t.example.com/track/click/x?url=aHR0cHM6Ly9leGFtcGxlLmNvbQ==">X</a>`,
+			want: `<a href="https://t.example.com/track/click/x?url=aHR0cHM6Ly9leGFtcGxlLmNvbQ==">X</a>`,
+		},
+		{
+			name: "comments and scripts",
+			body: `<!-- <a href="https://example.com/h">H</a> --><script>var s = '<a href="https://example.com/i">';</script>`,
+			want: `<!-- <a href="https://example.com/h">H</a> --><script>var s = '<a href="https://example.com/i">';</script>`,
+		},
+		{
+			name: "other markup kept verbatim",
+			body: "<!DOCTYPE html>\n<TABLE Width=100%><tr><td>&nbsp;Caf&eacute;</td></tr></TABLE><br/>",
+			want: "<!DOCTYPE html>\n<TABLE Width=100%><tr><td>&nbsp;Caf&eacute;</td></tr></TABLE><br/>",
+		},
+		{
+			name: "unterminated tag",
+			body: `<p>Hi</p><a href="https://example.com/j"`,
+			want: `<p>Hi</p><a href="https://example.com/j"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RewriteLinks(tt.body, testMessageID, testTrackingDomain, testTrackingSecret); got != tt.want {
+				t.Errorf("RewriteLinks() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteLinks_NoMessageID(t *testing.T) {
+	body := `<a href="https://example.com">x</a>`
+	if got := RewriteLinks(body, "", testTrackingDomain, testTrackingSecret); got != body {
+		t.Errorf("expected body unchanged without a message ID, got %q", got)
+	}
+}
+
+func TestAddTracking(t *testing.T) {
+	got := AddTracking(`<a href="https://example.com">x</a>`, testMessageID, testTrackingDomain, testTrackingSecret)
+	if !strings.Contains(got, trackedLink("https://example.com")) {
+		t.Errorf("expected tracked link, got %q", got)
+	}
+	if !strings.HasSuffix(got, `<img src="https://t.example.com/track/open/abc-123@mailblast.png" width="1" height="1" style="display:none;" />`) {
+		t.Errorf("expected open pixel, got %q", got)
+	}
+}
+
+func FuzzRewriteLinks(f *testing.F) {
+	seeds := []string{
+		``,
+		`<p>no links</p>`,
+		`<a href="https://example.com">x</a>`,
+		`<a href="https://example.com/?a=1&amp;b=2"><img src="x.png"></a>`,
+		`<map><area href="http://example.com/a"></map>`,
+		`<a data-notrack href="https://example.com">x</a>`,
+		`<a href=https://example.com/ x=">">`,
+		`<!-- <a href="https://example.com"> --><script><a href="https://example.com"></script>`,
+		`<a href="https://example.com"`,
+		`<a/href="https://example.com"/>`,
+		`<svg><a href="https://example.com"></a></svg>`,
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, body string) {
+		got := RewriteLinks(body, testMessageID, testTrackingDomain, testTrackingSecret)
+
+		// Bodies without links are copied verbatim
+		lower := strings.ToLower(body)
+		if !strings.Contains(lower, "<a") && got != body {
+			t.Fatalf("body without links changed:\n%q\n%q", body, got)
+		}
+
+		// Rewriting is idempotent
+		if again := RewriteLinks(got, testMessageID, testTrackingDomain, testTrackingSecret); again != got {
+			t.Fatalf("second rewrite changed the body:\n%q\n%q", got, again)
+		}
+
+		// Every tracked href decodes to a trackable URL with a valid signature
+		prefix := "https://t.example.com/track/click/abc-123@mailblast?"
+		z := html.NewTokenizer(strings.NewReader(got))
+		for {
+			tt := z.Next()
+			if tt == html.ErrorToken {
+				if z.Err() != io.EOF {
+					t.Fatalf("rewritten body does not tokenize: %v", z.Err())
+				}
+				return
+			}
+			for _, attr := range z.Token().Attr {
+				if attr.Key != "href" || !strings.HasPrefix(attr.Val, prefix) {
+					continue
+				}
+				query, err := url.ParseQuery(strings.TrimPrefix(attr.Val, prefix))
+				if err != nil {
+					t.Fatalf("tracked href %q has an invalid query: %v", attr.Val, err)
+				}
+				target, err := base64.URLEncoding.DecodeString(query.Get("url"))
+				if err != nil || !trackable(string(target)) {
+					t.Fatalf("tracked href %q does not decode to a trackable URL", attr.Val)
+				}
+				if !linksign.Verify(testTrackingSecret, "abc-123@mailblast", string(target), query.Get("sig")) {
+					t.Fatalf("tracked href %q has an invalid signature", attr.Val)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkRewriteLinks(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString(`<!DOCTYPE html><html><head><style>a { color: #06c; }</style></head><body><table width="100%">`)
+	for i := 0; i < 50; i++ {
+		sb.WriteString(`<tr><td class="item"><a href="https://shop.example.com/products/item?id=12345&amp;utm_source=newsletter">`)
+		sb.WriteString(`<img src="https://cdn.example.com/item.png" alt="Item" width="120"></a>`)
+		sb.WriteString(`<p>Description of the item with <a href="https://shop.example.com/item/reviews"><b>reviews</b></a>.</p></td></tr>`)
+	}
+	sb.WriteString(`</table><p><a href="mailto:help@example.com">Contact us</a></p></body></html>`)
+	body := sb.String()
+
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		RewriteLinks(body, testMessageID, testTrackingDomain, testTrackingSecret)
+	}
+}
@@ -0,0 +1,61 @@
+package email
+
+import (
+	"context"
+	"fmt"
+	netmail "net/mail"
+
+	"backend/internal/mail"
+)
+
+// MailSender adapts a mail.SMTPSender (the Redis queue consumer's sender) to EmailSender.
+// Messages are built like those of SmtpSender, with their attachments, inline
+// parts and Message-ID, and sent over the MAIL_* relay.
+type MailSender struct {
+	sender mail.SMTPSender
+}
+
+// NewMailSender creates an EmailSender backed by a mail.SMTPSender
+func NewMailSender(sender mail.SMTPSender) *MailSender {
+	return &MailSender{sender: sender}
+}
+
+// SendEmail builds msg and sends it through the mail.SMTPSender
+// Protocol and network failures are returned as *SMTPError.
+func (s *MailSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	// Validate required fields
+	if msg.From == "" {
+		return fmt.Errorf("from address is required")
+	}
+	if msg.To == "" {
+		return fmt.Errorf("to address is required")
+	}
+	if msg.Subject == "" {
+		return fmt.Errorf("subject is required")
+	}
+	if msg.HTMLBody == "" && msg.TextBody == "" {
+		return fmt.Errorf("either HTMLBody or TextBody is required")
+	}
+
+	// MAIL FROM takes the bare address; the display name is for the header
+	from, err := netmail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+
+	emailBody, err := buildMIMEEmail(msg)
+	if err != nil {
+		return fmt.Errorf("failed to build MIME email: %w", err)
+	}
+
+	// Large messages get longer to upload
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, sendTimeout(len(emailBody)))
+	defer cancel()
+
+	if err := s.sender.SendMessage(ctxWithTimeout, from.Address, msg.To, emailBody, msg.ClientID); err != nil {
+		// As *SMTPError, so that the router knows whether the relay may
+		// already have accepted the message
+		return fromPoolError(err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"backend/internal/config"
+	"backend/internal/mail"
+	"backend/internal/smtppool"
+	"backend/internal/smtptest"
+)
+
+// newTestMailSender creates a MailSender for an unauthenticated test server
+func newTestMailSender(srv *smtptest.Server) *MailSender {
+	return NewMailSender(mail.NewSMTPSender(config.SMTPConfig{
+		Host:       srv.Host,
+		Port:       srv.Port,
+		Encryption: smtppool.EncryptionNone,
+		Auth:       smtppool.AuthNone,
+		FromEmail:  "news@example.com",
+		FromName:   "News",
+	}))
+}
+
+func TestMailSender_SendsTheWholeMessage(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	sender := newTestMailSender(srv)
+
+	err := sender.SendEmail(context.Background(), EmailMessage{
+		From:            `"Shop" <shop@example.com>`,
+		To:              "b@example.org",
+		Subject:         "Your invoice",
+		HTMLBody:        `<p>Thanks</p><img src="cid:logo">`,
+		Headers:         map[string]string{"Message-ID": "<job-1@example.com>"},
+		Attachments:     []Attachment{{Filename: "invoice.pdf", Content: []byte("%PDF-1.4")}},
+		Inline:          []Attachment{{Filename: "logo.png", Content: []byte("png"), ContentID: "logo"}},
+		DisableAutoText: true,
+	})
+	if err != nil {
+		t.Fatalf("SendEmail() error = %v", err)
+	}
+
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(messages))
+	}
+	if messages[0].From != "shop@example.com" {
+		t.Errorf("envelope sender = %q, want shop@example.com", messages[0].From)
+	}
+	data := messages[0].Data
+	for _, want := range []string{
+		`From: "Shop" <shop@example.com>`,
+		"Message-ID: <job-1@example.com>",
+		"filename=invoice.pdf",
+		"Content-ID: <logo>",
+	} {
+		if !strings.Contains(data, want) {
+			t.Errorf("message lacks %q:\n%s", want, data)
+		}
+	}
+	if strings.Contains(data, "text/plain") {
+		t.Errorf("expected no generated text part:\n%s", data)
+	}
+
+	// A text-only message is not sent as HTML
+	err = sender.SendEmail(context.Background(), EmailMessage{From: "news@example.com", To: "b@example.org", Subject: "Hi", TextBody: "Hello"})
+	if err != nil {
+		t.Fatalf("SendEmail() error = %v", err)
+	}
+	if data := srv.Messages()[1].Data; strings.Contains(data, "text/html") {
+		t.Errorf("text-only message has an HTML part:\n%s", data)
+	}
+}
+
+func TestMailSender_ReturnsSMTPErrors(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	srv.RejectRecipient = func(addr string) bool { return true }
+	sender := newTestMailSender(srv)
+
+	err := sender.SendEmail(context.Background(), EmailMessage{From: "news@example.com", To: "b@example.org", Subject: "Hi", HTMLBody: "<p>Hi</p>"})
+	var smtpErr *SMTPError
+	if !errors.As(err, &smtpErr) {
+		t.Fatalf("SendEmail() error = %v, want *SMTPError", err)
+	}
+	if smtpErr.Op != SMTPOpRcpt || smtpErr.Code != 550 {
+		t.Errorf("error op, code = %q, %d, want rcpt, 550", smtpErr.Op, smtpErr.Code)
+	}
+}
+
+func TestMailSender_StopsWhenContextIsCancelled(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	sender := newTestMailSender(srv)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := sender.SendEmail(ctx, EmailMessage{From: "news@example.com", To: "b@example.org", Subject: "Hi", HTMLBody: "<p>Hi</p>"})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("SendEmail() error = %v, want context.Canceled", err)
+	}
+	if len(srv.Messages()) != 0 {
+		t.Errorf("server received %d messages, want none", len(srv.Messages()))
+	}
+}
@@ -0,0 +1,96 @@
+package email
+
+import (
+	"fmt"
+
+	"backend/internal/mergetags"
+	"backend/internal/models"
+	"backend/internal/templates"
+)
+
+// Recipient is an address with its own merge data
+type Recipient struct {
+	Email string                 `json:"email"`
+	Data  map[string]interface{} `json:"data,omitempty"`
+}
+
+// RecipientError reports a recipient that was not queued
+type RecipientError struct {
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+// renderedContent is the subject and bodies sent to one recipient
+type renderedContent struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// recipients returns the addresses of to[] followed by recipients[]
+func (r *SendEmailRequest) recipients() []Recipient {
+	all := make([]Recipient, 0, len(r.To)+len(r.Recipients))
+	for _, address := range r.To {
+		all = append(all, Recipient{Email: address})
+	}
+	return append(all, r.Recipients...)
+}
+
+// personalized reports whether the request renders merge tags, which it
+// does when it carries merge data; other requests are sent verbatim
+func (r *SendEmailRequest) personalized() bool {
+	return len(r.Data) > 0 || len(r.Recipients) > 0
+}
+
+// validateMergeTags checks the merge tag syntax of the subject and bodies
+func (r *SendEmailRequest) validateMergeTags() error {
+	if err := mergetags.Validate(r.Subject); err != nil {
+		return fmt.Errorf("subject: %w", err)
+	}
+	if err := mergetags.Validate(r.HTML); err != nil {
+		return fmt.Errorf("html: %w", err)
+	}
+	if err := mergetags.Validate(r.Text); err != nil {
+		return fmt.Errorf("text: %w", err)
+	}
+	return nil
+}
+
+// render returns the content of one recipient, rendered from template when
+// the request references one
+// Recipient data overrides the global data and {{email}} defaults to the
+// recipient's address. HTML values are escaped.
+func (r *SendEmailRequest) render(recipient Recipient, template *models.TemplateVersion) (renderedContent, error) {
+	if template == nil && !r.personalized() {
+		return renderedContent{Subject: r.Subject, HTML: r.HTML, Text: r.Text}, nil
+	}
+
+	data := map[string]interface{}{"email": recipient.Email}
+	for key, value := range r.Data {
+		data[key] = value
+	}
+	for key, value := range recipient.Data {
+		data[key] = value
+	}
+
+	if template != nil {
+		rendered, err := templates.Render(template, data)
+		if err != nil {
+			return renderedContent{}, err
+		}
+		return renderedContent{Subject: rendered.Subject, HTML: rendered.HTML, Text: rendered.Text}, nil
+	}
+
+	var content renderedContent
+	var err error
+	if content.Subject, err = mergetags.Render(r.Subject, data, false); err != nil {
+		return content, fmt.Errorf("subject: %w", err)
+	}
+	if content.HTML, err = mergetags.Render(r.HTML, data, true); err != nil {
+		return content, fmt.Errorf("html: %w", err)
+	}
+	if content.Text, err = mergetags.Render(r.Text, data, false); err != nil {
+		return content, fmt.Errorf("text: %w", err)
+	}
+	return content, nil
+}
@@ -0,0 +1,141 @@
+package email
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// queuedJobs drains the jobs of a queue that was not started
+func queuedJobs(q *Queue) []SendEmailJob {
+	var jobs []SendEmailJob
+	for len(q.jobs) > 0 {
+		jobs = append(jobs, <-q.jobs)
+	}
+	return jobs
+}
+
+func TestHandleSendEmail_RendersPerRecipient(t *testing.T) {
+	app, queue := newSendTestApp(newMemoryIdempotencyRepository())
+	body := `{
+		"from": "shop@example.com",
+		"to": ["plain@example.org"],
+		"recipients": [
+			{"email": "ana@example.org", "data": {"name": "Ana", "order": {"id": 7}}},
+			{"email": "bob@example.org", "data": {"name": "<Bob>", "order": {"id": 8}, "greeting": "Hey"}},
+			{"email": "eve@example.org", "data": {"name": "Eve"}}
+		],
+		"data": {"greeting": "Hello", "order": {"id": 0}},
+		"subject": "{{greeting}} {{name|there}}, order {{order.id}}",
+		"html": "<p>{{greeting}} {{name|there}}</p><p>{{email}}</p>",
+		"text": "{{greeting}} {{name|there}}"
+	}`
+
+	status, response, _ := postSend(t, app, uuid.New(), "", body)
+	if status != fiber.StatusOK || response.Status != "ok" || response.Queued != 4 || len(response.Errors) != 0 {
+		t.Fatalf("send = %d %+v, want 4 queued", status, response)
+	}
+
+	want := map[string][3]string{
+		"plain@example.org": {"Hello there, order 0", "<p>Hello there</p><p>plain@example.org</p>", "Hello there"},
+		"ana@example.org":   {"Hello Ana, order 7", "<p>Hello Ana</p><p>ana@example.org</p>", "Hello Ana"},
+		"bob@example.org":   {"Hey <Bob>, order 8", "<p>Hey &lt;Bob&gt;</p><p>bob@example.org</p>", "Hey <Bob>"},
+		"eve@example.org":   {"Hello Eve, order 0", "<p>Hello Eve</p><p>eve@example.org</p>", "Hello Eve"},
+	}
+	for _, job := range queuedJobs(queue) {
+		got := [3]string{job.Subject, job.HTMLBody, job.TextBody}
+		expected := want[job.To]
+		expected[1] = PrepareHTML(expected[1], job.EmailRecord.MessageID, false)
+		if got != expected {
+			t.Errorf("%s got %q, want %q", job.To, got, expected)
+		}
+		if job.EmailRecord.Subject != job.Subject {
+			t.Errorf("%s record subject = %q, want %q", job.To, job.EmailRecord.Subject, job.Subject)
+		}
+	}
+}
+
+func TestHandleSendEmail_InlinesCSSAndAddsTracking(t *testing.T) {
+	app, queue := newSendTestApp(newMemoryIdempotencyRepository())
+	body := `{
+		"from": "shop@example.com",
+		"recipients": [{"email": "ana@example.org", "data": {"name": "Ana"}}],
+		"subject": "Hi",
+		"html": "<style>p { color: red }</style><p>Hi {{name}}</p><a href=\"https://example.com/shop\">Shop</a>",
+		"inline_css": true
+	}`
+
+	status, response, _ := postSend(t, app, uuid.New(), "", body)
+	if status != fiber.StatusOK || response.Queued != 1 {
+		t.Fatalf("send = %d %+v, want 1 queued", status, response)
+	}
+	job := queuedJobs(queue)[0]
+	if !strings.Contains(job.HTMLBody, `<p style="color: red;">Hi Ana</p>`) || strings.Contains(job.HTMLBody, "<style") {
+		t.Errorf("expected inlined html, got %q", job.HTMLBody)
+	}
+	if !strings.Contains(job.HTMLBody, "/track/click/") || strings.Contains(job.HTMLBody, `href="https://example.com/shop"`) {
+		t.Errorf("expected tracked links, got %q", job.HTMLBody)
+	}
+	if !strings.Contains(job.HTMLBody, "/track/open/"+strings.Trim(job.EmailRecord.MessageID, "<>")) {
+		t.Errorf("expected the open tracking pixel, got %q", job.HTMLBody)
+	}
+}
+
+func TestHandleSendEmail_ReportsRenderErrorsPerRecipient(t *testing.T) {
+	app, queue := newSendTestApp(newMemoryIdempotencyRepository())
+	body := `{
+		"from": "shop@example.com",
+		"recipients": [
+			{"email": "ana@example.org", "data": {"code": "A1"}},
+			{"email": "bob@example.org"},
+			{"email": "eve@example.org", "data": {"code": ["not", "text"]}}
+		],
+		"subject": "Your code",
+		"text": "Code: {{code}}"
+	}`
+
+	status, response, _ := postSend(t, app, uuid.New(), "", body)
+	if status != fiber.StatusOK || response.Status != "partial" || response.Queued != 1 {
+		t.Fatalf("send = %d %+v, want 1 queued", status, response)
+	}
+	if len(response.Errors) != 2 || response.Errors[0].Email != "bob@example.org" || response.Errors[1].Email != "eve@example.org" {
+		t.Fatalf("errors = %+v, want bob and eve", response.Errors)
+	}
+	if !strings.Contains(response.Errors[0].Error, "code") {
+		t.Errorf("error %q does not name the variable", response.Errors[0].Error)
+	}
+	if jobs := queuedJobs(queue); len(jobs) != 1 || jobs[0].TextBody != "Code: A1" {
+		t.Errorf("jobs = %+v, want ana's", jobs)
+	}
+
+	// Every recipient failing is reported as failed
+	body = `{"from": "shop@example.com", "recipients": [{"email": "bob@example.org"}], "subject": "Hi", "text": "{{code}}"}`
+	if _, response, _ = postSend(t, app, uuid.New(), "", body); response.Status != "failed" || response.Queued != 0 {
+		t.Errorf("response = %+v, want failed", response)
+	}
+}
+
+func TestHandleSendEmail_MergeTagValidation(t *testing.T) {
+	app, queue := newSendTestApp(newMemoryIdempotencyRepository())
+
+	// Syntax errors reject the request
+	body := `{"from": "shop@example.com", "to": ["a@example.org"], "data": {"x": 1}, "subject": "Hi {{x", "text": "t"}`
+	if status, _, _ := postSend(t, app, uuid.New(), "", body); status != fiber.StatusBadRequest {
+		t.Errorf("unclosed tag = %d, want 400", status)
+	}
+	body = `{"from": "shop@example.com", "recipients": [{"email": "not-an-address"}], "subject": "Hi", "text": "t"}`
+	if status, _, _ := postSend(t, app, uuid.New(), "", body); status != fiber.StatusBadRequest {
+		t.Errorf("invalid recipient = %d, want 400", status)
+	}
+
+	// Without merge data content is sent verbatim
+	body = `{"from": "shop@example.com", "to": ["a@example.org"], "subject": "Hi {{x", "text": "{{literal}}"}`
+	if status, _, _ := postSend(t, app, uuid.New(), "", body); status != fiber.StatusOK {
+		t.Errorf("send without data = %d, want 200", status)
+	}
+	if jobs := queuedJobs(queue); len(jobs) != 1 || jobs[0].Subject != "Hi {{x" || jobs[0].TextBody != "{{literal}}" {
+		t.Errorf("jobs = %+v, want the content unchanged", jobs)
+	}
+}
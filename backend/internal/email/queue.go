@@ -2,21 +2,39 @@ package email
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
 	"sync"
+	"time"
 
 	"backend/internal/models"
 	"backend/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
 )
 
+// JobTypeSendEmail is the failed_jobs job type of a SendEmailJob
+const JobTypeSendEmail = "send_email"
+
 
 // SendEmailJob represents an email job to be processed by the worker queue
 type SendEmailJob struct {
 	EmailRecord *models.EmailMessageRecord
+	CampaignID  *uuid.UUID // optional, links dead-lettered jobs to their campaign
 	From        string
 	To          string
 	Subject     string
 	HTMLBody    string
 	TextBody    string
+	Attachments []Attachment
+	Inline      []Attachment
+
+	DisableAutoText bool // send HTML-only mail without a generated text part
+
+	attempts int   // send attempts made so far
+	lastErr  error // error of the last attempt, kept while a retry is pending
 }
 
 // Queue represents the email job queue
@@ -26,23 +44,46 @@ type Queue struct {
 	wg          sync.WaitGroup
 	sender      EmailSender
 	emailRepo   repositories.EmailRepository
+	failedJobs  repositories.FailedJobRepository
+	retry       RetryPolicy
+	logger      zerolog.Logger
 	ctx         context.Context
 	cancel      context.CancelFunc
+
+	// Producers hold mu for reading while they send on jobs; Stop takes it
+	// for writing to mark the queue closed before closing jobs
+	mu       sync.RWMutex
+	closed   bool
+	stopping chan struct{} // closed when Stop begins, wakes blocked producers
+	retries  sync.WaitGroup
 }
 
 // NewQueue creates a new email queue with workers
-func NewQueue(workers int, sender EmailSender, emailRepo repositories.EmailRepository) *Queue {
+// Jobs that fail to send are stored in failedJobs when it is not nil
+func NewQueue(workers int, sender EmailSender, emailRepo repositories.EmailRepository, failedJobs repositories.FailedJobRepository) *Queue {
 	ctx, cancel := context.WithCancel(context.Background())
 	return &Queue{
-		jobs:      make(chan SendEmailJob, 100), // Buffered channel with capacity 100
-		workers:   workers,
-		sender:   sender,
-		emailRepo: emailRepo,
-		ctx:       ctx,
-		cancel:    cancel,
+		jobs:       make(chan SendEmailJob, 100), // Buffered channel with capacity 100
+		workers:    workers,
+		sender:     sender,
+		emailRepo:  emailRepo,
+		failedJobs: failedJobs,
+		retry:      DefaultRetryPolicy(),
+		logger:     zerolog.New(os.Stdout).With().Timestamp().Logger(),
+		ctx:        ctx,
+		cancel:     cancel,
+		stopping:   make(chan struct{}),
 	}
 }
 
+// SetRetryPolicy replaces the retry policy; it must be called before Start
+func (q *Queue) SetRetryPolicy(policy RetryPolicy) {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	q.retry = policy
+}
+
 // Start starts the worker pool
 func (q *Queue) Start() {
 	for i := 0; i < q.workers; i++ {
@@ -52,44 +93,73 @@ func (q *Queue) Start() {
 }
 
 // Stop stops the worker pool gracefully
+// Jobs already in the queue are sent before it returns. Pending retries are
+// given up and dead-lettered so they can be requeued.
 func (q *Queue) Stop() {
+	close(q.stopping)
+
+	// Wait for producers blocked on a full queue to give up
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+
+	q.retries.Wait()
 	close(q.jobs)
-	q.cancel()
 	q.wg.Wait()
+	q.cancel()
 }
 
 // Enqueue adds an email job to the queue
 func (q *Queue) Enqueue(job SendEmailJob) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueStopped
+	}
+
 	select {
 	case q.jobs <- job:
 		return nil
-	case <-q.ctx.Done():
-		return q.ctx.Err()
 	default:
 		// Queue is full
 		return ErrQueueFull
 	}
 }
 
+// EnqueueWait adds an email job to the queue, blocking while the queue is full
+// Bulk producers (the campaign dispatcher) use it for backpressure.
+func (q *Queue) EnqueueWait(ctx context.Context, job SendEmailJob) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueStopped
+	}
+
+	select {
+	case q.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-q.stopping:
+		return ErrQueueStopped
+	}
+}
+
 // worker processes email jobs from the queue
 func (q *Queue) worker(id int) {
 	defer q.wg.Done()
 
-	for {
-		select {
-		case job, ok := <-q.jobs:
-			if !ok {
-				// Channel closed
-				return
-			}
-			q.processJob(job, id)
-		case <-q.ctx.Done():
-			return
-		}
+	// Runs until Stop closes the channel, so buffered jobs are sent first
+	for job := range q.jobs {
+		q.processJob(job, id)
 	}
 }
 
-// processJob processes a single email job
+// processJob makes one send attempt for an email job
+// Transient failures (4xx replies, network errors) are retried with jittered
+// exponential backoff; permanent failures stop after the first attempt. The
+// job is re-enqueued once its backoff has passed, so deferred messages do not
+// hold a worker.
 func (q *Queue) processJob(job SendEmailJob, _ int) {
 	// Create email message
 	msg := EmailMessage{
@@ -101,24 +171,239 @@ func (q *Queue) processJob(job SendEmailJob, _ int) {
 		Headers: map[string]string{
 			"Message-ID": job.EmailRecord.MessageID,
 		},
+		CampaignID:  job.EmailRecord.CampaignID,
+		ContactID:   job.EmailRecord.ContactID,
+		ClientID:    job.EmailRecord.ClientID,
+		Attachments: job.Attachments,
+		Inline:      job.Inline,
+
+		DisableAutoText: job.DisableAutoText,
 	}
 
+	// Bookkeeping must still happen while the queue is shutting down
+	ctx := context.WithoutCancel(q.ctx)
+
 	// Send email
-	err := q.sender.SendEmail(q.ctx, msg)
+	job.attempts++
+	result, err := SendWithResult(q.ctx, q.sender, msg)
+	q.recordAttempt(ctx, job, job.attempts, result, err)
+
+	if err != nil && IsTransient(err) && job.attempts < q.retry.MaxAttempts {
+		delay := q.retry.Backoff(job.attempts)
+		q.logger.Warn().
+			Err(err).
+			Str("event", "email.send.retry").
+			Str("message_id", job.EmailRecord.MessageID).
+			Int("attempt", job.attempts).
+			Dur("delay", delay).
+			Msg("Transient send failure, retrying")
 
-	// Update status
+		job.lastErr = err
+		if q.retryLater(job, delay) {
+			return
+		}
+		// Shutting down: give up now, the job is dead-lettered and can be requeued
+	}
+
+	q.finish(ctx, job, result, err)
+}
+
+// finish stores the outcome of the last send attempt of a job
+func (q *Queue) finish(ctx context.Context, job SendEmailJob, result *SendResult, err error) {
 	if err != nil {
 		// Update to failed
-		q.emailRepo.UpdateEmailStatus(q.ctx, job.EmailRecord.ID, "failed")
-	} else {
-		// Update to sent
-		q.emailRepo.UpdateEmailStatus(q.ctx, job.EmailRecord.ID, "sent")
+		q.emailRepo.UpdateEmailStatus(ctx, job.EmailRecord.ID, "failed")
+		q.deadLetter(ctx, job, err, job.attempts)
+		return
+	}
+
+	// Update to sent
+	q.emailRepo.UpdateEmailStatus(ctx, job.EmailRecord.ID, "sent")
+	if result != nil && (result.Provider != "" || result.ProviderMessageID != "") {
+		q.storeProvider(ctx, job, result)
 	}
 }
 
+// retryLater re-enqueues job after delay, reporting false when the queue is
+// stopping
+// A retry that is still pending when the queue stops is dead-lettered.
+func (q *Queue) retryLater(job SendEmailJob, delay time.Duration) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+
+	q.retries.Add(1)
+	go func() {
+		defer q.retries.Done()
+
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			if err := q.EnqueueWait(q.ctx, job); err == nil {
+				return
+			}
+		case <-q.stopping:
+		}
+
+		q.finish(context.WithoutCancel(q.ctx), job, nil, job.lastErr)
+	}()
+	return true
+}
+
+// storeProvider records which provider sent an email and the ID it assigned
+func (q *Queue) storeProvider(ctx context.Context, job SendEmailJob, result *SendResult) {
+	if err := q.emailRepo.SetProvider(ctx, job.EmailRecord.ID, result.Provider, result.ProviderMessageID); err != nil {
+		// SNS events still match on our Message-ID header
+		q.logger.Warn().
+			Err(err).
+			Str("event", "email.provider.record.failed").
+			Str("message_id", job.EmailRecord.MessageID).
+			Str("provider", result.Provider).
+			Str("provider_message_id", result.ProviderMessageID).
+			Msg("Failed to store email provider")
+	}
+}
+
+// recordAttempt stores one send attempt as an "attempt" email event
+func (q *Queue) recordAttempt(ctx context.Context, job SendEmailJob, attempt int, result *SendResult, sendErr error) {
+	meta := map[string]interface{}{
+		"attempt": attempt,
+		"outcome": "sent",
+	}
+	if result != nil && result.Provider != "" {
+		meta["provider"] = result.Provider
+	}
+	if sendErr != nil {
+		for key, value := range smtpErrorMeta(sendErr) {
+			meta[key] = value
+		}
+		meta["outcome"] = "failed"
+		if IsTransient(sendErr) && attempt < q.retry.MaxAttempts {
+			meta["outcome"] = "deferred"
+		}
+	}
+
+	if err := q.emailRepo.CreateEmailEventWithMeta(ctx, job.EmailRecord.ID, "attempt", meta); err != nil {
+		q.logger.Warn().
+			Err(err).
+			Str("event", "email.attempt.record.failed").
+			Str("message_id", job.EmailRecord.MessageID).
+			Int("attempt", attempt).
+			Msg("Failed to record send attempt")
+	}
+}
+
+// failedSendPayload is the failed_jobs payload of a SendEmailJob
+type failedSendPayload struct {
+	EmailID    uuid.UUID  `json:"email_id"`
+	MessageID  string     `json:"message_id"`
+	CampaignID *uuid.UUID `json:"campaign_id,omitempty"`
+	ClientID   *uuid.UUID `json:"client_id,omitempty"`
+	ContactID  *uuid.UUID `json:"contact_id,omitempty"`
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Subject    string     `json:"subject"`
+	HTMLBody   string     `json:"html_body"`
+	TextBody   string     `json:"text_body,omitempty"`
+
+	Attachments []Attachment `json:"attachments,omitempty"`
+	Inline      []Attachment `json:"inline,omitempty"`
+
+	DisableAutoText bool `json:"disable_auto_text,omitempty"`
+}
+
+// deadLetter stores a job that failed to send in failed_jobs
+func (q *Queue) deadLetter(ctx context.Context, job SendEmailJob, sendErr error, attempts int) {
+	if q.failedJobs == nil {
+		return
+	}
+
+	payload, err := json.Marshal(failedSendPayload{
+		EmailID:    job.EmailRecord.ID,
+		MessageID:  job.EmailRecord.MessageID,
+		CampaignID: job.CampaignID,
+		ClientID:   job.EmailRecord.ClientID,
+		ContactID:  job.EmailRecord.ContactID,
+		From:       job.From,
+		To:         job.To,
+		Subject:    job.Subject,
+		HTMLBody:   job.HTMLBody,
+		TextBody:   job.TextBody,
+
+		Attachments: job.Attachments,
+		Inline:      job.Inline,
+
+		DisableAutoText: job.DisableAutoText,
+	})
+	if err != nil {
+		q.logger.Error().
+			Err(err).
+			Str("event", "email.dead_letter.failed").
+			Str("message_id", job.EmailRecord.MessageID).
+			Msg("Failed to marshal failed job")
+		return
+	}
+
+	failed := &models.FailedJob{
+		Queue:        models.FailedJobQueueMemory,
+		JobType:      JobTypeSendEmail,
+		Payload:      payload,
+		ErrorMessage: sendErr.Error(),
+		Attempts:     attempts,
+		CampaignID:   job.CampaignID,
+	}
+	if err := q.failedJobs.Create(ctx, failed); err != nil {
+		q.logger.Error().
+			Err(err).
+			Str("event", "email.dead_letter.failed").
+			Str("message_id", job.EmailRecord.MessageID).
+			Msg("Failed to store failed job")
+	}
+}
+
+// Requeue puts a job stored by deadLetter back on the queue
+func (q *Queue) Requeue(ctx context.Context, payload []byte) error {
+	var p failedSendPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("invalid failed job payload: %w", err)
+	}
+
+	if err := q.emailRepo.UpdateEmailStatus(ctx, p.EmailID, "queued"); err != nil {
+		return err
+	}
+
+	return q.Enqueue(SendEmailJob{
+		EmailRecord: &models.EmailMessageRecord{
+			ID:         p.EmailID,
+			MessageID:  p.MessageID,
+			From:       p.From,
+			To:         p.To,
+			Subject:    p.Subject,
+			Status:     "queued",
+			CampaignID: p.CampaignID,
+			ClientID:   p.ClientID,
+			ContactID:  p.ContactID,
+		},
+		CampaignID:  p.CampaignID,
+		From:        p.From,
+		To:          p.To,
+		Subject:     p.Subject,
+		HTMLBody:    p.HTMLBody,
+		TextBody:    p.TextBody,
+		Attachments: p.Attachments,
+		Inline:      p.Inline,
+
+		DisableAutoText: p.DisableAutoText,
+	})
+}
+
 // Errors
 var (
-	ErrQueueFull = &QueueError{Message: "email queue is full"}
+	ErrQueueFull    = &QueueError{Message: "email queue is full"}
+	ErrQueueStopped = &QueueError{Message: "email queue is stopped"}
 )
 
 type QueueError struct {
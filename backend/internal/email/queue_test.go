@@ -0,0 +1,426 @@
+package email
+
+import (
+	"context"
+	"net/textproto"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// mockEmailRepository records status updates and events
+type mockEmailRepository struct {
+	mu        sync.Mutex
+	statuses  map[uuid.UUID]string
+	providers map[uuid.UUID]SendResult
+	events    []map[string]interface{}
+}
+
+func newMockEmailRepository() *mockEmailRepository {
+	return &mockEmailRepository{
+		statuses:  make(map[uuid.UUID]string),
+		providers: make(map[uuid.UUID]SendResult),
+	}
+}
+
+func (m *mockEmailRepository) CreateEmailMessage(ctx context.Context, msg models.EmailMessageRecord) error {
+	return nil
+}
+
+func (m *mockEmailRepository) UpdateEmailStatus(ctx context.Context, id uuid.UUID, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statuses[id] = status
+	return nil
+}
+
+func (m *mockEmailRepository) SetProvider(ctx context.Context, id uuid.UUID, provider, providerMessageID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.providers[id] = SendResult{Provider: provider, ProviderMessageID: providerMessageID}
+	return nil
+}
+
+func (m *mockEmailRepository) AddEmailEvent(ctx context.Context, event models.EmailEventRecord) error {
+	return nil
+}
+
+func (m *mockEmailRepository) GetEmailByMessageID(ctx context.Context, messageID string) (*models.EmailMessageRecord, error) {
+	return nil, nil
+}
+
+func (m *mockEmailRepository) CreateEmailEventWithMeta(ctx context.Context, emailID uuid.UUID, eventType string, meta map[string]interface{}) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if eventType == "attempt" {
+		m.events = append(m.events, meta)
+	}
+	return nil
+}
+
+func (m *mockEmailRepository) CheckSNSMessageIdExists(ctx context.Context, snsMessageId string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockEmailRepository) CheckOpenEventExistsToday(ctx context.Context, emailID uuid.UUID) (bool, error) {
+	return false, nil
+}
+
+func (m *mockEmailRepository) CheckClickEventExists(ctx context.Context, emailID uuid.UUID, targetURL string) (bool, error) {
+	return false, nil
+}
+
+// fakeFailedJobs records dead-lettered jobs
+type fakeFailedJobs struct {
+	jobs []models.FailedJob
+}
+
+func (f *fakeFailedJobs) Create(ctx context.Context, job *models.FailedJob) error {
+	f.jobs = append(f.jobs, *job)
+	return nil
+}
+
+func (f *fakeFailedJobs) GetByID(ctx context.Context, id uuid.UUID) (*models.FailedJob, error) {
+	return nil, repositories.ErrFailedJobNotFound
+}
+
+func (f *fakeFailedJobs) List(ctx context.Context, filter repositories.FailedJobFilter) ([]models.FailedJob, int64, error) {
+	return f.jobs, int64(len(f.jobs)), nil
+}
+
+func (f *fakeFailedJobs) ClaimRetry(ctx context.Context, id uuid.UUID, previous *time.Time, retriedAt time.Time) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeFailedJobs) ReleaseRetry(ctx context.Context, id uuid.UUID, retriedAt time.Time, previous *time.Time) error {
+	return nil
+}
+
+func (f *fakeFailedJobs) Delete(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (f *fakeFailedJobs) Purge(ctx context.Context, filter repositories.FailedJobPurgeFilter) (int64, error) {
+	return 0, nil
+}
+
+// scriptedSender returns the scripted errors in order, then succeeds
+type scriptedSender struct {
+	mu     sync.Mutex
+	errors []error
+	calls  int
+}
+
+func (s *scriptedSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls++
+	if len(s.errors) == 0 {
+		return nil
+	}
+	err := s.errors[0]
+	s.errors = s.errors[1:]
+	return err
+}
+
+func runQueueJob(t *testing.T, sender EmailSender, repo *mockEmailRepository, maxAttempts int) uuid.UUID {
+	t.Helper()
+
+	q := NewQueue(1, sender, repo, nil)
+	q.SetRetryPolicy(RetryPolicy{MaxAttempts: maxAttempts, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	q.Start()
+
+	record := &models.EmailMessageRecord{ID: uuid.New(), MessageID: "<test@example.com>"}
+	err := q.Enqueue(SendEmailJob{
+		EmailRecord: record,
+		From:        "sender@example.com",
+		To:          "user@example.com",
+		Subject:     "Test",
+		HTMLBody:    "<p>Test</p>",
+	})
+	if err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+
+	waitForStatus(t, repo, record.ID)
+	q.Stop()
+	return record.ID
+}
+
+// waitForStatus waits until the queue stored a final status for an email
+func waitForStatus(t *testing.T, repo *mockEmailRepository, id uuid.UUID) string {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		repo.mu.Lock()
+		status := repo.statuses[id]
+		repo.mu.Unlock()
+		if status != "" {
+			return status
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("email %s was not processed in time", id)
+	return ""
+}
+
+func TestQueue_RetriesTransientFailures(t *testing.T) {
+	repo := newMockEmailRepository()
+	sender := &scriptedSender{errors: []error{
+		NewSMTPError(SMTPOpRcpt, &textproto.Error{Code: 421, Msg: "4.7.0 Greylisted"}),
+		NewSMTPError(SMTPOpConnect, context.DeadlineExceeded),
+	}}
+
+	id := runQueueJob(t, sender, repo, 4)
+
+	if sender.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", sender.calls)
+	}
+	if repo.statuses[id] != "sent" {
+		t.Errorf("expected status sent, got %q", repo.statuses[id])
+	}
+	if len(repo.events) != 3 {
+		t.Fatalf("expected 3 attempt events, got %d", len(repo.events))
+	}
+	if repo.events[0]["outcome"] != "deferred" || repo.events[0]["smtp_code"] != 421 || repo.events[0]["enhanced_status"] != "4.7.0" {
+		t.Errorf("unexpected first attempt event: %v", repo.events[0])
+	}
+	if repo.events[2]["outcome"] != "sent" || repo.events[2]["attempt"] != 3 {
+		t.Errorf("unexpected last attempt event: %v", repo.events[2])
+	}
+}
+
+func TestQueue_PermanentFailureIsNotRetried(t *testing.T) {
+	repo := newMockEmailRepository()
+	sender := &scriptedSender{errors: []error{
+		NewSMTPError(SMTPOpRcpt, &textproto.Error{Code: 550, Msg: "5.1.1 No such user"}),
+	}}
+
+	id := runQueueJob(t, sender, repo, 4)
+
+	if sender.calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", sender.calls)
+	}
+	if repo.statuses[id] != "failed" {
+		t.Errorf("expected status failed, got %q", repo.statuses[id])
+	}
+	if len(repo.events) != 1 || repo.events[0]["outcome"] != "failed" || repo.events[0]["smtp_code"] != 550 {
+		t.Errorf("unexpected attempt events: %v", repo.events)
+	}
+}
+
+func TestQueue_GivesUpAfterMaxAttempts(t *testing.T) {
+	repo := newMockEmailRepository()
+	greylisted := NewSMTPError(SMTPOpRcpt, &textproto.Error{Code: 451, Msg: "4.7.1 Try later"})
+	sender := &scriptedSender{errors: []error{greylisted, greylisted, greylisted, greylisted}}
+
+	id := runQueueJob(t, sender, repo, 3)
+
+	if sender.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", sender.calls)
+	}
+	if repo.statuses[id] != "failed" {
+		t.Errorf("expected status failed, got %q", repo.statuses[id])
+	}
+	if last := repo.events[len(repo.events)-1]; last["outcome"] != "failed" {
+		t.Errorf("expected last attempt to be final, got %v", last)
+	}
+}
+
+// recipientSender fails transiently for one recipient and succeeds for others
+type recipientSender struct {
+	failing string
+}
+
+func (s recipientSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	if msg.To == s.failing {
+		return NewSMTPError(SMTPOpRcpt, &textproto.Error{Code: 451, Msg: "4.7.1 Try later"})
+	}
+	return nil
+}
+
+func TestQueue_DeferredRetryDoesNotHoldWorker(t *testing.T) {
+	repo := newMockEmailRepository()
+	failed := &fakeFailedJobs{}
+	q := NewQueue(1, recipientSender{failing: "deferred@example.com"}, repo, failed)
+	q.SetRetryPolicy(RetryPolicy{MaxAttempts: 4, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	q.Start()
+
+	deferred := &models.EmailMessageRecord{ID: uuid.New(), MessageID: "<deferred@example.com>"}
+	next := &models.EmailMessageRecord{ID: uuid.New(), MessageID: "<next@example.com>"}
+	for _, job := range []SendEmailJob{
+		{EmailRecord: deferred, To: "deferred@example.com", Subject: "Test", HTMLBody: "<p>Test</p>"},
+		{EmailRecord: next, To: "next@example.com", Subject: "Test", HTMLBody: "<p>Test</p>"},
+	} {
+		if err := q.Enqueue(job); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+	}
+
+	// The only worker is free while the first job waits for its retry
+	if status := waitForStatus(t, repo, next.ID); status != "sent" {
+		t.Errorf("expected second job to be sent, got %q", status)
+	}
+
+	// Stopping gives up the pending retry and dead-letters it
+	q.Stop()
+	if repo.statuses[deferred.ID] != "failed" {
+		t.Errorf("expected deferred job to fail on shutdown, got %q", repo.statuses[deferred.ID])
+	}
+	if len(failed.jobs) != 1 || failed.jobs[0].Attempts != 1 {
+		t.Errorf("expected deferred job to be dead-lettered after 1 attempt, got %+v", failed.jobs)
+	}
+	if err := q.Enqueue(SendEmailJob{EmailRecord: next}); err != ErrQueueStopped {
+		t.Errorf("expected ErrQueueStopped after Stop, got %v", err)
+	}
+}
+
+// resultSender succeeds and reports a send result
+type resultSender struct {
+	result SendResult
+}
+
+func (s resultSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	return nil
+}
+
+func (s resultSender) SendEmailWithResult(ctx context.Context, msg EmailMessage) (*SendResult, error) {
+	result := s.result
+	return &result, nil
+}
+
+func TestQueue_StoresProvider(t *testing.T) {
+	repo := newMockEmailRepository()
+	want := SendResult{Provider: "ses-primary", ProviderMessageID: "ses-message-id"}
+
+	id := runQueueJob(t, resultSender{want}, repo, 1)
+
+	if repo.statuses[id] != "sent" {
+		t.Errorf("expected status sent, got %q", repo.statuses[id])
+	}
+	if repo.providers[id] != want {
+		t.Errorf("expected provider %+v to be stored, got %+v", want, repo.providers[id])
+	}
+	if len(repo.events) != 1 || repo.events[0]["provider"] != "ses-primary" {
+		t.Errorf("expected provider in attempt event, got %v", repo.events)
+	}
+}
+
+// gatedSender blocks every send until its gate is closed
+type gatedSender struct {
+	gate chan struct{}
+}
+
+func (s gatedSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	<-s.gate
+	return ctx.Err()
+}
+
+func TestQueue_StopDrainsBufferedJobs(t *testing.T) {
+	repo := newMockEmailRepository()
+	sender := gatedSender{gate: make(chan struct{})}
+	q := NewQueue(1, sender, repo, nil)
+	q.Start()
+
+	var ids []uuid.UUID
+	for i := 0; i < 3; i++ {
+		record := &models.EmailMessageRecord{ID: uuid.New(), MessageID: "<drain@example.com>"}
+		if err := q.Enqueue(SendEmailJob{EmailRecord: record, To: "user@example.com", Subject: "Test", HTMLBody: "<p>Test</p>"}); err != nil {
+			t.Fatalf("enqueue failed: %v", err)
+		}
+		ids = append(ids, record.ID)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		q.Stop()
+		close(stopped)
+	}()
+	close(sender.gate)
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	for _, id := range ids {
+		if repo.statuses[id] != "sent" {
+			t.Errorf("expected buffered job %s to be sent before Stop returned, got %q", id, repo.statuses[id])
+		}
+	}
+}
+
+// rejectOnceSender fails its first send permanently and records every message
+type rejectOnceSender struct {
+	mu       sync.Mutex
+	messages []EmailMessage
+}
+
+func (s *rejectOnceSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+	if len(s.messages) == 1 {
+		return NewSMTPError(SMTPOpData, &textproto.Error{Code: 554, Msg: "5.7.1 Rejected"})
+	}
+	return nil
+}
+
+func TestQueue_RequeueRestoresClientAndContact(t *testing.T) {
+	repo := newMockEmailRepository()
+	failed := &fakeFailedJobs{}
+	sender := &rejectOnceSender{}
+	q := NewQueue(1, sender, repo, failed)
+	q.Start()
+	defer q.Stop()
+
+	clientID, contactID := uuid.New(), uuid.New()
+	record := &models.EmailMessageRecord{
+		ID:        uuid.New(),
+		MessageID: "<requeue@example.com>",
+		ClientID:  &clientID,
+		ContactID: &contactID,
+	}
+	if err := q.Enqueue(SendEmailJob{EmailRecord: record, To: "user@example.com", Subject: "Test", HTMLBody: "<p>Test</p>"}); err != nil {
+		t.Fatalf("enqueue failed: %v", err)
+	}
+	if status := waitForStatus(t, repo, record.ID); status != "failed" {
+		t.Fatalf("expected status failed, got %q", status)
+	}
+	if len(failed.jobs) != 1 {
+		t.Fatalf("expected 1 dead-lettered job, got %d", len(failed.jobs))
+	}
+
+	if err := q.Requeue(context.Background(), failed.jobs[0].Payload); err != nil {
+		t.Fatalf("requeue failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		repo.mu.Lock()
+		status := repo.statuses[record.ID]
+		repo.mu.Unlock()
+		if status == "sent" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("requeued email was not sent, status %q", status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	msg := sender.messages[len(sender.messages)-1]
+	if msg.ClientID == nil || *msg.ClientID != clientID {
+		t.Errorf("expected client %s on the requeued send, got %v", clientID, msg.ClientID)
+	}
+	if msg.ContactID == nil || *msg.ContactID != contactID {
+		t.Errorf("expected contact %s on the requeued send, got %v", contactID, msg.ContactID)
+	}
+}
@@ -0,0 +1,45 @@
+package email
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how the queue retries transient send failures
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first
+	BaseDelay   time.Duration // delay before the second attempt
+	MaxDelay    time.Duration // upper bound for a single delay
+}
+
+// DefaultRetryPolicy returns the policy used by NewQueue
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		BaseDelay:   2 * time.Second,
+		MaxDelay:    time.Minute,
+	}
+}
+
+// Backoff returns the jittered delay to wait after the given failed attempt (1-based)
+// The delay doubles with every attempt up to MaxDelay; the actual wait is picked
+// uniformly from the upper half of that window so retries do not synchronise.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
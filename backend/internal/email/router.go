@@ -0,0 +1,385 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/mail"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// Message streams matched by routing rules
+const (
+	StreamTransactional = "transactional"
+	StreamCampaign      = "campaign"
+)
+
+// ErrNoProviderAvailable is returned when the circuit of every candidate provider is open
+var ErrNoProviderAvailable = errors.New("no email provider available")
+
+// MessageStream returns the routing stream of msg: its Stream, or campaign
+// for campaign sends and transactional otherwise
+func MessageStream(msg EmailMessage) string {
+	if msg.Stream != "" {
+		return msg.Stream
+	}
+	if msg.CampaignID != nil {
+		return StreamCampaign
+	}
+	return StreamTransactional
+}
+
+// Provider is a named sender of a RoutingSender
+type Provider struct {
+	Name   string
+	Sender EmailSender
+	Weight int // share of the traffic no rule matches; 0 only takes rule matches and failover
+}
+
+// RouteRule sends the messages it matches to Providers, in order
+// Empty criteria match every message; a message uses the first matching rule.
+type RouteRule struct {
+	ClientID  *uuid.UUID
+	Stream    string
+	Domains   []string // recipient domains
+	Providers []string
+}
+
+// matches reports whether msg meets every criterion of the rule
+func (r *RouteRule) matches(msg EmailMessage) bool {
+	if r.ClientID != nil && (msg.ClientID == nil || *msg.ClientID != *r.ClientID) {
+		return false
+	}
+	if r.Stream != "" && r.Stream != MessageStream(msg) {
+		return false
+	}
+	if len(r.Domains) > 0 {
+		domain := recipientDomain(msg.To)
+		for _, d := range r.Domains {
+			if strings.EqualFold(d, domain) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// ProviderError is returned by RoutingSender when a provider fails a send
+type ProviderError struct {
+	Provider string
+	Err      error
+}
+
+// Error implements the error interface
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("provider %s: %v", e.Provider, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// routedProvider is a provider with its circuit breaker
+type routedProvider struct {
+	Provider
+	breaker *circuitBreaker
+}
+
+// RoutingSender implements EmailSender across several named providers.
+// Messages go to the providers of the first matching rule, or to a provider
+// picked by weight. Connection and infrastructure errors fail over to the next
+// candidate and count towards the provider's circuit breaker; other errors
+// (e.g. a rejected recipient) are returned as is.
+type RoutingSender struct {
+	providers []*routedProvider
+	byName    map[string]*routedProvider
+	rules     []RouteRule
+	logger    zerolog.Logger
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewRoutingSender creates a routing sender
+// Providers are tried in the order given when none has a weight.
+func NewRoutingSender(providers []Provider, rules []RouteRule, breaker BreakerConfig) (*RoutingSender, error) {
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("at least one provider is required")
+	}
+
+	r := &RoutingSender{
+		byName: make(map[string]*routedProvider),
+		rules:  rules,
+		logger: zerolog.New(os.Stdout).With().Timestamp().Logger(),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, p := range providers {
+		if p.Name == "" || p.Sender == nil {
+			return nil, fmt.Errorf("provider name and sender are required")
+		}
+		if _, exists := r.byName[p.Name]; exists {
+			return nil, fmt.Errorf("duplicate provider %q", p.Name)
+		}
+		if p.Weight < 0 {
+			return nil, fmt.Errorf("provider %q has a negative weight", p.Name)
+		}
+		routed := &routedProvider{Provider: p, breaker: newCircuitBreaker(breaker)}
+		r.providers = append(r.providers, routed)
+		r.byName[p.Name] = routed
+	}
+	for i, rule := range rules {
+		if len(rule.Providers) == 0 {
+			return nil, fmt.Errorf("rule %d has no providers", i)
+		}
+		for _, name := range rule.Providers {
+			if _, ok := r.byName[name]; !ok {
+				return nil, fmt.Errorf("rule %d uses unknown provider %q", i, name)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// SendEmail sends msg through the first available provider that accepts it
+func (r *RoutingSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	_, err := r.SendEmailWithResult(ctx, msg)
+	return err
+}
+
+// SendEmailWithResult sends msg and reports the provider that accepted it
+// Failures are returned as *ProviderError, or ErrNoProviderAvailable when no
+// candidate could be tried.
+func (r *RoutingSender) SendEmailWithResult(ctx context.Context, msg EmailMessage) (*SendResult, error) {
+	var lastErr error
+	for _, p := range r.candidates(msg) {
+		if !p.breaker.allow() {
+			continue
+		}
+
+		result, err := SendWithResult(ctx, p.Sender, msg)
+		if err == nil {
+			p.breaker.success()
+			result.Provider = p.Name
+			return result, nil
+		}
+
+		lastErr = &ProviderError{Provider: p.Name, Err: err}
+		if !isInfrastructureError(err) {
+			// The provider is healthy; another one would fail the same way
+			p.breaker.success()
+			return nil, lastErr
+		}
+
+		if p.breaker.failure() {
+			r.logger.Warn().
+				Str("event", "email.provider.circuit_open").
+				Str("provider", p.Name).
+				Msg("Email provider circuit opened")
+		}
+		if !beforeMessage(err) {
+			// The provider may have accepted the message; another one would duplicate it
+			return nil, lastErr
+		}
+		r.logger.Warn().
+			Err(err).
+			Str("event", "email.provider.failover").
+			Str("provider", p.Name).
+			Str("message_id", msg.Headers["Message-ID"]).
+			Msg("Email provider failed, trying next provider")
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if lastErr == nil {
+		return nil, ErrNoProviderAvailable
+	}
+	return nil, lastErr
+}
+
+// candidates returns the providers to try for msg, in order
+func (r *RoutingSender) candidates(msg EmailMessage) []*routedProvider {
+	for i := range r.rules {
+		if r.rules[i].matches(msg) {
+			candidates := make([]*routedProvider, len(r.rules[i].Providers))
+			for j, name := range r.rules[i].Providers {
+				candidates[j] = r.byName[name]
+			}
+			return candidates
+		}
+	}
+	return r.weighted()
+}
+
+// weighted orders the weighted providers by a weighted random draw, followed
+// by the unweighted ones in declaration order
+func (r *RoutingSender) weighted() []*routedProvider {
+	var pool, rest []*routedProvider
+	total := 0
+	for _, p := range r.providers {
+		if p.Weight > 0 {
+			pool = append(pool, p)
+			total += p.Weight
+		} else {
+			rest = append(rest, p)
+		}
+	}
+
+	ordered := make([]*routedProvider, 0, len(r.providers))
+	r.mu.Lock()
+	for len(pool) > 0 {
+		n := r.rand.Intn(total)
+		for i, p := range pool {
+			if n < p.Weight {
+				ordered = append(ordered, p)
+				total -= p.Weight
+				pool = append(pool[:i], pool[i+1:]...)
+				break
+			}
+			n -= p.Weight
+		}
+	}
+	r.mu.Unlock()
+
+	return append(ordered, rest...)
+}
+
+// isInfrastructureError reports whether err means the provider itself is
+// unavailable (connection, TLS, authentication or server errors) rather than
+// the message being refused
+func isInfrastructureError(err error) bool {
+	var smtpErr *SMTPError
+	if errors.As(err, &smtpErr) {
+		switch {
+		case smtpErr.Code == 0, smtpErr.Code == 421:
+			return true
+		case smtpErr.Op == SMTPOpConnect, smtpErr.Op == SMTPOpStartTLS, smtpErr.Op == SMTPOpAuth:
+			return true
+		}
+		return false
+	}
+
+	var sesErr *SESError
+	if errors.As(err, &sesErr) {
+		return sesErr.StatusCode == 0 || sesErr.StatusCode >= 500
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+// beforeMessage reports whether an infrastructure error happened before the
+// provider could have accepted the message, so sending it elsewhere is safe
+// A connection dropped while the message data was written or acknowledged is
+// ambiguous: the server may have queued it already.
+func beforeMessage(err error) bool {
+	var smtpErr *SMTPError
+	if errors.As(err, &smtpErr) && smtpErr.Code == 0 {
+		switch smtpErr.Op {
+		case SMTPOpConnect, SMTPOpStartTLS, SMTPOpAuth, SMTPOpMail:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// recipientDomain returns the lower-cased domain of an address like
+// "user@example.com" or "User <user@example.com>"
+func recipientDomain(to string) string {
+	if addr, err := mail.ParseAddress(to); err == nil {
+		to = addr.Address
+	}
+	if i := strings.LastIndex(to, "@"); i != -1 {
+		return strings.ToLower(strings.TrimSuffix(to[i+1:], ">"))
+	}
+	return ""
+}
+
+// BreakerConfig configures the circuit breaker of each routing provider
+type BreakerConfig struct {
+	FailureThreshold int           // consecutive infrastructure failures that open the circuit (default 5)
+	Cooldown         time.Duration // how long an open circuit skips the provider (default 30s)
+}
+
+// circuitBreaker skips a provider after consecutive failures.
+// Once the cooldown has passed, a single trial send is let through: success
+// closes the circuit, failure opens it for another cooldown.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time // zero while closed
+	trial    bool      // a half-open trial send is in flight
+}
+
+// newCircuitBreaker creates a closed circuit breaker
+func newCircuitBreaker(config BreakerConfig) *circuitBreaker {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 5
+	}
+	if config.Cooldown <= 0 {
+		config.Cooldown = 30 * time.Second
+	}
+	return &circuitBreaker{
+		threshold: config.FailureThreshold,
+		cooldown:  config.Cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow reports whether a send may be attempted
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if b.trial || b.now().Sub(b.openedAt) < b.cooldown {
+		return false
+	}
+	b.trial = true
+	return true
+}
+
+// success closes the circuit
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+	b.openedAt = time.Time{}
+	b.trial = false
+}
+
+// failure counts a failed send and reports whether it opened the circuit
+func (b *circuitBreaker) failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.trial || (b.openedAt.IsZero() && b.failures >= b.threshold) {
+		b.openedAt = b.now()
+		b.trial = false
+		return true
+	}
+	return false
+}
@@ -0,0 +1,253 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// stubSender returns err for every send and counts its calls
+type stubSender struct {
+	err   error
+	calls int
+}
+
+func (s *stubSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	s.calls++
+	return s.err
+}
+
+var (
+	errConnect    = NewSMTPError(SMTPOpConnect, errors.New("connection refused"))
+	errNoSuchRcpt = NewSMTPError(SMTPOpRcpt, &textproto.Error{Code: 550, Msg: "5.1.1 No such user"})
+)
+
+func newTestRouter(t *testing.T, providers []Provider, rules []RouteRule) *RoutingSender {
+	t.Helper()
+	router, err := NewRoutingSender(providers, rules, BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})
+	if err != nil {
+		t.Fatalf("failed to create routing sender: %v", err)
+	}
+	return router
+}
+
+func TestRoutingSender_Rules(t *testing.T) {
+	clientID := uuid.New()
+	campaignID := uuid.New()
+	senders := map[string]*stubSender{"default": {}, "client": {}, "campaign": {}, "gmail": {}}
+	router := newTestRouter(t, []Provider{
+		{Name: "default", Sender: senders["default"]},
+		{Name: "client", Sender: senders["client"]},
+		{Name: "campaign", Sender: senders["campaign"]},
+		{Name: "gmail", Sender: senders["gmail"]},
+	}, []RouteRule{
+		{ClientID: &clientID, Providers: []string{"client"}},
+		{Stream: StreamCampaign, Providers: []string{"campaign"}},
+		{Domains: []string{"gmail.com"}, Providers: []string{"gmail"}},
+	})
+
+	tests := []struct {
+		name string
+		msg  EmailMessage
+		want string
+	}{
+		{"client rule", EmailMessage{To: "a@gmail.com", ClientID: &clientID, CampaignID: &campaignID}, "client"},
+		{"campaign stream", EmailMessage{To: "a@gmail.com", CampaignID: &campaignID}, "campaign"},
+		{"explicit stream", EmailMessage{To: "a@example.com", Stream: StreamCampaign}, "campaign"},
+		{"recipient domain", EmailMessage{To: "User <a@GMail.com>"}, "gmail"},
+		{"no rule", EmailMessage{To: "a@example.com"}, "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := router.SendEmailWithResult(context.Background(), tt.msg)
+			if err != nil {
+				t.Fatalf("expected send to succeed, got: %v", err)
+			}
+			if result.Provider != tt.want {
+				t.Errorf("expected provider %q, got %q", tt.want, result.Provider)
+			}
+		})
+	}
+}
+
+func TestRoutingSender_Weights(t *testing.T) {
+	heavy, light := &stubSender{}, &stubSender{}
+	router := newTestRouter(t, []Provider{
+		{Name: "heavy", Sender: heavy, Weight: 9},
+		{Name: "light", Sender: light, Weight: 1},
+	}, nil)
+	router.rand = rand.New(rand.NewSource(1))
+
+	for i := 0; i < 1000; i++ {
+		if err := router.SendEmail(context.Background(), EmailMessage{To: "a@example.com"}); err != nil {
+			t.Fatalf("expected send to succeed, got: %v", err)
+		}
+	}
+	if heavy.calls < 850 || heavy.calls > 950 {
+		t.Errorf("expected about 900 sends through the heavy provider, got %d (light %d)", heavy.calls, light.calls)
+	}
+}
+
+func TestRoutingSender_FailsOverOnInfrastructureErrors(t *testing.T) {
+	primary, secondary := &stubSender{err: errConnect}, &stubSender{}
+	router := newTestRouter(t, []Provider{
+		{Name: "primary", Sender: primary},
+		{Name: "secondary", Sender: secondary},
+	}, nil)
+
+	result, err := router.SendEmailWithResult(context.Background(), EmailMessage{To: "a@example.com"})
+	if err != nil {
+		t.Fatalf("expected failover to succeed, got: %v", err)
+	}
+	if result.Provider != "secondary" || primary.calls != 1 || secondary.calls != 1 {
+		t.Errorf("expected primary then secondary, got provider %q (%d/%d calls)", result.Provider, primary.calls, secondary.calls)
+	}
+}
+
+func TestRoutingSender_DoesNotFailOverAfterMessageData(t *testing.T) {
+	for _, op := range []string{SMTPOpWrite, SMTPOpClose} {
+		t.Run(op, func(t *testing.T) {
+			dropped := NewSMTPError(op, errors.New("connection reset by peer"))
+			primary, secondary := &stubSender{err: dropped}, &stubSender{}
+			router := newTestRouter(t, []Provider{
+				{Name: "primary", Sender: primary},
+				{Name: "secondary", Sender: secondary},
+			}, nil)
+
+			err := router.SendEmail(context.Background(), EmailMessage{To: "a@example.com"})
+			var providerErr *ProviderError
+			if !errors.As(err, &providerErr) || providerErr.Provider != "primary" {
+				t.Fatalf("expected a ProviderError from primary, got: %v", err)
+			}
+			if secondary.calls != 0 {
+				t.Errorf("expected no failover once the message was sent, got %d secondary calls", secondary.calls)
+			}
+		})
+	}
+}
+
+func TestRoutingSender_DoesNotFailOverRejections(t *testing.T) {
+	primary, secondary := &stubSender{err: errNoSuchRcpt}, &stubSender{}
+	router := newTestRouter(t, []Provider{
+		{Name: "primary", Sender: primary},
+		{Name: "secondary", Sender: secondary},
+	}, nil)
+
+	err := router.SendEmail(context.Background(), EmailMessage{To: "a@example.com"})
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Provider != "primary" {
+		t.Fatalf("expected a ProviderError from primary, got: %v", err)
+	}
+	if IsTransient(err) || secondary.calls != 0 {
+		t.Errorf("expected a permanent error without failover, got transient=%v, %d secondary calls", IsTransient(err), secondary.calls)
+	}
+	if meta := smtpErrorMeta(err); meta["provider"] != "primary" || meta["smtp_code"] != 550 {
+		t.Errorf("unexpected attempt meta: %v", meta)
+	}
+}
+
+func TestRoutingSender_CircuitBreaker(t *testing.T) {
+	primary, secondary := &stubSender{err: errConnect}, &stubSender{}
+	router := newTestRouter(t, []Provider{
+		{Name: "primary", Sender: primary},
+		{Name: "secondary", Sender: secondary},
+	}, nil)
+	now := time.Now()
+	router.byName["primary"].breaker.now = func() time.Time { return now }
+	send := func() {
+		t.Helper()
+		if err := router.SendEmail(context.Background(), EmailMessage{To: "a@example.com"}); err != nil {
+			t.Fatalf("expected send to succeed, got: %v", err)
+		}
+	}
+
+	// Two failures open the circuit; the third send skips primary
+	send()
+	send()
+	send()
+	if primary.calls != 2 || secondary.calls != 3 {
+		t.Fatalf("expected open circuit to skip primary, got %d/%d calls", primary.calls, secondary.calls)
+	}
+
+	// After the cooldown one trial send goes to primary and succeeds
+	now = now.Add(2 * time.Minute)
+	primary.err = nil
+	send()
+	send()
+	if primary.calls != 4 || secondary.calls != 3 {
+		t.Errorf("expected closed circuit after a successful trial, got %d/%d calls", primary.calls, secondary.calls)
+	}
+}
+
+func TestRoutingSender_NoProviderAvailable(t *testing.T) {
+	only := &stubSender{err: errConnect}
+	router := newTestRouter(t, []Provider{{Name: "only", Sender: only}}, nil)
+
+	for i := 0; i < 2; i++ {
+		router.SendEmail(context.Background(), EmailMessage{To: "a@example.com"})
+	}
+	err := router.SendEmail(context.Background(), EmailMessage{To: "a@example.com"})
+	if !errors.Is(err, ErrNoProviderAvailable) || !IsTransient(err) {
+		t.Errorf("expected transient ErrNoProviderAvailable, got: %v", err)
+	}
+	if only.calls != 2 {
+		t.Errorf("expected open circuit to stop sends, got %d calls", only.calls)
+	}
+}
+
+func TestNewRoutingSender_Validates(t *testing.T) {
+	sender := &stubSender{}
+	if _, err := NewRoutingSender(nil, nil, BreakerConfig{}); err == nil {
+		t.Error("expected an error without providers")
+	}
+	if _, err := NewRoutingSender([]Provider{{Name: "a", Sender: sender}, {Name: "a", Sender: sender}}, nil, BreakerConfig{}); err == nil {
+		t.Error("expected an error for duplicate providers")
+	}
+	if _, err := NewRoutingSender([]Provider{{Name: "a", Sender: sender}}, []RouteRule{{Providers: []string{"b"}}}, BreakerConfig{}); err == nil {
+		t.Error("expected an error for a rule with an unknown provider")
+	}
+}
+
+func TestNewRoutingSenderFromConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routing.json")
+	os.WriteFile(path, []byte(`{
+		"providers": [
+			{"name": "ses-api", "type": "ses", "weight": 3, "ses": {"region": "us-east-1", "access_key_id": "AKID", "secret_access_key": "secret"}},
+			{"name": "relay", "type": "smtp", "weight": 1, "smtp": {"host": "smtp.example.com", "username": "u", "password": "p"}},
+			{"name": "sink", "type": "dummy"}
+		],
+		"rules": [{"domains": ["example.org"], "providers": ["sink"]}],
+		"breaker": {"failure_threshold": 3, "cooldown_seconds": 10}
+	}`), 0o600)
+
+	cfg, err := LoadRoutingConfig(path)
+	if err != nil {
+		t.Fatalf("failed to load routing config: %v", err)
+	}
+	router, err := NewRoutingSenderFromConfig(context.Background(), cfg, nil)
+	if err != nil {
+		t.Fatalf("failed to create routing sender: %v", err)
+	}
+
+	if len(router.providers) != 3 || router.providers[0].Weight != 3 {
+		t.Errorf("unexpected providers: %+v", router.providers)
+	}
+	if relay, ok := router.byName["relay"].Sender.(*SmtpSender); !ok || relay.config.Port != 587 {
+		t.Errorf("expected relay to be an SMTP sender on port 587, got %+v", router.byName["relay"].Sender)
+	}
+	if breaker := router.byName["sink"].breaker; breaker.threshold != 3 || breaker.cooldown != 10*time.Second {
+		t.Errorf("unexpected breaker config: %+v", breaker)
+	}
+
+	result, err := router.SendEmailWithResult(context.Background(), EmailMessage{To: "a@example.org", Subject: "Hi", HTMLBody: "<p>Hi</p>"})
+	if err != nil || result.Provider != "sink" {
+		t.Errorf("expected example.org to be routed to the dummy sink, got %v, %v", result, err)
+	}
+}
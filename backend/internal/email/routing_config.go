@@ -0,0 +1,133 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"backend/internal/config"
+	"backend/internal/dkim"
+	"backend/internal/mail"
+
+	"github.com/google/uuid"
+)
+
+// Routing provider types
+const (
+	ProviderTypeSMTP  = "smtp"  // SmtpSender
+	ProviderTypeSES   = "ses"   // SESSender
+	ProviderTypeMail  = "mail"  // mail.SMTPSender configured by MAIL_*
+	ProviderTypeDummy = "dummy" // DummyMailer
+)
+
+// RoutingConfig is the JSON configuration of a RoutingSender
+type RoutingConfig struct {
+	Providers []ProviderConfig `json:"providers"`
+	Rules     []RuleConfig     `json:"rules"`
+	Breaker   struct {
+		FailureThreshold int `json:"failure_threshold"`
+		CooldownSeconds  int `json:"cooldown_seconds"`
+	} `json:"breaker"`
+}
+
+// ProviderConfig configures one routing provider
+// SMTP and SES settings fall back to the SMTP_* and SES_* environment variables.
+type ProviderConfig struct {
+	Name   string      `json:"name"`
+	Type   string      `json:"type"`
+	Weight int         `json:"weight"`
+	SMTP   *SmtpConfig `json:"smtp"` // host, port, username, password, encryption, auth, ca_file, cert_file, key_file
+	SES    *SESConfig  `json:"ses"`
+}
+
+// RuleConfig configures one routing rule, see RouteRule
+type RuleConfig struct {
+	ClientID  *uuid.UUID `json:"client_id"`
+	Stream    string     `json:"stream"`
+	Domains   []string   `json:"domains"`
+	Providers []string   `json:"providers"`
+}
+
+// LoadRoutingConfig reads a routing configuration file
+func LoadRoutingConfig(path string) (*RoutingConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read routing config: %w", err)
+	}
+
+	var cfg RoutingConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid routing config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// NewRoutingSenderFromConfig creates the providers of cfg and a RoutingSender over them
+// signer, when not nil, DKIM-signs the mail of the smtp and mail providers.
+func NewRoutingSenderFromConfig(ctx context.Context, cfg *RoutingConfig, signer dkim.MessageSigner) (*RoutingSender, error) {
+	providers := make([]Provider, 0, len(cfg.Providers))
+	for _, pc := range cfg.Providers {
+		sender, err := newProviderSender(ctx, pc, signer)
+		if err != nil {
+			return nil, fmt.Errorf("provider %q: %w", pc.Name, err)
+		}
+		providers = append(providers, Provider{Name: pc.Name, Sender: sender, Weight: pc.Weight})
+	}
+
+	rules := make([]RouteRule, len(cfg.Rules))
+	for i, rc := range cfg.Rules {
+		rules[i] = RouteRule{
+			ClientID:  rc.ClientID,
+			Stream:    rc.Stream,
+			Domains:   rc.Domains,
+			Providers: rc.Providers,
+		}
+	}
+
+	return NewRoutingSender(providers, rules, BreakerConfig{
+		FailureThreshold: cfg.Breaker.FailureThreshold,
+		Cooldown:         time.Duration(cfg.Breaker.CooldownSeconds) * time.Second,
+	})
+}
+
+// newProviderSender creates the sender of a provider
+func newProviderSender(ctx context.Context, pc ProviderConfig, signer dkim.MessageSigner) (EmailSender, error) {
+	switch pc.Type {
+	case ProviderTypeSMTP:
+		smtpCfg := pc.SMTP
+		if smtpCfg == nil {
+			var err error
+			if smtpCfg, err = NewSmtpConfigFromEnv(); err != nil {
+				return nil, err
+			}
+		} else if err := smtpCfg.validate(); err != nil {
+			return nil, err
+		}
+		sender := NewSmtpSender(smtpCfg)
+		if signer != nil {
+			sender.SetSigner(signer)
+		}
+		return sender, nil
+	case ProviderTypeSES:
+		sesCfg := pc.SES
+		if sesCfg == nil {
+			var err error
+			if sesCfg, err = NewSESConfigFromEnv(); err != nil {
+				return nil, err
+			}
+		}
+		return NewSESSender(ctx, sesCfg)
+	case ProviderTypeMail:
+		mailCfg, err := config.LoadSMTPConfig()
+		if err != nil {
+			return nil, err
+		}
+		return NewMailSender(mail.NewSMTPSenderWithSigner(mailCfg, signer)), nil
+	case ProviderTypeDummy:
+		return NewDummySender(), nil
+	default:
+		return nil, fmt.Errorf("unknown provider type %q", pc.Type)
+	}
+}
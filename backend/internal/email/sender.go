@@ -2,40 +2,42 @@ package email
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
-	"net/smtp"
+	"net/mail"
 	"os"
 	"time"
 
+	"backend/internal/dkim"
+	"backend/internal/smtppool"
+
 	"github.com/rs/zerolog"
 )
 
 // SmtpConfig holds SMTP configuration
 type SmtpConfig struct {
-	Host     string
-	Port     int
-	Username string
-	Password string
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Encryption string `json:"encryption"` // starttls, implicit or none; by port when empty
+	Auth       string `json:"auth"`       // plain, login, cram-md5 or none; picked from the server's offer when empty
+	CAFile     string `json:"ca_file"`    // PEM roots replacing the system roots
+	CertFile   string `json:"cert_file"`  // PEM client certificate, with KeyFile
+	KeyFile    string `json:"key_file"`
 }
 
 // NewSmtpConfigFromEnv creates SMTP config from environment variables
 func NewSmtpConfigFromEnv() (*SmtpConfig, error) {
 	cfg := &SmtpConfig{
-		Host:     os.Getenv("SMTP_HOST"),
-		Port:     587, // Default port
-		Username: os.Getenv("SMTP_USERNAME"),
-		Password: os.Getenv("SMTP_PASSWORD"),
-	}
-
-	if cfg.Host == "" {
-		return nil, fmt.Errorf("SMTP_HOST is required")
-	}
-	if cfg.Username == "" {
-		return nil, fmt.Errorf("SMTP_USERNAME is required")
-	}
-	if cfg.Password == "" {
-		return nil, fmt.Errorf("SMTP_PASSWORD is required")
+		Host:       os.Getenv("SMTP_HOST"),
+		Port:       587, // Default port
+		Username:   os.Getenv("SMTP_USERNAME"),
+		Password:   os.Getenv("SMTP_PASSWORD"),
+		Encryption: os.Getenv("SMTP_ENCRYPTION"),
+		Auth:       os.Getenv("SMTP_AUTH"),
+		CAFile:     os.Getenv("SMTP_CA_FILE"),
+		CertFile:   os.Getenv("SMTP_CERT_FILE"),
+		KeyFile:    os.Getenv("SMTP_KEY_FILE"),
 	}
 
 	// Try to get port from env, default to 587
@@ -46,24 +48,93 @@ func NewSmtpConfigFromEnv() (*SmtpConfig, error) {
 		}
 	}
 
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	return cfg, nil
 }
 
+// validate normalizes the encryption mode and auth mechanism, checks that
+// credentials are set unless auth is none, and loads the TLS files
+func (c *SmtpConfig) validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("SMTP_HOST is required")
+	}
+	if c.Port == 0 {
+		c.Port = 587
+	}
+
+	var err error
+	if c.Encryption, err = smtppool.ParseEncryption(c.Encryption, c.Port); err != nil {
+		return err
+	}
+	if c.Auth, err = smtppool.ParseAuth(c.Auth); err != nil {
+		return err
+	}
+	if c.Auth != smtppool.AuthNone {
+		if c.Username == "" {
+			return fmt.Errorf("SMTP_USERNAME is required")
+		}
+		if c.Password == "" {
+			return fmt.Errorf("SMTP_PASSWORD is required")
+		}
+	}
+
+	_, err = c.server().TLSConfig()
+	return err
+}
+
+// server returns the connection pool key of the SMTP server
+func (c *SmtpConfig) server() smtppool.Server {
+	return smtppool.Server{
+		Host:       c.Host,
+		Port:       c.Port,
+		Username:   c.Username,
+		Password:   c.Password,
+		Encryption: c.Encryption,
+		Auth:       c.Auth,
+		CAFile:     c.CAFile,
+		CertFile:   c.CertFile,
+		KeyFile:    c.KeyFile,
+	}
+}
+
+// Deadline of one SMTP transaction
+const (
+	baseSendTimeout = 10 * time.Second // plain messages
+	minUploadRate   = 128 << 10        // slowest upload allowed for large messages, in bytes per second
+)
+
+// sendTimeout returns how long sending a message of size bytes may take
+// A 25 MB attachment needs minutes on links where a plain message needs seconds.
+func sendTimeout(size int) time.Duration {
+	return baseSendTimeout + time.Duration(size)*time.Second/minUploadRate
+}
+
 // SmtpSender implements EmailSender using SMTP
 type SmtpSender struct {
 	config SmtpConfig
+	pool   *smtppool.Pool
+	signer dkim.MessageSigner
 	logger zerolog.Logger
 }
 
-// NewSmtpSender creates a new SMTP sender
+// NewSmtpSender creates a new SMTP sender using the shared connection pool
 func NewSmtpSender(config *SmtpConfig) *SmtpSender {
 	return &SmtpSender{
 		config: *config,
+		pool:   smtppool.Shared(),
 		logger: zerolog.New(os.Stdout).With().Timestamp().Logger(),
 	}
 }
 
-// SendEmail sends an email using SMTP with STARTTLS
+// SetSigner makes the sender DKIM-sign every message with signer
+func (s *SmtpSender) SetSigner(signer dkim.MessageSigner) {
+	s.signer = signer
+}
+
+// SendEmail sends an email using SMTP with the configured encryption and auth
+// Protocol and network failures are returned as *SMTPError.
 func (s *SmtpSender) SendEmail(ctx context.Context, msg EmailMessage) error {
 	// Validate required fields
 	if msg.From == "" {
@@ -79,86 +150,26 @@ func (s *SmtpSender) SendEmail(ctx context.Context, msg EmailMessage) error {
 		return fmt.Errorf("either HTMLBody or TextBody is required")
 	}
 
-	// Build MIME email using SmtpEmailSender's buildMIMEEmail method
-	tempSender := &SmtpEmailSender{
-		host:     s.config.Host,
-		port:     s.config.Port,
-		username: s.config.Username,
-		password: s.config.Password,
-	}
-	emailBody, err := tempSender.buildMIMEEmail(msg)
-	if err != nil {
-		return fmt.Errorf("failed to build MIME email: %w", err)
-	}
-
-	// Create SMTP connection with timeout
-	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
-
-	// Use context with timeout
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
-	// Connect to SMTP server
-	conn, err := smtp.Dial(addr)
+	// MAIL FROM takes the bare address; the display name is for the header
+	from, err := mail.ParseAddress(msg.From)
 	if err != nil {
-		return fmt.Errorf("failed to connect to SMTP server: %w", err)
-	}
-	defer conn.Close()
-
-	// Check if context is cancelled
-	select {
-	case <-ctxWithTimeout.Done():
-		return ctxWithTimeout.Err()
-	default:
-	}
-
-	// STARTTLS
-	tlsConfig := &tls.Config{
-		ServerName:         s.config.Host,
-		InsecureSkipVerify: false,
-	}
-	if err := conn.StartTLS(tlsConfig); err != nil {
-		return fmt.Errorf("failed to start TLS: %w", err)
-	}
-
-	// Authenticate
-	auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
-	if err := conn.Auth(auth); err != nil {
-		return fmt.Errorf("failed to authenticate: %w", err)
+		return fmt.Errorf("invalid from address: %w", err)
 	}
 
-	// Set sender
-	if err := conn.Mail(msg.From); err != nil {
-		return fmt.Errorf("failed to set sender: %w", err)
-	}
-
-	// Set recipient
-	if err := conn.Rcpt(msg.To); err != nil {
-		return fmt.Errorf("failed to set recipient: %w", err)
-	}
-
-	// Send email data
-	writer, err := conn.Data()
+	// Build MIME email
+	emailBody, err := buildMIMEEmail(msg)
 	if err != nil {
-		return fmt.Errorf("failed to get data writer: %w", err)
-	}
-
-	// Check context before writing
-	select {
-	case <-ctxWithTimeout.Done():
-		writer.Close()
-		return ctxWithTimeout.Err()
-	default:
+		return fmt.Errorf("failed to build MIME email: %w", err)
 	}
+	emailBody = s.sign(ctx, emailBody, msg)
 
-	_, err = writer.Write(emailBody)
-	if err != nil {
-		writer.Close()
-		return fmt.Errorf("failed to write email data: %w", err)
-	}
+	// Large messages get longer to upload
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, sendTimeout(len(emailBody)))
+	defer cancel()
 
-	if err := writer.Close(); err != nil {
-		return fmt.Errorf("failed to close data writer: %w", err)
+	// Send over a pooled connection (TLS and AUTH happen once per connection)
+	if err := s.pool.Send(ctxWithTimeout, s.config.server(), from.Address, []string{msg.To}, emailBody); err != nil {
+		return fromPoolError(err)
 	}
 
 	s.logger.Info().
@@ -170,3 +181,21 @@ func (s *SmtpSender) SendEmail(ctx context.Context, msg EmailMessage) error {
 	return nil
 }
 
+// sign DKIM-signs a built message; when signing fails the message is sent
+// unsigned rather than not at all
+func (s *SmtpSender) sign(ctx context.Context, emailBody []byte, msg EmailMessage) []byte {
+	if s.signer == nil {
+		return emailBody
+	}
+	signed, err := s.signer.SignMessage(ctx, msg.ClientID, emailBody)
+	if err != nil {
+		s.logger.Error().
+			Err(err).
+			Str("event", "email.dkim.sign_failed").
+			Str("from", msg.From).
+			Str("to", msg.To).
+			Msg("Failed to DKIM-sign email, sending it unsigned")
+		return emailBody
+	}
+	return signed
+}
@@ -0,0 +1,109 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"backend/internal/smtptest"
+
+	"github.com/google/uuid"
+)
+
+// stubSigner prepends a fixed header, or fails when err is set
+type stubSigner struct {
+	err error
+}
+
+func (s stubSigner) SignMessage(ctx context.Context, clientID *uuid.UUID, raw []byte) ([]byte, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return append([]byte("DKIM-Signature: stub\r\n"), raw...), nil
+}
+
+func TestSmtpSender_Sign(t *testing.T) {
+	raw := []byte("From: a@example.com\r\n\r\nbody\r\n")
+	msg := EmailMessage{From: "a@example.com", To: "b@example.org"}
+
+	sender := NewSmtpSender(&SmtpConfig{Host: "localhost", Port: 25})
+	if got := sender.sign(context.Background(), raw, msg); !bytes.Equal(got, raw) {
+		t.Errorf("sender without signer changed the message:\n%s", got)
+	}
+
+	sender.SetSigner(stubSigner{})
+	if got := sender.sign(context.Background(), raw, msg); !bytes.HasPrefix(got, []byte("DKIM-Signature: stub\r\n")) {
+		t.Errorf("message was not signed:\n%s", got)
+	}
+
+	// A signing failure sends the message unsigned
+	sender.SetSigner(stubSigner{err: errors.New("no key")})
+	if got := sender.sign(context.Background(), raw, msg); !bytes.Equal(got, raw) {
+		t.Errorf("failed signing changed the message:\n%s", got)
+	}
+}
+
+func TestSmtpSender_SendEmailEnvelopeSender(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	sender := NewSmtpSender(&SmtpConfig{Host: srv.Host, Port: srv.Port, Encryption: "none", Auth: "none"})
+
+	err := sender.SendEmail(context.Background(), EmailMessage{
+		From:     `"MailBlast" <noreply@example.com>`,
+		To:       "b@example.org",
+		Subject:  "Hello",
+		TextBody: "Hi",
+	})
+	if err != nil {
+		t.Fatalf("SendEmail() error = %v", err)
+	}
+
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(messages))
+	}
+	if messages[0].From != "noreply@example.com" {
+		t.Errorf("envelope sender = %q, want noreply@example.com", messages[0].From)
+	}
+	if !bytes.Contains([]byte(messages[0].Data), []byte(`From: "MailBlast" <noreply@example.com>`)) {
+		t.Errorf("From header lost the display name:\n%s", messages[0].Data)
+	}
+}
+
+func TestSmtpConfig_Validate(t *testing.T) {
+	config := SmtpConfig{Host: "smtp.example.com", Port: 465, Username: "u", Password: "p", Auth: "LOGIN"}
+	if err := config.validate(); err != nil {
+		t.Fatalf("validate() error = %v", err)
+	}
+	if config.Encryption != "implicit" || config.Auth != "login" {
+		t.Errorf("encryption, auth = %q, %q, want implicit, login", config.Encryption, config.Auth)
+	}
+
+	relay := SmtpConfig{Host: "relay.internal", Port: 25, Encryption: "none", Auth: "none"}
+	if err := relay.validate(); err != nil {
+		t.Errorf("validate() of an unauthenticated relay error = %v", err)
+	}
+
+	for _, invalid := range []SmtpConfig{
+		{Port: 587, Username: "u", Password: "p"},
+		{Host: "smtp.example.com", Username: "u"},
+		{Host: "smtp.example.com", Username: "u", Password: "p", Encryption: "plaintext"},
+		{Host: "smtp.example.com", Username: "u", Password: "p", Auth: "xoauth2"},
+		{Host: "smtp.example.com", Username: "u", Password: "p", CAFile: "/nonexistent/ca.pem"},
+	} {
+		if err := invalid.validate(); err == nil {
+			t.Errorf("validate(%+v) error = nil", invalid)
+		}
+	}
+}
+
+func TestSendTimeout(t *testing.T) {
+	if got := sendTimeout(10 << 10); got > baseSendTimeout+time.Second {
+		t.Errorf("expected about %v for a small message, got %v", baseSendTimeout, got)
+	}
+	// A maximal message: attachments grow by a third when base64 encoded
+	if got := sendTimeout(MaxTotalAttachmentSize * 4 / 3); got < 4*time.Minute {
+		t.Errorf("expected minutes for a message with 25 MB of attachments, got %v", got)
+	}
+}
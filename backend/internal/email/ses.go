@@ -1,9 +1,141 @@
 package email
 
 import (
-	_ "github.com/aws/aws-sdk-go-v2" // AWS SDK v2 base (for future SES usage)
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+	"github.com/rs/zerolog"
 )
 
-// TODO: Implement AWS SES client and email sending
-// This package will handle AWS SES integration for sending emails
+// SESConfig holds SES API configuration
+type SESConfig struct {
+	Region           string `json:"region"`
+	Endpoint         string `json:"endpoint"`          // optional, overrides the regional SES endpoint (e.g. a local stand-in)
+	ConfigurationSet string `json:"configuration_set"` // optional, SES configuration set receiving the event destinations
+	AccessKeyID      string `json:"access_key_id"`     // optional, the default AWS credential chain is used when empty
+	SecretAccessKey  string `json:"secret_access_key"`
+}
+
+// NewSESConfigFromEnv creates SES API config from environment variables
+func NewSESConfigFromEnv() (*SESConfig, error) {
+	cfg := &SESConfig{
+		Region:           os.Getenv("SES_REGION"),
+		Endpoint:         os.Getenv("SES_ENDPOINT"),
+		ConfigurationSet: os.Getenv("SES_CONFIGURATION_SET"),
+		AccessKeyID:      os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey:  os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("SES_REGION or AWS_REGION is required")
+	}
+	if (cfg.AccessKeyID == "") != (cfg.SecretAccessKey == "") {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set together")
+	}
+
+	return cfg, nil
+}
+
+// SESSender implements EmailSender using the SES v2 SendEmail API with raw MIME
+type SESSender struct {
+	client           *sesv2.Client
+	configurationSet string
+	logger           zerolog.Logger
+}
+
+// NewSESSender creates a new SES API sender
+func NewSESSender(ctx context.Context, config *SESConfig) (*SESSender, error) {
+	opts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(config.Region),
+	}
+	if config.AccessKeyID != "" {
+		opts = append(opts, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(config.AccessKeyID, config.SecretAccessKey, ""),
+		))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	client := sesv2.NewFromConfig(awsCfg, func(o *sesv2.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+		}
+		// The queue retries transient failures with its own policy and records every attempt
+		o.Retryer = aws.NopRetryer{}
+	})
+
+	return &SESSender{
+		client:           client,
+		configurationSet: config.ConfigurationSet,
+		logger:           zerolog.New(os.Stdout).With().Timestamp().Logger(),
+	}, nil
+}
+
+// SendEmail sends an email through the SES API
+// API failures are returned as *SESError.
+func (s *SESSender) SendEmail(ctx context.Context, msg EmailMessage) error {
+	_, err := s.SendEmailWithResult(ctx, msg)
+	return err
+}
+
+// SendEmailWithResult sends an email through the SES API and reports the SES message ID
+func (s *SESSender) SendEmailWithResult(ctx context.Context, msg EmailMessage) (*SendResult, error) {
+	// Validate required fields
+	if msg.From == "" {
+		return nil, fmt.Errorf("from address is required")
+	}
+	if msg.To == "" {
+		return nil, fmt.Errorf("to address is required")
+	}
+	if msg.Subject == "" {
+		return nil, fmt.Errorf("subject is required")
+	}
+	if msg.HTMLBody == "" && msg.TextBody == "" {
+		return nil, fmt.Errorf("either HTMLBody or TextBody is required")
+	}
+
+	raw, err := buildMIMEEmail(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build MIME email: %w", err)
+	}
+
+	input := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(msg.From),
+		Destination: &types.Destination{
+			ToAddresses: []string{msg.To},
+		},
+		Content: &types.EmailContent{
+			Raw: &types.RawMessage{Data: raw},
+		},
+	}
+	if s.configurationSet != "" {
+		input.ConfigurationSetName = aws.String(s.configurationSet)
+	}
+
+	out, err := s.client.SendEmail(ctx, input)
+	if err != nil {
+		return nil, NewSESError(err)
+	}
+	sesMessageID := aws.ToString(out.MessageId)
+
+	s.logger.Info().
+		Str("event", "email.sent").
+		Str("message_id", msg.Headers["Message-ID"]).
+		Str("ses_message_id", sesMessageID).
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Msg("Email sent successfully via SES API")
 
+	return &SendResult{ProviderMessageID: sesMessageID}, nil
+}
@@ -0,0 +1,132 @@
+package email
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// sesStandIn serves the SES v2 SendEmail API, recording the last request body
+func sesStandIn(t *testing.T, status int, response string, headers map[string]string) (*httptest.Server, *map[string]interface{}) {
+	t.Helper()
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/email/outbound-emails" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			t.Errorf("expected a SigV4 signed request, got %q", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		for key, value := range headers {
+			w.Header().Set(key, value)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &body
+}
+
+func newTestSESSender(t *testing.T, endpoint string) *SESSender {
+	t.Helper()
+	sender, err := NewSESSender(context.Background(), &SESConfig{
+		Region:           "us-east-1",
+		Endpoint:         endpoint,
+		ConfigurationSet: "mailblast-events",
+		AccessKeyID:      "AKIDTEST",
+		SecretAccessKey:  "secret",
+	})
+	if err != nil {
+		t.Fatalf("failed to create SES sender: %v", err)
+	}
+	return sender
+}
+
+var sesTestMessage = EmailMessage{
+	From:     "sender@example.com",
+	To:       "user@example.com",
+	Subject:  "Hello",
+	HTMLBody: "<p>Hello</p>",
+	Headers:  map[string]string{"Message-ID": "<abc@mailblast>"},
+}
+
+func TestSESSender_SendsRawMIME(t *testing.T) {
+	server, body := sesStandIn(t, http.StatusOK, `{"MessageId":"0100018c-ses-id"}`, nil)
+	sender := newTestSESSender(t, server.URL)
+
+	result, err := sender.SendEmailWithResult(context.Background(), sesTestMessage)
+	if err != nil {
+		t.Fatalf("expected send to succeed, got: %v", err)
+	}
+	if result.ProviderMessageID != "0100018c-ses-id" {
+		t.Errorf("expected SES message ID, got %q", result.ProviderMessageID)
+	}
+
+	if (*body)["ConfigurationSetName"] != "mailblast-events" {
+		t.Errorf("expected configuration set, got %v", (*body)["ConfigurationSetName"])
+	}
+	raw := (*body)["Content"].(map[string]interface{})["Raw"].(map[string]interface{})["Data"].(string)
+	mime, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		t.Fatalf("raw data is not base64: %v", err)
+	}
+	for _, want := range []string{"Message-ID: <abc@mailblast>\r\n", "Subject: Hello\r\n", "To: user@example.com\r\n"} {
+		if !strings.Contains(string(mime), want) {
+			t.Errorf("expected raw message to contain %q, got:\n%s", want, mime)
+		}
+	}
+}
+
+func TestSESSender_ClassifiesErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		status    int
+		code      string
+		transient bool
+	}{
+		{"rejected", http.StatusBadRequest, "MessageRejected", false},
+		{"throttled", http.StatusTooManyRequests, "TooManyRequestsException", true},
+		{"limit exceeded", http.StatusBadRequest, "LimitExceededException", true},
+		{"server error", http.StatusInternalServerError, "InternalFailure", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _ := sesStandIn(t, tt.status, `{"message":"nope"}`, map[string]string{"X-Amzn-ErrorType": tt.code})
+			sender := newTestSESSender(t, server.URL)
+
+			err := sender.SendEmail(context.Background(), sesTestMessage)
+			sesErr, ok := err.(*SESError)
+			if !ok {
+				t.Fatalf("expected *SESError, got %T: %v", err, err)
+			}
+			if sesErr.Code != tt.code || sesErr.StatusCode != tt.status {
+				t.Errorf("expected %d %s, got %d %s", tt.status, tt.code, sesErr.StatusCode, sesErr.Code)
+			}
+			if IsTransient(err) != tt.transient {
+				t.Errorf("expected transient=%v for %v", tt.transient, err)
+			}
+			if meta := smtpErrorMeta(err); meta["ses_error_code"] != tt.code {
+				t.Errorf("expected error code in attempt meta, got %v", meta)
+			}
+		})
+	}
+}
+
+func TestSESSender_NetworkErrorIsTransient(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	sender := newTestSESSender(t, server.URL)
+
+	err := sender.SendEmail(context.Background(), sesTestMessage)
+	if err == nil || !IsTransient(err) {
+		t.Errorf("expected a transient error, got: %v", err)
+	}
+}
@@ -1,19 +1,20 @@
 package email
 
 import (
-	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/smtp"
+	"net/mail"
 	"os"
 	"strings"
-	"time"
 
 	"backend/internal/config"
+	"backend/internal/htmltext"
+	"backend/internal/mimemsg"
 	"backend/internal/models"
 	"backend/internal/repositories"
+	"backend/internal/smtppool"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
@@ -27,6 +28,19 @@ type EmailMessage struct {
 	HTMLBody string
 	TextBody string
 	Headers  map[string]string
+	Stream   string // optional routing stream, see MessageStream
+
+	// DisableAutoText sends HTML-only mail instead of generating a text part
+	// from HTMLBody when TextBody is empty
+	DisableAutoText bool
+
+	Attachments []Attachment
+	Inline      []Attachment // parts referenced from HTMLBody as cid:<ContentID>
+
+	// Optional links stored on the email_messages record
+	CampaignID *uuid.UUID
+	ContactID  *uuid.UUID
+	ClientID   *uuid.UUID
 }
 
 // EmailSender defines the interface for sending emails
@@ -34,14 +48,55 @@ type EmailSender interface {
 	SendEmail(ctx context.Context, msg EmailMessage) error
 }
 
+// SendResult describes how a message was accepted
+type SendResult struct {
+	Provider          string // name of the provider chosen by a RoutingSender
+	ProviderMessageID string // ID assigned by the provider, e.g. the SES message ID
+}
+
+// ResultSender is implemented by senders that report how a message was accepted;
+// the queue stores the result next to our Message-ID
+type ResultSender interface {
+	SendEmailWithResult(ctx context.Context, msg EmailMessage) (*SendResult, error)
+}
+
+// SendWithResult sends msg, collecting the SendResult of senders that report one
+func SendWithResult(ctx context.Context, sender EmailSender, msg EmailMessage) (*SendResult, error) {
+	if resultSender, ok := sender.(ResultSender); ok {
+		result, err := resultSender.SendEmailWithResult(ctx, msg)
+		if err == nil && result == nil {
+			result = &SendResult{}
+		}
+		return result, err
+	}
+	if err := sender.SendEmail(ctx, msg); err != nil {
+		return nil, err
+	}
+	return &SendResult{}, nil
+}
+
+// smtpFailureEvents are the log events of failed SMTP protocol steps
+var smtpFailureEvents = map[string]string{
+	SMTPOpConnect:  "email.smtp.connect.failed",
+	SMTPOpStartTLS: "email.smtp.tls.failed",
+	SMTPOpAuth:     "email.smtp.auth.failed",
+	SMTPOpMail:     "email.smtp.sender.failed",
+	SMTPOpRcpt:     "email.smtp.recipient.failed",
+	SMTPOpData:     "email.smtp.data.failed",
+	SMTPOpWrite:    "email.smtp.write.failed",
+	SMTPOpClose:    "email.smtp.close.failed",
+}
+
 // SmtpEmailSender implements EmailSender using SMTP
 type SmtpEmailSender struct {
-	host     string
-	port     int
-	username string
-	password string
-	repo     repositories.EmailRepository
-	logger   zerolog.Logger
+	host       string
+	port       int
+	username   string
+	password   string
+	encryption string
+	pool       *smtppool.Pool
+	repo       repositories.EmailRepository
+	logger     zerolog.Logger
 }
 
 // NewSmtpEmailSender creates a new SMTP email sender using config
@@ -59,19 +114,42 @@ func NewSmtpEmailSender() (*SmtpEmailSender, error) {
 		return nil, fmt.Errorf("AWS credentials not configured")
 	}
 
+	// SES accepts STARTTLS on 25, 587 and 2587 and implicit TLS on 465 and 2465
+	encryption, err := smtppool.ParseEncryption(cfg.AWSSESSMTPEncryption, cfg.AWSSESSMTPPort)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AWS_SES_SMTP_ENCRYPTION: %w", err)
+	}
+	if encryption == smtppool.EncryptionNone {
+		return nil, fmt.Errorf("AWS SES SMTP requires TLS")
+	}
+
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
 
 	return &SmtpEmailSender{
-		host:     cfg.AWSSESSMTPEndpoint,
-		port:     cfg.AWSSESSMTPPort,
-		username: cfg.AWSAccessKeyID,
-		password: cfg.AWSSecretKey,
-		repo:     repositories.NewEmailRepository(),
-		logger:   logger,
+		host:       cfg.AWSSESSMTPEndpoint,
+		port:       cfg.AWSSESSMTPPort,
+		username:   cfg.AWSAccessKeyID,
+		password:   cfg.AWSSecretKey,
+		encryption: encryption,
+		pool:       smtppool.Shared(),
+		repo:       repositories.NewEmailRepository(),
+		logger:     logger,
 	}, nil
 }
 
-// SendEmail sends an email using SMTP with STARTTLS
+// server returns the pool key of the SES SMTP endpoint
+func (s *SmtpEmailSender) server() smtppool.Server {
+	return smtppool.Server{
+		Host:       s.host,
+		Port:       s.port,
+		Username:   s.username,
+		Password:   s.password,
+		Encryption: s.encryption,
+	}
+}
+
+// SendEmail sends an email to the SES SMTP endpoint over STARTTLS or implicit TLS
+// Protocol and network failures are returned as *SMTPError.
 func (s *SmtpEmailSender) SendEmail(ctx context.Context, msg EmailMessage) error {
 	// Generate Message-ID
 	messageID := s.generateMessageID(msg.From)
@@ -86,11 +164,15 @@ func (s *SmtpEmailSender) SendEmail(ctx context.Context, msg EmailMessage) error
 
 	// Create email message record (status = "queued")
 	emailRecord := models.EmailMessageRecord{
-		MessageID: messageID,
-		From:      msg.From,
-		To:        msg.To,
-		Subject:   msg.Subject,
-		Status:    "queued",
+		ID:         uuid.New(),
+		MessageID:  messageID,
+		From:       msg.From,
+		To:         msg.To,
+		Subject:    msg.Subject,
+		Status:     "queued",
+		CampaignID: msg.CampaignID,
+		ContactID:  msg.ContactID,
+		ClientID:   msg.ClientID,
 	}
 
 	if err := s.repo.CreateEmailMessage(ctx, emailRecord); err != nil {
@@ -116,6 +198,12 @@ func (s *SmtpEmailSender) SendEmail(ctx context.Context, msg EmailMessage) error
 		return fmt.Errorf("either HTMLBody or TextBody is required")
 	}
 
+	// MAIL FROM takes the bare address; the display name is for the header
+	from, err := mail.ParseAddress(msg.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address: %w", err)
+	}
+
 	// Add Message-ID to headers if not present
 	if msg.Headers == nil {
 		msg.Headers = make(map[string]string)
@@ -132,17 +220,7 @@ func (s *SmtpEmailSender) SendEmail(ctx context.Context, msg EmailMessage) error
 			trackingDomain = "http://localhost:8080"
 		}
 
-		// Rewrite links for click tracking
-		msg.HTMLBody = RewriteLinks(msg.HTMLBody, messageID, trackingDomain)
-
-		// Add tracking pixel
-		cleanMessageID := strings.Trim(messageID, "<>")
-		trackingPixel := fmt.Sprintf(
-			`<img src="%s/track/open/%s.png" width="1" height="1" style="display:none;" />`,
-			strings.TrimSuffix(trackingDomain, "/"),
-			cleanMessageID,
-		)
-		msg.HTMLBody = msg.HTMLBody + trackingPixel
+		msg.HTMLBody = AddTracking(msg.HTMLBody, messageID, trackingDomain, config.AppConfig.TrackingSecret)
 	}
 
 	// Log SMTP send start
@@ -153,7 +231,7 @@ func (s *SmtpEmailSender) SendEmail(ctx context.Context, msg EmailMessage) error
 		Msg("SMTP send started")
 
 	// Build MIME email
-	emailBody, err := s.buildMIMEEmail(msg)
+	emailBody, err := buildMIMEEmail(msg)
 	if err != nil {
 		s.logger.Error().
 			Err(err).
@@ -173,200 +251,23 @@ func (s *SmtpEmailSender) SendEmail(ctx context.Context, msg EmailMessage) error
 		return fmt.Errorf("failed to build MIME email: %w", err)
 	}
 
-	// Create SMTP connection with timeout
-	addr := fmt.Sprintf("%s:%d", s.host, s.port)
-
-	// Use context with timeout
-	ctxWithTimeout, cancel := context.WithTimeout(ctx, 10*time.Second)
+	// Large messages get longer to upload
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, sendTimeout(len(emailBody)))
 	defer cancel()
 
-	// Connect to SMTP server
-	conn, err := smtp.Dial(addr)
-	if err != nil {
-		s.logger.Error().
-			Err(err).
-			Str("event", "email.smtp.connect.failed").
-			Str("message_id", messageID).
-			Msg("Failed to connect to SMTP server")
-
-		// Update status to failed
-		s.repo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
-		metaJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
-		s.repo.AddEmailEvent(ctx, models.EmailEventRecord{
-			EmailID:   emailRecord.ID,
-			EventType: "failed",
-			Meta:      metaJSON,
-		})
-
-		return fmt.Errorf("failed to connect to SMTP server: %w", err)
-	}
-	defer conn.Close()
-
-	// Check if context is cancelled
-	select {
-	case <-ctxWithTimeout.Done():
-		s.logger.Warn().
-			Str("event", "email.cancelled").
-			Str("message_id", messageID).
-			Msg("Context cancelled before sending email")
-		return ctxWithTimeout.Err()
-	default:
-	}
-
-	// STARTTLS
-	tlsConfig := &tls.Config{
-		ServerName:         s.host,
-		InsecureSkipVerify: false,
-	}
-	if err := conn.StartTLS(tlsConfig); err != nil {
-		s.logger.Error().
-			Err(err).
-			Str("event", "email.smtp.tls.failed").
-			Str("message_id", messageID).
-			Msg("Failed to start TLS")
-
-		// Update status to failed
-		s.repo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
-		metaJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
-		s.repo.AddEmailEvent(ctx, models.EmailEventRecord{
-			EmailID:   emailRecord.ID,
-			EventType: "failed",
-			Meta:      metaJSON,
-		})
-
-		return fmt.Errorf("failed to start TLS: %w", err)
-	}
-
-	// Authenticate
-	auth := smtp.PlainAuth("", s.username, s.password, s.host)
-	if err := conn.Auth(auth); err != nil {
-		s.logger.Error().
-			Err(err).
-			Str("event", "email.smtp.auth.failed").
-			Str("message_id", messageID).
-			Msg("Failed to authenticate")
-
-		// Update status to failed
-		s.repo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
-		metaJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
-		s.repo.AddEmailEvent(ctx, models.EmailEventRecord{
-			EmailID:   emailRecord.ID,
-			EventType: "failed",
-			Meta:      metaJSON,
-		})
-
-		return fmt.Errorf("failed to authenticate: %w", err)
-	}
-
-	// Set sender
-	if err := conn.Mail(msg.From); err != nil {
-		s.logger.Error().
-			Err(err).
-			Str("event", "email.smtp.sender.failed").
-			Str("message_id", messageID).
-			Msg("Failed to set sender")
-
-		// Update status to failed
-		s.repo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
-		metaJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
-		s.repo.AddEmailEvent(ctx, models.EmailEventRecord{
-			EmailID:   emailRecord.ID,
-			EventType: "failed",
-			Meta:      metaJSON,
-		})
-
-		return fmt.Errorf("failed to set sender: %w", err)
-	}
-
-	// Set recipient
-	if err := conn.Rcpt(msg.To); err != nil {
-		s.logger.Error().
-			Err(err).
-			Str("event", "email.smtp.recipient.failed").
-			Str("message_id", messageID).
-			Msg("Failed to set recipient")
-
-		// Update status to failed
-		s.repo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
-		metaJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
-		s.repo.AddEmailEvent(ctx, models.EmailEventRecord{
-			EmailID:   emailRecord.ID,
-			EventType: "failed",
-			Meta:      metaJSON,
-		})
-
-		return fmt.Errorf("failed to set recipient: %w", err)
-	}
-
-	// Send email data
-	writer, err := conn.Data()
-	if err != nil {
-		s.logger.Error().
-			Err(err).
-			Str("event", "email.smtp.data.failed").
-			Str("message_id", messageID).
-			Msg("Failed to get data writer")
-
-		// Update status to failed
-		s.repo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
-		metaJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
-		s.repo.AddEmailEvent(ctx, models.EmailEventRecord{
-			EmailID:   emailRecord.ID,
-			EventType: "failed",
-			Meta:      metaJSON,
-		})
-
-		return fmt.Errorf("failed to get data writer: %w", err)
-	}
-
-	// Check context before writing
-	select {
-	case <-ctxWithTimeout.Done():
-		writer.Close()
-		s.logger.Warn().
-			Str("event", "email.cancelled").
-			Str("message_id", messageID).
-			Msg("Context cancelled before writing email data")
-
-		// Update status to failed
-		s.repo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
-		s.repo.AddEmailEvent(ctx, models.EmailEventRecord{
-			EmailID:   emailRecord.ID,
-			EventType: "failed",
-			Meta:      json.RawMessage(`{"error": "context cancelled"}`),
-		})
-
-		return ctxWithTimeout.Err()
-	default:
-	}
-
-	_, err = writer.Write(emailBody)
-	if err != nil {
-		writer.Close()
-		s.logger.Error().
-			Err(err).
-			Str("event", "email.smtp.write.failed").
-			Str("message_id", messageID).
-			Msg("Failed to write email data")
-
-		// Update status to failed
-		s.repo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
-		metaJSON, _ := json.Marshal(map[string]string{"error": err.Error()})
-		s.repo.AddEmailEvent(ctx, models.EmailEventRecord{
-			EmailID:   emailRecord.ID,
-			EventType: "failed",
-			Meta:      metaJSON,
-		})
-
-		return fmt.Errorf("failed to write email data: %w", err)
-	}
-
-	if err := writer.Close(); err != nil {
+	// Send over a pooled connection (STARTTLS and AUTH happen once per connection)
+	if err := s.pool.Send(ctxWithTimeout, s.server(), from.Address, []string{msg.To}, emailBody); err != nil {
+		err = fromPoolError(err)
+		event := "email.cancelled"
+		var smtpErr *SMTPError
+		if errors.As(err, &smtpErr) {
+			event = smtpFailureEvents[smtpErr.Op]
+		}
 		s.logger.Error().
 			Err(err).
-			Str("event", "email.smtp.close.failed").
+			Str("event", event).
 			Str("message_id", messageID).
-			Msg("Failed to close data writer")
+			Msg("Failed to send email via SMTP")
 
 		// Update status to failed
 		s.repo.UpdateEmailStatus(ctx, emailRecord.ID, "failed")
@@ -377,7 +278,7 @@ func (s *SmtpEmailSender) SendEmail(ctx context.Context, msg EmailMessage) error
 			Meta:      metaJSON,
 		})
 
-		return fmt.Errorf("failed to close data writer: %w", err)
+		return err
 	}
 
 	// Update status to sent
@@ -412,144 +313,36 @@ func (s *SmtpEmailSender) SendEmail(ctx context.Context, msg EmailMessage) error
 }
 
 // buildMIMEEmail builds a complete MIME email message
-func (s *SmtpEmailSender) buildMIMEEmail(msg EmailMessage) ([]byte, error) {
-	var buf bytes.Buffer
-
-	// Generate boundary for multipart message
-	boundary := fmt.Sprintf("----=_Part_%d_%d", time.Now().Unix(), time.Now().UnixNano())
-
-	// Build headers
-	headers := make(map[string]string)
-
-	// Set default headers
-	headers["From"] = msg.From
-	headers["To"] = msg.To
-	headers["Subject"] = s.encodeSubject(msg.Subject)
-	headers["MIME-Version"] = "1.0"
-
-	// Add Message-ID if provided in headers
-	if msgID, ok := msg.Headers["Message-ID"]; ok {
-		headers["Message-ID"] = msgID
-	} else {
-		// Generate Message-ID if not provided
-		headers["Message-ID"] = s.generateMessageID(msg.From)
-	}
-
-	// Add custom headers
-	for key, value := range msg.Headers {
-		if key != "Message-ID" { // Already handled above
-			headers[key] = value
-		}
+// A Message-ID in msg.Headers is kept; Date and Message-ID are generated otherwise.
+// Without a TextBody the text part is generated from HTMLBody unless
+// msg.DisableAutoText is set.
+func buildMIMEEmail(msg EmailMessage) ([]byte, error) {
+	if msg.TextBody == "" && msg.HTMLBody != "" && !msg.DisableAutoText {
+		msg.TextBody = htmltext.Convert(msg.HTMLBody)
 	}
 
-	// Write headers
-	for key, value := range headers {
-		buf.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
-	}
+	m := mimemsg.Message{
+		From:     msg.From,
+		To:       []string{msg.To},
+		Subject:  msg.Subject,
+		Headers:  make(map[string]string, len(msg.Headers)),
+		TextBody: msg.TextBody,
+		HTMLBody: msg.HTMLBody,
 
-	// Determine if we need multipart
-	hasHTML := msg.HTMLBody != ""
-	hasText := msg.TextBody != ""
-
-	if hasHTML && hasText {
-		// Multipart/alternative
-		buf.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n", boundary))
-		buf.WriteString("\r\n")
-
-		// Text part
-		buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		buf.WriteString("\r\n")
-		buf.WriteString(s.quotedPrintableEncode(msg.TextBody))
-		buf.WriteString("\r\n")
-
-		// HTML part
-		buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		buf.WriteString("\r\n")
-		buf.WriteString(s.quotedPrintableEncode(msg.HTMLBody))
-		buf.WriteString("\r\n")
-
-		// Close boundary
-		buf.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
-	} else if hasHTML {
-		// HTML only
-		buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		buf.WriteString("\r\n")
-		buf.WriteString(s.quotedPrintableEncode(msg.HTMLBody))
-	} else if hasText {
-		// Text only
-		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
-		buf.WriteString("\r\n")
-		buf.WriteString(s.quotedPrintableEncode(msg.TextBody))
+		Attachments: msg.Attachments,
+		Inline:      msg.Inline,
 	}
-
-	return buf.Bytes(), nil
-}
-
-// encodeSubject encodes email subject for MIME
-func (s *SmtpEmailSender) encodeSubject(subject string) string {
-	// Simple encoding - if subject contains non-ASCII, encode it
-	if s.isASCII(subject) {
-		return subject
-	}
-	// For simplicity, return as-is (in production, use proper MIME encoding)
-	return subject
-}
-
-// isASCII checks if string contains only ASCII characters
-func (s *SmtpEmailSender) isASCII(str string) bool {
-	for i := 0; i < len(str); i++ {
-		if str[i] > 127 {
-			return false
-		}
-	}
-	return true
-}
-
-// quotedPrintableEncode performs basic quoted-printable encoding
-func (s *SmtpEmailSender) quotedPrintableEncode(text string) string {
-	var buf bytes.Buffer
-	lineLen := 0
-	maxLineLen := 76
-
-	for _, char := range text {
-		// Check if we need to break line
-		if lineLen >= maxLineLen {
-			buf.WriteString("=\r\n")
-			lineLen = 0
-		}
-
-		// Encode if necessary
-		if char == '\r' || char == '\n' {
-			if char == '\n' {
-				buf.WriteByte('\n')
-				lineLen = 0
-			}
+	for key, value := range msg.Headers {
+		if strings.EqualFold(key, "Message-ID") {
+			m.MessageID = value
 			continue
-		} else if char == '=' || char > 127 || char < 32 {
-			// Encode as =XX
-			buf.WriteString(fmt.Sprintf("=%02X", char))
-			lineLen += 3
-		} else {
-			buf.WriteRune(char)
-			lineLen++
 		}
+		m.Headers[key] = value
 	}
-
-	return buf.String()
+	return m.Build()
 }
 
 // generateMessageID generates a unique Message-ID in format <UUID@domain>
 func (s *SmtpEmailSender) generateMessageID(from string) string {
-	domain := "mailer.local"
-	if idx := strings.LastIndex(from, "@"); idx != -1 {
-		domain = from[idx+1:]
-	}
-	msgUUID := uuid.New()
-	return fmt.Sprintf("<%s@%s>", msgUUID.String(), domain)
+	return NewMessageID(from)
 }
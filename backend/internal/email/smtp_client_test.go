@@ -1,18 +1,17 @@
 package email
 
 import (
+	"context"
 	"strings"
 	"testing"
+
+	"backend/internal/smtppool"
+	"backend/internal/smtptest"
+
+	"github.com/rs/zerolog"
 )
 
 func TestBuildMIMEEmail_TextOnly(t *testing.T) {
-	sender := &SmtpEmailSender{
-		host:     "test.example.com",
-		port:     587,
-		username: "test",
-		password: "test",
-	}
-
 	msg := EmailMessage{
 		From:     "sender@example.com",
 		To:       "recipient@example.com",
@@ -21,7 +20,7 @@ func TestBuildMIMEEmail_TextOnly(t *testing.T) {
 		Headers:  make(map[string]string),
 	}
 
-	emailBody, err := sender.buildMIMEEmail(msg)
+	emailBody, err := buildMIMEEmail(msg)
 	if err != nil {
 		t.Fatalf("Failed to build MIME email: %v", err)
 	}
@@ -54,13 +53,6 @@ func TestBuildMIMEEmail_TextOnly(t *testing.T) {
 }
 
 func TestBuildMIMEEmail_HTMLOnly(t *testing.T) {
-	sender := &SmtpEmailSender{
-		host:     "test.example.com",
-		port:     587,
-		username: "test",
-		password: "test",
-	}
-
 	msg := EmailMessage{
 		From:     "sender@example.com",
 		To:       "recipient@example.com",
@@ -69,7 +61,7 @@ func TestBuildMIMEEmail_HTMLOnly(t *testing.T) {
 		Headers:  make(map[string]string),
 	}
 
-	emailBody, err := sender.buildMIMEEmail(msg)
+	emailBody, err := buildMIMEEmail(msg)
 	if err != nil {
 		t.Fatalf("Failed to build MIME email: %v", err)
 	}
@@ -88,13 +80,6 @@ func TestBuildMIMEEmail_HTMLOnly(t *testing.T) {
 }
 
 func TestBuildMIMEEmail_Multipart(t *testing.T) {
-	sender := &SmtpEmailSender{
-		host:     "test.example.com",
-		port:     587,
-		username: "test",
-		password: "test",
-	}
-
 	msg := EmailMessage{
 		From:     "sender@example.com",
 		To:       "recipient@example.com",
@@ -104,7 +89,7 @@ func TestBuildMIMEEmail_Multipart(t *testing.T) {
 		Headers:  make(map[string]string),
 	}
 
-	emailBody, err := sender.buildMIMEEmail(msg)
+	emailBody, err := buildMIMEEmail(msg)
 	if err != nil {
 		t.Fatalf("Failed to build MIME email: %v", err)
 	}
@@ -138,14 +123,57 @@ func TestBuildMIMEEmail_Multipart(t *testing.T) {
 	}
 }
 
-func TestBuildMIMEEmail_CustomHeaders(t *testing.T) {
-	sender := &SmtpEmailSender{
-		host:     "test.example.com",
-		port:     587,
-		username: "test",
-		password: "test",
+func TestBuildMIMEEmail_GeneratesTextPart(t *testing.T) {
+	msg := EmailMessage{
+		From:     "sender@example.com",
+		To:       "recipient@example.com",
+		Subject:  "HTML only",
+		HTMLBody: `<h1>Hello</h1><p>Read <a href="https://example.com/news">the news</a>.</p><img src="https://t.example.com/open" alt="">`,
+		Headers:  make(map[string]string),
+	}
+
+	emailBody, err := buildMIMEEmail(msg)
+	if err != nil {
+		t.Fatalf("Failed to build MIME email: %v", err)
+	}
+
+	bodyStr := string(emailBody)
+	if !strings.Contains(bodyStr, "Content-Type: multipart/alternative") {
+		t.Error("Missing multipart/alternative Content-Type")
+	}
+	if !strings.Contains(bodyStr, "Content-Type: text/plain") {
+		t.Error("Missing generated text/plain part")
+	}
+	for _, want := range []string{"Read the news [1].", "[1] https://example.com/news"} {
+		if !strings.Contains(bodyStr, want) {
+			t.Errorf("Generated text part missing %q", want)
+		}
+	}
+}
+
+func TestBuildMIMEEmail_DisableAutoText(t *testing.T) {
+	msg := EmailMessage{
+		From:     "sender@example.com",
+		To:       "recipient@example.com",
+		Subject:  "HTML only",
+		HTMLBody: "<p>HTML version</p>",
+		Headers:  make(map[string]string),
+
+		DisableAutoText: true,
+	}
+
+	emailBody, err := buildMIMEEmail(msg)
+	if err != nil {
+		t.Fatalf("Failed to build MIME email: %v", err)
+	}
+
+	bodyStr := string(emailBody)
+	if strings.Contains(bodyStr, "multipart/alternative") || strings.Contains(bodyStr, "text/plain") {
+		t.Error("Expected an HTML-only message")
 	}
+}
 
+func TestBuildMIMEEmail_CustomHeaders(t *testing.T) {
 	msg := EmailMessage{
 		From:     "sender@example.com",
 		To:       "recipient@example.com",
@@ -158,7 +186,7 @@ func TestBuildMIMEEmail_CustomHeaders(t *testing.T) {
 		},
 	}
 
-	emailBody, err := sender.buildMIMEEmail(msg)
+	emailBody, err := buildMIMEEmail(msg)
 	if err != nil {
 		t.Fatalf("Failed to build MIME email: %v", err)
 	}
@@ -180,13 +208,6 @@ func TestBuildMIMEEmail_CustomHeaders(t *testing.T) {
 }
 
 func TestBuildMIMEEmail_SubjectEncoding(t *testing.T) {
-	sender := &SmtpEmailSender{
-		host:     "test.example.com",
-		port:     587,
-		username: "test",
-		password: "test",
-	}
-
 	testCases := []struct {
 		name    string
 		subject string
@@ -206,7 +227,7 @@ func TestBuildMIMEEmail_SubjectEncoding(t *testing.T) {
 				Headers:  make(map[string]string),
 			}
 
-			emailBody, err := sender.buildMIMEEmail(msg)
+			emailBody, err := buildMIMEEmail(msg)
 			if err != nil {
 				t.Fatalf("Failed to build MIME email: %v", err)
 			}
@@ -221,14 +242,36 @@ func TestBuildMIMEEmail_SubjectEncoding(t *testing.T) {
 	}
 }
 
-func TestBuildMIMEEmail_MIMEStructure(t *testing.T) {
-	sender := &SmtpEmailSender{
-		host:     "test.example.com",
-		port:     587,
-		username: "test",
-		password: "test",
+func TestBuildMIMEEmail_EncodesNonASCIISubjectAndSetsDate(t *testing.T) {
+	msg := EmailMessage{
+		From:     "sender@example.com",
+		To:       "recipient@example.com",
+		Subject:  "Grüße ✓",
+		TextBody: "Café",
+		Headers:  map[string]string{"Message-ID": "<custom-id@example.com>"},
 	}
 
+	emailBody, err := buildMIMEEmail(msg)
+	if err != nil {
+		t.Fatalf("Failed to build MIME email: %v", err)
+	}
+
+	bodyStr := string(emailBody)
+	if !strings.Contains(bodyStr, "Subject: =?UTF-8?q?Gr=C3=BC=C3=9Fe_=E2=9C=93?=") {
+		t.Errorf("Subject not RFC 2047 encoded:\n%s", bodyStr)
+	}
+	if !strings.HasPrefix(bodyStr, "Date: ") {
+		t.Error("Message should start with a Date header")
+	}
+	if strings.Count(bodyStr, "Message-ID:") != 1 {
+		t.Error("Message should have exactly one Message-ID header")
+	}
+	if !strings.Contains(bodyStr, "Caf=C3=A9") {
+		t.Error("Body should be quoted-printable encoded byte-wise")
+	}
+}
+
+func TestBuildMIMEEmail_MIMEStructure(t *testing.T) {
 	msg := EmailMessage{
 		From:     "sender@example.com",
 		To:       "recipient@example.com",
@@ -238,7 +281,7 @@ func TestBuildMIMEEmail_MIMEStructure(t *testing.T) {
 		Headers:  make(map[string]string),
 	}
 
-	emailBody, err := sender.buildMIMEEmail(msg)
+	emailBody, err := buildMIMEEmail(msg)
 	if err != nil {
 		t.Fatalf("Failed to build MIME email: %v", err)
 	}
@@ -271,33 +314,6 @@ func TestBuildMIMEEmail_MIMEStructure(t *testing.T) {
 	}
 }
 
-func TestQuotedPrintableEncode(t *testing.T) {
-	sender := &SmtpEmailSender{}
-
-	testCases := []struct {
-		name     string
-		input    string
-		expected string // Should contain certain patterns
-	}{
-		{"Simple text", "Hello World", "Hello World"},
-		{"Text with newline", "Line 1\nLine 2", "Line 1"},
-		{"Text with equals", "Test=Value", "="}, // Should encode =
-	}
-
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			result := sender.quotedPrintableEncode(tc.input)
-			if result == "" {
-				t.Error("Quoted-printable encoding returned empty string")
-			}
-			// Basic validation - result should not be empty
-			if len(result) == 0 {
-				t.Error("Encoding result is empty")
-			}
-		})
-	}
-}
-
 func TestGenerateMessageID(t *testing.T) {
 	sender := &SmtpEmailSender{}
 
@@ -314,3 +330,33 @@ func TestGenerateMessageID(t *testing.T) {
 		t.Error("Message-ID should contain domain from email address")
 	}
 }
+
+func TestSmtpEmailSender_SendEmailEnvelopeSender(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	sender := &SmtpEmailSender{
+		host:       srv.Host,
+		port:       srv.Port,
+		encryption: smtppool.EncryptionNone,
+		pool:       smtppool.Shared(),
+		repo:       newMockEmailRepository(),
+		logger:     zerolog.Nop(),
+	}
+
+	err := sender.SendEmail(context.Background(), EmailMessage{
+		From:     "Shop <shop@example.com>",
+		To:       "b@example.org",
+		Subject:  "Hello",
+		TextBody: "Hi",
+	})
+	if err != nil {
+		t.Fatalf("SendEmail() error = %v", err)
+	}
+
+	messages := srv.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(messages))
+	}
+	if messages[0].From != "shop@example.com" {
+		t.Errorf("envelope sender = %q, want shop@example.com", messages[0].From)
+	}
+}
@@ -0,0 +1,70 @@
+package email
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"backend/internal/models"
+	"backend/internal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// TemplateSource returns template versions; templates.Service implements it
+type TemplateSource interface {
+	GetVersion(ctx context.Context, id uuid.UUID, version int, clientID *uuid.UUID) (*models.TemplateVersion, error)
+}
+
+// SetTemplates sets the source of the templates requests can reference
+func (h *SendEmailHandler) SetTemplates(source TemplateSource) {
+	h.templates = source
+}
+
+// validateTemplate checks the template fields of a request
+// A template replaces subject, html and text, so they cannot be combined.
+func (r *SendEmailRequest) validateTemplate() error {
+	if r.TemplateID == "" {
+		if r.TemplateVersion != 0 {
+			return fmt.Errorf("template_version requires template_id")
+		}
+		return nil
+	}
+	if _, err := uuid.Parse(r.TemplateID); err != nil {
+		return fmt.Errorf("invalid template_id format")
+	}
+	if r.TemplateVersion < 0 {
+		return fmt.Errorf("invalid template_version")
+	}
+	if r.Subject != "" || r.HTML != "" || r.Text != "" {
+		return fmt.Errorf("subject, html and text cannot be combined with template_id")
+	}
+	return nil
+}
+
+// loadTemplate returns the template version a request references, nil when
+// it has none. Templates of other clients than the sending one are not found.
+// On error it also returns the HTTP status to respond with.
+func (h *SendEmailHandler) loadTemplate(ctx context.Context, req *SendEmailRequest, links *sendLinks) (*models.TemplateVersion, int, error) {
+	if req.TemplateID == "" {
+		return nil, fiber.StatusOK, nil
+	}
+	if h.templates == nil {
+		return nil, fiber.StatusBadRequest, fmt.Errorf("templates are not available")
+	}
+
+	id := uuid.MustParse(req.TemplateID) // checked by validateTemplate
+	version, err := h.templates.GetVersion(ctx, id, req.TemplateVersion, links.ClientID)
+	switch {
+	case errors.Is(err, templates.ErrTemplateNotFound), errors.Is(err, templates.ErrVersionNotFound):
+		return nil, fiber.StatusNotFound, err
+	case err != nil:
+		return nil, fiber.StatusInternalServerError, fmt.Errorf("failed to load template")
+	}
+
+	if len(req.Inline) > 0 && version.HTMLContent == "" {
+		return nil, fiber.StatusBadRequest, fmt.Errorf("inline parts require html")
+	}
+	return version, fiber.StatusOK, nil
+}
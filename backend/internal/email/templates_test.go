@@ -0,0 +1,137 @@
+package email
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/templates"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// clientTemplates serves the versions of templates owned by one client
+type clientTemplates struct {
+	clientID uuid.UUID
+	versions map[uuid.UUID][]*models.TemplateVersion // oldest first
+}
+
+func (s *clientTemplates) GetVersion(ctx context.Context, id uuid.UUID, version int, clientID *uuid.UUID) (*models.TemplateVersion, error) {
+	versions, ok := s.versions[id]
+	if !ok || clientID != nil && *clientID != s.clientID {
+		return nil, templates.ErrTemplateNotFound
+	}
+	if version == 0 {
+		version = len(versions)
+	}
+	if version > len(versions) {
+		return nil, templates.ErrVersionNotFound
+	}
+	return versions[version-1], nil
+}
+
+// newTemplateSendTestApp serves HandleSendEmail with a receipt template of
+// client in two versions
+func newTemplateSendTestApp(client uuid.UUID) (*fiber.App, *Queue, uuid.UUID) {
+	templateID := uuid.New()
+	source := &clientTemplates{clientID: client, versions: map[uuid.UUID][]*models.TemplateVersion{
+		templateID: {
+			{TemplateID: templateID, Version: 1, Subject: "Receipt", TextContent: "Thanks"},
+			{
+				TemplateID:  templateID,
+				Version:     2,
+				Subject:     "Receipt {{order_id}}",
+				HTMLContent: "<p>Thanks {{name}}</p>",
+				TextContent: "Thanks {{name}}, order {{order_id}}",
+				Variables: models.TemplateVariables{
+					{Name: "name", Type: models.TemplateVariableString, Default: "friend"},
+					{Name: "order_id", Type: models.TemplateVariableNumber, Required: true},
+				},
+			},
+		},
+	}}
+
+	queue := NewQueue(1, nil, newMockEmailRepository(), nil)
+	handler := NewSendEmailHandler(queue, newMockEmailRepository(), nil)
+	handler.SetTemplates(source)
+	return serveSendEmail(handler), queue, templateID
+}
+
+func TestHandleSendEmail_RendersTemplate(t *testing.T) {
+	client := uuid.New()
+	app, queue, templateID := newTemplateSendTestApp(client)
+	body := `{
+		"from": "shop@example.com",
+		"template_id": "` + templateID.String() + `",
+		"recipients": [
+			{"email": "ana@example.org", "data": {"name": "<Ana>", "order_id": 7}},
+			{"email": "bob@example.org", "data": {"order_id": 8}},
+			{"email": "eve@example.org", "data": {"name": "Eve"}}
+		]
+	}`
+
+	status, response, _ := postSend(t, app, client, "", body)
+	if status != fiber.StatusOK || response.Status != "partial" || response.Queued != 2 || response.TemplateVersion != 2 {
+		t.Fatalf("send = %d %+v, want 2 queued from version 2", status, response)
+	}
+	if len(response.Errors) != 1 || response.Errors[0].Email != "eve@example.org" || !strings.Contains(response.Errors[0].Error, "order_id") {
+		t.Errorf("errors = %+v, want eve missing order_id", response.Errors)
+	}
+
+	want := map[string][3]string{
+		"ana@example.org": {"Receipt 7", "<p>Thanks &lt;Ana&gt;</p>", "Thanks <Ana>, order 7"},
+		"bob@example.org": {"Receipt 8", "<p>Thanks friend</p>", "Thanks friend, order 8"},
+	}
+	for _, job := range queuedJobs(queue) {
+		got := [3]string{job.Subject, job.HTMLBody, job.TextBody}
+		expected := want[job.To]
+		expected[1] = PrepareHTML(expected[1], job.EmailRecord.MessageID, false)
+		if got != expected {
+			t.Errorf("%s got %q, want %q", job.To, got, expected)
+		}
+	}
+}
+
+func TestHandleSendEmail_RendersPinnedTemplateVersion(t *testing.T) {
+	client := uuid.New()
+	app, queue, templateID := newTemplateSendTestApp(client)
+	body := `{"from": "shop@example.com", "to": ["ana@example.org"], "template_id": "` + templateID.String() + `", "template_version": 1}`
+
+	status, response, _ := postSend(t, app, client, "", body)
+	if status != fiber.StatusOK || response.Queued != 1 || response.TemplateVersion != 1 {
+		t.Fatalf("send = %d %+v, want 1 queued from version 1", status, response)
+	}
+	if jobs := queuedJobs(queue); jobs[0].Subject != "Receipt" || jobs[0].TextBody != "Thanks" {
+		t.Errorf("job = %q %q, want version 1 content", jobs[0].Subject, jobs[0].TextBody)
+	}
+}
+
+func TestHandleSendEmail_RejectsInvalidTemplateRequests(t *testing.T) {
+	client := uuid.New()
+	app, _, templateID := newTemplateSendTestApp(client)
+	id := templateID.String()
+
+	tests := []struct {
+		name   string
+		client uuid.UUID
+		body   string
+		want   int
+	}{
+		{"content with template", client, `{"from":"a@example.com","to":["b@example.org"],"template_id":"` + id + `","subject":"Hi"}`, fiber.StatusBadRequest},
+		{"invalid template_id", client, `{"from":"a@example.com","to":["b@example.org"],"template_id":"nope"}`, fiber.StatusBadRequest},
+		{"version without template", client, `{"from":"a@example.com","to":["b@example.org"],"subject":"Hi","text":"Hi","template_version":2}`, fiber.StatusBadRequest},
+		{"unknown version", client, `{"from":"a@example.com","to":["b@example.org"],"template_id":"` + id + `","template_version":3}`, fiber.StatusNotFound},
+		{"unknown template", client, `{"from":"a@example.com","to":["b@example.org"],"template_id":"` + uuid.NewString() + `"}`, fiber.StatusNotFound},
+		{"template of another client", uuid.New(), `{"from":"a@example.com","to":["b@example.org"],"template_id":"` + id + `"}`, fiber.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, _, _ := postSend(t, app, tt.client, "", tt.body); status != tt.want {
+				t.Errorf("send status = %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
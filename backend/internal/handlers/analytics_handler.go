@@ -1,16 +1,23 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 
+	"backend/internal/middleware"
+	"backend/internal/repositories"
 	"backend/internal/services"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 )
 
+// errNoClient is returned when a non-admin user is not linked to a client
+var errNoClient = errors.New("user is not linked to a client")
+
 // AnalyticsHandler handles analytics API requests
 type AnalyticsHandler struct {
 	analyticsService *services.AnalyticsService
@@ -25,9 +32,50 @@ func NewAnalyticsHandler(analyticsService *services.AnalyticsService) *Analytics
 	}
 }
 
+// analyticsFilter builds the filter from the client_id, campaign_id and contact_id query parameters
+// Non-admin users are always restricted to their own client.
+func analyticsFilter(c *fiber.Ctx) (repositories.AnalyticsFilter, error) {
+	var filter repositories.AnalyticsFilter
+	var err error
+
+	if filter.CampaignID, err = parseOptionalUUID(c.Query("campaign_id")); err != nil {
+		return filter, fmt.Errorf("invalid campaign_id format")
+	}
+	if filter.ContactID, err = parseOptionalUUID(c.Query("contact_id")); err != nil {
+		return filter, fmt.Errorf("invalid contact_id format")
+	}
+
+	if !middleware.IsAdmin(c) {
+		if filter.ClientID = middleware.ClientIDFromContext(c); filter.ClientID == nil {
+			return filter, errNoClient
+		}
+		return filter, nil
+	}
+	if filter.ClientID, err = parseOptionalUUID(c.Query("client_id")); err != nil {
+		return filter, fmt.Errorf("invalid client_id format")
+	}
+	return filter, nil
+}
+
+// filterError responds to an analyticsFilter error
+func filterError(c *fiber.Ctx, err error) error {
+	status := fiber.StatusBadRequest
+	if errors.Is(err, errNoClient) {
+		status = fiber.StatusForbidden
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"error": err.Error(),
+	})
+}
+
 // GetOverview handles GET /analytics/overview
 func (h *AnalyticsHandler) GetOverview(c *fiber.Ctx) error {
-	stats, err := h.analyticsService.GetOverview(c.Context())
+	filter, err := analyticsFilter(c)
+	if err != nil {
+		return filterError(c, err)
+	}
+
+	stats, err := h.analyticsService.GetOverview(c.Context(), filter)
 	if err != nil {
 		h.logger.Error().
 			Err(err).
@@ -45,7 +93,12 @@ func (h *AnalyticsHandler) GetOverview(c *fiber.Ctx) error {
 func (h *AnalyticsHandler) GetTimeline(c *fiber.Ctx) error {
 	rangeStr := c.Query("range", "7d") // Default to 7 days
 
-	timeline, err := h.analyticsService.GetTimeline(c.Context(), rangeStr)
+	filter, err := analyticsFilter(c)
+	if err != nil {
+		return filterError(c, err)
+	}
+
+	timeline, err := h.analyticsService.GetTimeline(c.Context(), rangeStr, filter)
 	if err != nil {
 		h.logger.Error().
 			Err(err).
@@ -73,7 +126,12 @@ func (h *AnalyticsHandler) GetTopLinks(c *fiber.Ctx) error {
 		}
 	}
 
-	links, err := h.analyticsService.GetTopLinks(c.Context(), limit)
+	filter, err := analyticsFilter(c)
+	if err != nil {
+		return filterError(c, err)
+	}
+
+	links, err := h.analyticsService.GetTopLinks(c.Context(), limit, filter)
 	if err != nil {
 		h.logger.Error().
 			Err(err).
@@ -96,7 +154,12 @@ func (h *AnalyticsHandler) GetEmailEvents(c *fiber.Ctx) error {
 		})
 	}
 
-	events, err := h.analyticsService.GetEmailEvents(c.Context(), messageID)
+	filter, err := analyticsFilter(c)
+	if err != nil {
+		return filterError(c, err)
+	}
+
+	events, err := h.analyticsService.GetEmailEvents(c.Context(), messageID, filter)
 	if err != nil {
 		h.logger.Error().
 			Err(err).
@@ -113,3 +176,65 @@ func (h *AnalyticsHandler) GetEmailEvents(c *fiber.Ctx) error {
 		"events":     events,
 	})
 }
+
+// GetEmailMessages handles GET /analytics/messages?campaign_id=&contact_id=&status=&limit=50&offset=0
+func (h *AnalyticsHandler) GetEmailMessages(c *fiber.Ctx) error {
+	filter, err := analyticsFilter(c)
+	if err != nil {
+		return filterError(c, err)
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit", "50"))
+	offset, _ := strconv.Atoi(c.Query("offset", "0"))
+
+	messages, total, err := h.analyticsService.GetEmailMessages(c.Context(), filter, c.Query("status"), limit, offset)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("event", "analytics.messages.failed").
+			Msg("Failed to get email messages")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch email messages",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"messages": messages,
+		"total":    total,
+	})
+}
+
+// GetCampaignStats handles GET /analytics/campaigns/:id
+func (h *AnalyticsHandler) GetCampaignStats(c *fiber.Ctx) error {
+	campaignID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid campaign ID",
+		})
+	}
+
+	// Client users only see their own campaigns
+	filter, err := analyticsFilter(c)
+	if err != nil {
+		return filterError(c, err)
+	}
+
+	stats, err := h.analyticsService.GetCampaignStats(c.Context(), campaignID, filter.ClientID)
+	if err != nil {
+		if errors.Is(err, repositories.ErrCampaignNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "campaign not found",
+			})
+		}
+		h.logger.Error().
+			Err(err).
+			Str("event", "analytics.campaign.failed").
+			Str("campaign_id", campaignID.String()).
+			Msg("Failed to get campaign stats")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch campaign statistics",
+		})
+	}
+
+	return c.JSON(stats)
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"backend/internal/cache"
+	"backend/internal/models"
+	"backend/internal/repositories"
+	"backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// mockAnalyticsRepository records the filter of the last query
+type mockAnalyticsRepository struct {
+	lastFilter *repositories.AnalyticsFilter
+	campaigns  map[uuid.UUID]*models.Campaign
+}
+
+func (m *mockAnalyticsRepository) GetOverviewStats(ctx context.Context, filter repositories.AnalyticsFilter) (*repositories.OverviewStats, error) {
+	m.lastFilter = &filter
+	return &repositories.OverviewStats{}, nil
+}
+
+func (m *mockAnalyticsRepository) GetTimelineStats(ctx context.Context, days int, filter repositories.AnalyticsFilter) ([]repositories.TimelineStat, error) {
+	m.lastFilter = &filter
+	return nil, nil
+}
+
+func (m *mockAnalyticsRepository) GetTopClickedLinks(ctx context.Context, limit int, filter repositories.AnalyticsFilter) ([]repositories.TopLink, error) {
+	m.lastFilter = &filter
+	return nil, nil
+}
+
+func (m *mockAnalyticsRepository) GetEmailEvents(ctx context.Context, messageID string, filter repositories.AnalyticsFilter) ([]models.EmailEventRecord, error) {
+	m.lastFilter = &filter
+	return nil, nil
+}
+
+func (m *mockAnalyticsRepository) GetEmailMessages(ctx context.Context, filter repositories.AnalyticsFilter, status string, limit, offset int) ([]models.EmailMessageRecord, int64, error) {
+	m.lastFilter = &filter
+	return nil, 0, nil
+}
+
+func (m *mockAnalyticsRepository) GetCampaign(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
+	campaign, ok := m.campaigns[id]
+	if !ok {
+		return nil, repositories.ErrCampaignNotFound
+	}
+	return campaign, nil
+}
+
+func (m *mockAnalyticsRepository) GetCampaignStats(ctx context.Context, campaign *models.Campaign) (*repositories.CampaignStats, error) {
+	return &repositories.CampaignStats{CampaignID: campaign.ID, Title: campaign.Title, Recipients: 3}, nil
+}
+
+// newAnalyticsTestApp serves the analytics handlers as a user with the given role and client
+func newAnalyticsTestApp(repo *mockAnalyticsRepository, role string, clientID *uuid.UUID) *fiber.App {
+	handler := NewAnalyticsHandler(services.NewAnalyticsService(repo, cache.NewAnalyticsCache(cache.NewMemoryCache())))
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("user_role", role)
+		c.Locals("user", &models.User{ID: uuid.New(), Role: role, ClientID: clientID})
+		return c.Next()
+	})
+	app.Get("/analytics/overview", handler.GetOverview)
+	app.Get("/analytics/messages", handler.GetEmailMessages)
+	app.Get("/analytics/campaigns/:id", handler.GetCampaignStats)
+	return app
+}
+
+func TestAnalyticsHandler_ClientUsersAreScopedToTheirClient(t *testing.T) {
+	repo := &mockAnalyticsRepository{}
+	clientID := uuid.New()
+	app := newAnalyticsTestApp(repo, "client", &clientID)
+
+	// client_id in the query is ignored for client users
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/analytics/overview?client_id="+uuid.NewString(), nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+	if repo.lastFilter == nil || repo.lastFilter.ClientID == nil || *repo.lastFilter.ClientID != clientID {
+		t.Errorf("expected filter on client %s, got %+v", clientID, repo.lastFilter)
+	}
+}
+
+func TestAnalyticsHandler_ClientUserWithoutClientIsForbidden(t *testing.T) {
+	repo := &mockAnalyticsRepository{}
+	app := newAnalyticsTestApp(repo, "client", nil)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/analytics/overview", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusForbidden {
+		t.Errorf("expected status 403, got %d", resp.StatusCode)
+	}
+	if repo.lastFilter != nil {
+		t.Error("expected no query to run")
+	}
+}
+
+func TestAnalyticsHandler_AdminFilters(t *testing.T) {
+	repo := &mockAnalyticsRepository{}
+	app := newAnalyticsTestApp(repo, "admin", nil)
+	clientID, campaignID, contactID := uuid.New(), uuid.New(), uuid.New()
+
+	url := "/analytics/messages?client_id=" + clientID.String() + "&campaign_id=" + campaignID.String() + "&contact_id=" + contactID.String()
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, url, nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected status 200, got %d", resp.StatusCode)
+	}
+
+	filter := repo.lastFilter
+	if filter == nil || filter.ClientID == nil || filter.CampaignID == nil || filter.ContactID == nil {
+		t.Fatalf("expected all filters to be set, got %+v", filter)
+	}
+	if *filter.ClientID != clientID || *filter.CampaignID != campaignID || *filter.ContactID != contactID {
+		t.Errorf("unexpected filter %+v", filter)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/analytics/messages?campaign_id=nope", nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	if resp.StatusCode != fiber.StatusBadRequest {
+		t.Errorf("expected status 400 for invalid campaign_id, got %d", resp.StatusCode)
+	}
+}
+
+func TestAnalyticsHandler_CampaignStatsOwnership(t *testing.T) {
+	ownClient, otherClient := uuid.New(), uuid.New()
+	own := &models.Campaign{ID: uuid.New(), ClientID: ownClient, Title: "Own"}
+	other := &models.Campaign{ID: uuid.New(), ClientID: otherClient, Title: "Other"}
+	repo := &mockAnalyticsRepository{campaigns: map[uuid.UUID]*models.Campaign{own.ID: own, other.ID: other}}
+
+	tests := []struct {
+		name       string
+		role       string
+		clientID   *uuid.UUID
+		campaignID string
+		expected   int
+	}{
+		{"Own campaign", "client", &ownClient, own.ID.String(), fiber.StatusOK},
+		{"Other client's campaign", "client", &ownClient, other.ID.String(), fiber.StatusNotFound},
+		{"Admin sees any campaign", "admin", nil, other.ID.String(), fiber.StatusOK},
+		{"Unknown campaign", "admin", nil, uuid.NewString(), fiber.StatusNotFound},
+		{"Invalid ID", "admin", nil, "nope", fiber.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := newAnalyticsTestApp(repo, tt.role, tt.clientID)
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/analytics/campaigns/"+tt.campaignID, nil))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.expected {
+				t.Errorf("expected status %d, got %d", tt.expected, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -1,27 +1,36 @@
 package handlers
 
 import (
-	"encoding/json"
+	"context"
 
-	"backend/internal/email"
+	"backend/internal/middleware"
 	"backend/internal/queue"
+	"backend/internal/repositories"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 )
 
-type EmailHandler struct{}
+type EmailHandler struct {
+	owners repositories.OwnershipRepository
+}
 
 // NewEmailHandler creates a new email handler
-func NewEmailHandler() *EmailHandler {
-	return &EmailHandler{}
+// owners checks that campaign_id and contact_id belong to the sending client.
+func NewEmailHandler(owners repositories.OwnershipRepository) *EmailHandler {
+	return &EmailHandler{owners: owners}
 }
 
 // SendEmailRequest represents the request body for sending email
+// Emails are sent from the worker's MAIL_FROM_ADDRESS.
 type SendEmailRequest struct {
-	To       string `json:"to"`
-	Subject  string `json:"subject"`
-	BodyHTML string `json:"body_html"`
-	From     string `json:"from"`
+	To         string `json:"to"`
+	Subject    string `json:"subject"`
+	BodyHTML   string `json:"body_html"`
+	ClientID   string `json:"client_id,omitempty"`   // admins only
+	CampaignID string `json:"campaign_id,omitempty"` // optional
+	ContactID  string `json:"contact_id,omitempty"`  // optional
+	InlineCSS  bool   `json:"inline_css,omitempty"`  // inline <style> rules of body_html
 }
 
 // SendEmail handles POST /send-email
@@ -34,30 +43,81 @@ func (h *EmailHandler) SendEmail(c *fiber.Ctx) error {
 	}
 
 	// Validate required fields
-	if req.To == "" || req.Subject == "" || req.BodyHTML == "" || req.From == "" {
+	if req.To == "" || req.Subject == "" || req.BodyHTML == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "to, subject, body_html, and from are required",
+			"error": "to, subject, and body_html are required",
 		})
 	}
 
-	// Convert to EmailJob
-	job := email.EmailJob{
-		To:       req.To,
-		Subject:  req.Subject,
-		BodyHTML: req.BodyHTML,
-		From:     req.From,
+	// Convert to the payload consumed by queue.EmailWorker
+	payload := queue.EmailJobPayload{
+		Email:     req.To,
+		Subject:   req.Subject,
+		HTML:      req.BodyHTML,
+		ClientID:  middleware.ClientIDFromContext(c),
+		InlineCSS: req.InlineCSS,
 	}
 
-	// Marshal to JSON
-	jobData, err := json.Marshal(job)
+	var err error
+	if payload.CampaignID, err = parseOptionalUUID(req.CampaignID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid campaign_id format",
+		})
+	}
+	if payload.ContactID, err = parseOptionalUUID(req.ContactID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid contact_id format",
+		})
+	}
+
+	// Client users always send for their own client
+	requested, err := parseOptionalUUID(req.ClientID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to marshal job",
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid client_id format",
 		})
 	}
+	if requested != nil {
+		if middleware.IsAdmin(c) {
+			payload.ClientID = requested
+		} else if payload.ClientID == nil || *payload.ClientID != *requested {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "cannot send on behalf of another client",
+			})
+		}
+	}
+
+	// Campaigns and contacts of another client are reported as not found
+	if payload.ClientID != nil || !middleware.IsAdmin(c) {
+		for _, check := range []struct {
+			name      string
+			id        *uuid.UUID
+			belongsTo func(context.Context, uuid.UUID, uuid.UUID) (bool, error)
+		}{
+			{"campaign", payload.CampaignID, h.owners.CampaignBelongsTo},
+			{"contact", payload.ContactID, h.owners.ContactBelongsTo},
+		} {
+			if check.id == nil {
+				continue
+			}
+			ok := false
+			if payload.ClientID != nil {
+				if ok, err = check.belongsTo(c.Context(), *check.id, *payload.ClientID); err != nil {
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+						"error": "Failed to check " + check.name,
+					})
+				}
+			}
+			if !ok {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+					"error": check.name + " not found",
+				})
+			}
+		}
+	}
 
 	// Enqueue into Redis
-	if err := queue.Enqueue(jobData); err != nil {
+	if err := queue.EnqueueJob(queue.JobTypeSendEmail, payload); err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to queue email",
 		})
@@ -67,3 +127,15 @@ func (h *EmailHandler) SendEmail(c *fiber.Ctx) error {
 		"status": "queued",
 	})
 }
+
+// parseOptionalUUID parses value as a UUID, returning nil for an empty value
+func parseOptionalUUID(value string) (*uuid.UUID, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
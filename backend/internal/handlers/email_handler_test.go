@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+	"backend/internal/queue"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// mockOwnershipRepository knows the client of each campaign and contact
+type mockOwnershipRepository struct {
+	owners map[uuid.UUID]uuid.UUID
+}
+
+func (m *mockOwnershipRepository) CampaignBelongsTo(ctx context.Context, campaignID, clientID uuid.UUID) (bool, error) {
+	owner, ok := m.owners[campaignID]
+	return ok && owner == clientID, nil
+}
+
+func (m *mockOwnershipRepository) ContactBelongsTo(ctx context.Context, contactID, clientID uuid.UUID) (bool, error) {
+	owner, ok := m.owners[contactID]
+	return ok && owner == clientID, nil
+}
+
+func TestSendEmail_RejectsRecordsOfAnotherClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	previous := queue.Queue
+	queue.Queue = client
+	t.Cleanup(func() { queue.Queue = previous })
+
+	sender, other := uuid.New(), uuid.New()
+	ownCampaign, otherCampaign := uuid.New(), uuid.New()
+	ownContact, otherContact := uuid.New(), uuid.New()
+	owners := &mockOwnershipRepository{owners: map[uuid.UUID]uuid.UUID{
+		ownCampaign:   sender,
+		otherCampaign: other,
+		ownContact:    sender,
+		otherContact:  other,
+	}}
+
+	app := fiber.New()
+	app.Post("/send-email", func(c *fiber.Ctx) error {
+		c.Locals("user", &models.User{ID: uuid.New(), Role: "client", ClientID: &sender})
+		return c.Next()
+	}, NewEmailHandler(owners).SendEmail)
+
+	tests := []struct {
+		name     string
+		campaign uuid.UUID
+		contact  uuid.UUID
+		want     int
+	}{
+		{"own campaign and contact", ownCampaign, ownContact, fiber.StatusOK},
+		{"campaign of another client", otherCampaign, ownContact, fiber.StatusNotFound},
+		{"contact of another client", ownCampaign, otherContact, fiber.StatusNotFound},
+		{"unknown campaign", uuid.New(), ownContact, fiber.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mr.FlushAll()
+			body := `{"to":"a@example.org","subject":"Hi","body_html":"<p>Hi</p>",` +
+				`"campaign_id":"` + tt.campaign.String() + `","contact_id":"` + tt.contact.String() + `"}`
+			req := httptest.NewRequest("POST", "/send-email", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatalf("app.Test() error = %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			wantQueued := int64(0)
+			if tt.want == fiber.StatusOK {
+				wantQueued = 1
+			}
+			if queued, _ := client.LLen(context.Background(), queue.QueueName).Result(); queued != wantQueued {
+				t.Errorf("queued %d jobs, want %d", queued, wantQueued)
+			}
+		})
+	}
+}
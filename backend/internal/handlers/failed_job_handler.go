@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"time"
+
+	"backend/internal/repositories"
+	"backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// FailedJobHandler handles the dead-letter queue admin API
+type FailedJobHandler struct {
+	failedJobService *services.FailedJobService
+	logger           zerolog.Logger
+}
+
+// NewFailedJobHandler creates a new failed job handler
+func NewFailedJobHandler(failedJobService *services.FailedJobService) *FailedJobHandler {
+	return &FailedJobHandler{
+		failedJobService: failedJobService,
+		logger:           zerolog.New(os.Stdout).With().Timestamp().Logger(),
+	}
+}
+
+// List handles GET /admin/failed-jobs?queue=&job_type=&campaign_id=&hours=&retried=&limit=50&offset=0
+func (h *FailedJobHandler) List(c *fiber.Ctx) error {
+	filter := repositories.FailedJobFilter{
+		Queue:   c.Query("queue"),
+		JobType: c.Query("job_type"),
+		Limit:   50,
+	}
+
+	if campaignIDStr := c.Query("campaign_id"); campaignIDStr != "" {
+		campaignID, err := uuid.Parse(campaignIDStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid campaign_id",
+			})
+		}
+		filter.CampaignID = &campaignID
+	}
+	if hoursStr := c.Query("hours"); hoursStr != "" {
+		hours, err := strconv.Atoi(hoursStr)
+		if err != nil || hours <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "hours must be a positive integer",
+			})
+		}
+		since := time.Now().Add(-time.Duration(hours) * time.Hour)
+		filter.Since = &since
+	}
+	if retriedStr := c.Query("retried"); retriedStr != "" {
+		retried, err := strconv.ParseBool(retriedStr)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "retried must be true or false",
+			})
+		}
+		filter.Retried = &retried
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 500 {
+		filter.Limit = limit
+	}
+	if offset, err := strconv.Atoi(c.Query("offset")); err == nil && offset > 0 {
+		filter.Offset = offset
+	}
+
+	jobs, total, err := h.failedJobService.List(c.Context(), filter)
+	if err != nil {
+		h.logger.Error().
+			Err(err).
+			Str("event", "failed_jobs.list.failed").
+			Msg("Failed to list failed jobs")
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "failed to list failed jobs",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"failed_jobs": jobs,
+		"total":       total,
+		"limit":       filter.Limit,
+		"offset":      filter.Offset,
+	})
+}
+
+// GetByID handles GET /admin/failed-jobs/:id
+func (h *FailedJobHandler) GetByID(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid failed job id",
+		})
+	}
+
+	job, err := h.failedJobService.Get(c.Context(), id)
+	if err != nil {
+		return h.handleError(c, err, "failed_jobs.get.failed")
+	}
+
+	return c.JSON(job)
+}
+
+// Requeue handles POST /admin/failed-jobs/:id/requeue?force=true
+func (h *FailedJobHandler) Requeue(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid failed job id",
+		})
+	}
+
+	job, err := h.failedJobService.Requeue(c.Context(), id, c.QueryBool("force"))
+	if err != nil {
+		return h.handleError(c, err, "failed_jobs.requeue.failed")
+	}
+
+	h.logger.Info().
+		Str("event", "failed_jobs.requeued").
+		Str("failed_job_id", job.ID.String()).
+		Str("queue", job.Queue).
+		Str("job_type", job.JobType).
+		Msg("Failed job requeued")
+
+	return c.JSON(job)
+}
+
+// Delete handles DELETE /admin/failed-jobs/:id
+func (h *FailedJobHandler) Delete(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid failed job id",
+		})
+	}
+
+	if err := h.failedJobService.Delete(c.Context(), id); err != nil {
+		return h.handleError(c, err, "failed_jobs.delete.failed")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// Purge handles DELETE /admin/failed-jobs?older_than_hours=&retried=true&all=true
+// At least one criterion is required so a bare DELETE cannot wipe the table.
+func (h *FailedJobHandler) Purge(c *fiber.Ctx) error {
+	filter := repositories.FailedJobPurgeFilter{
+		OnlyRetried: c.QueryBool("retried"),
+		All:         c.QueryBool("all"),
+	}
+	if hoursStr := c.Query("older_than_hours"); hoursStr != "" {
+		hours, err := strconv.Atoi(hoursStr)
+		if err != nil || hours <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "older_than_hours must be a positive integer",
+			})
+		}
+		olderThan := time.Now().Add(-time.Duration(hours) * time.Hour)
+		filter.OlderThan = &olderThan
+	}
+	if filter.OlderThan == nil && !filter.OnlyRetried && !filter.All {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "one of older_than_hours, retried=true or all=true is required",
+		})
+	}
+
+	purged, err := h.failedJobService.Purge(c.Context(), filter)
+	if err != nil {
+		return h.handleError(c, err, "failed_jobs.purge.failed")
+	}
+
+	h.logger.Info().
+		Str("event", "failed_jobs.purged").
+		Int64("count", purged).
+		Msg("Failed jobs purged")
+
+	return c.JSON(fiber.Map{
+		"purged": purged,
+	})
+}
+
+// handleError maps service errors to HTTP responses
+func (h *FailedJobHandler) handleError(c *fiber.Ctx, err error, event string) error {
+	switch {
+	case errors.Is(err, repositories.ErrFailedJobNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "failed job not found",
+		})
+	case errors.Is(err, services.ErrFailedJobAlreadyRetried):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "failed job was already requeued; pass force=true to requeue it again",
+		})
+	}
+
+	h.logger.Error().
+		Err(err).
+		Str("event", event).
+		Msg("Failed job operation failed")
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "failed job operation failed",
+	})
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/repositories"
+	"backend/internal/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// mockFailedJobRepository is an in-memory FailedJobRepository
+type mockFailedJobRepository struct {
+	jobs map[uuid.UUID]*models.FailedJob
+}
+
+func (m *mockFailedJobRepository) Create(ctx context.Context, job *models.FailedJob) error {
+	m.jobs[job.ID] = job
+	return nil
+}
+
+func (m *mockFailedJobRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.FailedJob, error) {
+	job, ok := m.jobs[id]
+	if !ok {
+		return nil, repositories.ErrFailedJobNotFound
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (m *mockFailedJobRepository) List(ctx context.Context, filter repositories.FailedJobFilter) ([]models.FailedJob, int64, error) {
+	var jobs []models.FailedJob
+	for _, job := range m.jobs {
+		jobs = append(jobs, *job)
+	}
+	return jobs, int64(len(jobs)), nil
+}
+
+func (m *mockFailedJobRepository) ClaimRetry(ctx context.Context, id uuid.UUID, previous *time.Time, retriedAt time.Time) (bool, error) {
+	job, ok := m.jobs[id]
+	if !ok || !sameTime(job.RetriedAt, previous) {
+		return false, nil
+	}
+	job.RetriedAt = &retriedAt
+	return true, nil
+}
+
+func (m *mockFailedJobRepository) ReleaseRetry(ctx context.Context, id uuid.UUID, retriedAt time.Time, previous *time.Time) error {
+	if job, ok := m.jobs[id]; ok && sameTime(job.RetriedAt, &retriedAt) {
+		job.RetriedAt = previous
+	}
+	return nil
+}
+
+// sameTime reports whether two optional times are equal
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.Equal(*b)
+}
+
+func (m *mockFailedJobRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	if _, ok := m.jobs[id]; !ok {
+		return repositories.ErrFailedJobNotFound
+	}
+	delete(m.jobs, id)
+	return nil
+}
+
+func (m *mockFailedJobRepository) Purge(ctx context.Context, filter repositories.FailedJobPurgeFilter) (int64, error) {
+	purged := int64(len(m.jobs))
+	m.jobs = make(map[uuid.UUID]*models.FailedJob)
+	return purged, nil
+}
+
+func newFailedJobTestApp(repo *mockFailedJobRepository, requeued *[]uuid.UUID) *fiber.App {
+	requeuers := map[string]services.JobRequeuer{
+		models.FailedJobQueueRedis: func(ctx context.Context, job *models.FailedJob) error {
+			*requeued = append(*requeued, job.ID)
+			return nil
+		},
+	}
+	handler := NewFailedJobHandler(services.NewFailedJobService(repo, requeuers))
+
+	app := fiber.New()
+	app.Get("/admin/failed-jobs/:id", handler.GetByID)
+	app.Post("/admin/failed-jobs/:id/requeue", handler.Requeue)
+	app.Delete("/admin/failed-jobs/:id", handler.Delete)
+	app.Delete("/admin/failed-jobs", handler.Purge)
+	return app
+}
+
+func TestFailedJobHandler_Requeue(t *testing.T) {
+	job := &models.FailedJob{ID: uuid.New(), Queue: models.FailedJobQueueRedis, JobType: "send_email"}
+	repo := &mockFailedJobRepository{jobs: map[uuid.UUID]*models.FailedJob{job.ID: job}}
+	var requeued []uuid.UUID
+	app := newFailedJobTestApp(repo, &requeued)
+
+	path := "/admin/failed-jobs/" + job.ID.String() + "/requeue"
+
+	resp, _ := app.Test(httptest.NewRequest("POST", path, nil))
+	assertEqual(t, http.StatusOK, resp.StatusCode, "first requeue")
+	assertEqual(t, 1, len(requeued), "requeuer calls")
+	if repo.jobs[job.ID].RetriedAt == nil {
+		t.Error("expected job to be marked as retried")
+	}
+
+	resp, _ = app.Test(httptest.NewRequest("POST", path, nil))
+	assertEqual(t, http.StatusConflict, resp.StatusCode, "second requeue without force")
+	assertEqual(t, 1, len(requeued), "requeuer calls after conflict")
+
+	resp, _ = app.Test(httptest.NewRequest("POST", path+"?force=true", nil))
+	assertEqual(t, http.StatusOK, resp.StatusCode, "forced requeue")
+	assertEqual(t, 2, len(requeued), "requeuer calls after forced requeue")
+}
+
+func TestFailedJobService_RequeueClaimsJobOnce(t *testing.T) {
+	job := &models.FailedJob{ID: uuid.New(), Queue: models.FailedJobQueueRedis, JobType: "send_email"}
+	repo := &mockFailedJobRepository{jobs: map[uuid.UUID]*models.FailedJob{job.ID: job}}
+
+	var service *services.FailedJobService
+	calls := 0
+	var concurrentErr error
+	requeuers := map[string]services.JobRequeuer{
+		models.FailedJobQueueRedis: func(ctx context.Context, job *models.FailedJob) error {
+			calls++
+			// A second requeue arriving while the first is enqueueing
+			if calls == 1 {
+				_, concurrentErr = service.Requeue(ctx, job.ID, false)
+			}
+			return nil
+		},
+	}
+	service = services.NewFailedJobService(repo, requeuers)
+
+	if _, err := service.Requeue(context.Background(), job.ID, false); err != nil {
+		t.Fatalf("requeue failed: %v", err)
+	}
+	if !errors.Is(concurrentErr, services.ErrFailedJobAlreadyRetried) {
+		t.Errorf("expected concurrent requeue to be rejected, got %v", concurrentErr)
+	}
+	assertEqual(t, 1, calls, "requeuer calls")
+}
+
+func TestFailedJobService_RequeueReleasesClaimOnFailure(t *testing.T) {
+	job := &models.FailedJob{ID: uuid.New(), Queue: models.FailedJobQueueRedis, JobType: "send_email"}
+	repo := &mockFailedJobRepository{jobs: map[uuid.UUID]*models.FailedJob{job.ID: job}}
+	requeuers := map[string]services.JobRequeuer{
+		models.FailedJobQueueRedis: func(ctx context.Context, job *models.FailedJob) error {
+			return errors.New("redis unavailable")
+		},
+	}
+	service := services.NewFailedJobService(repo, requeuers)
+
+	if _, err := service.Requeue(context.Background(), job.ID, false); err == nil {
+		t.Fatal("expected requeue to fail")
+	}
+	if repo.jobs[job.ID].RetriedAt != nil {
+		t.Error("expected claim to be released after a failed requeue")
+	}
+}
+
+func TestFailedJobHandler_NotFound(t *testing.T) {
+	repo := &mockFailedJobRepository{jobs: make(map[uuid.UUID]*models.FailedJob)}
+	var requeued []uuid.UUID
+	app := newFailedJobTestApp(repo, &requeued)
+
+	missing := uuid.New().String()
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/admin/failed-jobs/"+missing, nil))
+	assertEqual(t, http.StatusNotFound, resp.StatusCode, "get missing job")
+
+	resp, _ = app.Test(httptest.NewRequest("POST", "/admin/failed-jobs/"+missing+"/requeue", nil))
+	assertEqual(t, http.StatusNotFound, resp.StatusCode, "requeue missing job")
+
+	resp, _ = app.Test(httptest.NewRequest("DELETE", "/admin/failed-jobs/"+missing, nil))
+	assertEqual(t, http.StatusNotFound, resp.StatusCode, "delete missing job")
+
+	resp, _ = app.Test(httptest.NewRequest("GET", "/admin/failed-jobs/not-a-uuid", nil))
+	assertEqual(t, http.StatusBadRequest, resp.StatusCode, "invalid id")
+}
+
+func TestFailedJobHandler_PurgeRequiresCriteria(t *testing.T) {
+	job := &models.FailedJob{ID: uuid.New(), Queue: models.FailedJobQueueRedis}
+	repo := &mockFailedJobRepository{jobs: map[uuid.UUID]*models.FailedJob{job.ID: job}}
+	var requeued []uuid.UUID
+	app := newFailedJobTestApp(repo, &requeued)
+
+	resp, _ := app.Test(httptest.NewRequest("DELETE", "/admin/failed-jobs", nil))
+	assertEqual(t, http.StatusBadRequest, resp.StatusCode, "purge without criteria")
+	assertEqual(t, 1, len(repo.jobs), "jobs after rejected purge")
+
+	resp, _ = app.Test(httptest.NewRequest("DELETE", "/admin/failed-jobs?all=true", nil))
+	assertEqual(t, http.StatusOK, resp.StatusCode, "purge all")
+	assertEqual(t, 0, len(repo.jobs), "jobs after purge")
+}
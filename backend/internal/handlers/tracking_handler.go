@@ -1,11 +1,17 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
+	"html/template"
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
+	"backend/internal/linksign"
+	"backend/internal/models"
 	"backend/internal/services"
 	"backend/internal/tracking"
 
@@ -13,21 +19,64 @@ import (
 	"github.com/rs/zerolog"
 )
 
+// invalidLinkPage is shown for click tracking links that were not sent by us
+const invalidLinkPage = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Invalid link</title></head>
+<body>
+<h1>Invalid link</h1>
+<p>This link is broken or has been modified. Please use the link from the original email.</p>
+</body>
+</html>
+`
+
+// unsignedLinkPage lets the recipient of a link sent before links were signed
+// continue to it; it is not redirected to, as anyone can build such a link
+var unsignedLinkPage = template.Must(template.New("unsigned").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="referrer" content="no-referrer"><title>Leaving MailBlast</title></head>
+<body>
+<h1>You are leaving MailBlast</h1>
+<p>This link leads to <strong>{{.}}</strong>. Only continue if you trust it.</p>
+<p><a href="{{.}}" rel="noopener noreferrer">Continue to {{.}}</a></p>
+</body>
+</html>
+`))
+
+// MessageLookup finds the email a tracking link was sent in
+type MessageLookup interface {
+	GetEmailByMessageID(ctx context.Context, messageID string) (*models.EmailMessageRecord, error)
+}
+
 type TrackingHandler struct {
 	TrackingService *services.TrackingService
 	MessageTracker  *tracking.MessageTracker
+	linkSecret      string
+	unsignedBefore  time.Time // links of emails created before are accepted unsigned
+	messages        MessageLookup
 	logger          zerolog.Logger
 }
 
 // NewTrackingHandler creates a new tracking handler
-func NewTrackingHandler(trackingService *services.TrackingService, messageTracker *tracking.MessageTracker) *TrackingHandler {
+// linkSecret verifies the signatures of click tracking links.
+func NewTrackingHandler(trackingService *services.TrackingService, messageTracker *tracking.MessageTracker, linkSecret string) *TrackingHandler {
 	return &TrackingHandler{
 		TrackingService: trackingService,
 		MessageTracker:  messageTracker,
+		linkSecret:      linkSecret,
 		logger:          zerolog.New(os.Stdout).With().Timestamp().Logger(),
 	}
 }
 
+// AcceptUnsignedLinks accepts the unsigned click tracking links of emails
+// created before cutoff, which were sent before links were signed
+// Their clicks are recorded, but the target is shown on a page to continue
+// from instead of being redirected to.
+func (h *TrackingHandler) AcceptUnsignedLinks(cutoff time.Time, messages MessageLookup) {
+	h.unsignedBefore = cutoff
+	h.messages = messages
+}
+
 // isValidURL validates that a URL is safe for redirect
 // Only allows http:// and https:// URLs
 // Rejects: javascript:, data:, file:, protocol-relative (//), relative URLs, empty URLs
@@ -100,7 +149,7 @@ func (h *TrackingHandler) TrackOpen(c *fiber.Ctx) error {
 				Msg("Failed to record open event")
 			// Continue to return pixel even if recording fails
 		}
-	} else {
+	} else if h.TrackingService != nil {
 		// Fallback to TrackingService for backward compatibility
 		if err := h.TrackingService.RecordEvent(c.Context(), messageID, "open", meta); err != nil {
 			h.logger.Error().
@@ -128,22 +177,41 @@ func (h *TrackingHandler) TrackOpen(c *fiber.Ctx) error {
 }
 
 // TrackClick handles click tracking redirect requests
+// Only links signed for the message are recorded and redirected; anything
+// else gets an error page, so the tracker cannot be used as an open redirect.
+// Unsigned links of emails sent before links were signed are not redirected
+// either (see AcceptUnsignedLinks).
 func (h *TrackingHandler) TrackClick(c *fiber.Ctx) error {
 	messageID := c.Params("messageId")
 	encodedURL := c.Query("url")
 
 	if messageID == "" || encodedURL == "" {
-		return c.Status(fiber.StatusBadRequest).SendString("missing url")
+		return invalidLink(c)
 	}
 
 	// Decode base64 URL
 	decodedURL, err := base64.URLEncoding.DecodeString(encodedURL)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).SendString("invalid url")
+		return invalidLink(c)
 	}
 
 	targetURL := string(decodedURL)
 
+	// Verify the link was sent in this message
+	sig := c.Query("sig")
+	if sig == "" && h.sentUnsigned(c.Context(), messageID) {
+		return h.trackUnsignedClick(c, messageID, targetURL)
+	}
+	if !linksign.Verify(h.linkSecret, messageID, targetURL, sig) {
+		h.logger.Warn().
+			Str("event", "email.click.invalid_signature").
+			Str("mid", messageID).
+			Str("url", targetURL).
+			Str("ip", c.IP()).
+			Msg("Click tracking link with an invalid signature rejected")
+		return invalidLink(c)
+	}
+
 	// Validate URL before redirect (CRITICAL: Prevent open redirect)
 	if !isValidURL(targetURL) {
 		h.logger.Warn().
@@ -151,9 +219,51 @@ func (h *TrackingHandler) TrackClick(c *fiber.Ctx) error {
 			Str("mid", messageID).
 			Str("url", targetURL).
 			Msg("Invalid or dangerous URL rejected")
-		return c.Status(fiber.StatusBadRequest).SendString("invalid url")
+		return invalidLink(c)
 	}
 
+	h.recordClick(c, messageID, targetURL)
+	return c.Redirect(targetURL, fiber.StatusFound)
+}
+
+// trackUnsignedClick records the click on a link sent before links were
+// signed and shows its target instead of redirecting
+func (h *TrackingHandler) trackUnsignedClick(c *fiber.Ctx, messageID, targetURL string) error {
+	if !isValidURL(targetURL) {
+		h.logger.Warn().
+			Str("event", "email.click.invalid_url").
+			Str("mid", messageID).
+			Str("url", targetURL).
+			Msg("Invalid or dangerous URL rejected")
+		return invalidLink(c)
+	}
+
+	h.recordClick(c, messageID, targetURL)
+
+	var page bytes.Buffer
+	if err := unsignedLinkPage.Execute(&page, targetURL); err != nil {
+		return invalidLink(c)
+	}
+	c.Set("Content-Type", fiber.MIMETextHTMLCharsetUTF8)
+	c.Set("Cache-Control", "no-store")
+	return c.Send(page.Bytes())
+}
+
+// sentUnsigned reports whether the email of messageID was created before
+// click tracking links were signed
+func (h *TrackingHandler) sentUnsigned(ctx context.Context, messageID string) bool {
+	if h.unsignedBefore.IsZero() || h.messages == nil {
+		return false
+	}
+	email, err := h.messages.GetEmailByMessageID(ctx, messageID)
+	if err != nil || email == nil {
+		return false
+	}
+	return email.CreatedAt.Before(h.unsignedBefore)
+}
+
+// recordClick records and logs a click on an accepted link
+func (h *TrackingHandler) recordClick(c *fiber.Ctx, messageID, targetURL string) {
 	ip := c.IP()
 	ua := string(c.Request().Header.UserAgent())
 
@@ -168,7 +278,7 @@ func (h *TrackingHandler) TrackClick(c *fiber.Ctx) error {
 				Msg("Failed to record click event")
 			// Continue to redirect even if recording fails
 		}
-	} else {
+	} else if h.TrackingService != nil {
 		// Fallback to TrackingService for backward compatibility
 		meta := map[string]interface{}{
 			"ip":         ip,
@@ -193,6 +303,11 @@ func (h *TrackingHandler) TrackClick(c *fiber.Ctx) error {
 		Str("ip", ip).
 		Str("ua", ua).
 		Msg("Link clicked")
+}
 
-	return c.Redirect(targetURL, fiber.StatusFound)
+// invalidLink responds with the error page for a rejected click tracking link
+func invalidLink(c *fiber.Ctx) error {
+	c.Set("Content-Type", fiber.MIMETextHTMLCharsetUTF8)
+	c.Set("Cache-Control", "no-store")
+	return c.Status(fiber.StatusBadRequest).SendString(invalidLinkPage)
 }
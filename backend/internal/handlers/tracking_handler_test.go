@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"encoding/base64"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"backend/internal/linksign"
+	"backend/internal/models"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -42,22 +49,26 @@ func TestIsValidURL(t *testing.T) {
 	}
 }
 
+// clickPath returns the path of a click tracking link signed for a message
+func clickPath(messageID, target string) string {
+	return "/track/click/" + messageID + "?url=" + base64.URLEncoding.EncodeToString([]byte(target)) +
+		"&sig=" + linksign.Sign("test-secret", messageID, target)
+}
+
 func TestTrackClick_InvalidURL(t *testing.T) {
 	app := fiber.New()
-	handler := &TrackingHandler{}
+	handler := &TrackingHandler{linkSecret: "test-secret"}
 
 	app.Get("/track/click/:messageId", handler.TrackClick)
 
 	// Test JavaScript URL
-	jsURL := base64.URLEncoding.EncodeToString([]byte("javascript:alert(1)"))
-	req := httptest.NewRequest("GET", "/track/click/test-123?url="+jsURL, nil)
+	req := httptest.NewRequest("GET", clickPath("test-123", "javascript:alert(1)"), nil)
 	resp, _ := app.Test(req)
 
 	assertEqual(t, http.StatusBadRequest, resp.StatusCode, "JavaScript URL should be rejected")
 
 	// Test protocol-relative URL
-	protoURL := base64.URLEncoding.EncodeToString([]byte("//evil.com"))
-	req2 := httptest.NewRequest("GET", "/track/click/test-123?url="+protoURL, nil)
+	req2 := httptest.NewRequest("GET", clickPath("test-123", "//evil.com"), nil)
 	resp2, _ := app.Test(req2)
 
 	assertEqual(t, http.StatusBadRequest, resp2.StatusCode, "Protocol-relative URL should be rejected")
@@ -65,18 +76,101 @@ func TestTrackClick_InvalidURL(t *testing.T) {
 
 func TestTrackClick_ValidURL(t *testing.T) {
 	app := fiber.New()
-	handler := &TrackingHandler{}
+	handler := &TrackingHandler{linkSecret: "test-secret"}
 
 	app.Get("/track/click/:messageId", handler.TrackClick)
 
-	// Test valid HTTPS URL
-	validURL := base64.URLEncoding.EncodeToString([]byte("https://example.com"))
-	req := httptest.NewRequest("GET", "/track/click/test-123?url="+validURL, nil)
+	req := httptest.NewRequest("GET", clickPath("test-123", "https://example.com"), nil)
 	resp, _ := app.Test(req)
 
-	// Should not return 400 (will return other status if message not found, but not 400 for invalid URL)
-	if resp.StatusCode == http.StatusBadRequest {
-		t.Error("Valid URL should not be rejected with 400 Bad Request")
+	assertEqual(t, http.StatusFound, resp.StatusCode, "Signed link should redirect")
+	assertEqual(t, "https://example.com", resp.Header.Get("Location"), "Redirect location")
+}
+
+func TestTrackClick_TamperedLink(t *testing.T) {
+	app := fiber.New()
+	handler := &TrackingHandler{linkSecret: "test-secret"}
+
+	app.Get("/track/click/:messageId", handler.TrackClick)
+
+	signed := clickPath("test-123", "https://example.com")
+	evilURL := base64.URLEncoding.EncodeToString([]byte("https://evil.example"))
+
+	tests := []struct {
+		name string
+		path string
+	}{
+		{"unsigned", "/track/click/test-123?url=" + evilURL},
+		{"other target", strings.Replace(signed, base64.URLEncoding.EncodeToString([]byte("https://example.com")), evilURL, 1)},
+		{"other message", strings.Replace(signed, "test-123", "test-124", 1)},
+		{"bad signature", signed[:len(signed)-2] + "AA"},
+		{"other secret", "/track/click/test-123?url=" + evilURL + "&sig=" + linksign.Sign("other-secret", "test-123", "https://evil.example")},
+		{"missing url", "/track/click/test-123"},
+		{"invalid base64", "/track/click/test-123?url=!!!"},
 	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			assertEqual(t, http.StatusBadRequest, resp.StatusCode, "Tampered link status")
+			assertEqual(t, "", resp.Header.Get("Location"), "Tampered link should not redirect")
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), "Invalid link") {
+				t.Errorf("expected error page, got %q", body)
+			}
+		})
+	}
+}
+
+// stubMessages serves emails by Message-ID
+type stubMessages map[string]*models.EmailMessageRecord
+
+func (s stubMessages) GetEmailByMessageID(ctx context.Context, messageID string) (*models.EmailMessageRecord, error) {
+	return s[messageID], nil
 }
 
+func TestTrackClick_UnsignedLinksOfOldEmails(t *testing.T) {
+	cutoff := time.Now()
+	app := fiber.New()
+	handler := &TrackingHandler{linkSecret: "test-secret"}
+	handler.AcceptUnsignedLinks(cutoff, stubMessages{
+		"old-123": {MessageID: "old-123", CreatedAt: cutoff.Add(-time.Hour)},
+		"new-123": {MessageID: "new-123", CreatedAt: cutoff.Add(time.Hour)},
+	})
+	app.Get("/track/click/:messageId", handler.TrackClick)
+
+	unsigned := func(messageID, target string) string {
+		return "/track/click/" + messageID + "?url=" + base64.URLEncoding.EncodeToString([]byte(target))
+	}
+
+	// The target is shown, not redirected to
+	resp, err := app.Test(httptest.NewRequest("GET", unsigned("old-123", "https://example.com/?a=1&b=<2>"), nil))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	assertEqual(t, http.StatusOK, resp.StatusCode, "Unsigned link of an old email status")
+	assertEqual(t, "", resp.Header.Get("Location"), "Unsigned link should not redirect")
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(body), `href="https://example.com/?a=1&amp;b=%3c2%3e"`) {
+		t.Errorf("expected a page linking to the target, got %q", body)
+	}
+
+	for name, path := range map[string]string{
+		"newer email":   unsigned("new-123", "https://example.com"),
+		"unknown email": unsigned("other-123", "https://example.com"),
+		"javascript":    unsigned("old-123", "javascript:alert(1)"),
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		assertEqual(t, http.StatusBadRequest, resp.StatusCode, name+" status")
+	}
+
+	// Signed links of old emails still redirect
+	resp, _ = app.Test(httptest.NewRequest("GET", clickPath("old-123", "https://example.com"), nil))
+	assertEqual(t, http.StatusFound, resp.StatusCode, "Signed link of an old email status")
+}
@@ -0,0 +1,454 @@
+// Package htmltext converts HTML email bodies into the plain text
+// alternative sent next to them.
+//
+// Links become numbered footnotes, headings and lists keep their structure
+// and paragraphs are wrapped at LineWidth. Scripts, styles, hidden elements
+// and images without alt text, such as the open tracking pixel, are dropped.
+package htmltext
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// LineWidth is the column paragraphs are wrapped at
+const LineWidth = 76
+
+// minLineWidth keeps deeply indented text readable
+const minLineWidth = 20
+
+// skippedElements are dropped together with their content
+var skippedElements = map[atom.Atom]bool{
+	atom.Head:     true,
+	atom.Title:    true,
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Template: true,
+	atom.Noscript: true,
+	atom.Iframe:   true,
+	atom.Object:   true,
+	atom.Svg:      true,
+}
+
+// paragraphElements are separated from surrounding text by a blank line
+var paragraphElements = map[atom.Atom]bool{
+	atom.P:       true,
+	atom.Table:   true,
+	atom.Dl:      true,
+	atom.Figure:  true,
+	atom.Address: true,
+}
+
+// lineElements start and end on a line of their own
+var lineElements = map[atom.Atom]bool{
+	atom.Div:        true,
+	atom.Section:    true,
+	atom.Article:    true,
+	atom.Header:     true,
+	atom.Footer:     true,
+	atom.Main:       true,
+	atom.Nav:        true,
+	atom.Aside:      true,
+	atom.Center:     true,
+	atom.Form:       true,
+	atom.Fieldset:   true,
+	atom.Figcaption: true,
+	atom.Caption:    true,
+	atom.Thead:      true,
+	atom.Tbody:      true,
+	atom.Tfoot:      true,
+	atom.Tr:         true,
+	atom.Td:         true,
+	atom.Th:         true,
+	atom.Dt:         true,
+	atom.Dd:         true,
+}
+
+// Convert returns the plain text version of an HTML document or fragment
+func Convert(content string) string {
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return ""
+	}
+
+	c := &converter{width: LineWidth, footnotes: make(map[string]int)}
+	c.walk(doc)
+	c.flush()
+
+	if len(c.links) > 0 {
+		c.blank = len(c.lines) > 0
+		for i, link := range c.links {
+			c.emit(fmt.Sprintf("[%d] %s", i+1, link))
+		}
+	}
+	return strings.Join(c.lines, "\n")
+}
+
+// indent is the prefix of the lines of a list item or quote
+type indent struct {
+	first string // prefix of the first line, e.g. a list marker
+	rest  string
+	used  bool
+}
+
+// converter accumulates the text of an HTML tree
+// Inline text collects in text until a block boundary flushes it into lines.
+type converter struct {
+	width     int
+	lines     []string
+	text      strings.Builder
+	space     bool // whitespace is pending before the next word
+	blank     bool // a blank line is due before the next line
+	flushes   int
+	pre       int // depth of <pre> elements
+	lists     int // depth of <ul> and <ol> elements
+	indents   []indent
+	links     []string
+	footnotes map[string]int // footnote number by URL
+}
+
+// walk converts n and its children
+func (c *converter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.write(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		c.children(n)
+		return
+	}
+	if skippedElements[n.DataAtom] || hidden(n) {
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		c.lineBreak()
+	case atom.Hr:
+		c.block(true)
+		c.emit(strings.Repeat("-", minLineWidth))
+		c.block(true)
+	case atom.Img:
+		c.write(strings.TrimSpace(attr(n, "alt")))
+	case atom.A:
+		c.link(n)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		c.heading(n)
+	case atom.Ul, atom.Ol:
+		c.list(n)
+	case atom.Li:
+		// A list item outside of a list
+		c.listItem(n, "* ")
+	case atom.Blockquote:
+		c.block(true)
+		c.indents = append(c.indents, indent{first: "> ", rest: "> "})
+		c.children(n)
+		c.flush()
+		c.indents = c.indents[:len(c.indents)-1]
+		c.block(true)
+	case atom.Pre:
+		c.block(true)
+		c.pre++
+		c.children(n)
+		c.flush()
+		c.pre--
+		c.block(true)
+	default:
+		switch {
+		case paragraphElements[n.DataAtom]:
+			c.block(true)
+			c.children(n)
+			c.block(true)
+		case lineElements[n.DataAtom]:
+			c.block(false)
+			c.children(n)
+			c.block(false)
+		default:
+			c.children(n)
+		}
+	}
+}
+
+// children converts the children of n
+func (c *converter) children(n *html.Node) {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.walk(child)
+	}
+}
+
+// write adds inline text, collapsing whitespace outside of <pre>
+func (c *converter) write(data string) {
+	if c.pre > 0 {
+		c.text.WriteString(data)
+		return
+	}
+	for _, r := range data {
+		if isSpace(r) {
+			c.space = true
+			continue
+		}
+		if c.space && c.text.Len() > 0 && !strings.HasSuffix(c.text.String(), "\n") {
+			c.text.WriteByte(' ')
+		}
+		c.space = false
+		c.text.WriteRune(r)
+	}
+}
+
+// lineBreak ends the current line without ending the paragraph
+func (c *converter) lineBreak() {
+	c.text.WriteByte('\n')
+	c.space = false
+}
+
+// link writes the text of an anchor followed by the footnote of its URL
+// The footnote is left out when the text already shows the URL and for
+// fragment and script links; mailto links show their address instead.
+func (c *converter) link(n *html.Node) {
+	href := strings.TrimSpace(attr(n, "href"))
+	start, flushes := c.text.Len(), c.flushes
+	c.children(n)
+
+	text := strings.TrimSpace(c.text.String())
+	if c.flushes == flushes {
+		text = strings.TrimSpace(c.text.String()[start:])
+	}
+	lower := strings.ToLower(href)
+	switch {
+	case href == "", strings.HasPrefix(href, "#"), strings.HasPrefix(lower, "javascript:"):
+		return
+	case strings.HasPrefix(lower, "mailto:"):
+		address, _, _ := strings.Cut(href[len("mailto:"):], "?")
+		if address != "" && !strings.Contains(text, address) {
+			c.write(" (" + address + ")")
+		}
+		return
+	case text == "" && c.flushes == flushes:
+		// An image without alt text; a lone footnote would not say what it links
+		return
+	case sameURL(text, href):
+		return
+	}
+
+	number, ok := c.footnotes[href]
+	if !ok {
+		c.links = append(c.links, href)
+		number = len(c.links)
+		c.footnotes[href] = number
+	}
+	marker := fmt.Sprintf("[%d]", number)
+	if c.text.Len() == 0 && len(c.lines) > 0 && c.flushes != flushes {
+		// The link text was a block of its own
+		c.lines[len(c.lines)-1] += " " + marker
+		return
+	}
+	c.write(" " + marker)
+}
+
+// heading writes a heading on its own paragraph; h1 and h2 are underlined,
+// smaller headings are marked with #
+func (c *converter) heading(n *html.Node) {
+	level := int(n.Data[1] - '0')
+	c.block(true)
+	if level > 2 {
+		c.write(strings.Repeat("#", level) + " ")
+	}
+	c.children(n)
+
+	first := len(c.lines)
+	c.flush()
+	if level <= 2 && len(c.lines) > first {
+		width := 0
+		for _, line := range c.lines[first:] {
+			width = max(width, utf8.RuneCountInString(strings.TrimPrefix(line, c.restPrefix())))
+		}
+		underline := "="
+		if level == 2 {
+			underline = "-"
+		}
+		c.emit(strings.Repeat(underline, width))
+	}
+	c.block(true)
+}
+
+// list writes the items of a <ul> or <ol>; nested lists are not set apart
+// by blank lines
+func (c *converter) list(n *html.Node) {
+	c.block(c.lists == 0)
+	c.lists++
+
+	ordered := n.DataAtom == atom.Ol
+	number := 1
+	if start, err := strconv.Atoi(attr(n, "start")); err == nil {
+		number = start
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode || child.DataAtom != atom.Li {
+			c.walk(child)
+			continue
+		}
+		marker := "* "
+		if ordered {
+			marker = strconv.Itoa(number) + ". "
+			number++
+		}
+		c.listItem(child, marker)
+	}
+
+	c.lists--
+	c.block(c.lists == 0)
+}
+
+// listItem writes a list item, indenting its continuation lines under the marker
+func (c *converter) listItem(n *html.Node, marker string) {
+	c.block(false)
+	c.indents = append(c.indents, indent{first: marker, rest: strings.Repeat(" ", len(marker))})
+	c.children(n)
+	c.flush()
+	c.indents = c.indents[:len(c.indents)-1]
+}
+
+// block ends the current paragraph; with blank a blank line separates it
+// from the next one
+func (c *converter) block(blank bool) {
+	c.flush()
+	if blank && len(c.lines) > 0 {
+		c.blank = true
+	}
+}
+
+// flush wraps the pending inline text into lines
+func (c *converter) flush() {
+	text := c.text.String()
+	c.text.Reset()
+	c.space = false
+	c.flushes++
+
+	if c.pre > 0 {
+		text = strings.TrimSuffix(text, "\n")
+		if text == "" {
+			return
+		}
+		for _, line := range strings.Split(text, "\n") {
+			c.emit(strings.TrimRight(line, " \t\r"))
+		}
+		return
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	text = strings.TrimRight(text, "\n")
+	for _, line := range strings.Split(text, "\n") {
+		c.wrap(strings.TrimSpace(line))
+	}
+}
+
+// wrap emits line wrapped at the line width left by the indentation
+// Words longer than a line, such as URLs, are not broken.
+func (c *converter) wrap(line string) {
+	if line == "" {
+		c.emit("")
+		return
+	}
+	width := max(c.width-utf8.RuneCountInString(c.restPrefix()), minLineWidth)
+
+	var current strings.Builder
+	length := 0
+	for _, word := range strings.Split(line, " ") {
+		n := utf8.RuneCountInString(word)
+		if length > 0 && length+1+n > width {
+			c.emit(current.String())
+			current.Reset()
+			length = 0
+		}
+		if length > 0 {
+			current.WriteByte(' ')
+			length++
+		}
+		current.WriteString(word)
+		length += n
+	}
+	c.emit(current.String())
+}
+
+// emit appends a line with the current indentation
+func (c *converter) emit(line string) {
+	if c.blank {
+		c.lines = append(c.lines, strings.TrimRight(c.restPrefix(), " "))
+		c.blank = false
+	}
+
+	var prefix strings.Builder
+	for i := range c.indents {
+		if c.indents[i].used {
+			prefix.WriteString(c.indents[i].rest)
+		} else {
+			prefix.WriteString(c.indents[i].first)
+			c.indents[i].used = true
+		}
+	}
+	c.lines = append(c.lines, strings.TrimRight(prefix.String()+line, " "))
+}
+
+// restPrefix returns the indentation of continuation lines
+func (c *converter) restPrefix() string {
+	var prefix strings.Builder
+	for _, in := range c.indents {
+		prefix.WriteString(in.rest)
+	}
+	return prefix.String()
+}
+
+// hidden reports whether an element is not displayed
+func hidden(n *html.Node) bool {
+	for _, a := range n.Attr {
+		switch a.Key {
+		case "hidden":
+			return true
+		case "style":
+			style := strings.ToLower(strings.Join(strings.Fields(a.Val), ""))
+			if strings.Contains(style, "display:none") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// attr returns the value of an attribute of n
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// isSpace reports whether r is HTML whitespace or a non-breaking space
+func isSpace(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', '\r', '\f', '\u00a0':
+		return true
+	}
+	return false
+}
+
+// sameURL reports whether a link's text is its URL
+func sameURL(text, href string) bool {
+	normalize := func(s string) string {
+		s = strings.ToLower(strings.TrimSpace(s))
+		for _, scheme := range []string{"https://", "http://"} {
+			s = strings.TrimPrefix(s, scheme)
+		}
+		return strings.TrimSuffix(strings.TrimPrefix(s, "www."), "/")
+	}
+	return normalize(text) == normalize(href)
+}
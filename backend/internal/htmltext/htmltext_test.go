@@ -0,0 +1,82 @@
+package htmltext
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"empty", "", ""},
+		{"plain text", "Hello", "Hello"},
+		{"whitespace collapsed", "<p>Hello\n   there,\tfriend</p>", "Hello there, friend"},
+		{"paragraphs", "<p>One</p><p>Two</p>", "One\n\nTwo"},
+		{"line breaks", "<p>One<br>Two<br/>Three</p>", "One\nTwo\nThree"},
+		{"divs", "<div>One</div><div>Two</div>", "One\nTwo"},
+		{"entities", "<p>Tom &amp; Jerry&nbsp;&lt;3</p>", "Tom & Jerry <3"},
+		{"dropped elements", `<html><head><title>T</title><style>p{color:red}</style></head><body><script>alert(1)</script><p>Body</p></body></html>`, "Body"},
+		{"hidden elements", `<div style="display: none">preheader</div><p hidden>no</p><p>Shown</p>`, "Shown"},
+		{"tracking pixel", `<p>Hi</p><img src="https://t.example.com/track/open/1" width="1" height="1" alt="" style="display:none">`, "Hi"},
+		{"image alt text", `<p><img src="logo.png" alt="Acme"> News</p>`, "Acme News"},
+		{"h1", "<h1>Title</h1><p>Text</p>", "Title\n=====\n\nText"},
+		{"h2", "<h2>Sub title</h2>", "Sub title\n---------"},
+		{"h3", "<h3>Small</h3><p>Text</p>", "### Small\n\nText"},
+		{"unordered list", "<p>Items:</p><ul><li>One</li><li>Two</li></ul><p>End</p>", "Items:\n\n* One\n* Two\n\nEnd"},
+		{"ordered list", `<ol start="3"><li>Three</li><li>Four</li></ol>`, "3. Three\n4. Four"},
+		{"nested list", "<ul><li>One<ul><li>Inner</li></ul></li><li>Two</li></ul>", "* One\n  * Inner\n* Two"},
+		{"blockquote", "<blockquote><p>Quoted</p><p>Again</p></blockquote>", "> Quoted\n>\n> Again"},
+		{"pre", "<pre>line 1\n  indented</pre>", "line 1\n  indented"},
+		{"table", "<table><tr><td>A</td><td>B</td></tr></table>", "A\nB"},
+		{"horizontal rule", "<p>A</p><hr><p>B</p>", "A\n\n--------------------\n\nB"},
+		{"link", `<p>Read <a href="https://example.com/post">the post</a>.</p>`, "Read the post [1].\n\n[1] https://example.com/post"},
+		{"repeated link", `<a href="https://a.example">A</a> <a href="https://b.example">B</a> <a href="https://a.example">again</a>`, "A [1] B [2] again [1]\n\n[1] https://a.example\n[2] https://b.example"},
+		{"link showing its URL", `<a href="https://example.com/">example.com</a>`, "example.com"},
+		{"mailto", `<a href="mailto:hi@example.com?subject=Hi">Write us</a>`, "Write us (hi@example.com)"},
+		{"mailto showing address", `<a href="mailto:hi@example.com">hi@example.com</a>`, "hi@example.com"},
+		{"anchor link", `<a href="#top">Top</a>`, "Top"},
+		{"image link without alt", `<a href="https://example.com"><img src="banner.png"></a><p>Text</p>`, "Text"},
+		{"block link", `<a href="https://example.com"><p>Click here</p></a>`, "Click here [1]\n\n[1] https://example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Convert(tt.content); got != tt.want {
+				t.Errorf("Convert(%q) =\n%s\nwant\n%s", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvert_Wraps(t *testing.T) {
+	content := "<p>" + strings.Repeat("lorem ipsum ", 30) + "</p><ul><li>" + strings.Repeat("dolor sit ", 20) + "</li></ul>"
+	got := Convert(content)
+
+	lines := strings.Split(got, "\n")
+	if len(lines) < 6 {
+		t.Fatalf("expected wrapped text, got:\n%s", got)
+	}
+	for _, line := range lines {
+		if utf8.RuneCountInString(line) > LineWidth {
+			t.Errorf("line longer than %d: %q", LineWidth, line)
+		}
+		if strings.HasSuffix(line, " ") {
+			t.Errorf("line has trailing space: %q", line)
+		}
+	}
+	if !strings.Contains(got, "\n  dolor") {
+		t.Errorf("expected list continuation lines to be indented, got:\n%s", got)
+	}
+}
+
+func TestConvert_LongWordsNotBroken(t *testing.T) {
+	url := "https://example.com/" + strings.Repeat("x", 100)
+	got := Convert("<p>See " + url + " now</p>")
+	if got != "See\n"+url+"\nnow" {
+		t.Errorf("unexpected output:\n%s", got)
+	}
+}
@@ -0,0 +1,41 @@
+// Package linksign signs the targets of click tracking links.
+//
+// A tracking link carries its target URL, so without a signature anyone could
+// build links that record clicks for any message or redirect through the
+// tracking domain to any site. The signature binds the target to the message
+// it was sent in.
+package linksign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+)
+
+// size is the length in bytes of a signature before encoding
+const size = 16
+
+// Sign returns the signature of a link to target in a message
+func Sign(secret, messageID, target string) string {
+	return base64.RawURLEncoding.EncodeToString(mac(secret, messageID, target))
+}
+
+// Verify reports whether signature is the signature of a link to target in
+// a message
+func Verify(secret, messageID, target, signature string) bool {
+	decoded, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(decoded, mac(secret, messageID, target))
+}
+
+// mac returns the truncated HMAC-SHA256 of a message ID and target
+// The message ID cannot contain a NUL byte, so the input is unambiguous.
+func mac(secret, messageID, target string) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(messageID))
+	h.Write([]byte{0})
+	h.Write([]byte(target))
+	return h.Sum(nil)[:size]
+}
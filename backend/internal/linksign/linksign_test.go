@@ -0,0 +1,33 @@
+package linksign
+
+import "testing"
+
+func TestVerify(t *testing.T) {
+	sig := Sign("secret", "abc-123@mailblast", "https://example.com/a")
+
+	tests := []struct {
+		name      string
+		secret    string
+		messageID string
+		target    string
+		signature string
+		want      bool
+	}{
+		{"valid", "secret", "abc-123@mailblast", "https://example.com/a", sig, true},
+		{"other target", "secret", "abc-123@mailblast", "https://evil.example/a", sig, false},
+		{"other message", "secret", "abc-124@mailblast", "https://example.com/a", sig, false},
+		{"other secret", "secret2", "abc-123@mailblast", "https://example.com/a", sig, false},
+		{"moved separator", "secret", "abc-123@mailblasthttps://example.com/a", "", sig, false},
+		{"truncated", "secret", "abc-123@mailblast", "https://example.com/a", sig[:len(sig)-1], false},
+		{"not base64", "secret", "abc-123@mailblast", "https://example.com/a", "!!!", false},
+		{"empty", "secret", "abc-123@mailblast", "https://example.com/a", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Verify(tt.secret, tt.messageID, tt.target, tt.signature); got != tt.want {
+				t.Errorf("Verify() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
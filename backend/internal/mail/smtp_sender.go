@@ -1,101 +1,82 @@
 package mail
 
 import (
-	"bytes"
-	"crypto/tls"
+	"context"
+	"errors"
 	"fmt"
-	"net/smtp"
+	netmail "net/mail"
 	"os"
-	"strings"
-	"time"
 
 	"backend/internal/config"
+	"backend/internal/dkim"
+	"backend/internal/htmltext"
+	"backend/internal/mimemsg"
+	"backend/internal/smtppool"
 
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 )
 
 // SMTPSender interface for sending emails via SMTP
+// clientID is the client the email is sent for, nil for system mail. Failed
+// SMTP steps are returned wrapping a *smtppool.Error.
 type SMTPSender interface {
-	Send(to string, subject string, body string) (string, error)
+	Send(ctx context.Context, to string, subject string, body string, clientID *uuid.UUID) (string, error)
+	// SendMessage sends a message built by the caller, with from as the
+	// envelope sender
+	SendMessage(ctx context.Context, from string, to string, message []byte, clientID *uuid.UUID) error
+}
+
+// sendFailures describe the SMTP protocol step a send failed at
+var sendFailures = map[string]string{
+	smtppool.OpConnect:  "failed to connect to SMTP server",
+	smtppool.OpStartTLS: "failed to start TLS",
+	smtppool.OpAuth:     "failed to authenticate",
+	smtppool.OpMail:     "failed to set sender",
+	smtppool.OpRcpt:     "failed to set recipient",
+	smtppool.OpData:     "failed to get data writer",
+	smtppool.OpWrite:    "failed to write email data",
+	smtppool.OpClose:    "failed to close data writer",
 }
 
 // smtpSender implements SMTPSender using net/smtp
 type smtpSender struct {
 	config config.SMTPConfig
+	pool   *smtppool.Pool
+	signer dkim.MessageSigner
 	logger zerolog.Logger
 }
 
-// NewSMTPSender creates a new SMTP sender
+// NewSMTPSender creates a new SMTP sender using the shared connection pool
 func NewSMTPSender(cfg config.SMTPConfig) SMTPSender {
+	return NewSMTPSenderWithSigner(cfg, nil)
+}
+
+// NewSMTPSenderWithSigner creates a new SMTP sender that DKIM-signs messages
+// with signer; a nil signer sends unsigned mail
+func NewSMTPSenderWithSigner(cfg config.SMTPConfig, signer dkim.MessageSigner) SMTPSender {
 	return &smtpSender{
 		config: cfg,
+		pool:   smtppool.Shared(),
+		signer: signer,
 		logger: zerolog.New(os.Stdout).With().Timestamp().Logger(),
 	}
 }
 
 // Send sends an email via SMTP and returns the Message-ID
-func (s *smtpSender) Send(to string, subject string, body string) (string, error) {
+func (s *smtpSender) Send(ctx context.Context, to string, subject string, body string, clientID *uuid.UUID) (string, error) {
 	// Generate Message-ID
 	messageID := s.generateMessageID()
 
-	// Build email headers
-	headers := s.buildHeaders(to, subject, messageID)
-
-	// Build email body
-	emailBody := s.buildEmailBody(headers, body)
-
-	// Send via SMTP
-	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
-
-	// Create SMTP connection
-	conn, err := smtp.Dial(addr)
-	if err != nil {
-		return messageID, fmt.Errorf("failed to connect to SMTP server: %w", err)
-	}
-	defer conn.Close()
-
-	// Use TLS if encryption is "tls"
-	if s.config.Encryption == "tls" {
-		tlsConfig := &tls.Config{
-			ServerName:         s.config.Host,
-			InsecureSkipVerify: false,
-		}
-		if err := conn.StartTLS(tlsConfig); err != nil {
-			return messageID, fmt.Errorf("failed to start TLS: %w", err)
-		}
-	}
-
-	// Authenticate
-	auth := smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host)
-	if err := conn.Auth(auth); err != nil {
-		return messageID, fmt.Errorf("failed to authenticate: %w", err)
-	}
-
-	// Set sender (SMTP MAIL command uses email address only)
-	if err := conn.Mail(s.config.FromEmail); err != nil {
-		return messageID, fmt.Errorf("failed to set sender: %w", err)
-	}
-
-	// Set recipient
-	if err := conn.Rcpt(to); err != nil {
-		return messageID, fmt.Errorf("failed to set recipient: %w", err)
-	}
-
-	// Send email data
-	writer, err := conn.Data()
-	if err != nil {
-		return messageID, fmt.Errorf("failed to get data writer: %w", err)
-	}
-
-	_, err = writer.Write(emailBody)
+	// Build MIME email
+	emailBody, err := s.buildMessage(to, subject, messageID, body)
 	if err != nil {
-		writer.Close()
-		return messageID, fmt.Errorf("failed to write email data: %w", err)
+		return messageID, fmt.Errorf("failed to build email: %w", err)
 	}
 
-	if err := writer.Close(); err != nil {
-		return messageID, fmt.Errorf("failed to close data writer: %w", err)
+	// The MAIL command uses the email address only
+	if err := s.send(ctx, s.config.FromEmail, to, emailBody, clientID); err != nil {
+		return messageID, err
 	}
 
 	s.logger.Info().
@@ -108,68 +89,62 @@ func (s *smtpSender) Send(to string, subject string, body string) (string, error
 	return messageID, nil
 }
 
-// buildHeaders builds email headers
-func (s *smtpSender) buildHeaders(to, subject, messageID string) map[string]string {
-	headers := make(map[string]string)
-
-	// From header
-	from := s.config.FromEmail
-	if s.config.FromName != "" {
-		from = fmt.Sprintf("%s <%s>", s.config.FromName, s.config.FromEmail)
+// SendMessage DKIM-signs a built message and sends it via SMTP
+func (s *smtpSender) SendMessage(ctx context.Context, from string, to string, message []byte, clientID *uuid.UUID) error {
+	if err := s.send(ctx, from, to, message, clientID); err != nil {
+		return err
 	}
-	headers["From"] = from
-
-	// To header
-	headers["To"] = to
-
-	// Subject header
-	headers["Subject"] = subject
-
-	// Message-ID header
-	headers["Message-ID"] = messageID
-
-	// MIME-Version
-	headers["MIME-Version"] = "1.0"
 
-	// Content-Type
-	headers["Content-Type"] = `text/html; charset="UTF-8"`
-
-	// Date
-	headers["Date"] = time.Now().Format(time.RFC1123Z)
+	s.logger.Info().
+		Str("event", "email.smtp.sent").
+		Str("to", to).
+		Msg("Email sent successfully via SMTP")
 
-	return headers
+	return nil
 }
 
-// buildEmailBody builds the complete email body with headers
-func (s *smtpSender) buildEmailBody(headers map[string]string, body string) []byte {
-	var buf bytes.Buffer
-
-	// Write headers
-	for key, value := range headers {
-		buf.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
+// send DKIM-signs message and sends it over a pooled connection
+func (s *smtpSender) send(ctx context.Context, from, to string, message []byte, clientID *uuid.UUID) error {
+	// A signing failure should not stop the send
+	if s.signer != nil {
+		signed, err := s.signer.SignMessage(ctx, clientID, message)
+		if err != nil {
+			s.logger.Error().
+				Err(err).
+				Str("event", "email.smtp.dkim_sign_failed").
+				Str("to", to).
+				Msg("Failed to DKIM-sign email, sending it unsigned")
+		} else {
+			message = signed
+		}
 	}
 
-	// Empty line between headers and body
-	buf.WriteString("\r\n")
-
-	// Write body
-	buf.WriteString(body)
+	if err := s.pool.Send(ctx, s.config.Server(), from, []string{to}, message); err != nil {
+		var poolErr *smtppool.Error
+		if errors.As(err, &poolErr) {
+			return fmt.Errorf("%s: %w", sendFailures[poolErr.Op], poolErr)
+		}
+		return err
+	}
+	return nil
+}
 
-	return buf.Bytes()
+// buildMessage builds the HTML email, with a text part generated from it,
+// with the configured sender
+func (s *smtpSender) buildMessage(to, subject, messageID, body string) ([]byte, error) {
+	from := (&netmail.Address{Name: s.config.FromName, Address: s.config.FromEmail}).String()
+	msg := mimemsg.Message{
+		From:      from,
+		To:        []string{to},
+		Subject:   subject,
+		MessageID: messageID,
+		HTMLBody:  body,
+		TextBody:  htmltext.Convert(body),
+	}
+	return msg.Build()
 }
 
 // generateMessageID generates a unique RFC-compliant Message-ID
 func (s *smtpSender) generateMessageID() string {
-	// Extract domain from FromEmail
-	domain := "mailblast.local"
-	if idx := strings.LastIndex(s.config.FromEmail, "@"); idx != -1 {
-		domain = s.config.FromEmail[idx+1:]
-	}
-
-	// Generate UUID for unique part
-	uniqueID := uuid.New().String()
-
-	// Format: <UUID@domain>
-	return fmt.Sprintf("<%s@%s>", uniqueID, domain)
+	return mimemsg.NewMessageID(s.config.FromEmail)
 }
-
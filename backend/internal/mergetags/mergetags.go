@@ -0,0 +1,230 @@
+// Package mergetags renders merge tags in email subjects and bodies.
+//
+// A tag is a variable name between double braces, optionally followed by a
+// default used when the variable is missing or empty:
+//
+//	Hello {{first_name|there}}, your order {{order.id}} has shipped.
+//
+// Values are HTML-escaped when rendering HTML; triple braces ({{{body}}})
+// insert a value as is. Dotted names look up nested objects.
+package mergetags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrSyntax is returned for malformed tags
+	ErrSyntax = errors.New("invalid merge tag")
+	// ErrMissingVariable is returned for a tag without a value or default
+	ErrMissingVariable = errors.New("missing merge variable")
+	// ErrInvalidValue is returned for values that are not strings, numbers or booleans
+	ErrInvalidValue = errors.New("invalid merge variable")
+)
+
+// tag is one parsed merge tag
+type tag struct {
+	name       string
+	defaultVal string
+	hasDefault bool
+	raw        bool // triple braces, never escaped
+}
+
+// segment is literal text followed by an optional tag
+type segment struct {
+	text string
+	tag  *tag
+}
+
+// Render replaces the merge tags of content with values from data
+func Render(content string, data map[string]interface{}, escapeHTML bool) (string, error) {
+	segments, err := parse(content)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.Grow(len(content))
+	for _, s := range segments {
+		b.WriteString(s.text)
+		if s.tag == nil {
+			continue
+		}
+		value, err := s.tag.value(data)
+		if err != nil {
+			return "", err
+		}
+		if escapeHTML && !s.tag.raw {
+			value = html.EscapeString(value)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+// Validate checks the syntax of the merge tags in content
+func Validate(content string) error {
+	_, err := parse(content)
+	return err
+}
+
+// Variables returns the names of the variables content uses, in order of
+// first use, and whether each one has a default
+func Variables(content string) ([]string, map[string]bool, error) {
+	segments, err := parse(content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var names []string
+	defaults := make(map[string]bool)
+	for _, s := range segments {
+		if s.tag == nil {
+			continue
+		}
+		if _, seen := defaults[s.tag.name]; !seen {
+			names = append(names, s.tag.name)
+			defaults[s.tag.name] = s.tag.hasDefault
+		} else if !s.tag.hasDefault {
+			defaults[s.tag.name] = false
+		}
+	}
+	return names, defaults, nil
+}
+
+// parse splits content into literal text and tags
+func parse(content string) ([]segment, error) {
+	var segments []segment
+	rest := content
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			if rest != "" {
+				segments = append(segments, segment{text: rest})
+			}
+			return segments, nil
+		}
+
+		open, closing := "{{", "}}"
+		if strings.HasPrefix(rest[start:], "{{{") {
+			open, closing = "{{{", "}}}"
+		}
+		body := rest[start+len(open):]
+		end := strings.Index(body, closing)
+		if end < 0 {
+			return nil, fmt.Errorf("%w: %s without %s", ErrSyntax, open, closing)
+		}
+
+		t, err := parseTag(body[:end])
+		if err != nil {
+			return nil, err
+		}
+		t.raw = open == "{{{"
+		segments = append(segments, segment{text: rest[:start], tag: t})
+		rest = body[end+len(closing):]
+	}
+}
+
+// parseTag parses the inside of a tag: name, optionally followed by |default
+func parseTag(expr string) (*tag, error) {
+	name, defaultVal, hasDefault := strings.Cut(expr, "|")
+	t := &tag{name: strings.TrimSpace(name), hasDefault: hasDefault}
+	if !ValidName(t.name) {
+		return nil, fmt.Errorf("%w: {{%s}}", ErrSyntax, expr)
+	}
+	if hasDefault {
+		// Quotes keep leading and trailing spaces: {{name|" friend "}}
+		t.defaultVal = strings.TrimSpace(defaultVal)
+		if strings.HasPrefix(t.defaultVal, `"`) {
+			if unquoted, err := strconv.Unquote(t.defaultVal); err == nil {
+				t.defaultVal = unquoted
+			}
+		}
+	}
+	return t, nil
+}
+
+// ValidName reports whether name can be used in a tag: a dotted path of
+// letters, digits, underscores and hyphens
+func ValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, part := range strings.Split(name, ".") {
+		if part == "" {
+			return false
+		}
+		for _, r := range part {
+			if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// value returns the text the tag renders to
+func (t *tag) value(data map[string]interface{}) (string, error) {
+	value, found := lookup(data, t.name)
+	if !found || value == nil {
+		if t.hasDefault {
+			return t.defaultVal, nil
+		}
+		return "", fmt.Errorf("%w: %s", ErrMissingVariable, t.name)
+	}
+
+	text, err := format(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s is %v", ErrInvalidValue, t.name, err)
+	}
+	if text == "" && t.hasDefault {
+		return t.defaultVal, nil
+	}
+	return text, nil
+}
+
+// lookup finds name in data, first as a key and then as a dotted path
+func lookup(data map[string]interface{}, name string) (interface{}, bool) {
+	if value, ok := data[name]; ok {
+		return value, true
+	}
+
+	current := interface{}(data)
+	for _, part := range strings.Split(name, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// format converts a scalar JSON value to text
+func format(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(v), nil
+	case json.Number:
+		return v.String(), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	default:
+		return "", fmt.Errorf("a %T, not a string, number or boolean", value)
+	}
+}
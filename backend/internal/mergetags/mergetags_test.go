@@ -0,0 +1,102 @@
+package mergetags
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	data := map[string]interface{}{
+		"first_name": "Ana",
+		"empty":      "",
+		"count":      float64(3),
+		"price":      12.5,
+		"vip":        true,
+		"missing":    nil,
+		"html":       `<b>"Tom" & Jerry</b>`,
+		"order":      map[string]interface{}{"id": "A-1", "items": map[string]interface{}{"count": float64(2)}},
+		"flat.key":   "flat",
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		html    bool
+		want    string
+	}{
+		{"plain text", "no tags", false, "no tags"},
+		{"value", "Hi {{first_name}}!", false, "Hi Ana!"},
+		{"spaces", "Hi {{ first_name }}!", false, "Hi Ana!"},
+		{"numbers and booleans", "{{count}} x {{price}} {{vip}}", false, "3 x 12.5 true"},
+		{"default for missing", "Hi {{name|there}}", false, "Hi there"},
+		{"default for null", "Hi {{missing|there}}", false, "Hi there"},
+		{"default for empty", "Hi {{empty | there}}", false, "Hi there"},
+		{"quoted default", `Hi{{name|" dear friend"}}`, false, "Hi dear friend"},
+		{"empty without default", "[{{empty}}]", false, "[]"},
+		{"nested", "{{order.id}}/{{order.items.count}}", false, "A-1/2"},
+		{"dotted key", "{{flat.key}}", false, "flat"},
+		{"escaped in HTML", "<p>{{html}}</p>", true, "<p>&lt;b&gt;&#34;Tom&#34; &amp; Jerry&lt;/b&gt;</p>"},
+		{"defaults escaped in HTML", "{{name|<you>}}", true, "&lt;you&gt;"},
+		{"not escaped in text", "{{html}}", false, `<b>"Tom" & Jerry</b>`},
+		{"triple braces are raw", "<p>{{{html}}}</p>", true, `<p><b>"Tom" & Jerry</b></p>`},
+		{"single braces are text", "a { b } {c}", true, "a { b } {c}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Render(tt.content, data, tt.html)
+			if err != nil || got != tt.want {
+				t.Errorf("Render(%q) = %q, %v, want %q", tt.content, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRender_Errors(t *testing.T) {
+	data := map[string]interface{}{
+		"list":   []interface{}{"a"},
+		"object": map[string]interface{}{"a": "b"},
+		"name":   "x",
+	}
+
+	tests := []struct {
+		content string
+		want    error
+	}{
+		{"Hi {{first_name}}", ErrMissingVariable},
+		{"{{name.first}}", ErrMissingVariable},
+		{"{{list}}", ErrInvalidValue},
+		{"{{object}}", ErrInvalidValue},
+		{"Hi {{name", ErrSyntax},
+		{"Hi {{{name}}", ErrSyntax},
+		{"{{}}", ErrSyntax},
+		{"{{first name}}", ErrSyntax},
+		{"{{a..b}}", ErrSyntax},
+		{"{{<b>}}", ErrSyntax},
+	}
+
+	for _, tt := range tests {
+		if _, err := Render(tt.content, data, true); !errors.Is(err, tt.want) {
+			t.Errorf("Render(%q) error = %v, want %v", tt.content, err, tt.want)
+		}
+	}
+}
+
+func TestVariables(t *testing.T) {
+	names, defaults, err := Variables("{{first_name|there}} {{order.id}} {{{first_name}}} {{coupon|none}}")
+	if err != nil {
+		t.Fatalf("Variables() error = %v", err)
+	}
+	if want := []string{"first_name", "order.id", "coupon"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+	// first_name is also used without a default, so it is required
+	if want := map[string]bool{"first_name": false, "order.id": false, "coupon": true}; !reflect.DeepEqual(defaults, want) {
+		t.Errorf("defaults = %v, want %v", defaults, want)
+	}
+
+	if err := Validate("{{ok}} {{not ok}}"); !errors.Is(err, ErrSyntax) {
+		t.Errorf("Validate() error = %v, want ErrSyntax", err)
+	}
+}
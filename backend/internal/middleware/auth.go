@@ -5,9 +5,11 @@ import (
 	"strings"
 
 	"backend/internal/auth"
+	"backend/internal/models"
 	"backend/internal/users"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 )
 
@@ -123,3 +125,21 @@ func RequireAdmin() fiber.Handler {
 func RequireClientOrAdmin() fiber.Handler {
 	return RequireRole("admin", "client")
 }
+
+// IsAdmin reports whether the authenticated user is an admin
+func IsAdmin(c *fiber.Ctx) bool {
+	role, _ := c.Locals("user_role").(string)
+	return role == "admin"
+}
+
+// ClientIDFromContext returns the client of the authenticated user
+// It returns nil for users that are not linked to a client (e.g. admins).
+func ClientIDFromContext(c *fiber.Ctx) *uuid.UUID {
+	if claims, ok := c.Locals("claims").(*auth.Claims); ok && claims != nil && claims.ClientID != nil {
+		return claims.ClientID
+	}
+	if user, ok := c.Locals("user").(*models.User); ok && user != nil && user.ClientID != nil {
+		return user.ClientID
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BodyLimit enforces a per-route request body limit
+// It relies on fiber.Config.StreamRequestBody: bodies within the server's
+// BodyLimit are read as usual, larger (or chunked) ones are left as a stream
+// that this middleware reads up to limit(c) bytes. Bigger bodies get 413
+// without being read in full.
+func BodyLimit(limit func(c *fiber.Ctx) int) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		stream := c.Context().RequestBodyStream()
+		if stream == nil {
+			return c.Next()
+		}
+
+		maxSize := limit(c)
+		if c.Request().Header.ContentLength() > maxSize {
+			return tooLarge(c)
+		}
+
+		body, err := io.ReadAll(io.LimitReader(stream, int64(maxSize)+1))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Failed to read request body",
+			})
+		}
+		if len(body) > maxSize {
+			return tooLarge(c)
+		}
+
+		c.Request().SetBody(body)
+		return c.Next()
+	}
+}
+
+// tooLarge refuses a request whose body was not read in full
+// The rest of the body is still on the connection, so it cannot be reused.
+func tooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"error": "Request body too large",
+	})
+}
@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestBodyLimit(t *testing.T) {
+	app := fiber.New(fiber.Config{BodyLimit: 16, StreamRequestBody: true})
+	app.Use(BodyLimit(func(c *fiber.Ctx) int {
+		if c.Path() == "/large" {
+			return 64
+		}
+		return 16
+	}))
+	echo := func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	}
+	app.Post("/small", echo)
+	app.Post("/large", echo)
+
+	tests := []struct {
+		name     string
+		path     string
+		size     int
+		expected int
+	}{
+		{"Within server limit", "/small", 16, http.StatusOK},
+		{"Over default limit", "/small", 17, http.StatusRequestEntityTooLarge},
+		{"Raised limit", "/large", 64, http.StatusOK},
+		{"Over raised limit", "/large", 65, http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := bytes.Repeat([]byte("a"), tt.size)
+			resp, err := app.Test(httptest.NewRequest("POST", tt.path, bytes.NewReader(body)))
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.StatusCode != tt.expected {
+				t.Fatalf("Expected status %d, got %d", tt.expected, resp.StatusCode)
+			}
+			if tt.expected == http.StatusOK {
+				got, _ := io.ReadAll(resp.Body)
+				if !bytes.Equal(got, body) {
+					t.Errorf("Expected the handler to see the full body, got %d bytes", len(got))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,434 @@
+// Package mimemsg builds RFC 5322 / RFC 2045 email messages.
+// Headers are written in a stable order with RFC 2047 encoding of non-ASCII
+// text, and bodies are quoted-printable encoded byte-wise.
+package mimemsg
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxLineLength is the length header lines are folded at (RFC 5322 section 2.1.1)
+const maxLineLength = 78
+
+// base64LineLength is the length of base64 body lines (RFC 2045 section 6.8)
+const base64LineLength = 76
+
+// defaultDomain is the Message-ID domain when the From address has none
+const defaultDomain = "mailblast.local"
+
+// builderHeaders are written by Build and cannot be set through Message.Headers
+var builderHeaders = map[string]bool{
+	"Date":                      true,
+	"From":                      true,
+	"To":                        true,
+	"Subject":                   true,
+	"Message-Id":                true,
+	"Mime-Version":              true,
+	"Content-Type":              true,
+	"Content-Transfer-Encoding": true,
+}
+
+// addressHeaders hold address lists and are encoded per address
+var addressHeaders = map[string]bool{
+	"From":     true,
+	"To":       true,
+	"Cc":       true,
+	"Bcc":      true,
+	"Reply-To": true,
+	"Sender":   true,
+}
+
+// newBoundary returns a random multipart boundary; tests replace it
+var newBoundary = func() string {
+	var b [12]byte
+	rand.Read(b[:])
+	return "mb_" + hex.EncodeToString(b[:])
+}
+
+// Message is an email to be built
+type Message struct {
+	From      string   // address, optionally with a display name
+	To        []string // addresses, optionally with display names
+	Subject   string
+	Date      time.Time         // defaults to now
+	MessageID string            // defaults to NewMessageID(From)
+	Headers   map[string]string // additional headers, e.g. List-Unsubscribe
+	TextBody  string
+	HTMLBody  string
+
+	Attachments []Attachment // files attached to the message
+	Inline      []Attachment // parts the HTML body references as cid:<ContentID>, e.g. logos
+}
+
+// Attachment is a file attached to a message or embedded in its HTML body
+type Attachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type,omitempty"` // detected from the filename extension when empty
+	Content     []byte `json:"content"`                // base64 encoded in JSON
+	ContentID   string `json:"content_id,omitempty"`   // inline parts only, without angle brackets
+}
+
+// NewMessageID returns a unique Message-ID in the format <UUID@domain>,
+// taking the domain from the from address
+func NewMessageID(from string) string {
+	domain := defaultDomain
+	if addr, err := mail.ParseAddress(from); err == nil {
+		from = addr.Address
+	}
+	if idx := strings.LastIndex(from, "@"); idx != -1 && idx < len(from)-1 {
+		domain = from[idx+1:]
+	}
+	return fmt.Sprintf("<%s@%s>", uuid.New().String(), domain)
+}
+
+// Build returns the message in wire format, with CRLF line endings.
+// Headers are written as Date, From, To, Subject, Message-ID, the additional
+// headers sorted by name, then MIME-Version and the content headers.
+func (m *Message) Build() ([]byte, error) {
+	if m.TextBody == "" && m.HTMLBody == "" {
+		return nil, fmt.Errorf("a text or HTML body is required")
+	}
+
+	from, err := formatAddresses("From", []string{m.From})
+	if err != nil {
+		return nil, err
+	}
+	to, err := formatAddresses("To", m.To)
+	if err != nil {
+		return nil, err
+	}
+
+	date := m.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	messageID := m.MessageID
+	if messageID == "" {
+		messageID = NewMessageID(m.From)
+	}
+	if !strings.HasPrefix(messageID, "<") {
+		messageID = "<" + messageID + ">"
+	}
+
+	var buf bytes.Buffer
+	writeHeader(&buf, "Date", date.Format(time.RFC1123Z))
+	writeHeader(&buf, "From", from)
+	writeHeader(&buf, "To", to)
+	writeHeader(&buf, "Subject", encodeText(m.Subject))
+	writeHeader(&buf, "Message-ID", messageID)
+
+	names := make([]string, 0, len(m.Headers))
+	for name := range m.Headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := formatHeader(name, m.Headers[name])
+		if err != nil {
+			return nil, err
+		}
+		writeHeader(&buf, name, value)
+	}
+
+	writeHeader(&buf, "MIME-Version", "1.0")
+
+	body, err := m.body()
+	if err != nil {
+		return nil, err
+	}
+	writeHeader(&buf, "Content-Type", body.contentType)
+	for _, h := range body.headers {
+		writeHeader(&buf, h[0], h[1])
+	}
+	buf.WriteString("\r\n")
+	if err := body.write(&buf); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// part is a MIME entity: its content type, other content headers and a writer of its body
+type part struct {
+	contentType string
+	headers     [][2]string
+	write       func(io.Writer) error
+}
+
+// body returns the MIME structure of the message:
+//
+//	multipart/mixed            when there are attachments
+//	  multipart/related        when there are inline parts
+//	    multipart/alternative  when there are both text and HTML bodies
+//	      text/plain
+//	      text/html
+//	    inline parts
+//	  attachments
+func (m *Message) body() (part, error) {
+	if len(m.Inline) > 0 && m.HTMLBody == "" {
+		return part{}, fmt.Errorf("inline parts require an HTML body")
+	}
+
+	var content part
+	switch {
+	case m.TextBody != "" && m.HTMLBody != "":
+		content = multipartPart("alternative", []part{
+			textPart("plain", m.TextBody),
+			textPart("html", m.HTMLBody),
+		})
+	case m.HTMLBody != "":
+		content = textPart("html", m.HTMLBody)
+	default:
+		content = textPart("plain", m.TextBody)
+	}
+
+	if len(m.Inline) > 0 {
+		parts := []part{content}
+		for i := range m.Inline {
+			p, err := attachmentPart(&m.Inline[i], true)
+			if err != nil {
+				return part{}, err
+			}
+			parts = append(parts, p)
+		}
+		content = multipartPart("related", parts)
+	}
+
+	if len(m.Attachments) > 0 {
+		parts := []part{content}
+		for i := range m.Attachments {
+			p, err := attachmentPart(&m.Attachments[i], false)
+			if err != nil {
+				return part{}, err
+			}
+			parts = append(parts, p)
+		}
+		content = multipartPart("mixed", parts)
+	}
+
+	return content, nil
+}
+
+// textPart returns a quoted-printable text/subtype part
+func textPart(subtype, body string) part {
+	return part{
+		contentType: "text/" + subtype + "; charset=UTF-8",
+		headers:     [][2]string{{"Content-Transfer-Encoding", "quoted-printable"}},
+		write: func(w io.Writer) error {
+			return writeQuotedPrintable(w, body)
+		},
+	}
+}
+
+// multipartPart returns a multipart/subtype part holding parts
+func multipartPart(subtype string, parts []part) part {
+	boundary := newBoundary()
+	return part{
+		contentType: fmt.Sprintf("multipart/%s; boundary=%q", subtype, boundary),
+		write: func(w io.Writer) error {
+			mw := multipart.NewWriter(w)
+			if err := mw.SetBoundary(boundary); err != nil {
+				return err
+			}
+			for _, p := range parts {
+				header := textproto.MIMEHeader{"Content-Type": {p.contentType}}
+				for _, h := range p.headers {
+					header[h[0]] = []string{h[1]} // keeps the Content-ID spelling
+				}
+				pw, err := mw.CreatePart(header)
+				if err != nil {
+					return err
+				}
+				if err := p.write(pw); err != nil {
+					return err
+				}
+			}
+			return mw.Close()
+		},
+	}
+}
+
+// attachmentPart returns a base64 part for an attachment, or an inline part
+// referenced from the HTML body by its Content-ID
+func attachmentPart(a *Attachment, inline bool) (part, error) {
+	filename := a.Filename
+	if i := strings.LastIndexAny(filename, `/\`); i != -1 {
+		filename = filename[i+1:]
+	}
+	if filename == "" || strings.ContainsAny(filename, "\r\n\"") {
+		return part{}, fmt.Errorf("invalid attachment filename %q", a.Filename)
+	}
+
+	mediaType := a.ContentType
+	if mediaType == "" {
+		mediaType = mime.TypeByExtension(path.Ext(filename))
+	}
+	if mediaType == "" {
+		mediaType = "application/octet-stream"
+	}
+	mediaType, params, err := mime.ParseMediaType(mediaType)
+	if err != nil {
+		return part{}, fmt.Errorf("invalid content type %q of attachment %s", a.ContentType, filename)
+	}
+	if strings.HasPrefix(mediaType, "multipart/") {
+		return part{}, fmt.Errorf("attachment %s cannot be multipart", filename)
+	}
+	params["name"] = filename
+
+	disposition := "attachment"
+	var headers [][2]string
+	if inline {
+		if a.ContentID == "" || strings.ContainsAny(a.ContentID, "<>\r\n\" ") {
+			return part{}, fmt.Errorf("inline part %s needs a valid content_id", filename)
+		}
+		disposition = "inline"
+		headers = append(headers, [2]string{"Content-ID", "<" + a.ContentID + ">"})
+	}
+	headers = append(headers,
+		[2]string{"Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename})},
+		[2]string{"Content-Transfer-Encoding", "base64"},
+	)
+
+	content := a.Content
+	return part{
+		contentType: mime.FormatMediaType(mediaType, params),
+		headers:     headers,
+		write: func(w io.Writer) error {
+			return writeBase64(w, content)
+		},
+	}, nil
+}
+
+// writeBase64 writes content base64 encoded in lines of 76 characters
+func writeBase64(w io.Writer, content []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > base64LineLength {
+		if _, err := io.WriteString(w, encoded[:base64LineLength]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[base64LineLength:]
+	}
+	_, err := io.WriteString(w, encoded)
+	return err
+}
+
+// writeQuotedPrintable encodes body byte-wise as quoted-printable with CRLF line endings
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// formatHeader validates an additional header and encodes its value
+func formatHeader(name, value string) (string, error) {
+	if !validHeaderName(name) {
+		return "", fmt.Errorf("invalid header name %q", name)
+	}
+	canonical := textproto.CanonicalMIMEHeaderKey(name)
+	if builderHeaders[canonical] {
+		return "", fmt.Errorf("header %s is set by the message builder", name)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("header %s contains a line break", name)
+	}
+	if addressHeaders[canonical] {
+		list, err := mail.ParseAddressList(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s address list %q: %w", name, value, err)
+		}
+		formatted := make([]string, len(list))
+		for i, addr := range list {
+			formatted[i] = formatAddress(addr)
+		}
+		return strings.Join(formatted, ", "), nil
+	}
+	return encodeText(value), nil
+}
+
+// formatAddresses parses addresses and formats them as an address list,
+// RFC 2047 encoding display names where needed
+func formatAddresses(header string, addresses []string) (string, error) {
+	formatted := make([]string, 0, len(addresses))
+	for _, a := range addresses {
+		if strings.TrimSpace(a) == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(a)
+		if err != nil {
+			return "", fmt.Errorf("invalid %s address %q: %w", header, a, err)
+		}
+		formatted = append(formatted, formatAddress(addr))
+	}
+	if len(formatted) == 0 {
+		return "", fmt.Errorf("%s address is required", header)
+	}
+	return strings.Join(formatted, ", "), nil
+}
+
+// formatAddress formats addr as a bare address, or with its display name
+// quoted or RFC 2047 encoded as needed
+func formatAddress(addr *mail.Address) string {
+	if addr.Name == "" {
+		return addr.Address
+	}
+	return addr.String()
+}
+
+// encodeText RFC 2047 encodes an unstructured header value that is not plain ASCII
+func encodeText(value string) string {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= 0x80 || (value[i] < 0x20 && value[i] != '\t') {
+			return mime.QEncoding.Encode("UTF-8", value)
+		}
+	}
+	return value
+}
+
+// writeHeader writes a header field, folding it at spaces to keep lines
+// within maxLineLength where possible
+func writeHeader(buf *bytes.Buffer, name, value string) {
+	buf.WriteString(name)
+	buf.WriteByte(':')
+	lineLen := len(name) + 1
+	for i, word := range strings.Split(value, " ") {
+		if i > 0 && lineLen+1+len(word) > maxLineLength {
+			buf.WriteString("\r\n")
+			lineLen = 0
+		}
+		buf.WriteByte(' ')
+		buf.WriteString(word)
+		lineLen += 1 + len(word)
+	}
+	buf.WriteString("\r\n")
+}
+
+// validHeaderName reports whether name is a valid RFC 5322 field name
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if name[i] <= ' ' || name[i] >= 0x7f || name[i] == ':' {
+			return false
+		}
+	}
+	return true
+}
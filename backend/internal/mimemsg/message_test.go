@@ -0,0 +1,312 @@
+package mimemsg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixedMessage returns a message with a fixed date and Message-ID
+func fixedMessage() Message {
+	return Message{
+		From:      "Mailblast <news@example.com>",
+		To:        []string{"recipient@example.com"},
+		Subject:   "Monthly update",
+		Date:      time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC),
+		MessageID: "<0d9a3c1e-6f0b-4a52-9d6e-3f1c2b7a8e90@example.com>",
+	}
+}
+
+func TestBuild_Golden(t *testing.T) {
+	original := newBoundary
+	defer func() { newBoundary = original }()
+
+	tests := []struct {
+		name  string
+		build func(*Message)
+	}{
+		{"text_only", func(m *Message) {
+			m.TextBody = "Hello,\nthis is the plain text version.\n"
+		}},
+		{"html_only", func(m *Message) {
+			m.HTMLBody = `<html><body><h1>Hello</h1><p style="color:#333">Price = 10&euro;</p></body></html>`
+		}},
+		{"alternative", func(m *Message) {
+			m.TextBody = "Hello,\nplain text version"
+			m.HTMLBody = "<p>Hello,<br>HTML version</p>"
+		}},
+		{"unicode", func(m *Message) {
+			m.From = "Zoë Müller <zoe@example.com>"
+			m.To = []string{"José Ñúñez <jose@example.com>", "plain@example.com"}
+			m.Subject = "Grüße aus München – a long subject line that needs several encoded words ✓"
+			m.TextBody = "Café = naïve ✓ " + strings.Repeat("long line ", 12) + "\r\nTrailing space \nEnd"
+		}},
+		{"attachment", func(m *Message) {
+			m.TextBody = "Your invoice is attached."
+			m.Attachments = []Attachment{
+				{Filename: "Rechnung März.pdf", Content: []byte("%PDF-1.4 " + strings.Repeat("0123456789", 10))},
+			}
+		}},
+		{"inline_and_attachments", func(m *Message) {
+			m.TextBody = "Monthly report"
+			m.HTMLBody = `<p><img src="cid:logo@mailblast">Monthly report</p>`
+			m.Inline = []Attachment{
+				{Filename: "logo.png", ContentType: "image/png", Content: []byte{0x89, 'P', 'N', 'G', 0, 1, 2, 3}, ContentID: "logo@mailblast"},
+			}
+			m.Attachments = []Attachment{
+				{Filename: "report.csv", ContentType: "text/csv; charset=utf-8", Content: []byte("month,sent\n2024-02,1000\n")},
+				{Filename: "../../etc/data.bin", Content: []byte{0xff, 0xfe}},
+			}
+		}},
+		{"extra_headers", func(m *Message) {
+			m.Headers = map[string]string{
+				"X-Mailer":         "Mailblast",
+				"List-Unsubscribe": "<https://example.com/unsubscribe?id=1>",
+				"Reply-To":         "Support Team <support@example.com>",
+				"X-Campaign":       "Spring sale ☀",
+			}
+			m.TextBody = "Body"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := 0
+			newBoundary = func() string {
+				n++
+				return fmt.Sprintf("mb_boundary_%d", n)
+			}
+
+			msg := fixedMessage()
+			tt.build(&msg)
+
+			got, err := msg.Build()
+			if err != nil {
+				t.Fatalf("Build() error = %v", err)
+			}
+
+			golden := filepath.Join("testdata", tt.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("Build() mismatch with %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestBuild_ParsesAsMail(t *testing.T) {
+	msg := fixedMessage()
+	msg.From = "Zoë Müller <zoe@example.com>"
+	msg.Subject = "Grüße ✓"
+	msg.TextBody = "Café = naïve ✓\n" + strings.Repeat("x", 200)
+
+	raw, err := msg.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	for i, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("line %d is %d bytes long", i, len(line))
+		}
+		if strings.Contains(line, "\n") {
+			t.Errorf("line %d has a bare LF", i)
+		}
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("Subject = %q (%v), want %q", subject, err, msg.Subject)
+	}
+	from, err := parsed.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Name != "Zoë Müller" {
+		t.Errorf("From = %v (%v), want Zoë Müller", from, err)
+	}
+
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatalf("failed to decode body: %v", err)
+	}
+	want := strings.ReplaceAll(msg.TextBody, "\n", "\r\n")
+	if string(body) != want {
+		t.Errorf("decoded body = %q, want %q", body, want)
+	}
+}
+
+func TestBuild_AttachmentsParse(t *testing.T) {
+	msg := fixedMessage()
+	msg.TextBody = "text"
+	msg.HTMLBody = `<img src="cid:logo">`
+	msg.Inline = []Attachment{{Filename: "logo.png", Content: []byte("png-bytes"), ContentID: "logo"}}
+	msg.Attachments = []Attachment{{Filename: "big.bin", Content: bytes.Repeat([]byte{0, 1, 2, 0xff}, 1000)}}
+
+	raw, err := msg.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	// Walk the tree and collect the leaf parts in order
+	type leaf struct {
+		contentType string
+		cid         string
+		body        []byte
+	}
+	var leaves []leaf
+	var walk func(contentType string, header textproto.MIMEHeader, body io.Reader)
+	walk = func(contentType string, header textproto.MIMEHeader, body io.Reader) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatalf("invalid Content-Type %q: %v", contentType, err)
+		}
+		if strings.HasPrefix(mediaType, "multipart/") {
+			mr := multipart.NewReader(body, params["boundary"])
+			for {
+				p, err := mr.NextRawPart()
+				if err == io.EOF {
+					return
+				}
+				if err != nil {
+					t.Fatalf("NextPart() error = %v", err)
+				}
+				walk(p.Header.Get("Content-Type"), p.Header, p)
+			}
+		}
+		data, _ := io.ReadAll(body)
+		if header.Get("Content-Transfer-Encoding") == "base64" {
+			data, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(data), "\r\n", ""))
+			if err != nil {
+				t.Fatalf("invalid base64 body: %v", err)
+			}
+		}
+		leaves = append(leaves, leaf{mediaType, header.Get("Content-Id"), data})
+	}
+	walk(parsed.Header.Get("Content-Type"), textproto.MIMEHeader(parsed.Header), parsed.Body)
+
+	want := []string{"text/plain", "text/html", "image/png", "application/octet-stream"}
+	if len(leaves) != len(want) {
+		t.Fatalf("got %d leaf parts, want %d", len(leaves), len(want))
+	}
+	for i, l := range leaves {
+		if l.contentType != want[i] {
+			t.Errorf("part %d Content-Type = %s, want %s", i, l.contentType, want[i])
+		}
+	}
+	if leaves[2].cid != "<logo>" || string(leaves[2].body) != "png-bytes" {
+		t.Errorf("inline part = %q %q, want <logo> png-bytes", leaves[2].cid, leaves[2].body)
+	}
+	if !bytes.Equal(leaves[3].body, msg.Attachments[0].Content) {
+		t.Error("attachment content does not round-trip")
+	}
+}
+
+func TestBuild_DefaultsDateAndMessageID(t *testing.T) {
+	msg := Message{From: "news@example.com", To: []string{"user@example.com"}, Subject: "Hi", TextBody: "Hi"}
+
+	raw, err := msg.Build()
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	date, err := parsed.Header.Date()
+	if err != nil || time.Since(date) > time.Minute {
+		t.Errorf("Date = %v (%v), want now", date, err)
+	}
+	if id := parsed.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q, want <...@example.com>", id)
+	}
+}
+
+func TestBuild_RejectsInvalidInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(*Message)
+	}{
+		{"No body", func(m *Message) { m.TextBody = "" }},
+		{"Invalid From", func(m *Message) { m.From = "not an address" }},
+		{"No recipient", func(m *Message) { m.To = nil }},
+		{"Header injection", func(m *Message) { m.Headers = map[string]string{"X-Tag": "a\r\nBcc: victim@example.com"} }},
+		{"Builder header", func(m *Message) { m.Headers = map[string]string{"Content-Type": "text/plain"} }},
+		{"Invalid header name", func(m *Message) { m.Headers = map[string]string{"X Tag": "a"} }},
+		{"Inline without HTML", func(m *Message) {
+			m.Inline = []Attachment{{Filename: "logo.png", Content: []byte{1}, ContentID: "logo"}}
+		}},
+		{"Inline without Content-ID", func(m *Message) {
+			m.HTMLBody = "<img src=cid:logo>"
+			m.Inline = []Attachment{{Filename: "logo.png", Content: []byte{1}}}
+		}},
+		{"Attachment without filename", func(m *Message) {
+			m.Attachments = []Attachment{{Content: []byte{1}}}
+		}},
+		{"Attachment with invalid content type", func(m *Message) {
+			m.Attachments = []Attachment{{Filename: "a.bin", ContentType: "not a type", Content: []byte{1}}}
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := fixedMessage()
+			msg.TextBody = "Body"
+			tt.build(&msg)
+
+			if _, err := msg.Build(); err == nil {
+				t.Error("Build() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestNewMessageID(t *testing.T) {
+	tests := []struct {
+		from   string
+		suffix string
+	}{
+		{"news@example.com", "@example.com>"},
+		{"Mailblast <news@mail.example.org>", "@mail.example.org>"},
+		{"", "@" + defaultDomain + ">"},
+	}
+
+	for _, tt := range tests {
+		id := NewMessageID(tt.from)
+		if !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, tt.suffix) {
+			t.Errorf("NewMessageID(%q) = %q, want suffix %q", tt.from, id, tt.suffix)
+		}
+	}
+	if NewMessageID("a@example.com") == NewMessageID("a@example.com") {
+		t.Error("NewMessageID() returned the same ID twice")
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RollupEventSent is the rollup event type counting created email messages
+const RollupEventSent = "sent"
+
+// AnalyticsRollup is one pre-aggregated analytics counter
+// Emails without a client or campaign are stored under uuid.Nil, and rows that
+// are not about a single link have an empty LinkURL.
+type AnalyticsRollup struct {
+	Bucket      time.Time `gorm:"type:timestamp;primaryKey" json:"bucket"` // start of the hour or day
+	ClientID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"client_id"`
+	CampaignID  uuid.UUID `gorm:"type:uuid;primaryKey" json:"campaign_id"`
+	EventType   string    `gorm:"type:varchar(50);primaryKey" json:"event_type"`
+	LinkURL     string    `gorm:"type:text;primaryKey;default:''" json:"link_url"`
+	TotalCount  int64     `gorm:"not null;default:0" json:"total_count"`  // events in the bucket
+	UniqueCount int64     `gorm:"not null;default:0" json:"unique_count"` // emails whose first such event is in the bucket
+}
+
+// AnalyticsHourlyRollup is an AnalyticsRollup with hourly buckets
+type AnalyticsHourlyRollup struct {
+	AnalyticsRollup `gorm:"embedded"`
+}
+
+// TableName specifies the table name for GORM
+func (AnalyticsHourlyRollup) TableName() string {
+	return "analytics_hourly_rollups"
+}
+
+// AnalyticsDailyRollup is an AnalyticsRollup with daily buckets
+type AnalyticsDailyRollup struct {
+	AnalyticsRollup `gorm:"embedded"`
+}
+
+// TableName specifies the table name for GORM
+func (AnalyticsDailyRollup) TableName() string {
+	return "analytics_daily_rollups"
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DKIMKey is a key a client signs the mail of one sending domain with
+// A domain belongs to the client whose key was verified in its DNS and has
+// at most one active key; the others are kept while their DNS records are
+// still published.
+type DKIMKey struct {
+	ID         uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	ClientID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"client_id"`
+	Domain     string     `gorm:"type:varchar(255);not null;uniqueIndex:idx_dkim_keys_domain_selector" json:"domain"`
+	Selector   string     `gorm:"type:varchar(63);not null;uniqueIndex:idx_dkim_keys_domain_selector" json:"selector"`
+	Algorithm  string     `gorm:"type:varchar(20);not null" json:"algorithm"` // rsa-sha256 or ed25519-sha256
+	PrivateKey string     `gorm:"type:text;not null" json:"-"`                // PKCS #8 PEM
+	Active     bool       `gorm:"not null;default:false" json:"active"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"` // first found published in DNS
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM
+func (DKIMKey) TableName() string {
+	return "dkim_keys"
+}
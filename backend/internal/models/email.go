@@ -9,14 +9,19 @@ import (
 
 // EmailMessageRecord represents an email message in the database
 type EmailMessageRecord struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
-	MessageID string    `gorm:"type:text;not null" json:"message_id"`
-	From      string    `gorm:"type:text;not null;column:from_email" json:"from_email"`
-	To        string    `gorm:"type:text;not null;column:to_email" json:"to_email"`
-	Subject   string    `gorm:"type:text;not null" json:"subject"`
-	Status    string    `gorm:"type:text;not null;default:'queued'" json:"status"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	MessageID         string     `gorm:"type:text;not null" json:"message_id"`
+	ProviderMessageID string     `gorm:"type:text" json:"provider_message_id,omitempty"` // e.g. the SES message ID, set once sent
+	Provider          string     `gorm:"type:varchar(100)" json:"provider,omitempty"`    // routing provider that sent the email
+	From              string     `gorm:"type:text;not null;column:from_email" json:"from_email"`
+	To                string     `gorm:"type:text;not null;column:to_email" json:"to_email"`
+	Subject           string     `gorm:"type:text;not null" json:"subject"`
+	Status            string     `gorm:"type:text;not null;default:'queued'" json:"status"`
+	CampaignID        *uuid.UUID `gorm:"type:uuid" json:"campaign_id,omitempty"` // set for campaign sends
+	ContactID         *uuid.UUID `gorm:"type:uuid" json:"contact_id,omitempty"`  // recipient contact, if known
+	ClientID          *uuid.UUID `gorm:"type:uuid" json:"client_id,omitempty"`   // client the email was sent for
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
 }
 
 // TableName specifies the table name for GORM
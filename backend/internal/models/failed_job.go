@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Queues a failed job can originate from
+const (
+	FailedJobQueueRedis  = "redis"  // queue.Consumer (POST /send-email)
+	FailedJobQueueMemory = "memory" // email.Queue (POST /emails/send)
+)
+
+// FailedJob is a job that exhausted its retries (dead-letter entry)
+type FailedJob struct {
+	ID           uuid.UUID       `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Queue        string          `gorm:"type:varchar(50);not null" json:"queue"` // redis, memory
+	JobType      string          `gorm:"type:varchar(100);not null" json:"job_type"`
+	Payload      json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	ErrorMessage string          `gorm:"type:text;not null" json:"error_message"`
+	Attempts     int             `gorm:"not null;default:0" json:"attempts"`
+	CampaignID   *uuid.UUID      `gorm:"type:uuid" json:"campaign_id,omitempty"`
+	RetriedAt    *time.Time      `gorm:"type:timestamp" json:"retried_at,omitempty"` // set when requeued
+	CreatedAt    time.Time       `json:"created_at"`
+}
+
+// TableName specifies the table name for GORM
+func (FailedJob) TableName() string {
+	return "failed_jobs"
+}
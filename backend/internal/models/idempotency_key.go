@@ -0,0 +1,27 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IdempotencyKey is an Idempotency-Key sent with POST /emails/send and the
+// response of its first request, which retries get instead of a new send
+type IdempotencyKey struct {
+	ID          uuid.UUID       `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	Scope       string          `gorm:"type:varchar(100);not null;uniqueIndex:idx_idempotency_keys_scope_key" json:"scope"` // client:<id>, or user:<id> for admins
+	Key         string          `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_keys_scope_key" json:"key"`
+	RequestHash string          `gorm:"type:varchar(64);not null" json:"request_hash"` // hex SHA-256 of the request
+	StatusCode  int             `gorm:"not null;default:0" json:"status_code"`         // 0 while the first request is in progress
+	Response    json.RawMessage `gorm:"type:jsonb" json:"response,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	LockedUntil time.Time       `gorm:"type:timestamp;not null;default:CURRENT_TIMESTAMP" json:"locked_until"` // a retry may take over an in-progress key after this
+	ExpiresAt   time.Time       `gorm:"type:timestamp;not null;index" json:"expires_at"`
+}
+
+// TableName specifies the table name for GORM
+func (IdempotencyKey) TableName() string {
+	return "idempotency_keys"
+}
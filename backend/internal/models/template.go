@@ -0,0 +1,92 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Template variable types
+const (
+	TemplateVariableString  = "string"
+	TemplateVariableNumber  = "number"
+	TemplateVariableBoolean = "boolean"
+	TemplateVariableObject  = "object" // for dotted tags such as {{order.id}}
+)
+
+// Template is a reusable email of a client
+// Its content lives in numbered TemplateVersions that never change once
+// created; LatestVersion is the version used when none is requested.
+type Template struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	ClientID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_templates_client_name" json:"client_id"`
+	Name          string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_templates_client_name" json:"name"`
+	Description   string    `gorm:"type:text" json:"description,omitempty"`
+	LatestVersion int       `gorm:"not null;default:0" json:"latest_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM
+func (Template) TableName() string {
+	return "templates"
+}
+
+// TemplateVariable declares a merge variable of a template version
+type TemplateVariable struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"` // string (default), number, boolean or object
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"` // used when the variable is not given
+	Description string      `json:"description,omitempty"`
+}
+
+// TemplateVariables is a variables schema stored as a JSON array
+type TemplateVariables []TemplateVariable
+
+// Value implements driver.Valuer
+func (v TemplateVariables) Value() (driver.Value, error) {
+	if v == nil {
+		v = TemplateVariables{}
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (v *TemplateVariables) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*v = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(data, v)
+	case string:
+		return json.Unmarshal([]byte(data), v)
+	default:
+		return fmt.Errorf("unsupported TemplateVariables value %T", value)
+	}
+}
+
+// TemplateVersion is an immutable, numbered revision of a template's content
+type TemplateVersion struct {
+	ID          uuid.UUID         `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	TemplateID  uuid.UUID         `gorm:"type:uuid;not null;uniqueIndex:idx_template_versions_template_version" json:"template_id"`
+	Version     int               `gorm:"not null;uniqueIndex:idx_template_versions_template_version" json:"version"`
+	Subject     string            `gorm:"type:text;not null" json:"subject"`
+	HTMLContent string            `gorm:"type:text" json:"html"`
+	TextContent string            `gorm:"type:text" json:"text"`
+	Variables   TemplateVariables `gorm:"type:jsonb;not null;default:'[]'" json:"variables"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+// TableName specifies the table name for GORM
+func (TemplateVersion) TableName() string {
+	return "template_versions"
+}
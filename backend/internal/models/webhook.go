@@ -0,0 +1,121 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook delivery statuses
+const (
+	WebhookDeliveryPending   = "pending"   // waiting for its next attempt
+	WebhookDeliverySucceeded = "succeeded" // the endpoint answered 2xx
+	WebhookDeliveryFailed    = "failed"    // every attempt failed
+)
+
+// StringList is a list of strings stored as a JSON array
+type StringList []string
+
+// Value implements driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		l = StringList{}
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*l = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	default:
+		return fmt.Errorf("unsupported StringList value %T", value)
+	}
+}
+
+// WebhookEndpoint is a client URL receiving email events
+// An empty EventTypes list subscribes to every event type.
+type WebhookEndpoint struct {
+	ID          uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	ClientID    uuid.UUID  `gorm:"type:uuid;not null;index" json:"client_id"`
+	URL         string     `gorm:"type:text;not null" json:"url"`
+	Description string     `gorm:"type:text" json:"description,omitempty"`
+	EventTypes  StringList `gorm:"type:jsonb;not null;default:'[]'" json:"event_types"`
+	Secret      string     `gorm:"type:varchar(100);not null" json:"-"` // only returned on create and rotation
+	Active      bool       `gorm:"not null;default:true" json:"active"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM
+func (WebhookEndpoint) TableName() string {
+	return "webhook_endpoints"
+}
+
+// Subscribes reports whether the endpoint receives events of eventType
+func (e *WebhookEndpoint) Subscribes(eventType string) bool {
+	if len(e.EventTypes) == 0 {
+		return true
+	}
+	for _, t := range e.EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event to deliver to one endpoint
+type WebhookDelivery struct {
+	ID                 uuid.UUID       `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	EndpointID         uuid.UUID       `gorm:"type:uuid;not null" json:"endpoint_id"`
+	ClientID           uuid.UUID       `gorm:"type:uuid;not null" json:"client_id"`
+	EventID            uuid.UUID       `gorm:"type:uuid;not null" json:"event_id"` // shared by the deliveries of one event
+	EventType          string          `gorm:"type:varchar(50);not null" json:"event_type"`
+	Payload            json.RawMessage `gorm:"type:jsonb;not null" json:"payload"`
+	Status             string          `gorm:"type:varchar(20);not null;default:'pending'" json:"status"` // pending, succeeded, failed
+	Attempts           int             `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt      *time.Time      `gorm:"type:timestamp" json:"next_attempt_at,omitempty"`
+	LastResponseStatus int             `gorm:"not null;default:0" json:"last_response_status,omitempty"`
+	LastError          string          `gorm:"type:text" json:"last_error,omitempty"`
+	DeliveredAt        *time.Time      `gorm:"type:timestamp" json:"delivered_at,omitempty"`
+	ReplayOf           *uuid.UUID      `gorm:"type:uuid" json:"replay_of,omitempty"` // delivery this one replays
+	CreatedAt          time.Time       `json:"created_at"`
+	UpdatedAt          time.Time       `json:"updated_at"`
+}
+
+// TableName specifies the table name for GORM
+func (WebhookDelivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// WebhookDeliveryAttempt is the outcome of one HTTP request of a delivery
+type WebhookDeliveryAttempt struct {
+	ID             uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey" json:"id"`
+	DeliveryID     uuid.UUID `gorm:"type:uuid;not null" json:"delivery_id"`
+	Attempt        int       `gorm:"not null" json:"attempt"`
+	URL            string    `gorm:"type:text;not null" json:"url"`
+	ResponseStatus int       `gorm:"not null;default:0" json:"response_status"` // 0 when no response was received
+	ResponseBody   string    `gorm:"type:text" json:"response_body,omitempty"`  // truncated
+	Error          string    `gorm:"type:text" json:"error,omitempty"`
+	DurationMs     int64     `gorm:"not null;default:0" json:"duration_ms"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// TableName specifies the table name for GORM
+func (WebhookDeliveryAttempt) TableName() string {
+	return "webhook_delivery_attempts"
+}
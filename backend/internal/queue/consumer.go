@@ -0,0 +1,504 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"backend/internal/email"
+	"backend/internal/models"
+	"backend/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/rs/zerolog"
+)
+
+// HandlerFunc processes the payload of one job type
+// EmailWorker.ProcessEmailJob satisfies this signature
+type HandlerFunc func(ctx context.Context, jobType string, payload []byte) error
+
+// ConsumerConfig controls concurrency and delivery guarantees of a Consumer
+type ConsumerConfig struct {
+	Concurrency       int           // number of parallel workers
+	VisibilityTimeout time.Duration // how long a claimed job stays invisible before it is reclaimed
+	PollInterval      time.Duration // sleep between claims when the queue is empty
+	MaxAttempts       int           // attempts before a failing job is given up
+	RetryDelay        time.Duration // delay before the second attempt, doubled for every further one
+	MaxRetryDelay     time.Duration // upper bound for a single retry delay
+}
+
+// DefaultConsumerConfig returns sensible defaults for production use
+func DefaultConsumerConfig() ConsumerConfig {
+	return ConsumerConfig{
+		Concurrency:       4,
+		VisibilityTimeout: 5 * time.Minute,
+		PollInterval:      500 * time.Millisecond,
+		MaxAttempts:       3,
+		RetryDelay:        email.DefaultRetryPolicy().BaseDelay,
+		MaxRetryDelay:     email.DefaultRetryPolicy().MaxDelay,
+	}
+}
+
+// claimScript queues the retries that are due (ARGV[2]), then atomically
+// moves the oldest job to the processing list and leases it
+var claimScript = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[4], '-inf', ARGV[2], 'LIMIT', 0, 100)
+for _, job in ipairs(due) do
+	redis.call('ZREM', KEYS[4], job)
+	redis.call('LPUSH', KEYS[1], job)
+end
+local raw = redis.call('RPOPLPUSH', KEYS[1], KEYS[2])
+if raw then
+	redis.call('ZADD', KEYS[3], ARGV[1], raw)
+end
+return raw
+`)
+
+// ackScript removes a finished job from the processing list and its lease
+var ackScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+return 1
+`)
+
+// requeueScript acknowledges a job and pushes its replacement onto KEYS[1]
+// (the dead-letter list)
+var requeueScript = redis.NewScript(`
+redis.call('LREM', KEYS[2], 1, ARGV[1])
+redis.call('ZREM', KEYS[3], ARGV[1])
+redis.call('LPUSH', KEYS[1], ARGV[2])
+return 1
+`)
+
+// retryScript acknowledges a job and schedules its replacement (ARGV[2]) in
+// the delayed set, due at ARGV[3]
+var retryScript = redis.NewScript(`
+redis.call('LREM', KEYS[1], 1, ARGV[1])
+redis.call('ZREM', KEYS[2], ARGV[1])
+redis.call('ZADD', KEYS[3], ARGV[3], ARGV[2])
+return 1
+`)
+
+// reclaimScript returns jobs whose lease expired (their worker died) to the queue
+var reclaimScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[3], '-inf', ARGV[1], 'LIMIT', 0, ARGV[2])
+local reclaimed = 0
+for _, raw in ipairs(expired) do
+	redis.call('ZREM', KEYS[3], raw)
+	if redis.call('LREM', KEYS[2], 1, raw) > 0 then
+		redis.call('RPUSH', KEYS[1], raw)
+		reclaimed = reclaimed + 1
+	end
+end
+return {reclaimed, #expired}
+`)
+
+// reclaimBatchSize limits how many expired leases one reclaim pass handles
+const reclaimBatchSize = 100
+
+// Consumer pops jobs from the Redis queue with at-least-once delivery.
+// Claimed jobs live in ProcessingQueueName with a lease in LeasesKey until they
+// are acknowledged; leases that expire are returned to the queue.
+type Consumer struct {
+	client     *redis.Client
+	config     ConsumerConfig
+	handlers   map[string]HandlerFunc
+	failedJobs repositories.FailedJobRepository
+	logger     zerolog.Logger
+	wg         sync.WaitGroup
+	cancel     context.CancelFunc
+}
+
+// NewConsumer creates a new queue consumer
+// Jobs that exhaust their retries are stored in failedJobs; when it is nil or the
+// insert fails they are moved to DeadLetterQueueName instead.
+func NewConsumer(client *redis.Client, config ConsumerConfig, failedJobs repositories.FailedJobRepository) *Consumer {
+	defaults := DefaultConsumerConfig()
+	if config.Concurrency <= 0 {
+		config.Concurrency = defaults.Concurrency
+	}
+	if config.VisibilityTimeout <= 0 {
+		config.VisibilityTimeout = defaults.VisibilityTimeout
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = defaults.RetryDelay
+	}
+	if config.MaxRetryDelay <= 0 {
+		config.MaxRetryDelay = defaults.MaxRetryDelay
+	}
+
+	return &Consumer{
+		client:     client,
+		config:     config,
+		handlers:   make(map[string]HandlerFunc),
+		failedJobs: failedJobs,
+		logger:     zerolog.New(os.Stdout).With().Timestamp().Logger(),
+	}
+}
+
+// jobIDKey is the context key of the ID of the job a handler is processing
+type jobIDKey struct{}
+
+// lastAttemptKey is the context key telling a handler whether a transient
+// failure of its job is retried
+type lastAttemptKey struct{}
+
+// JobID returns the ID of the job a handler is processing; it is the same on
+// every attempt of the job
+func JobID(ctx context.Context) string {
+	id, _ := ctx.Value(jobIDKey{}).(string)
+	return id
+}
+
+// LastAttempt reports whether a handler is making the last attempt of its job,
+// after which a failure is not retried
+// It is true outside of a Consumer.
+func LastAttempt(ctx context.Context) bool {
+	last, ok := ctx.Value(lastAttemptKey{}).(bool)
+	return last || !ok
+}
+
+// rawJobNamespace derives the IDs of entries pushed without an envelope
+var rawJobNamespace = uuid.MustParse("5b0e3f4c-6a0d-4c1e-9a57-2f1d8b6c9e41")
+
+// Handle registers the handler for a job type; it must be called before Start
+func (c *Consumer) Handle(jobType string, handler HandlerFunc) {
+	c.handlers[jobType] = handler
+}
+
+// Start launches the workers and the lease reclaimer
+func (c *Consumer) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	for i := 0; i < c.config.Concurrency; i++ {
+		c.wg.Add(1)
+		go c.worker(ctx, i)
+	}
+
+	c.wg.Add(1)
+	go c.reclaimer(ctx)
+}
+
+// Stop stops claiming new jobs and waits for in-flight jobs to finish
+func (c *Consumer) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+}
+
+// worker claims and processes jobs until ctx is cancelled
+func (c *Consumer) worker(ctx context.Context, id int) {
+	defer c.wg.Done()
+
+	for ctx.Err() == nil {
+		raw, err := c.claim(ctx)
+		if err != nil {
+			if !errors.Is(err, redis.Nil) && ctx.Err() == nil {
+				c.logger.Error().
+					Err(err).
+					Str("event", "queue.claim.failed").
+					Int("worker", id).
+					Msg("Failed to claim job")
+			}
+			// Queue empty or Redis unavailable: wait before polling again
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.config.PollInterval):
+			}
+			continue
+		}
+
+		// In-flight jobs run to completion even if the consumer is stopping
+		c.process(context.WithoutCancel(ctx), raw)
+	}
+}
+
+// claim moves the next job into the processing list and returns its raw value
+func (c *Consumer) claim(ctx context.Context) (string, error) {
+	return c.claimAt(ctx, time.Now())
+}
+
+// claimAt claims the next job as of now, queueing the retries due by then first
+func (c *Consumer) claimAt(ctx context.Context, now time.Time) (string, error) {
+	deadline := now.Add(c.config.VisibilityTimeout).UnixMilli()
+	return claimScript.Run(ctx, c.client, []string{QueueName, ProcessingQueueName, LeasesKey, DelayedKey}, deadline, now.UnixMilli()).Text()
+}
+
+// process runs the handler for one claimed job and settles it
+func (c *Consumer) process(ctx context.Context, raw string) {
+	var job Job
+	if err := json.Unmarshal([]byte(raw), &job); err != nil {
+		c.logger.Error().
+			Err(err).
+			Str("event", "queue.job.invalid").
+			Msg("Dead-lettering job with invalid envelope")
+		c.moveToDeadLetter(ctx, raw, raw)
+		return
+	}
+	// Entries pushed by hand (e.g. runbook scripts) are send_email payloads
+	// without an envelope
+	if len(job.Payload) == 0 && job.Type == "" {
+		job.Type = JobTypeSendEmail
+		job.Payload = json.RawMessage(raw)
+	}
+	// Retries keep the ID given here, as they are stored with an envelope;
+	// deriving it from the entry keeps it when the entry is reclaimed
+	if job.ID == "" {
+		job.ID = uuid.NewSHA1(rawJobNamespace, []byte(raw)).String()
+	}
+
+	// Jobs nobody can process are dead-lettered rather than dropped, so they
+	// can be inspected and requeued once a handler exists
+	handler, ok := c.handlers[job.Type]
+	if !ok {
+		c.logger.Error().
+			Str("event", "queue.job.unhandled").
+			Str("job_id", job.ID).
+			Str("job_type", job.Type).
+			Msg("No handler registered for job type, dead-lettering job")
+		c.deadLetter(ctx, raw, job, fmt.Errorf("no handler registered for job type %q", job.Type))
+		return
+	}
+
+	// Keep the lease alive while the handler runs
+	stopHeartbeat := c.heartbeat(ctx, raw)
+	handlerCtx := context.WithValue(ctx, jobIDKey{}, job.ID)
+	handlerCtx = context.WithValue(handlerCtx, lastAttemptKey{}, job.Attempts+1 >= c.config.MaxAttempts)
+	err := c.run(handlerCtx, handler, job)
+	stopHeartbeat()
+
+	if err == nil {
+		c.ack(ctx, raw)
+		return
+	}
+
+	// Failures are classified like those of the in-process queue: only
+	// transient ones (4xx replies, network errors) are retried
+	job.Attempts++
+	if !email.IsTransient(err) {
+		c.logger.Error().
+			Err(err).
+			Str("event", "queue.job.permanent_failure").
+			Str("job_id", job.ID).
+			Str("job_type", job.Type).
+			Int("attempts", job.Attempts).
+			Msg("Job failed permanently")
+		c.deadLetter(ctx, raw, job, err)
+		return
+	}
+	if job.Attempts >= c.config.MaxAttempts {
+		c.logger.Error().
+			Err(err).
+			Str("event", "queue.job.exhausted").
+			Str("job_id", job.ID).
+			Str("job_type", job.Type).
+			Int("attempts", job.Attempts).
+			Msg("Job failed and exhausted its retries")
+		c.deadLetter(ctx, raw, job, err)
+		return
+	}
+
+	delay := c.retryPolicy().Backoff(job.Attempts)
+	c.logger.Warn().
+		Err(err).
+		Str("event", "queue.job.retry").
+		Str("job_id", job.ID).
+		Str("job_type", job.Type).
+		Int("attempts", job.Attempts).
+		Dur("retry_in", delay).
+		Msg("Job failed, retrying later")
+	c.retry(ctx, raw, job, time.Now().Add(delay))
+}
+
+// run calls the handler of a job, returning a panic as an error so that the
+// job is dead-lettered instead of the worker dying
+func (c *Consumer) run(ctx context.Context, handler HandlerFunc, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.logger.Error().
+				Str("event", "queue.job.panic").
+				Str("job_id", job.ID).
+				Str("job_type", job.Type).
+				Interface("panic", r).
+				Str("stack", string(debug.Stack())).
+				Msg("Job handler panicked")
+			err = fmt.Errorf("job handler panicked: %v", r)
+		}
+	}()
+	return handler(ctx, job.Type, job.Payload)
+}
+
+// retryPolicy returns the backoff of failed jobs
+func (c *Consumer) retryPolicy() email.RetryPolicy {
+	return email.RetryPolicy{
+		MaxAttempts: c.config.MaxAttempts,
+		BaseDelay:   c.config.RetryDelay,
+		MaxDelay:    c.config.MaxRetryDelay,
+	}
+}
+
+// heartbeat periodically extends the lease of raw until the returned func is called
+func (c *Consumer) heartbeat(ctx context.Context, raw string) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(c.config.VisibilityTimeout / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				deadline := time.Now().Add(c.config.VisibilityTimeout).UnixMilli()
+				// XX: only refresh leases that still exist
+				c.client.ZAddXX(ctx, LeasesKey, redis.Z{Score: float64(deadline), Member: raw})
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// ack removes a settled job from the processing list
+func (c *Consumer) ack(ctx context.Context, raw string) {
+	if err := ackScript.Run(ctx, c.client, []string{ProcessingQueueName, LeasesKey}, raw).Err(); err != nil {
+		c.logger.Error().
+			Err(err).
+			Str("event", "queue.ack.failed").
+			Msg("Failed to acknowledge job; it will be redelivered after the visibility timeout")
+	}
+}
+
+// retry replaces a failed job with an updated copy that is queued again at due
+func (c *Consumer) retry(ctx context.Context, raw string, job Job, due time.Time) {
+	updated, err := json.Marshal(job)
+	if err != nil {
+		c.logger.Error().
+			Err(err).
+			Str("event", "queue.requeue.failed").
+			Str("job_id", job.ID).
+			Msg("Failed to marshal job for requeue")
+		return
+	}
+	if err := retryScript.Run(ctx, c.client, []string{ProcessingQueueName, LeasesKey, DelayedKey}, raw, string(updated), due.UnixMilli()).Err(); err != nil {
+		c.logger.Error().
+			Err(err).
+			Str("event", "queue.requeue.failed").
+			Str("job_id", job.ID).
+			Msg("Failed to requeue job; it will be redelivered after the visibility timeout")
+	}
+}
+
+// deadLetter stores an exhausted job in failed_jobs and removes it from the queue
+func (c *Consumer) deadLetter(ctx context.Context, raw string, job Job, jobErr error) {
+	if c.failedJobs != nil {
+		failed := &models.FailedJob{
+			Queue:        models.FailedJobQueueRedis,
+			JobType:      job.Type,
+			Payload:      job.Payload,
+			ErrorMessage: jobErr.Error(),
+			Attempts:     job.Attempts,
+			CampaignID:   campaignIDFromPayload(job.Payload),
+		}
+		err := c.failedJobs.Create(ctx, failed)
+		if err == nil {
+			c.ack(ctx, raw)
+			return
+		}
+		c.logger.Error().
+			Err(err).
+			Str("event", "queue.dead_letter.store_failed").
+			Str("job_id", job.ID).
+			Msg("Failed to store failed job, moving it to the dead-letter list")
+	}
+
+	updated, err := json.Marshal(job)
+	if err != nil {
+		updated = []byte(raw)
+	}
+	c.moveToDeadLetter(ctx, raw, string(updated))
+}
+
+// moveToDeadLetter replaces raw with entry on the Redis dead-letter list
+func (c *Consumer) moveToDeadLetter(ctx context.Context, raw, entry string) {
+	if err := requeueScript.Run(ctx, c.client, []string{DeadLetterQueueName, ProcessingQueueName, LeasesKey}, raw, entry).Err(); err != nil {
+		c.logger.Error().
+			Err(err).
+			Str("event", "queue.dead_letter.failed").
+			Msg("Failed to dead-letter job; it will be redelivered after the visibility timeout")
+	}
+}
+
+// campaignIDFromPayload extracts an optional campaign_id field from a job payload
+func campaignIDFromPayload(payload json.RawMessage) *uuid.UUID {
+	var linked struct {
+		CampaignID string `json:"campaign_id"`
+	}
+	if err := json.Unmarshal(payload, &linked); err != nil || linked.CampaignID == "" {
+		return nil
+	}
+	id, err := uuid.Parse(linked.CampaignID)
+	if err != nil {
+		return nil
+	}
+	return &id
+}
+
+// reclaimer periodically returns jobs with expired leases to the queue
+func (c *Consumer) reclaimer(ctx context.Context) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.config.VisibilityTimeout / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Reclaim(ctx, time.Now()); err != nil && ctx.Err() == nil {
+				c.logger.Error().
+					Err(err).
+					Str("event", "queue.reclaim.failed").
+					Msg("Failed to reclaim expired jobs")
+			}
+		}
+	}
+}
+
+// Reclaim returns every job whose lease expired before now to the queue
+func (c *Consumer) Reclaim(ctx context.Context, now time.Time) (int, error) {
+	total := 0
+	for {
+		counts, err := reclaimScript.Run(ctx, c.client, []string{QueueName, ProcessingQueueName, LeasesKey},
+			strconv.FormatInt(now.UnixMilli(), 10), reclaimBatchSize).Int64Slice()
+		if err != nil {
+			return total, fmt.Errorf("failed to reclaim jobs: %w", err)
+		}
+		// counts = {reclaimed, expired leases examined}
+		total += int(counts[0])
+		if counts[1] < reclaimBatchSize {
+			break
+		}
+	}
+
+	if total > 0 {
+		c.logger.Warn().
+			Str("event", "queue.reclaim").
+			Int("count", total).
+			Msg("Reclaimed jobs with expired leases")
+	}
+	return total, nil
+}
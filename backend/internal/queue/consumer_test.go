@@ -0,0 +1,401 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/email"
+	"backend/internal/models"
+	"backend/internal/repositories"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeFailedJobRepository records failed jobs in memory
+type fakeFailedJobRepository struct {
+	jobs      []models.FailedJob
+	createErr error
+}
+
+func (r *fakeFailedJobRepository) Create(ctx context.Context, job *models.FailedJob) error {
+	if r.createErr != nil {
+		return r.createErr
+	}
+	r.jobs = append(r.jobs, *job)
+	return nil
+}
+
+func (r *fakeFailedJobRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.FailedJob, error) {
+	return nil, repositories.ErrFailedJobNotFound
+}
+
+func (r *fakeFailedJobRepository) List(ctx context.Context, filter repositories.FailedJobFilter) ([]models.FailedJob, int64, error) {
+	return r.jobs, int64(len(r.jobs)), nil
+}
+
+func (r *fakeFailedJobRepository) ClaimRetry(ctx context.Context, id uuid.UUID, previous *time.Time, retriedAt time.Time) (bool, error) {
+	return true, nil
+}
+
+func (r *fakeFailedJobRepository) ReleaseRetry(ctx context.Context, id uuid.UUID, retriedAt time.Time, previous *time.Time) error {
+	return nil
+}
+
+func (r *fakeFailedJobRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	return nil
+}
+
+func (r *fakeFailedJobRepository) Purge(ctx context.Context, filter repositories.FailedJobPurgeFilter) (int64, error) {
+	return 0, nil
+}
+
+// newTestConsumer starts a miniredis server and points the package-level queue at it
+func newTestConsumer(t *testing.T, config ConsumerConfig, failedJobs repositories.FailedJobRepository) (*Consumer, *miniredis.Miniredis) {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	previous := Queue
+	Queue = client
+	t.Cleanup(func() { Queue = previous })
+
+	return NewConsumer(client, config, failedJobs), mr
+}
+
+func TestConsumerProcessesJobsInOrderAndAcks(t *testing.T) {
+	consumer, mr := newTestConsumer(t, ConsumerConfig{Concurrency: 1, PollInterval: 10 * time.Millisecond}, nil)
+
+	var mu sync.Mutex
+	var received []string
+	done := make(chan struct{})
+	consumer.Handle(JobTypeSendEmail, func(ctx context.Context, jobType string, payload []byte) error {
+		var p EmailJobPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+		mu.Lock()
+		received = append(received, p.Email)
+		if len(received) == 2 {
+			close(done)
+		}
+		mu.Unlock()
+		return nil
+	})
+
+	for _, to := range []string{"first@example.com", "second@example.com"} {
+		if err := EnqueueJob(JobTypeSendEmail, EmailJobPayload{Email: to}); err != nil {
+			t.Fatalf("EnqueueJob failed: %v", err)
+		}
+	}
+
+	consumer.Start(context.Background())
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for jobs")
+	}
+	consumer.Stop()
+
+	if received[0] != "first@example.com" || received[1] != "second@example.com" {
+		t.Errorf("expected FIFO order, got %v", received)
+	}
+	if mr.Exists(ProcessingQueueName) {
+		t.Error("expected processing list to be empty after ack")
+	}
+	if mr.Exists(LeasesKey) {
+		t.Error("expected no leases after ack")
+	}
+}
+
+func TestConsumerRequeuesUntilExhausted(t *testing.T) {
+	failedJobs := &fakeFailedJobRepository{}
+	consumer, mr := newTestConsumer(t, ConsumerConfig{MaxAttempts: 3}, failedJobs)
+	ctx := context.Background()
+
+	calls := 0
+	consumer.Handle(JobTypeSendEmail, func(ctx context.Context, jobType string, payload []byte) error {
+		calls++
+		return &email.SMTPError{Op: email.SMTPOpConnect, Code: 421, Message: "smtp unavailable"}
+	})
+
+	campaignID := uuid.New()
+	payload := map[string]string{"email": "user@example.com", "campaign_id": campaignID.String()}
+	if err := EnqueueJob(JobTypeSendEmail, payload); err != nil {
+		t.Fatalf("EnqueueJob failed: %v", err)
+	}
+
+	// Drive the consumer synchronously: each failure schedules a retry with one more attempt
+	now := time.Now()
+	for i := 1; i <= 3; i++ {
+		raw, err := consumer.claimAt(ctx, now)
+		if err != nil {
+			t.Fatalf("claim %d failed: %v", i, err)
+		}
+		consumer.process(ctx, raw)
+
+		if i < 3 {
+			if mr.Exists(QueueName) {
+				t.Fatalf("expected the retry of attempt %d to wait for its backoff", i)
+			}
+			delayed, _ := mr.ZMembers(DelayedKey)
+			if len(delayed) != 1 {
+				t.Fatalf("expected job to be scheduled after attempt %d, delayed set has %d items", i, len(delayed))
+			}
+			var job Job
+			if err := json.Unmarshal([]byte(delayed[0]), &job); err != nil {
+				t.Fatalf("failed to decode retried job: %v", err)
+			}
+			if job.Attempts != i {
+				t.Errorf("expected attempts %d, got %d", i, job.Attempts)
+			}
+			if _, err := consumer.claimAt(ctx, time.Now()); !errors.Is(err, redis.Nil) {
+				t.Fatalf("expected no job before the retry is due, got %v", err)
+			}
+			now = time.Now().Add(time.Hour)
+		}
+	}
+
+	if calls != 3 {
+		t.Errorf("expected 3 handler calls, got %d", calls)
+	}
+	if mr.Exists(QueueName) || mr.Exists(ProcessingQueueName) || mr.Exists(DelayedKey) {
+		t.Error("expected exhausted job to be removed from the queue")
+	}
+
+	if len(failedJobs.jobs) != 1 {
+		t.Fatalf("expected 1 failed job, got %d", len(failedJobs.jobs))
+	}
+	failed := failedJobs.jobs[0]
+	if failed.Queue != models.FailedJobQueueRedis || failed.JobType != JobTypeSendEmail {
+		t.Errorf("unexpected failed job origin: %s/%s", failed.Queue, failed.JobType)
+	}
+	if failed.Attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", failed.Attempts)
+	}
+	if !strings.Contains(failed.ErrorMessage, "smtp unavailable") {
+		t.Errorf("unexpected error message: %s", failed.ErrorMessage)
+	}
+	if failed.CampaignID == nil || *failed.CampaignID != campaignID {
+		t.Errorf("expected campaign_id %s, got %v", campaignID, failed.CampaignID)
+	}
+}
+
+func TestConsumerDeadLettersPermanentFailures(t *testing.T) {
+	failedJobs := &fakeFailedJobRepository{}
+	consumer, mr := newTestConsumer(t, ConsumerConfig{MaxAttempts: 3}, failedJobs)
+	ctx := context.Background()
+
+	consumer.Handle(JobTypeSendEmail, func(ctx context.Context, jobType string, payload []byte) error {
+		return &email.SMTPError{Op: email.SMTPOpRcpt, Code: 550, Message: "mailbox unavailable"}
+	})
+
+	if err := EnqueueJob(JobTypeSendEmail, EmailJobPayload{Email: "user@example.com"}); err != nil {
+		t.Fatalf("EnqueueJob failed: %v", err)
+	}
+	raw, err := consumer.claim(ctx)
+	if err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	consumer.process(ctx, raw)
+
+	if mr.Exists(QueueName) || mr.Exists(DelayedKey) || mr.Exists(ProcessingQueueName) {
+		t.Error("expected a permanent failure not to be retried")
+	}
+	if len(failedJobs.jobs) != 1 || failedJobs.jobs[0].Attempts != 1 {
+		t.Fatalf("expected 1 failed job after 1 attempt, got %+v", failedJobs.jobs)
+	}
+}
+
+func TestConsumerDeadLettersJobsWhoseHandlerPanics(t *testing.T) {
+	failedJobs := &fakeFailedJobRepository{}
+	consumer, mr := newTestConsumer(t, ConsumerConfig{MaxAttempts: 3}, failedJobs)
+	ctx := context.Background()
+
+	consumer.Handle(JobTypeSendEmail, func(ctx context.Context, jobType string, payload []byte) error {
+		panic("nil template")
+	})
+
+	if err := EnqueueJob(JobTypeSendEmail, EmailJobPayload{Email: "user@example.com"}); err != nil {
+		t.Fatalf("EnqueueJob failed: %v", err)
+	}
+	raw, err := consumer.claim(ctx)
+	if err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	consumer.process(ctx, raw)
+
+	if mr.Exists(QueueName) || mr.Exists(DelayedKey) || mr.Exists(ProcessingQueueName) {
+		t.Error("expected the job to leave the queue")
+	}
+	if len(failedJobs.jobs) != 1 || !strings.Contains(failedJobs.jobs[0].ErrorMessage, "nil template") {
+		t.Fatalf("expected the panic to be stored as a failed job, got %+v", failedJobs.jobs)
+	}
+}
+
+func TestConsumerFallsBackToDeadLetterList(t *testing.T) {
+	failedJobs := &fakeFailedJobRepository{createErr: errors.New("database unavailable")}
+	consumer, mr := newTestConsumer(t, ConsumerConfig{MaxAttempts: 1}, failedJobs)
+	ctx := context.Background()
+
+	consumer.Handle(JobTypeSendEmail, func(ctx context.Context, jobType string, payload []byte) error {
+		return errors.New("smtp unavailable")
+	})
+
+	if err := EnqueueJob(JobTypeSendEmail, EmailJobPayload{Email: "user@example.com"}); err != nil {
+		t.Fatalf("EnqueueJob failed: %v", err)
+	}
+	raw, err := consumer.claim(ctx)
+	if err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	consumer.process(ctx, raw)
+
+	dead, _ := mr.List(DeadLetterQueueName)
+	if len(dead) != 1 {
+		t.Fatalf("expected 1 dead-lettered job, got %d", len(dead))
+	}
+	if mr.Exists(QueueName) || mr.Exists(ProcessingQueueName) || mr.Exists(LeasesKey) {
+		t.Error("expected dead-lettered job to be removed from the queue")
+	}
+}
+
+func TestConsumerReclaimsExpiredLeases(t *testing.T) {
+	consumer, mr := newTestConsumer(t, ConsumerConfig{VisibilityTimeout: time.Minute}, nil)
+	ctx := context.Background()
+
+	if err := EnqueueJob(JobTypeSendEmail, EmailJobPayload{Email: "user@example.com"}); err != nil {
+		t.Fatalf("EnqueueJob failed: %v", err)
+	}
+
+	// Simulate a worker that claimed the job and then died
+	if _, err := consumer.claim(ctx); err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+
+	reclaimed, err := consumer.Reclaim(ctx, time.Now())
+	if err != nil {
+		t.Fatalf("Reclaim failed: %v", err)
+	}
+	if reclaimed != 0 {
+		t.Errorf("expected live lease not to be reclaimed, got %d", reclaimed)
+	}
+
+	reclaimed, err = consumer.Reclaim(ctx, time.Now().Add(2*time.Minute))
+	if err != nil {
+		t.Fatalf("Reclaim failed: %v", err)
+	}
+	if reclaimed != 1 {
+		t.Errorf("expected 1 reclaimed job, got %d", reclaimed)
+	}
+
+	items, _ := mr.List(QueueName)
+	if len(items) != 1 {
+		t.Errorf("expected job back on the queue, got %d items", len(items))
+	}
+	if mr.Exists(ProcessingQueueName) || mr.Exists(LeasesKey) {
+		t.Error("expected processing list and leases to be empty after reclaim")
+	}
+}
+
+func TestConsumerDeadLettersUnhandledJobTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		jobType string
+	}{
+		{"unknown type", `{"id":"1","type":"unknown","payload":{}}`, "unknown"},
+		{"envelope without type", `{"id":"1","payload":{}}`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failedJobs := &fakeFailedJobRepository{}
+			consumer, mr := newTestConsumer(t, ConsumerConfig{}, failedJobs)
+			ctx := context.Background()
+
+			if _, err := mr.Lpush(QueueName, tt.raw); err != nil {
+				t.Fatalf("Lpush failed: %v", err)
+			}
+
+			raw, err := consumer.claim(ctx)
+			if err != nil {
+				t.Fatalf("claim failed: %v", err)
+			}
+			consumer.process(ctx, raw)
+
+			if mr.Exists(QueueName) || mr.Exists(ProcessingQueueName) || mr.Exists(LeasesKey) {
+				t.Error("expected unhandled job to be removed from the queue")
+			}
+			if len(failedJobs.jobs) != 1 {
+				t.Fatalf("expected 1 failed job, got %d", len(failedJobs.jobs))
+			}
+			if failedJobs.jobs[0].JobType != tt.jobType {
+				t.Errorf("expected job type %q, got %q", tt.jobType, failedJobs.jobs[0].JobType)
+			}
+		})
+	}
+}
+
+func TestConsumerDeadLettersUnhandledJobsWithoutStore(t *testing.T) {
+	consumer, mr := newTestConsumer(t, ConsumerConfig{}, nil)
+	ctx := context.Background()
+
+	if _, err := mr.Lpush(QueueName, `{"id":"1","type":"unknown","payload":{}}`); err != nil {
+		t.Fatalf("Lpush failed: %v", err)
+	}
+
+	raw, err := consumer.claim(ctx)
+	if err != nil {
+		t.Fatalf("claim failed: %v", err)
+	}
+	consumer.process(ctx, raw)
+
+	dead, _ := mr.List(DeadLetterQueueName)
+	if len(dead) != 1 {
+		t.Errorf("expected unhandled job on the dead-letter list, got %d items", len(dead))
+	}
+}
+
+func TestConsumerHandlesEntriesWithoutEnvelopeAsSendEmail(t *testing.T) {
+	consumer, mr := newTestConsumer(t, ConsumerConfig{}, nil)
+	ctx := context.Background()
+
+	var received EmailJobPayload
+	var jobIDs []string
+	consumer.Handle(JobTypeSendEmail, func(ctx context.Context, jobType string, payload []byte) error {
+		jobIDs = append(jobIDs, JobID(ctx))
+		return json.Unmarshal(payload, &received)
+	})
+
+	// The same entry, e.g. delivered again after its lease expired, keeps its ID
+	entry := `{"email":"user@example.com","subject":"Hi","html":"<p>Hi</p>"}`
+	for i := 0; i < 2; i++ {
+		if _, err := mr.Lpush(QueueName, entry); err != nil {
+			t.Fatalf("Lpush failed: %v", err)
+		}
+		raw, err := consumer.claim(ctx)
+		if err != nil {
+			t.Fatalf("claim failed: %v", err)
+		}
+		consumer.process(ctx, raw)
+	}
+
+	if received.Email != "user@example.com" || received.Subject != "Hi" {
+		t.Errorf("unexpected payload: %+v", received)
+	}
+	if len(jobIDs) != 2 || jobIDs[0] == "" || jobIDs[0] != jobIDs[1] {
+		t.Errorf("expected the same job ID for both deliveries, got %v", jobIDs)
+	}
+	if mr.Exists(ProcessingQueueName) || mr.Exists(DeadLetterQueueName) {
+		t.Error("expected the entry to be acknowledged")
+	}
+}
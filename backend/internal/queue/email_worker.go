@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	netmail "net/mail"
 	"os"
+	"strings"
 	"time"
 
-	"backend/internal/config"
-	"backend/internal/mail"
+	"backend/internal/email"
 	"backend/internal/metrics"
 	"backend/internal/models"
 	"backend/internal/repositories"
@@ -19,37 +20,41 @@ import (
 
 // EmailWorker processes email jobs from the queue
 type EmailWorker struct {
-	smtpSender mail.SMTPSender
-	emailRepo  repositories.EmailRepository
-	logger     zerolog.Logger
+	sender    email.EmailSender
+	fromEmail string
+	from      string
+	emailRepo repositories.EmailRepository
+	logger    zerolog.Logger
 }
 
-// NewEmailWorker creates a new email worker
-func NewEmailWorker() (*EmailWorker, error) {
-	// Load SMTP config
-	smtpConfig, err := config.LoadSMTPConfig()
-	if err != nil {
-		return nil, fmt.Errorf("failed to load SMTP config: %w", err)
+// NewEmailWorker creates a new email worker sending through sender, the
+// EMAIL_SENDER backend shared with the in-process queue, from fromEmail
+func NewEmailWorker(sender email.EmailSender, fromEmail, fromName string) (*EmailWorker, error) {
+	if fromEmail == "" {
+		return nil, fmt.Errorf("MAIL_FROM_ADDRESS is required")
 	}
 
-	// Create SMTP sender
-	sender := mail.NewSMTPSender(smtpConfig)
-
 	// Create email repository
 	emailRepo := repositories.NewEmailRepository()
 
 	return &EmailWorker{
-		smtpSender: sender,
-		emailRepo:  emailRepo,
-		logger:     zerolog.New(os.Stdout).With().Timestamp().Logger(),
+		sender:    sender,
+		fromEmail: fromEmail,
+		from:      (&netmail.Address{Name: fromName, Address: fromEmail}).String(),
+		emailRepo: emailRepo,
+		logger:    zerolog.New(os.Stdout).With().Timestamp().Logger(),
 	}, nil
 }
 
 // EmailJobPayload represents the payload for send_email job
 type EmailJobPayload struct {
-	Email   string `json:"email"`
-	Subject string `json:"subject"`
-	HTML    string `json:"html"`
+	Email      string     `json:"email"`
+	Subject    string     `json:"subject"`
+	HTML       string     `json:"html"`
+	CampaignID *uuid.UUID `json:"campaign_id,omitempty"`
+	ContactID  *uuid.UUID `json:"contact_id,omitempty"`
+	ClientID   *uuid.UUID `json:"client_id,omitempty"`
+	InlineCSS  bool       `json:"inline_css,omitempty"` // inline <style> rules of html into style attributes
 }
 
 // ProcessEmailJob processes an email job
@@ -75,14 +80,25 @@ func (w *EmailWorker) ProcessEmailJob(ctx context.Context, jobType string, paylo
 		return fmt.Errorf("html body is required")
 	}
 
-	// Get SMTP config for from_email
-	smtpConfig, err := config.LoadSMTPConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load SMTP config: %w", err)
+	// Every attempt of a job sends the same Message-ID and updates the same
+	// email record
+	messageID := jobMessageID(JobID(ctx), w.fromEmail)
+	record := w.emailRecord(ctx, messageID, &jobPayload)
+
+	// Send email through the configured backend
+	msg := email.EmailMessage{
+		From:     w.from,
+		To:       jobPayload.Email,
+		Subject:  jobPayload.Subject,
+		HTMLBody: email.PrepareHTML(jobPayload.HTML, messageID, jobPayload.InlineCSS),
+		Headers: map[string]string{
+			"Message-ID": messageID,
+		},
+		CampaignID: jobPayload.CampaignID,
+		ContactID:  jobPayload.ContactID,
+		ClientID:   jobPayload.ClientID,
 	}
-
-	// Send email via SMTP
-	messageID, err := w.smtpSender.Send(jobPayload.Email, jobPayload.Subject, jobPayload.HTML)
+	result, err := email.SendWithResult(ctx, w.sender, msg)
 	if err != nil {
 		w.logger.Error().
 			Err(err).
@@ -91,28 +107,24 @@ func (w *EmailWorker) ProcessEmailJob(ctx context.Context, jobType string, paylo
 			Str("subject", jobPayload.Subject).
 			Msg("Failed to send email")
 
-		// Try to save failed email record
-		w.saveEmailRecord(ctx, messageID, smtpConfig.FromEmail, jobPayload.Email, jobPayload.Subject, "failed")
-		// Update metrics
-		metrics.GetMetrics().IncrementEmailFailed()
+		// A failure the consumer retries leaves the email queued
+		if !email.IsTransient(err) || LastAttempt(ctx) {
+			w.updateEmailRecord(ctx, record, "failed", nil)
+			// Update metrics
+			metrics.GetMetrics().IncrementEmailFailed()
+		}
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
-	// Save email record with status "sent"
-	if err := w.saveEmailRecord(ctx, messageID, smtpConfig.FromEmail, jobPayload.Email, jobPayload.Subject, "sent"); err != nil {
-		w.logger.Error().
-			Err(err).
-			Str("event", "email.save.failed").
-			Str("message_id", messageID).
-			Msg("Failed to save email record")
-		// Don't return error - email was sent successfully
-	}
+	// Record the sent email; it was sent even if this fails
+	w.updateEmailRecord(ctx, record, "sent", result)
 
 	w.logger.Info().
 		Str("event", "email.send.success").
 		Str("message_id", messageID).
 		Str("to", jobPayload.Email).
 		Str("subject", jobPayload.Subject).
+		Str("provider", result.Provider).
 		Msg("Email sent and saved successfully")
 
 	// Update metrics
@@ -121,18 +133,65 @@ func (w *EmailWorker) ProcessEmailJob(ctx context.Context, jobType string, paylo
 	return nil
 }
 
-// saveEmailRecord saves email record to database
-func (w *EmailWorker) saveEmailRecord(ctx context.Context, messageID, fromEmail, toEmail, subject, status string) error {
-	emailRecord := models.EmailMessageRecord{
-		ID:        uuid.New(),
-		MessageID: messageID,
-		From:      fromEmail,
-		To:        toEmail,
-		Subject:   subject,
-		Status:    status,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+// jobMessageID returns the Message-ID of the email of a job, derived from the
+// job ID so that retries reuse it
+func jobMessageID(jobID, fromEmail string) string {
+	messageID := email.NewMessageID(fromEmail)
+	if jobID == "" {
+		return messageID
 	}
+	return "<" + jobID + messageID[strings.IndexByte(messageID, '@'):]
+}
 
-	return w.emailRepo.CreateEmailMessage(ctx, emailRecord)
+// emailRecord returns the email record of messageID, created as queued on the
+// first attempt of a job
+// It returns nil when the record can neither be loaded nor created; the
+// email is still sent.
+func (w *EmailWorker) emailRecord(ctx context.Context, messageID string, job *EmailJobPayload) *models.EmailMessageRecord {
+	if record, err := w.emailRepo.GetEmailByMessageID(ctx, messageID); err == nil && record != nil {
+		return record
+	}
+
+	now := time.Now()
+	record := &models.EmailMessageRecord{
+		ID:         uuid.New(),
+		MessageID:  messageID,
+		From:       w.fromEmail,
+		To:         job.Email,
+		Subject:    job.Subject,
+		Status:     "queued",
+		CampaignID: job.CampaignID,
+		ContactID:  job.ContactID,
+		ClientID:   job.ClientID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := w.emailRepo.CreateEmailMessage(ctx, *record); err != nil {
+		w.logger.Error().
+			Err(err).
+			Str("event", "email.save.failed").
+			Str("message_id", messageID).
+			Msg("Failed to save email record")
+		return nil
+	}
+	return record
+}
+
+// updateEmailRecord sets the status of the email record of an attempt
+// result, when not nil, records the provider that accepted the email.
+func (w *EmailWorker) updateEmailRecord(ctx context.Context, record *models.EmailMessageRecord, status string, result *email.SendResult) {
+	if record == nil {
+		return
+	}
+	err := w.emailRepo.UpdateEmailStatus(ctx, record.ID, status)
+	if err == nil && result != nil {
+		err = w.emailRepo.SetProvider(ctx, record.ID, result.Provider, result.ProviderMessageID)
+	}
+	if err != nil {
+		w.logger.Error().
+			Err(err).
+			Str("event", "email.save.failed").
+			Str("message_id", record.MessageID).
+			Msg("Failed to update email record")
+	}
 }
@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"backend/internal/email"
+	"backend/internal/models"
+	"backend/internal/repositories"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// fakeEmailRepository keeps email records in memory
+type fakeEmailRepository struct {
+	repositories.EmailRepository
+	records map[uuid.UUID]*models.EmailMessageRecord
+	created int
+}
+
+func (r *fakeEmailRepository) CreateEmailMessage(ctx context.Context, msg models.EmailMessageRecord) error {
+	r.created++
+	r.records[msg.ID] = &msg
+	return nil
+}
+
+func (r *fakeEmailRepository) UpdateEmailStatus(ctx context.Context, id uuid.UUID, status string) error {
+	record, ok := r.records[id]
+	if !ok {
+		return errors.New("email message not found")
+	}
+	record.Status = status
+	return nil
+}
+
+func (r *fakeEmailRepository) SetProvider(ctx context.Context, id uuid.UUID, provider, providerMessageID string) error {
+	r.records[id].Provider = provider
+	return nil
+}
+
+func (r *fakeEmailRepository) GetEmailByMessageID(ctx context.Context, messageID string) (*models.EmailMessageRecord, error) {
+	for _, record := range r.records {
+		if record.MessageID == messageID {
+			return record, nil
+		}
+	}
+	return nil, errors.New("email message not found")
+}
+
+// flakySender fails its first failures sends with a transient error
+type flakySender struct {
+	failures   int
+	messageIDs []string
+	htmlBodies []string
+}
+
+func (s *flakySender) SendEmail(ctx context.Context, msg email.EmailMessage) error {
+	s.messageIDs = append(s.messageIDs, msg.Headers["Message-ID"])
+	s.htmlBodies = append(s.htmlBodies, msg.HTMLBody)
+	if len(s.messageIDs) <= s.failures {
+		return &email.SMTPError{Op: email.SMTPOpConnect, Code: 421, Message: "try again later"}
+	}
+	return nil
+}
+
+// newTestEmailWorker creates a worker sending through sender from news@example.com
+func newTestEmailWorker(sender email.EmailSender, repo *fakeEmailRepository) *EmailWorker {
+	return &EmailWorker{
+		sender:    sender,
+		fromEmail: "news@example.com",
+		from:      "news@example.com",
+		emailRepo: repo,
+		logger:    zerolog.Nop(),
+	}
+}
+
+func TestEmailWorkerKeepsOneRecordAcrossAttempts(t *testing.T) {
+	repo := &fakeEmailRepository{records: map[uuid.UUID]*models.EmailMessageRecord{}}
+	sender := &flakySender{failures: 1}
+	worker := newTestEmailWorker(sender, repo)
+	ctx := context.WithValue(context.Background(), jobIDKey{}, "job-1")
+	payload := []byte(`{"email":"a@example.com","subject":"Hi","html":"<p>Hi</p>"}`)
+
+	if err := worker.ProcessEmailJob(ctx, JobTypeSendEmail, payload); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	if err := worker.ProcessEmailJob(ctx, JobTypeSendEmail, payload); err != nil {
+		t.Fatalf("second attempt: %v", err)
+	}
+
+	if repo.created != 1 || len(repo.records) != 1 {
+		t.Fatalf("expected one email record, created %d", repo.created)
+	}
+	for _, record := range repo.records {
+		if record.Status != "sent" {
+			t.Errorf("expected status sent, got %q", record.Status)
+		}
+		if record.MessageID != "<job-1@example.com>" {
+			t.Errorf("unexpected Message-ID %q", record.MessageID)
+		}
+	}
+	if sender.messageIDs[0] != sender.messageIDs[1] {
+		t.Errorf("retry sent a different Message-ID: %v", sender.messageIDs)
+	}
+}
+
+func TestEmailWorkerFailsRecordOnlyWhenNotRetried(t *testing.T) {
+	repo := &fakeEmailRepository{records: map[uuid.UUID]*models.EmailMessageRecord{}}
+	worker := newTestEmailWorker(&flakySender{failures: 2}, repo)
+	ctx := context.WithValue(context.Background(), jobIDKey{}, "job-1")
+	payload := []byte(`{"email":"a@example.com","subject":"Hi","html":"<p>Hi</p>"}`)
+
+	for _, attempt := range []struct {
+		last bool
+		want string
+	}{
+		{false, "queued"},
+		{true, "failed"},
+	} {
+		attemptCtx := context.WithValue(ctx, lastAttemptKey{}, attempt.last)
+		if err := worker.ProcessEmailJob(attemptCtx, JobTypeSendEmail, payload); err == nil {
+			t.Fatal("expected the attempt to fail")
+		}
+		for _, record := range repo.records {
+			if record.Status != attempt.want {
+				t.Errorf("last attempt %v: expected status %q, got %q", attempt.last, attempt.want, record.Status)
+			}
+		}
+	}
+}
+
+func TestEmailWorkerInlinesCSSAndAddsTracking(t *testing.T) {
+	sender := &flakySender{}
+	worker := newTestEmailWorker(sender, &fakeEmailRepository{records: map[uuid.UUID]*models.EmailMessageRecord{}})
+	ctx := context.WithValue(context.Background(), jobIDKey{}, "job-1")
+	payload := []byte(`{"email":"a@example.com","subject":"Hi","inline_css":true,` +
+		`"html":"<style>p { color: red }</style><p>Hi</p><a href=\"https://example.com/shop\">Shop</a>"}`)
+
+	if err := worker.ProcessEmailJob(ctx, JobTypeSendEmail, payload); err != nil {
+		t.Fatalf("ProcessEmailJob: %v", err)
+	}
+
+	body := sender.htmlBodies[0]
+	if !strings.Contains(body, `<p style="color: red;">Hi</p>`) || strings.Contains(body, "<style") {
+		t.Errorf("expected inlined html, got %q", body)
+	}
+	if !strings.Contains(body, "/track/click/") || !strings.Contains(body, "/track/open/job-1@example.com.png") {
+		t.Errorf("expected click and open tracking, got %q", body)
+	}
+}
@@ -1,6 +1,16 @@
 package queue
 
+import (
+	"encoding/json"
+	"time"
+)
+
+// JobTypeSendEmail is the job type handled by EmailWorker.ProcessEmailJob
+const JobTypeSendEmail = "send_email"
+
 // EmailJob represents an email job in the queue
+//
+// Deprecated: queue send_email jobs with EnqueueJob and an EmailJobPayload.
 type EmailJob struct {
 	ClientID   string   `json:"client_id"`
 	ContactIDs []string `json:"contact_ids"`
@@ -8,3 +18,12 @@ type EmailJob struct {
 	BatchID    string   `json:"batch_id"`
 }
 
+// Job is the envelope stored in the Redis queue
+// The ID makes every entry unique so it can be removed from the processing list on ack
+type Job struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   int             `json:"attempts"`
+	EnqueuedAt time.Time       `json:"enqueued_at"`
+}
@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -14,13 +16,35 @@ var ctx = context.Background()
 
 const QueueName = "email_queue"
 
+// ProcessingQueueName holds jobs claimed by a worker but not yet acknowledged
+const ProcessingQueueName = QueueName + ":processing"
+
+// LeasesKey is a sorted set of claimed jobs scored by lease expiry (unix ms)
+const LeasesKey = QueueName + ":leases"
+
+// DeadLetterQueueName holds exhausted jobs that could not be stored in failed_jobs
+const DeadLetterQueueName = QueueName + ":dead"
+
+// DelayedKey is a sorted set of failed jobs waiting for their retry, scored by
+// when they are due (unix ms)
+const DelayedKey = QueueName + ":delayed"
+
 // InitRedis initializes the Redis client connection
+// addr may be a plain host:port or a redis:// / rediss:// URL
 func InitRedis(addr string) error {
-	rdb := redis.NewClient(&redis.Options{
+	opts := &redis.Options{
 		Addr:     addr,
 		Password: "", // No password by default
 		DB:       0,
-	})
+	}
+	if strings.HasPrefix(addr, "redis://") || strings.HasPrefix(addr, "rediss://") {
+		parsed, err := redis.ParseURL(addr)
+		if err != nil {
+			return fmt.Errorf("invalid Redis URL: %w", err)
+		}
+		opts = parsed
+	}
+	rdb := redis.NewClient(opts)
 
 	// Test the connection
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -34,26 +58,46 @@ func InitRedis(addr string) error {
 	return nil
 }
 
-// EnqueueEmail adds an email job to the queue
+// EnqueueEmail adds an email job to the queue as a send_email job
+//
+// Deprecated: EmailJob carries no message, so the consumer moves these jobs
+// to failed_jobs; use EnqueueJob(JobTypeSendEmail, EmailJobPayload{...}).
 func EnqueueEmail(job EmailJob) error {
-	if Queue == nil {
-		return fmt.Errorf("redis client is not initialized")
-	}
+	return EnqueueJob(JobTypeSendEmail, job)
+}
 
-	// Marshal job to JSON
-	jobData, err := json.Marshal(job)
+// EnqueueJob wraps payload in a job envelope and pushes it onto the queue
+func EnqueueJob(jobType string, payload interface{}) error {
+	// Marshal payload to JSON
+	payloadData, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal job: %w", err)
+		return fmt.Errorf("failed to marshal job payload: %w", err)
 	}
 
-	// Push into Redis list
-	return Queue.LPush(ctx, QueueName, jobData).Err()
+	return enqueueRaw(jobType, payloadData)
 }
 
-// Enqueue is a compatibility function for old email handler (deprecated)
+// Enqueue is a compatibility function that queues an already-encoded send_email payload (deprecated)
 func Enqueue(data []byte) error {
+	return enqueueRaw(JobTypeSendEmail, data)
+}
+
+// enqueueRaw pushes an encoded payload onto the queue
+func enqueueRaw(jobType string, payload []byte) error {
 	if Queue == nil {
 		return fmt.Errorf("redis client is not initialized")
 	}
-	return Queue.LPush(ctx, QueueName, data).Err()
+
+	jobData, err := json.Marshal(Job{
+		ID:         uuid.New().String(),
+		Type:       jobType,
+		Payload:    payload,
+		EnqueuedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+
+	// Push into Redis list (consumers pop from the other end, so the queue is FIFO)
+	return Queue.LPush(ctx, QueueName, jobData).Err()
 }
@@ -3,19 +3,82 @@ package repositories
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"sort"
 	"time"
 
 	"backend/internal/db"
 	"backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 // AnalyticsRepository provides analytics queries
 type AnalyticsRepository interface {
-	GetOverviewStats(ctx context.Context) (*OverviewStats, error)
-	GetTimelineStats(ctx context.Context, days int) ([]TimelineStat, error)
-	GetTopClickedLinks(ctx context.Context, limit int) ([]TopLink, error)
-	GetEmailEvents(ctx context.Context, messageID string) ([]models.EmailEventRecord, error)
+	GetOverviewStats(ctx context.Context, filter AnalyticsFilter) (*OverviewStats, error)
+	GetTimelineStats(ctx context.Context, days int, filter AnalyticsFilter) ([]TimelineStat, error)
+	GetTopClickedLinks(ctx context.Context, limit int, filter AnalyticsFilter) ([]TopLink, error)
+	GetEmailEvents(ctx context.Context, messageID string, filter AnalyticsFilter) ([]models.EmailEventRecord, error)
+	GetEmailMessages(ctx context.Context, filter AnalyticsFilter, status string, limit, offset int) ([]models.EmailMessageRecord, int64, error)
+	GetCampaign(ctx context.Context, id uuid.UUID) (*models.Campaign, error)
+	GetCampaignStats(ctx context.Context, campaign *models.Campaign) (*CampaignStats, error)
+}
+
+// ErrCampaignNotFound is returned when a campaign does not exist
+var ErrCampaignNotFound = errors.New("campaign not found")
+
+// AnalyticsFilter restricts analytics queries to the emails of a client, campaign or contact
+// Nil fields are not filtered on.
+type AnalyticsFilter struct {
+	ClientID   *uuid.UUID
+	CampaignID *uuid.UUID
+	ContactID  *uuid.UUID
+}
+
+// IsEmpty reports whether the filter matches every email
+func (f AnalyticsFilter) IsEmpty() bool {
+	return f.ClientID == nil && f.CampaignID == nil && f.ContactID == nil
+}
+
+// messages scopes a query on email_messages to the filter
+func (f AnalyticsFilter) messages(tx *gorm.DB) *gorm.DB {
+	if f.ClientID != nil {
+		tx = tx.Where("email_messages.client_id = ?", *f.ClientID)
+	}
+	if f.CampaignID != nil {
+		tx = tx.Where("email_messages.campaign_id = ?", *f.CampaignID)
+	}
+	if f.ContactID != nil {
+		tx = tx.Where("email_messages.contact_id = ?", *f.ContactID)
+	}
+	return tx
+}
+
+// events scopes a query on email_events to the filter by joining their email
+func (f AnalyticsFilter) events(tx *gorm.DB) *gorm.DB {
+	if f.IsEmpty() {
+		return tx
+	}
+	return f.messages(tx.Joins("JOIN email_messages ON email_messages.id = email_events.email_id"))
+}
+
+// usesRollups reports whether the filter can be answered from the rollup tables
+// The rollups are not broken down by contact.
+func (f AnalyticsFilter) usesRollups() bool {
+	return f.ContactID == nil
+}
+
+// rollups scopes a query on a rollup table to the filter
+func (f AnalyticsFilter) rollups(tx *gorm.DB) *gorm.DB {
+	if f.ClientID != nil {
+		tx = tx.Where("client_id = ?", *f.ClientID)
+	}
+	if f.CampaignID != nil {
+		tx = tx.Where("campaign_id = ?", *f.CampaignID)
+	}
+	return tx
 }
 
 type analyticsRepository struct{}
@@ -25,42 +88,184 @@ func NewAnalyticsRepository() AnalyticsRepository {
 	return &analyticsRepository{}
 }
 
+// EngagementDefinitions documents the engagement metrics in analytics responses
+var EngagementDefinitions = map[string]string{
+	"unique_opens":       "Emails opened at least once (distinct email_id with an open event)",
+	"total_opens":        "Open events; repeated opens of one email are recorded at most once per day",
+	"unique_clicks":      "Emails with at least one tracked click (distinct email_id with a click event)",
+	"total_clicks":       "Click events; repeated clicks on the same link of one email are recorded once",
+	"open_rate":          "unique_opens / delivered",
+	"click_rate":         "unique_clicks / delivered",
+	"click_through_rate": "unique_clicks / delivered",
+	"click_to_open_rate": "unique_clicks / unique_opens",
+	"opens":              "Timeline: open events on that day (total)",
+	"clicks":             "Timeline: click events on that day (total)",
+	"timeline_unique":    "Timeline: emails whose first open or click was on that day (distinct emails per day when filtering by contact)",
+}
+
 // OverviewStats represents overall email statistics
 type OverviewStats struct {
-	TotalSent      int64   `json:"total_sent"`
-	TotalDelivered int64   `json:"total_delivered"`
-	TotalBounced   int64   `json:"total_bounced"`
-	TotalComplaint int64   `json:"total_complaint"`
-	TotalFailed    int64   `json:"total_failed"`
-	OpenRate       float64 `json:"open_rate"`
-	ClickRate      float64 `json:"click_rate"`
+	TotalSent      int64             `json:"total_sent"`
+	TotalDelivered int64             `json:"total_delivered"`
+	TotalBounced   int64             `json:"total_bounced"`
+	TotalComplaint int64             `json:"total_complaint"`
+	TotalFailed    int64             `json:"total_failed"`
+	UniqueOpens    int64             `json:"unique_opens"`
+	TotalOpens     int64             `json:"total_opens"`
+	UniqueClicks   int64             `json:"unique_clicks"`
+	TotalClicks    int64             `json:"total_clicks"`
+	OpenRate       float64           `json:"open_rate"`  // unique opens / delivered
+	ClickRate      float64           `json:"click_rate"` // unique clicks / delivered
+	Definitions    map[string]string `json:"definitions"`
 }
 
 // TimelineStat represents daily statistics
+// Opens and Clicks are total events; the unique counts are distinct emails per day.
 type TimelineStat struct {
-	Date       string `json:"date"`
-	Sent       int64  `json:"sent"`
-	Delivered  int64  `json:"delivered"`
-	Opens      int64  `json:"opens"`
-	Clicks     int64  `json:"clicks"`
-	Bounces    int64  `json:"bounces"`
-	Complaints int64  `json:"complaints"`
+	Date         string `json:"date"`
+	Sent         int64  `json:"sent"`
+	Delivered    int64  `json:"delivered"`
+	Opens        int64  `json:"opens"`
+	UniqueOpens  int64  `json:"unique_opens"`
+	Clicks       int64  `json:"clicks"`
+	UniqueClicks int64  `json:"unique_clicks"`
+	Bounces      int64  `json:"bounces"`
+	Complaints   int64  `json:"complaints"`
 }
 
+// engagementCounts holds unique and total open and click counts
+type engagementCounts struct {
+	UniqueOpens  int64
+	TotalOpens   int64
+	UniqueClicks int64
+	TotalClicks  int64
+}
+
+// rollupCountsSelect computes the delivery and engagement counts over a rollup table
+const rollupCountsSelect = `COALESCE(SUM(unique_count) FILTER (WHERE event_type = 'delivered'), 0) AS delivered,
+	COALESCE(SUM(unique_count) FILTER (WHERE event_type = 'bounce'), 0) AS bounced,
+	COALESCE(SUM(unique_count) FILTER (WHERE event_type = 'complaint'), 0) AS complaints,
+	COALESCE(SUM(unique_count) FILTER (WHERE event_type = 'open'), 0) AS unique_opens,
+	COALESCE(SUM(total_count) FILTER (WHERE event_type = 'open'), 0) AS total_opens,
+	COALESCE(SUM(unique_count) FILTER (WHERE event_type = 'click'), 0) AS unique_clicks,
+	COALESCE(SUM(total_count) FILTER (WHERE event_type = 'click'), 0) AS total_clicks`
+
+// rollupCounts holds the counts computed by rollupCountsSelect
+type rollupCounts struct {
+	Sent         int64
+	Delivered    int64
+	Bounced      int64
+	Complaints   int64
+	UniqueOpens  int64
+	TotalOpens   int64
+	UniqueClicks int64
+	TotalClicks  int64
+}
+
+// sumRollups sums the daily rollups matching the filter, excluding per-link rows
+func sumRollups(ctx context.Context, filter AnalyticsFilter) (*rollupCounts, error) {
+	var counts rollupCounts
+	if err := db.DB.WithContext(ctx).
+		Model(&models.AnalyticsDailyRollup{}).
+		Scopes(filter.rollups).
+		Select("COALESCE(SUM(total_count) FILTER (WHERE event_type = ?), 0) AS sent, "+rollupCountsSelect, models.RollupEventSent).
+		Where("link_url = ''").
+		Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	return &counts, nil
+}
+
+// engagementSelect computes engagementCounts over email_events
+const engagementSelect = `COUNT(DISTINCT email_events.email_id) FILTER (WHERE email_events.event_type = 'open') AS unique_opens,
+	COUNT(*) FILTER (WHERE email_events.event_type = 'open') AS total_opens,
+	COUNT(DISTINCT email_events.email_id) FILTER (WHERE email_events.event_type = 'click') AS unique_clicks,
+	COUNT(*) FILTER (WHERE email_events.event_type = 'click') AS total_clicks`
+
 // TopLink represents a top clicked link
+// LastClicked is the start of the hour of the last click.
 type TopLink struct {
 	URL         string    `json:"url"`
 	ClickCount  int64     `json:"click_count"`
 	LastClicked time.Time `json:"last_clicked"`
 }
 
+// CampaignStats represents the engagement of a single campaign
+// Delivered, bounced and complaint counts are emails with at least one such event.
+type CampaignStats struct {
+	CampaignID       uuid.UUID         `json:"campaign_id"`
+	Title            string            `json:"title"`
+	Status           string            `json:"status"`
+	Recipients       int64             `json:"recipients"`
+	Delivered        int64             `json:"delivered"`
+	Bounced          int64             `json:"bounced"`
+	Complaints       int64             `json:"complaints"`
+	UniqueOpens      int64             `json:"unique_opens"`
+	TotalOpens       int64             `json:"total_opens"`
+	UniqueClicks     int64             `json:"unique_clicks"`
+	TotalClicks      int64             `json:"total_clicks"`
+	ClickThroughRate float64           `json:"click_through_rate"` // unique clicks / delivered
+	ClickToOpenRate  float64           `json:"click_to_open_rate"` // unique clicks / unique opens
+	Links            []LinkClicks      `json:"links"`
+	Definitions      map[string]string `json:"definitions"`
+}
+
+// LinkClicks represents the clicks on one URL of a campaign
+type LinkClicks struct {
+	URL          string `json:"url"`
+	UniqueClicks int64  `json:"unique_clicks"`
+	TotalClicks  int64  `json:"total_clicks"`
+}
+
 // GetOverviewStats returns overall email statistics
-func (r *analyticsRepository) GetOverviewStats(ctx context.Context) (*OverviewStats, error) {
-	stats := &OverviewStats{}
+// Delivered, bounced and complaint counts are emails with at least one such event.
+func (r *analyticsRepository) GetOverviewStats(ctx context.Context, filter AnalyticsFilter) (*OverviewStats, error) {
+	if !filter.usesRollups() {
+		return r.overviewStatsFromEvents(ctx, filter)
+	}
+
+	counts, err := sumRollups(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	stats := &OverviewStats{
+		TotalSent:      counts.Sent,
+		TotalDelivered: counts.Delivered,
+		TotalBounced:   counts.Bounced,
+		TotalComplaint: counts.Complaints,
+		UniqueOpens:    counts.UniqueOpens,
+		TotalOpens:     counts.TotalOpens,
+		UniqueClicks:   counts.UniqueClicks,
+		TotalClicks:    counts.TotalClicks,
+		Definitions:    EngagementDefinitions,
+	}
+
+	// Send failures are a message status, not an event
+	if err := db.DB.WithContext(ctx).
+		Model(&models.EmailMessageRecord{}).
+		Scopes(filter.messages).
+		Where("status = ?", "failed").
+		Count(&stats.TotalFailed).Error; err != nil {
+		return nil, err
+	}
+
+	if stats.TotalDelivered > 0 {
+		stats.OpenRate = float64(stats.UniqueOpens) / float64(stats.TotalDelivered)
+		stats.ClickRate = float64(stats.UniqueClicks) / float64(stats.TotalDelivered)
+	}
+
+	return stats, nil
+}
+
+// overviewStatsFromEvents computes the overview from email_messages and email_events
+// It is used for filters the rollups cannot answer; counts come from message statuses.
+func (r *analyticsRepository) overviewStatsFromEvents(ctx context.Context, filter AnalyticsFilter) (*OverviewStats, error) {
+	stats := &OverviewStats{Definitions: EngagementDefinitions}
 
 	// Count total sent (all emails)
 	if err := db.DB.WithContext(ctx).
 		Model(&models.EmailMessageRecord{}).
+		Scopes(filter.messages).
 		Count(&stats.TotalSent).Error; err != nil {
 		return nil, err
 	}
@@ -68,6 +273,7 @@ func (r *analyticsRepository) GetOverviewStats(ctx context.Context) (*OverviewSt
 	// Count by status
 	if err := db.DB.WithContext(ctx).
 		Model(&models.EmailMessageRecord{}).
+		Scopes(filter.messages).
 		Where("status = ?", "delivered").
 		Count(&stats.TotalDelivered).Error; err != nil {
 		return nil, err
@@ -75,6 +281,7 @@ func (r *analyticsRepository) GetOverviewStats(ctx context.Context) (*OverviewSt
 
 	if err := db.DB.WithContext(ctx).
 		Model(&models.EmailMessageRecord{}).
+		Scopes(filter.messages).
 		Where("status = ?", "bounced").
 		Count(&stats.TotalBounced).Error; err != nil {
 		return nil, err
@@ -82,6 +289,7 @@ func (r *analyticsRepository) GetOverviewStats(ctx context.Context) (*OverviewSt
 
 	if err := db.DB.WithContext(ctx).
 		Model(&models.EmailMessageRecord{}).
+		Scopes(filter.messages).
 		Where("status = ?", "complaint").
 		Count(&stats.TotalComplaint).Error; err != nil {
 		return nil, err
@@ -89,40 +297,99 @@ func (r *analyticsRepository) GetOverviewStats(ctx context.Context) (*OverviewSt
 
 	if err := db.DB.WithContext(ctx).
 		Model(&models.EmailMessageRecord{}).
+		Scopes(filter.messages).
 		Where("status = ?", "failed").
 		Count(&stats.TotalFailed).Error; err != nil {
 		return nil, err
 	}
 
-	// Count open events
-	var openCount int64
+	// Count unique and total opens and clicks
+	var engagement engagementCounts
 	if err := db.DB.WithContext(ctx).
 		Model(&models.EmailEventRecord{}).
-		Where("event_type = ?", "open").
-		Count(&openCount).Error; err != nil {
+		Scopes(filter.events).
+		Select(engagementSelect).
+		Where("email_events.event_type IN (?, ?)", "open", "click").
+		Scan(&engagement).Error; err != nil {
 		return nil, err
 	}
+	stats.UniqueOpens = engagement.UniqueOpens
+	stats.TotalOpens = engagement.TotalOpens
+	stats.UniqueClicks = engagement.UniqueClicks
+	stats.TotalClicks = engagement.TotalClicks
+
+	// Calculate rates from unique engagement so they never exceed 100%
+	if stats.TotalDelivered > 0 {
+		stats.OpenRate = float64(stats.UniqueOpens) / float64(stats.TotalDelivered)
+		stats.ClickRate = float64(stats.UniqueClicks) / float64(stats.TotalDelivered)
+	}
+
+	return stats, nil
+}
+
+// GetTimelineStats returns daily statistics for the specified number of days
+func (r *analyticsRepository) GetTimelineStats(ctx context.Context, days int, filter AnalyticsFilter) ([]TimelineStat, error) {
+	if !filter.usesRollups() {
+		return r.timelineStatsFromEvents(ctx, days, filter)
+	}
+
+	startDate := time.Now().AddDate(0, 0, -days)
+	startDay := time.Date(startDate.Year(), startDate.Month(), startDate.Day(), 0, 0, 0, 0, startDate.Location())
 
-	// Count click events
-	var clickCount int64
+	var counts []struct {
+		Date        string
+		Type        string
+		Count       int64
+		UniqueCount int64
+	}
 	if err := db.DB.WithContext(ctx).
-		Model(&models.EmailEventRecord{}).
-		Where("event_type = ?", "click").
-		Count(&clickCount).Error; err != nil {
+		Model(&models.AnalyticsDailyRollup{}).
+		Scopes(filter.rollups).
+		Select("TO_CHAR(bucket, 'YYYY-MM-DD') AS date, event_type AS type, SUM(total_count) AS count, SUM(unique_count) AS unique_count").
+		Where("bucket >= ? AND link_url = '' AND event_type IN ?", startDay,
+			[]string{models.RollupEventSent, "delivered", "open", "click", "bounce", "complaint"}).
+		Group("bucket, event_type").
+		Scan(&counts).Error; err != nil {
 		return nil, err
 	}
 
-	// Calculate rates
-	if stats.TotalDelivered > 0 {
-		stats.OpenRate = float64(openCount) / float64(stats.TotalDelivered)
-		stats.ClickRate = float64(clickCount) / float64(stats.TotalDelivered)
+	result := make([]TimelineStat, days)
+	index := make(map[string]int, days)
+	for i := 0; i < days; i++ {
+		date := startDate.AddDate(0, 0, i).Format("2006-01-02")
+		result[i] = TimelineStat{Date: date}
+		index[date] = i
 	}
 
-	return stats, nil
+	for _, c := range counts {
+		i, ok := index[c.Date]
+		if !ok {
+			continue
+		}
+		stat := &result[i]
+		switch c.Type {
+		case models.RollupEventSent:
+			stat.Sent = c.Count
+		case "delivered":
+			stat.Delivered = c.Count
+		case "open":
+			stat.Opens = c.Count
+			stat.UniqueOpens = c.UniqueCount
+		case "click":
+			stat.Clicks = c.Count
+			stat.UniqueClicks = c.UniqueCount
+		case "bounce":
+			stat.Bounces = c.Count
+		case "complaint":
+			stat.Complaints = c.Count
+		}
+	}
+
+	return result, nil
 }
 
-// GetTimelineStats returns daily statistics for the specified number of days
-func (r *analyticsRepository) GetTimelineStats(ctx context.Context, days int) ([]TimelineStat, error) {
+// timelineStatsFromEvents computes the timeline from email_messages and email_events
+func (r *analyticsRepository) timelineStatsFromEvents(ctx context.Context, days int, filter AnalyticsFilter) ([]TimelineStat, error) {
 	// Calculate start date
 	startDate := time.Now().AddDate(0, 0, -days)
 
@@ -134,6 +401,7 @@ func (r *analyticsRepository) GetTimelineStats(ctx context.Context, days int) ([
 	var sentCounts []SentCount
 	if err := db.DB.WithContext(ctx).
 		Model(&models.EmailMessageRecord{}).
+		Scopes(filter.messages).
 		Select("DATE(created_at) as date, COUNT(*) as count").
 		Where("created_at >= ?", startDate).
 		Group("DATE(created_at)").
@@ -150,6 +418,7 @@ func (r *analyticsRepository) GetTimelineStats(ctx context.Context, days int) ([
 	var deliveredCounts []DeliveredCount
 	if err := db.DB.WithContext(ctx).
 		Model(&models.EmailMessageRecord{}).
+		Scopes(filter.messages).
 		Select("DATE(updated_at) as date, COUNT(*) as count").
 		Where("status = ? AND updated_at >= ?", "delivered", startDate).
 		Group("DATE(updated_at)").
@@ -160,16 +429,18 @@ func (r *analyticsRepository) GetTimelineStats(ctx context.Context, days int) ([
 
 	// Query events grouped by date
 	type EventCount struct {
-		Date  string
-		Type  string
-		Count int64
+		Date        string
+		Type        string
+		Count       int64
+		UniqueCount int64
 	}
 	var eventCounts []EventCount
 	if err := db.DB.WithContext(ctx).
 		Model(&models.EmailEventRecord{}).
-		Select("DATE(created_at) as date, event_type as type, COUNT(*) as count").
-		Where("created_at >= ? AND event_type IN (?, ?, ?, ?)", startDate, "open", "click", "bounce", "complaint").
-		Group("DATE(created_at), event_type").
+		Scopes(filter.events).
+		Select("DATE(email_events.created_at) as date, email_events.event_type as type, COUNT(*) as count, COUNT(DISTINCT email_events.email_id) as unique_count").
+		Where("email_events.created_at >= ? AND email_events.event_type IN (?, ?, ?, ?)", startDate, "open", "click", "bounce", "complaint").
+		Group("DATE(email_events.created_at), email_events.event_type").
 		Order("date ASC").
 		Scan(&eventCounts).Error; err != nil {
 		return nil, err
@@ -212,8 +483,10 @@ func (r *analyticsRepository) GetTimelineStats(ctx context.Context, days int) ([
 			switch ec.Type {
 			case "open":
 				stat.Opens = ec.Count
+				stat.UniqueOpens = ec.UniqueCount
 			case "click":
 				stat.Clicks = ec.Count
+				stat.UniqueClicks = ec.UniqueCount
 			case "bounce":
 				stat.Bounces = ec.Count
 			case "complaint":
@@ -235,12 +508,36 @@ func (r *analyticsRepository) GetTimelineStats(ctx context.Context, days int) ([
 }
 
 // GetTopClickedLinks returns the most clicked URLs
-func (r *analyticsRepository) GetTopClickedLinks(ctx context.Context, limit int) ([]TopLink, error) {
+func (r *analyticsRepository) GetTopClickedLinks(ctx context.Context, limit int, filter AnalyticsFilter) ([]TopLink, error) {
+	if !filter.usesRollups() {
+		return r.topClickedLinksFromEvents(ctx, limit, filter)
+	}
+
+	result := []TopLink{}
+	query := db.DB.WithContext(ctx).
+		Model(&models.AnalyticsHourlyRollup{}).
+		Scopes(filter.rollups).
+		Select("link_url AS url, SUM(total_count) AS click_count, MAX(bucket) AS last_clicked").
+		Where("event_type = ? AND link_url <> ''", "click").
+		Group("link_url").
+		Order("click_count DESC, url ASC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Scan(&result).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// topClickedLinksFromEvents aggregates the most clicked URLs from email_events
+func (r *analyticsRepository) topClickedLinksFromEvents(ctx context.Context, limit int, filter AnalyticsFilter) ([]TopLink, error) {
 	// Get all click events
 	var events []models.EmailEventRecord
 	if err := db.DB.WithContext(ctx).
-		Where("event_type = ?", "click").
-		Order("created_at DESC").
+		Scopes(filter.events).
+		Where("email_events.event_type = ?", "click").
+		Order("email_events.created_at DESC").
 		Find(&events).Error; err != nil {
 		return nil, err
 	}
@@ -293,10 +590,12 @@ func (r *analyticsRepository) GetTopClickedLinks(ctx context.Context, limit int)
 }
 
 // GetEmailEvents returns all events for a specific message ID
-func (r *analyticsRepository) GetEmailEvents(ctx context.Context, messageID string) ([]models.EmailEventRecord, error) {
+// The email must match the filter, so clients only see their own emails.
+func (r *analyticsRepository) GetEmailEvents(ctx context.Context, messageID string, filter AnalyticsFilter) ([]models.EmailEventRecord, error) {
 	// First, find the email by message ID
 	var email models.EmailMessageRecord
 	if err := db.DB.WithContext(ctx).
+		Scopes(filter.messages).
 		Where("message_id = ?", messageID).
 		First(&email).Error; err != nil {
 		return nil, err
@@ -313,3 +612,88 @@ func (r *analyticsRepository) GetEmailEvents(ctx context.Context, messageID stri
 
 	return events, nil
 }
+
+// GetEmailMessages returns the emails matching the filter, newest first, and the total count
+// An empty status matches every status.
+func (r *analyticsRepository) GetEmailMessages(ctx context.Context, filter AnalyticsFilter, status string, limit, offset int) ([]models.EmailMessageRecord, int64, error) {
+	query := db.DB.WithContext(ctx).
+		Model(&models.EmailMessageRecord{}).
+		Scopes(filter.messages)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var messages []models.EmailMessageRecord
+	query = query.Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return messages, total, nil
+}
+
+// GetCampaign returns the campaign with the given ID
+func (r *analyticsRepository) GetCampaign(ctx context.Context, id uuid.UUID) (*models.Campaign, error) {
+	var campaign models.Campaign
+	if err := db.DB.WithContext(ctx).Where("id = ?", id).First(&campaign).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCampaignNotFound
+		}
+		return nil, fmt.Errorf("failed to get campaign: %w", err)
+	}
+	return &campaign, nil
+}
+
+// GetCampaignStats returns the engagement of a campaign and its clicks per link
+// Only emails of the campaign's own client are counted.
+func (r *analyticsRepository) GetCampaignStats(ctx context.Context, campaign *models.Campaign) (*CampaignStats, error) {
+	filter := AnalyticsFilter{CampaignID: &campaign.ID, ClientID: &campaign.ClientID}
+	stats := &CampaignStats{
+		CampaignID:  campaign.ID,
+		Title:       campaign.Title,
+		Status:      campaign.Status,
+		Links:       []LinkClicks{},
+		Definitions: EngagementDefinitions,
+	}
+
+	counts, err := sumRollups(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	stats.Recipients = counts.Sent
+	stats.Delivered = counts.Delivered
+	stats.Bounced = counts.Bounced
+	stats.Complaints = counts.Complaints
+	stats.UniqueOpens = counts.UniqueOpens
+	stats.TotalOpens = counts.TotalOpens
+	stats.UniqueClicks = counts.UniqueClicks
+	stats.TotalClicks = counts.TotalClicks
+
+	if err := db.DB.WithContext(ctx).
+		Model(&models.AnalyticsDailyRollup{}).
+		Scopes(filter.rollups).
+		Select("link_url AS url, SUM(unique_count) AS unique_clicks, SUM(total_count) AS total_clicks").
+		Where("event_type = ? AND link_url <> ''", "click").
+		Group("link_url").
+		Order("total_clicks DESC, url ASC").
+		Scan(&stats.Links).Error; err != nil {
+		return nil, err
+	}
+
+	if stats.Delivered > 0 {
+		stats.ClickThroughRate = float64(stats.UniqueClicks) / float64(stats.Delivered)
+	}
+	if stats.UniqueOpens > 0 {
+		stats.ClickToOpenRate = float64(stats.UniqueClicks) / float64(stats.UniqueOpens)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,185 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// rollupTable is a rollup table and the date_trunc unit of its buckets
+type rollupTable struct {
+	name string
+	unit string
+}
+
+// rollupTables lists the rollup tables maintained for every counted event
+var rollupTables = []rollupTable{
+	{name: models.AnalyticsHourlyRollup{}.TableName(), unit: "hour"},
+	{name: models.AnalyticsDailyRollup{}.TableName(), unit: "day"},
+}
+
+// rollupEventTypes are the email_events types counted in the rollups
+var rollupEventTypes = []string{"delivered", "bounce", "complaint", "reject", "rendering_failure", "open", "click"}
+
+// rollupLinkMaxLength bounds link_url so it fits in the primary key index
+const rollupLinkMaxLength = 2048
+
+// isRollupEventType reports whether events of this type are counted in the rollups
+func isRollupEventType(eventType string) bool {
+	for _, t := range rollupEventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// rollupConflict is the upsert clause adding the new counts to an existing row
+const rollupConflict = `ON CONFLICT (bucket, client_id, campaign_id, event_type, link_url) DO UPDATE SET
+	total_count = %[1]s.total_count + EXCLUDED.total_count,
+	unique_count = %[1]s.unique_count + EXCLUDED.unique_count`
+
+// rollupRebuildConflict is the upsert clause replacing an existing row with the rebuilt counts
+const rollupRebuildConflict = `ON CONFLICT (bucket, client_id, campaign_id, event_type, link_url) DO UPDATE SET
+	total_count = EXCLUDED.total_count,
+	unique_count = EXCLUDED.unique_count`
+
+// recordMessageRollup counts a newly created email message as "sent"
+func recordMessageRollup(tx *gorm.DB, msg *models.EmailMessageRecord) error {
+	for _, table := range rollupTables {
+		query := fmt.Sprintf(`INSERT INTO %[1]s (bucket, client_id, campaign_id, event_type, link_url, total_count, unique_count)
+			SELECT date_trunc('%[2]s', m.created_at), COALESCE(m.client_id, '00000000-0000-0000-0000-000000000000'),
+				COALESCE(m.campaign_id, '00000000-0000-0000-0000-000000000000'), ?, '', 1, 1
+			FROM email_messages m WHERE m.id = ?
+			`+rollupConflict, table.name, table.unit)
+		if err := tx.Exec(query, models.RollupEventSent, msg.ID).Error; err != nil {
+			return fmt.Errorf("failed to update %s: %w", table.name, err)
+		}
+	}
+	return nil
+}
+
+// recordEventRollup counts a newly created email event
+// The event is unique when it is the email's first event of its type (and, for
+// link rows, its first click on that link).
+func recordEventRollup(tx *gorm.DB, event *models.EmailEventRecord) error {
+	if !isRollupEventType(event.EventType) {
+		return nil
+	}
+
+	for _, table := range rollupTables {
+		query := fmt.Sprintf(`INSERT INTO %[1]s (bucket, client_id, campaign_id, event_type, link_url, total_count, unique_count)
+			SELECT date_trunc('%[2]s', e.created_at), COALESCE(m.client_id, '00000000-0000-0000-0000-000000000000'),
+				COALESCE(m.campaign_id, '00000000-0000-0000-0000-000000000000'), e.event_type, '', 1,
+				CASE WHEN EXISTS (
+					SELECT 1 FROM email_events p
+					WHERE p.email_id = e.email_id AND p.event_type = e.event_type AND p.id <> e.id
+				) THEN 0 ELSE 1 END
+			FROM email_events e JOIN email_messages m ON m.id = e.email_id
+			WHERE e.id = ?
+			`+rollupConflict, table.name, table.unit)
+		if err := tx.Exec(query, event.ID).Error; err != nil {
+			return fmt.Errorf("failed to update %s: %w", table.name, err)
+		}
+
+		if event.EventType != "click" {
+			continue
+		}
+		query = fmt.Sprintf(`INSERT INTO %[1]s (bucket, client_id, campaign_id, event_type, link_url, total_count, unique_count)
+			SELECT date_trunc('%[2]s', e.created_at), COALESCE(m.client_id, '00000000-0000-0000-0000-000000000000'),
+				COALESCE(m.campaign_id, '00000000-0000-0000-0000-000000000000'), e.event_type, LEFT(e.meta->>'url', %[3]d), 1,
+				CASE WHEN EXISTS (
+					SELECT 1 FROM email_events p
+					WHERE p.email_id = e.email_id AND p.event_type = e.event_type
+						AND p.meta->>'url' = e.meta->>'url' AND p.id <> e.id
+				) THEN 0 ELSE 1 END
+			FROM email_events e JOIN email_messages m ON m.id = e.email_id
+			WHERE e.id = ? AND e.meta->>'url' IS NOT NULL AND e.meta->>'url' <> ''
+			`+rollupConflict, table.name, table.unit, rollupLinkMaxLength)
+		if err := tx.Exec(query, event.ID).Error; err != nil {
+			return fmt.Errorf("failed to update %s: %w", table.name, err)
+		}
+	}
+	return nil
+}
+
+// AnalyticsRollupRepository maintains the analytics rollup tables
+type AnalyticsRollupRepository interface {
+	Rebuild(ctx context.Context, since time.Time) error
+}
+
+type analyticsRollupRepository struct{}
+
+// NewAnalyticsRollupRepository creates a new analytics rollup repository
+func NewAnalyticsRollupRepository() AnalyticsRollupRepository {
+	return &analyticsRollupRepository{}
+}
+
+// Rebuild recomputes every rollup bucket from the start of since's day onwards
+// from email_messages and email_events. A zero since rebuilds everything.
+// Rows are replaced in one transaction, so readers never see a partial rebuild.
+func (r *analyticsRollupRepository) Rebuild(ctx context.Context, since time.Time) error {
+	since = time.Date(since.Year(), since.Month(), since.Day(), 0, 0, 0, 0, since.Location())
+
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range rollupTables {
+			if err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE bucket >= ?", table.name), since).Error; err != nil {
+				return fmt.Errorf("failed to clear %s: %w", table.name, err)
+			}
+
+			// Created messages
+			sent := fmt.Sprintf(`INSERT INTO %[1]s (bucket, client_id, campaign_id, event_type, link_url, total_count, unique_count)
+				SELECT date_trunc('%[2]s', m.created_at), COALESCE(m.client_id, '00000000-0000-0000-0000-000000000000'),
+					COALESCE(m.campaign_id, '00000000-0000-0000-0000-000000000000'), ?, '', COUNT(*), COUNT(*)
+				FROM email_messages m
+				WHERE m.created_at >= ?
+				GROUP BY 1, 2, 3
+				`+rollupRebuildConflict, table.name, table.unit)
+			if err := tx.Exec(sent, models.RollupEventSent, since).Error; err != nil {
+				return fmt.Errorf("failed to rebuild sent counts in %s: %w", table.name, err)
+			}
+
+			// Events; the first event of each type per email is the unique one
+			events := fmt.Sprintf(`INSERT INTO %[1]s (bucket, client_id, campaign_id, event_type, link_url, total_count, unique_count)
+				SELECT date_trunc('%[2]s', e.created_at), COALESCE(m.client_id, '00000000-0000-0000-0000-000000000000'),
+					COALESCE(m.campaign_id, '00000000-0000-0000-0000-000000000000'), e.event_type, '',
+					COUNT(*), COUNT(*) FILTER (WHERE e.rn = 1)
+				FROM (
+					SELECT email_id, event_type, created_at,
+						ROW_NUMBER() OVER (PARTITION BY email_id, event_type ORDER BY created_at, id) AS rn
+					FROM email_events
+					WHERE event_type IN ?
+				) e JOIN email_messages m ON m.id = e.email_id
+				WHERE e.created_at >= ?
+				GROUP BY 1, 2, 3, 4
+				`+rollupRebuildConflict, table.name, table.unit)
+			if err := tx.Exec(events, rollupEventTypes, since).Error; err != nil {
+				return fmt.Errorf("failed to rebuild event counts in %s: %w", table.name, err)
+			}
+
+			// Clicks per link
+			links := fmt.Sprintf(`INSERT INTO %[1]s (bucket, client_id, campaign_id, event_type, link_url, total_count, unique_count)
+				SELECT date_trunc('%[2]s', e.created_at), COALESCE(m.client_id, '00000000-0000-0000-0000-000000000000'),
+					COALESCE(m.campaign_id, '00000000-0000-0000-0000-000000000000'), 'click', LEFT(e.url, %[3]d),
+					COUNT(*), COUNT(*) FILTER (WHERE e.rn = 1)
+				FROM (
+					SELECT email_id, created_at, meta->>'url' AS url,
+						ROW_NUMBER() OVER (PARTITION BY email_id, meta->>'url' ORDER BY created_at, id) AS rn
+					FROM email_events
+					WHERE event_type = 'click' AND meta->>'url' IS NOT NULL AND meta->>'url' <> ''
+				) e JOIN email_messages m ON m.id = e.email_id
+				WHERE e.created_at >= ?
+				GROUP BY 1, 2, 3, 5
+				`+rollupRebuildConflict, table.name, table.unit, rollupLinkMaxLength)
+			if err := tx.Exec(links, since).Error; err != nil {
+				return fmt.Errorf("failed to rebuild link counts in %s: %w", table.name, err)
+			}
+		}
+		return nil
+	})
+}
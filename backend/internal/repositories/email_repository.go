@@ -10,11 +10,13 @@ import (
 	"backend/internal/models"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type EmailRepository interface {
 	CreateEmailMessage(ctx context.Context, msg models.EmailMessageRecord) error
 	UpdateEmailStatus(ctx context.Context, id uuid.UUID, status string) error
+	SetProvider(ctx context.Context, id uuid.UUID, provider, providerMessageID string) error
 	AddEmailEvent(ctx context.Context, event models.EmailEventRecord) error
 	GetEmailByMessageID(ctx context.Context, messageID string) (*models.EmailMessageRecord, error)
 	CreateEmailEventWithMeta(ctx context.Context, emailID uuid.UUID, eventType string, meta map[string]interface{}) error
@@ -35,12 +37,14 @@ func NewEmailRepository() EmailRepository {
 	return &EmailRepositoryImpl{}
 }
 
-// CreateEmailMessage creates a new email message record
+// CreateEmailMessage creates a new email message record and counts it in the analytics rollups
 func (r *emailRepository) CreateEmailMessage(ctx context.Context, msg models.EmailMessageRecord) error {
-	if err := db.DB.WithContext(ctx).Create(&msg).Error; err != nil {
-		return fmt.Errorf("failed to create email message: %w", err)
-	}
-	return nil
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&msg).Error; err != nil {
+			return fmt.Errorf("failed to create email message: %w", err)
+		}
+		return recordMessageRollup(tx, &msg)
+	})
 }
 
 // UpdateEmailStatus updates the status of an email message
@@ -58,18 +62,55 @@ func (r *emailRepository) UpdateEmailStatus(ctx context.Context, id uuid.UUID, s
 	return nil
 }
 
-// AddEmailEvent adds an email event record
+// AddEmailEvent adds an email event record and counts it in the analytics rollups
 func (r *emailRepository) AddEmailEvent(ctx context.Context, event models.EmailEventRecord) error {
-	if err := db.DB.WithContext(ctx).Create(&event).Error; err != nil {
-		return fmt.Errorf("failed to create email event: %w", err)
+	if event.ID == uuid.Nil {
+		event.ID = uuid.New()
+	}
+
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if isRollupEventType(event.EventType) {
+			// Serialize events of the same email so exactly one of them counts as unique
+			if err := tx.Exec("SELECT 1 FROM email_messages WHERE id = ? FOR UPDATE", event.EmailID).Error; err != nil {
+				return fmt.Errorf("failed to lock email message: %w", err)
+			}
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return fmt.Errorf("failed to create email event: %w", err)
+		}
+		return recordEventRollup(tx, &event)
+	})
+}
+
+// SetProvider stores the provider that sent an email and the message ID it
+// assigned; empty values are left unchanged
+func (r *emailRepository) SetProvider(ctx context.Context, id uuid.UUID, provider, providerMessageID string) error {
+	updates := map[string]interface{}{
+		"updated_at": time.Now(),
+	}
+	if provider != "" {
+		updates["provider"] = provider
+	}
+	if providerMessageID != "" {
+		updates["provider_message_id"] = providerMessageID
+	}
+
+	if err := db.DB.WithContext(ctx).
+		Model(&models.EmailMessageRecord{}).
+		Where("id = ?", id).
+		Updates(updates).Error; err != nil {
+		return fmt.Errorf("failed to set email provider: %w", err)
 	}
 	return nil
 }
 
-// GetEmailByMessageID retrieves an email message by Message-ID
+// GetEmailByMessageID retrieves an email message by Message-ID, or by the
+// provider's message ID when SES events carry no Message-ID header
 func (r *emailRepository) GetEmailByMessageID(ctx context.Context, messageID string) (*models.EmailMessageRecord, error) {
 	var msg models.EmailMessageRecord
-	if err := db.DB.WithContext(ctx).Where("message_id = ?", messageID).First(&msg).Error; err != nil {
+	if err := db.DB.WithContext(ctx).
+		Where("message_id = ? OR provider_message_id = ?", messageID, messageID).
+		First(&msg).Error; err != nil {
 		return nil, fmt.Errorf("failed to get email by message ID: %w", err)
 	}
 	return &msg, nil
@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrFailedJobNotFound is returned when a failed job does not exist
+var ErrFailedJobNotFound = errors.New("failed job not found")
+
+// FailedJobFilter narrows down failed job listings; zero values are ignored
+type FailedJobFilter struct {
+	Queue      string
+	JobType    string
+	CampaignID *uuid.UUID
+	Since      *time.Time
+	Retried    *bool
+	Limit      int
+	Offset     int
+}
+
+// FailedJobPurgeFilter selects failed jobs to delete; at least one field must be set
+type FailedJobPurgeFilter struct {
+	OlderThan   *time.Time
+	OnlyRetried bool
+	All         bool
+}
+
+type FailedJobRepository interface {
+	Create(ctx context.Context, job *models.FailedJob) error
+	GetByID(ctx context.Context, id uuid.UUID) (*models.FailedJob, error)
+	List(ctx context.Context, filter FailedJobFilter) ([]models.FailedJob, int64, error)
+	ClaimRetry(ctx context.Context, id uuid.UUID, previous *time.Time, retriedAt time.Time) (bool, error)
+	ReleaseRetry(ctx context.Context, id uuid.UUID, retriedAt time.Time, previous *time.Time) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	Purge(ctx context.Context, filter FailedJobPurgeFilter) (int64, error)
+}
+
+type failedJobRepository struct{}
+
+// NewFailedJobRepository creates a new failed job repository
+func NewFailedJobRepository() FailedJobRepository {
+	return &failedJobRepository{}
+}
+
+// Create stores a job that exhausted its retries
+func (r *failedJobRepository) Create(ctx context.Context, job *models.FailedJob) error {
+	if err := db.DB.WithContext(ctx).Create(job).Error; err != nil {
+		return fmt.Errorf("failed to create failed job: %w", err)
+	}
+	return nil
+}
+
+// GetByID retrieves a failed job by ID
+func (r *failedJobRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.FailedJob, error) {
+	var job models.FailedJob
+	if err := db.DB.WithContext(ctx).Where("id = ?", id).First(&job).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFailedJobNotFound
+		}
+		return nil, fmt.Errorf("failed to get failed job: %w", err)
+	}
+	return &job, nil
+}
+
+// List returns failed jobs matching the filter, newest first, with the total count
+func (r *failedJobRepository) List(ctx context.Context, filter FailedJobFilter) ([]models.FailedJob, int64, error) {
+	query := db.DB.WithContext(ctx).Model(&models.FailedJob{})
+	if filter.Queue != "" {
+		query = query.Where("queue = ?", filter.Queue)
+	}
+	if filter.JobType != "" {
+		query = query.Where("job_type = ?", filter.JobType)
+	}
+	if filter.CampaignID != nil {
+		query = query.Where("campaign_id = ?", *filter.CampaignID)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at > ?", *filter.Since)
+	}
+	if filter.Retried != nil {
+		if *filter.Retried {
+			query = query.Where("retried_at IS NOT NULL")
+		} else {
+			query = query.Where("retried_at IS NULL")
+		}
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count failed jobs: %w", err)
+	}
+
+	query = query.Order("created_at DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+
+	var jobs []models.FailedJob
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list failed jobs: %w", err)
+	}
+	return jobs, total, nil
+}
+
+// ClaimRetry sets retried_at if it still holds previous (nil: never retried),
+// reporting whether this caller claimed the requeue
+// Concurrent requeues of the same job race on this update, so only one of
+// them puts the job back on its queue.
+func (r *failedJobRepository) ClaimRetry(ctx context.Context, id uuid.UUID, previous *time.Time, retriedAt time.Time) (bool, error) {
+	query := db.DB.WithContext(ctx).Model(&models.FailedJob{}).Where("id = ?", id)
+	if previous == nil {
+		query = query.Where("retried_at IS NULL")
+	} else {
+		query = query.Where("retried_at = ?", *previous)
+	}
+
+	result := query.Update("retried_at", retriedAt)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to claim failed job for retry: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReleaseRetry restores retried_at to previous after a claimed requeue failed
+func (r *failedJobRepository) ReleaseRetry(ctx context.Context, id uuid.UUID, retriedAt time.Time, previous *time.Time) error {
+	result := db.DB.WithContext(ctx).Model(&models.FailedJob{}).
+		Where("id = ? AND retried_at = ?", id, retriedAt).
+		Update("retried_at", previous)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to release failed job retry: %w", result.Error)
+	}
+	return nil
+}
+
+// Delete removes a single failed job
+func (r *failedJobRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	result := db.DB.WithContext(ctx).Where("id = ?", id).Delete(&models.FailedJob{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete failed job: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrFailedJobNotFound
+	}
+	return nil
+}
+
+// Purge deletes failed jobs matching the filter and returns how many were removed
+func (r *failedJobRepository) Purge(ctx context.Context, filter FailedJobPurgeFilter) (int64, error) {
+	if filter.OlderThan == nil && !filter.OnlyRetried && !filter.All {
+		return 0, fmt.Errorf("purge filter is empty")
+	}
+
+	query := db.DB.WithContext(ctx)
+	if filter.OlderThan != nil {
+		query = query.Where("created_at < ?", *filter.OlderThan)
+	}
+	if filter.OnlyRetried {
+		query = query.Where("retried_at IS NOT NULL")
+	}
+	if filter.All && filter.OlderThan == nil && !filter.OnlyRetried {
+		// GORM refuses unconditional deletes
+		query = query.Where("1 = 1")
+	}
+
+	result := query.Delete(&models.FailedJob{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to purge failed jobs: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,109 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrIdempotencyKeyLost is returned for a reservation that expired and was
+// taken over by a retry of its request
+var ErrIdempotencyKeyLost = errors.New("idempotency key reservation was taken over")
+
+type IdempotencyRepository interface {
+	Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error)
+	Renew(ctx context.Context, id uuid.UUID, lockedUntil time.Time) error
+	Complete(ctx context.Context, id uuid.UUID, statusCode int, response []byte) error
+	Release(ctx context.Context, id uuid.UUID) error
+	DeleteExpired(ctx context.Context, now time.Time) (int64, error)
+}
+
+type idempotencyRepository struct{}
+
+// NewIdempotencyRepository creates a new idempotency key repository
+func NewIdempotencyRepository() IdempotencyRepository {
+	return &idempotencyRepository{}
+}
+
+// Reserve stores key unless its scope already holds the same key, in which
+// case the stored key is returned instead
+// An expired key is replaced, and so is a key of the same request that is
+// still in progress after its LockedUntil: the request holding it has died.
+func (r *idempotencyRepository) Reserve(ctx context.Context, key *models.IdempotencyKey) (*models.IdempotencyKey, error) {
+	var existing *models.IdempotencyKey
+	err := db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Where("scope = ? AND key = ?", key.Scope, key.Key).
+			Where(tx.Where("expires_at <= ?", now).
+				Or("status_code = 0 AND locked_until <= ? AND request_hash = ?", now, key.RequestHash)).
+			Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+		if result.Error != nil || result.RowsAffected == 1 {
+			return result.Error
+		}
+
+		existing = &models.IdempotencyKey{}
+		return tx.Where("scope = ? AND key = ?", key.Scope, key.Key).First(existing).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	return existing, nil
+}
+
+// Renew extends the lease of a reserved key that is still in progress
+func (r *idempotencyRepository) Renew(ctx context.Context, id uuid.UUID, lockedUntil time.Time) error {
+	result := db.DB.WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("id = ? AND status_code = 0", id).
+		Update("locked_until", lockedUntil)
+	if result.Error != nil {
+		return fmt.Errorf("failed to renew idempotency key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdempotencyKeyLost
+	}
+	return nil
+}
+
+// Complete stores the response of a reserved key
+// It returns ErrIdempotencyKeyLost when the reservation was taken over.
+func (r *idempotencyRepository) Complete(ctx context.Context, id uuid.UUID, statusCode int, response []byte) error {
+	result := db.DB.WithContext(ctx).Model(&models.IdempotencyKey{}).
+		Where("id = ? AND status_code = 0", id).
+		Updates(map[string]interface{}{"status_code": statusCode, "response": response})
+	if result.Error != nil {
+		return fmt.Errorf("failed to complete idempotency key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdempotencyKeyLost
+	}
+	return nil
+}
+
+// Release deletes a reserved key so that the request can be retried
+func (r *idempotencyRepository) Release(ctx context.Context, id uuid.UUID) error {
+	if err := db.DB.WithContext(ctx).Where("id = ?", id).Delete(&models.IdempotencyKey{}).Error; err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes the keys that expired before now and returns how many were removed
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	result := db.DB.WithContext(ctx).Where("expires_at <= ?", now).Delete(&models.IdempotencyKey{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to delete expired idempotency keys: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
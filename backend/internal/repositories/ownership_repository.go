@@ -0,0 +1,47 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// OwnershipRepository checks that the campaigns and contacts an email links to
+// belong to the client sending it
+type OwnershipRepository interface {
+	CampaignBelongsTo(ctx context.Context, campaignID, clientID uuid.UUID) (bool, error)
+	ContactBelongsTo(ctx context.Context, contactID, clientID uuid.UUID) (bool, error)
+}
+
+type ownershipRepository struct{}
+
+// NewOwnershipRepository creates a new ownership repository
+func NewOwnershipRepository() OwnershipRepository {
+	return &ownershipRepository{}
+}
+
+// CampaignBelongsTo reports whether a campaign exists and belongs to clientID
+func (r *ownershipRepository) CampaignBelongsTo(ctx context.Context, campaignID, clientID uuid.UUID) (bool, error) {
+	var count int64
+	if err := db.DB.WithContext(ctx).Model(&models.Campaign{}).
+		Where("id = ? AND client_id = ?", campaignID, clientID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check campaign owner: %w", err)
+	}
+	return count > 0, nil
+}
+
+// ContactBelongsTo reports whether a contact exists and belongs to clientID
+func (r *ownershipRepository) ContactBelongsTo(ctx context.Context, contactID, clientID uuid.UUID) (bool, error) {
+	var count int64
+	if err := db.DB.WithContext(ctx).Model(&models.Contact{}).
+		Where("id = ? AND client_id = ?", contactID, clientID).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("failed to check contact owner: %w", err)
+	}
+	return count > 0, nil
+}
@@ -6,7 +6,10 @@ import (
 	"strconv"
 
 	"backend/internal/cache"
+	"backend/internal/models"
 	"backend/internal/repositories"
+
+	"github.com/google/uuid"
 )
 
 // AnalyticsService provides analytics business logic
@@ -15,38 +18,40 @@ type AnalyticsService struct {
 	cache         *cache.AnalyticsCache
 }
 
-// NewAnalyticsService creates a new analytics service
-func NewAnalyticsService(analyticsRepo repositories.AnalyticsRepository) *AnalyticsService {
+// NewAnalyticsService creates a new analytics service caching results in analyticsCache
+func NewAnalyticsService(analyticsRepo repositories.AnalyticsRepository, analyticsCache *cache.AnalyticsCache) *AnalyticsService {
 	return &AnalyticsService{
 		analyticsRepo: analyticsRepo,
-		cache:         cache.NewAnalyticsCache(),
+		cache:         analyticsCache,
 	}
 }
 
-// GetOverview returns overall email statistics (with caching)
-func (s *AnalyticsService) GetOverview(ctx context.Context) (*repositories.OverviewStats, error) {
+// GetOverview returns email statistics matching the filter
+func (s *AnalyticsService) GetOverview(ctx context.Context, filter repositories.AnalyticsFilter) (*repositories.OverviewStats, error) {
 	// Check cache first
-	if cached, ok := s.cache.GetOverview(); ok {
+	cached, gen, ok := s.cache.GetOverview(ctx, filter)
+	if ok {
 		return cached, nil
 	}
 
 	// Fetch from repository
-	stats, err := s.analyticsRepo.GetOverviewStats(ctx)
+	stats, err := s.analyticsRepo.GetOverviewStats(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 
 	// Cache the result
-	s.cache.SetOverview(stats)
+	s.cache.SetOverview(ctx, filter, gen, stats)
 
 	return stats, nil
 }
 
-// GetTimeline returns timeline statistics for the specified range (with caching)
+// GetTimeline returns timeline statistics for the specified range
 // range can be "7d", "30d", or "90d"
-func (s *AnalyticsService) GetTimeline(ctx context.Context, rangeStr string) ([]repositories.TimelineStat, error) {
+func (s *AnalyticsService) GetTimeline(ctx context.Context, rangeStr string, filter repositories.AnalyticsFilter) ([]repositories.TimelineStat, error) {
 	// Check cache first
-	if cached, ok := s.cache.GetTimeline(rangeStr); ok {
+	cached, gen, ok := s.cache.GetTimeline(ctx, rangeStr, filter)
+	if ok {
 		return cached, nil
 	}
 
@@ -56,19 +61,19 @@ func (s *AnalyticsService) GetTimeline(ctx context.Context, rangeStr string) ([]
 	}
 
 	// Fetch from repository
-	stats, err := s.analyticsRepo.GetTimelineStats(ctx, days)
+	stats, err := s.analyticsRepo.GetTimelineStats(ctx, days, filter)
 	if err != nil {
 		return nil, err
 	}
 
 	// Cache the result
-	s.cache.SetTimeline(rangeStr, stats)
+	s.cache.SetTimeline(ctx, rangeStr, filter, gen, stats)
 
 	return stats, nil
 }
 
-// GetTopLinks returns the most clicked URLs (with caching)
-func (s *AnalyticsService) GetTopLinks(ctx context.Context, limit int) ([]repositories.TopLink, error) {
+// GetTopLinks returns the most clicked URLs
+func (s *AnalyticsService) GetTopLinks(ctx context.Context, limit int, filter repositories.AnalyticsFilter) ([]repositories.TopLink, error) {
 	if limit <= 0 {
 		limit = 10 // Default limit
 	}
@@ -76,30 +81,27 @@ func (s *AnalyticsService) GetTopLinks(ctx context.Context, limit int) ([]reposi
 		limit = 100 // Max limit
 	}
 
-	// Check cache first (only for default limit of 10)
-	if limit == 10 {
-		if cached, ok := s.cache.GetTopLinks(); ok {
-			return cached, nil
-		}
+	// Check cache first
+	cached, gen, ok := s.cache.GetTopLinks(ctx, limit, filter)
+	if ok {
+		return cached, nil
 	}
 
 	// Fetch from repository
-	links, err := s.analyticsRepo.GetTopClickedLinks(ctx, limit)
+	links, err := s.analyticsRepo.GetTopClickedLinks(ctx, limit, filter)
 	if err != nil {
 		return nil, err
 	}
 
-	// Cache the result (only for default limit)
-	if limit == 10 {
-		s.cache.SetTopLinks(links)
-	}
+	// Cache the result
+	s.cache.SetTopLinks(ctx, limit, filter, gen, links)
 
 	return links, nil
 }
 
-// GetEmailEvents returns all events for a specific message ID
-func (s *AnalyticsService) GetEmailEvents(ctx context.Context, messageID string) ([]interface{}, error) {
-	events, err := s.analyticsRepo.GetEmailEvents(ctx, messageID)
+// GetEmailEvents returns all events for a specific message ID matching the filter
+func (s *AnalyticsService) GetEmailEvents(ctx context.Context, messageID string, filter repositories.AnalyticsFilter) ([]interface{}, error) {
+	events, err := s.analyticsRepo.GetEmailEvents(ctx, messageID, filter)
 	if err != nil {
 		return nil, err
 	}
@@ -118,6 +120,35 @@ func (s *AnalyticsService) GetEmailEvents(ctx context.Context, messageID string)
 	return result, nil
 }
 
+// GetEmailMessages returns a page of emails matching the filter and the total count
+func (s *AnalyticsService) GetEmailMessages(ctx context.Context, filter repositories.AnalyticsFilter, status string, limit, offset int) ([]models.EmailMessageRecord, int64, error) {
+	if limit <= 0 {
+		limit = 50 // Default limit
+	}
+	if limit > 200 {
+		limit = 200 // Max limit
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	return s.analyticsRepo.GetEmailMessages(ctx, filter, status, limit, offset)
+}
+
+// GetCampaignStats returns the engagement of a campaign
+// When clientID is set, campaigns of other clients are reported as not found.
+func (s *AnalyticsService) GetCampaignStats(ctx context.Context, campaignID uuid.UUID, clientID *uuid.UUID) (*repositories.CampaignStats, error) {
+	campaign, err := s.analyticsRepo.GetCampaign(ctx, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	if clientID != nil && campaign.ClientID != *clientID {
+		return nil, repositories.ErrCampaignNotFound
+	}
+
+	return s.analyticsRepo.GetCampaignStats(ctx, campaign)
+}
+
 // parseRange parses range string to days
 func parseRange(rangeStr string) (int, error) {
 	if len(rangeStr) < 2 {
@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/models"
+	"backend/internal/repositories"
+
+	"github.com/google/uuid"
+)
+
+// ErrFailedJobAlreadyRetried is returned when requeueing a job that was already requeued
+var ErrFailedJobAlreadyRetried = errors.New("failed job was already requeued")
+
+// JobRequeuer puts the payload of a failed job back on its originating queue
+type JobRequeuer func(ctx context.Context, job *models.FailedJob) error
+
+// FailedJobService provides dead-letter queue inspection and recovery
+type FailedJobService struct {
+	repo      repositories.FailedJobRepository
+	requeuers map[string]JobRequeuer // keyed by FailedJob.Queue
+}
+
+// NewFailedJobService creates a new failed job service
+func NewFailedJobService(repo repositories.FailedJobRepository, requeuers map[string]JobRequeuer) *FailedJobService {
+	return &FailedJobService{
+		repo:      repo,
+		requeuers: requeuers,
+	}
+}
+
+// List returns failed jobs matching the filter with the total count
+func (s *FailedJobService) List(ctx context.Context, filter repositories.FailedJobFilter) ([]models.FailedJob, int64, error) {
+	return s.repo.List(ctx, filter)
+}
+
+// Get returns a single failed job
+func (s *FailedJobService) Get(ctx context.Context, id uuid.UUID) (*models.FailedJob, error) {
+	return s.repo.GetByID(ctx, id)
+}
+
+// Requeue puts a failed job back on its queue and marks it as retried
+// A job that was already requeued is only requeued again when force is set.
+// The job is claimed before it is enqueued, so concurrent requeues of the same
+// job enqueue it once; the claim is released when enqueueing fails.
+func (s *FailedJobService) Requeue(ctx context.Context, id uuid.UUID, force bool) (*models.FailedJob, error) {
+	job, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.RetriedAt != nil && !force {
+		return nil, ErrFailedJobAlreadyRetried
+	}
+
+	requeue, ok := s.requeuers[job.Queue]
+	if !ok {
+		return nil, fmt.Errorf("no requeuer for queue %q", job.Queue)
+	}
+
+	// retried_at is stored with microsecond precision
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	previous := job.RetriedAt
+	claimed, err := s.repo.ClaimRetry(ctx, job.ID, previous, now)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return nil, ErrFailedJobAlreadyRetried
+	}
+
+	if err := requeue(ctx, job); err != nil {
+		// Use a fresh context so the claim is released even if the request was cancelled
+		if releaseErr := s.repo.ReleaseRetry(context.WithoutCancel(ctx), job.ID, now, previous); releaseErr != nil {
+			return nil, fmt.Errorf("failed to requeue job: %w (and failed to release it: %v)", err, releaseErr)
+		}
+		return nil, fmt.Errorf("failed to requeue job: %w", err)
+	}
+
+	job.RetriedAt = &now
+	return job, nil
+}
+
+// Delete removes a single failed job
+func (s *FailedJobService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.repo.Delete(ctx, id)
+}
+
+// Purge deletes failed jobs matching the filter
+func (s *FailedJobService) Purge(ctx context.Context, filter repositories.FailedJobPurgeFilter) (int64, error) {
+	return s.repo.Purge(ctx, filter)
+}
@@ -0,0 +1,105 @@
+package smtppool
+
+import (
+	"errors"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// Authentication mechanisms of Server.Auth
+const (
+	AuthAuto    = ""         // the best mechanism the server offers (the default)
+	AuthPlain   = "plain"    // AUTH PLAIN, only over TLS or to localhost
+	AuthLogin   = "login"    // AUTH LOGIN, only over TLS or to localhost
+	AuthCRAMMD5 = "cram-md5" // AUTH CRAM-MD5, the password never crosses the wire
+	AuthNone    = "none"     // no AUTH, for relays that trust the network
+)
+
+// ParseAuth maps an authentication setting to an Auth* mechanism
+func ParseAuth(value string) (string, error) {
+	switch mechanism := strings.ToLower(strings.TrimSpace(value)); mechanism {
+	case AuthAuto, AuthPlain, AuthLogin, AuthCRAMMD5, AuthNone:
+		return mechanism, nil
+	default:
+		return "", fmt.Errorf("unknown SMTP auth mechanism %q (expected plain, login, cram-md5 or none)", value)
+	}
+}
+
+// authenticates reports whether connections to the server log in
+func (s Server) authenticates() bool {
+	return s.Username != "" && s.Auth != AuthNone
+}
+
+// auth returns the smtp.Auth of the server's mechanism; AuthAuto picks from
+// the mechanisms the server advertised, preferring CRAM-MD5 without TLS
+func (s Server) auth(client *smtp.Client) (smtp.Auth, error) {
+	mechanism := s.Auth
+	if mechanism == AuthAuto {
+		ok, advertised := client.Extension("AUTH")
+		if !ok {
+			return nil, errors.New("server does not support AUTH")
+		}
+		offered := make(map[string]bool)
+		for _, name := range strings.Fields(strings.ToLower(advertised)) {
+			offered[name] = true
+		}
+
+		preference := []string{AuthPlain, AuthLogin, AuthCRAMMD5}
+		if _, tls := client.TLSConnectionState(); !tls {
+			preference = []string{AuthCRAMMD5, AuthPlain, AuthLogin}
+		}
+		for _, name := range preference {
+			if offered[name] {
+				mechanism = name
+				break
+			}
+		}
+		if mechanism == AuthAuto {
+			return nil, fmt.Errorf("no supported AUTH mechanism in %q", advertised)
+		}
+	}
+
+	switch mechanism {
+	case AuthPlain:
+		return smtp.PlainAuth("", s.Username, s.Password, s.Host), nil
+	case AuthLogin:
+		return &loginAuth{username: s.Username, password: s.Password, host: s.Host}, nil
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(s.Username, s.Password), nil
+	default:
+		return nil, fmt.Errorf("unknown SMTP auth mechanism %q", mechanism)
+	}
+}
+
+// loginAuth implements the AUTH LOGIN mechanism, which net/smtp lacks
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// Start implements smtp.Auth; like smtp.PlainAuth it refuses to send the
+// password over an unencrypted connection to another host
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && a.host != "localhost" && a.host != "127.0.0.1" && a.host != "::1" {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next implements smtp.Auth by answering the Username: and Password: prompts
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	prompt := strings.ToLower(string(fromServer))
+	switch {
+	case strings.HasPrefix(prompt, "user"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "pass"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected AUTH LOGIN prompt %q", fromServer)
+	}
+}
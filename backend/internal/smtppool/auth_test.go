@@ -0,0 +1,142 @@
+package smtppool
+
+import (
+	"net/smtp"
+	"testing"
+
+	"backend/internal/smtptest"
+)
+
+// authServer starts a server accepting user/secret with the given mechanisms,
+// over STARTTLS when ca is not nil
+func authServer(t *testing.T, ca *smtptest.CA, mechanisms ...string) (*smtptest.Server, Server) {
+	t.Helper()
+	srv := smtptest.NewUnstartedServer(t)
+	srv.AuthMechanisms = mechanisms
+	srv.Users = map[string]string{"user": "secret"}
+
+	server := Server{Host: srv.Host, Port: srv.Port, Username: "user", Password: "secret", Encryption: EncryptionNone}
+	if ca != nil {
+		srv.TLSConfig = ca.ServerTLSConfig(t)
+		server.Encryption = EncryptionSTARTTLS
+		server.CAFile = ca.CertFile
+	}
+	srv.Start()
+	return srv, server
+}
+
+func TestPool_AuthMechanisms(t *testing.T) {
+	ca := smtptest.NewCA(t)
+	all := []string{"CRAM-MD5", "LOGIN", "PLAIN"}
+
+	tests := []struct {
+		name    string
+		auth    string
+		tls     bool
+		offered []string
+		want    string
+	}{
+		{"plain", AuthPlain, true, all, "PLAIN"},
+		{"login", AuthLogin, true, all, "LOGIN"},
+		{"cram-md5", AuthCRAMMD5, true, all, "CRAM-MD5"},
+		{"auto prefers plain over TLS", AuthAuto, true, all, "PLAIN"},
+		{"auto prefers cram-md5 without TLS", AuthAuto, false, all, "CRAM-MD5"},
+		{"auto falls back to login", AuthAuto, true, []string{"LOGIN"}, "LOGIN"},
+		{"plain to localhost without TLS", AuthPlain, false, all, "PLAIN"},
+		{"login to localhost without TLS", AuthLogin, false, all, "LOGIN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var serverCA *smtptest.CA
+			if tt.tls {
+				serverCA = ca
+			}
+			srv, server := authServer(t, serverCA, tt.offered...)
+			server.Auth = tt.auth
+			p := newTestPool(t, Config{})
+
+			send(t, p, server, "user@example.com")
+			send(t, p, server, "user@example.com")
+
+			logins := srv.Logins()
+			if len(logins) != 1 || logins[0].Mechanism != tt.want || logins[0].Username != "user" {
+				t.Errorf("logins = %+v, want one %s login", logins, tt.want)
+			}
+		})
+	}
+}
+
+func TestPool_AuthFailures(t *testing.T) {
+	tests := []struct {
+		name    string
+		offered []string
+		server  func(Server) Server
+		wantOp  string
+	}{
+		{"wrong password", []string{"PLAIN"}, func(s Server) Server { s.Password = "wrong"; return s }, OpAuth},
+		{"wrong cram-md5 password", []string{"CRAM-MD5"}, func(s Server) Server { s.Password = "wrong"; return s }, OpAuth},
+		{"no AUTH offered", nil, func(s Server) Server { return s }, OpAuth},
+		{"no common mechanism", []string{"XOAUTH2"}, func(s Server) Server { return s }, OpAuth},
+		{"auth none on a server requiring auth", []string{"PLAIN"}, func(s Server) Server { s.Auth = AuthNone; return s }, OpMail},
+		{"no username on a server requiring auth", []string{"PLAIN"}, func(s Server) Server { s.Username = ""; return s }, OpMail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, server := authServer(t, nil, tt.offered...)
+			p := newTestPool(t, Config{})
+
+			wantOp(t, sendErr(p, tt.server(server)), tt.wantOp)
+			if len(srv.Messages()) != 0 {
+				t.Error("message accepted without authentication")
+			}
+		})
+	}
+}
+
+func TestPool_RelayWithoutAuth(t *testing.T) {
+	srv := smtptest.NewUnstartedServer(t)
+	srv.AuthMechanisms = []string{"PLAIN"}
+	srv.Start()
+	p := newTestPool(t, Config{})
+
+	server := Server{Host: srv.Host, Port: srv.Port, Username: "user", Password: "secret", Encryption: EncryptionNone, Auth: AuthNone}
+	send(t, p, server, "user@example.com")
+
+	if got := countCommand(srv.Commands(), "AUTH"); got != 0 {
+		t.Errorf("AUTH sent %d times, want 0", got)
+	}
+}
+
+func TestLoginAuth_RefusesUnencryptedRemoteServers(t *testing.T) {
+	auth := &loginAuth{username: "user", password: "secret", host: "smtp.example.com"}
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: false}); err == nil {
+		t.Error("Start() over plaintext error = nil")
+	}
+
+	mechanism, _, err := auth.Start(&smtp.ServerInfo{Name: "smtp.example.com", TLS: true})
+	if err != nil || mechanism != "LOGIN" {
+		t.Fatalf("Start() = %q, %v", mechanism, err)
+	}
+	if answer, err := auth.Next([]byte("Username:"), true); err != nil || string(answer) != "user" {
+		t.Errorf("Next(Username:) = %q, %v", answer, err)
+	}
+	if answer, err := auth.Next([]byte("Password:"), true); err != nil || string(answer) != "secret" {
+		t.Errorf("Next(Password:) = %q, %v", answer, err)
+	}
+	if _, err := auth.Next([]byte("Token:"), true); err == nil {
+		t.Error("Next(Token:) error = nil")
+	}
+}
+
+func TestParseAuth(t *testing.T) {
+	for value, want := range map[string]string{"": AuthAuto, "PLAIN": AuthPlain, "login": AuthLogin, "CRAM-MD5": AuthCRAMMD5, "none": AuthNone} {
+		if got, err := ParseAuth(value); err != nil || got != want {
+			t.Errorf("ParseAuth(%q) = %q, %v, want %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseAuth("xoauth2"); err == nil {
+		t.Error("ParseAuth(xoauth2) error = nil")
+	}
+}
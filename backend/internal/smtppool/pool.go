@@ -0,0 +1,507 @@
+// Package smtppool keeps authenticated SMTP connections open between sends.
+// Connections are pooled per server and credentials, reset with RSET between
+// messages, health checked with NOOP after sitting idle, and replaced after
+// a maximum number of messages or an idle timeout.
+package smtppool
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// SMTP protocol steps reported in Error.Op
+const (
+	OpConnect  = "connect"
+	OpStartTLS = "starttls"
+	OpAuth     = "auth"
+	OpMail     = "mail"
+	OpRcpt     = "rcpt"
+	OpData     = "data"
+	OpWrite    = "write"
+	OpClose    = "close"
+)
+
+// ErrPoolClosed is returned by Send after Close
+var ErrPoolClosed = errors.New("smtp pool is closed")
+
+// Error is returned by Send when a protocol step fails
+type Error struct {
+	Op  string // protocol step, see Op* constants
+	Err error  // underlying error, a *textproto.Error for server replies
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return fmt.Sprintf("smtp %s: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Server identifies an SMTP server and the credentials used on it.
+// Each distinct Server gets its own set of connections.
+type Server struct {
+	Host       string
+	Port       int
+	Username   string // AUTH is skipped when empty
+	Password   string
+	Encryption string // Encryption* mode, STARTTLS when empty
+	Auth       string // Auth* mechanism, picked from the server's offer when empty
+	CAFile     string // PEM roots that replace the system roots
+	CertFile   string // PEM client certificate, with KeyFile
+	KeyFile    string
+}
+
+// addr returns the host:port of the server
+func (s Server) addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Config configures a Pool
+type Config struct {
+	MaxConns         int           // open connections per server (default 10)
+	MaxMessages      int           // messages sent on a connection before it is replaced (default 100)
+	IdleTimeout      time.Duration // idle connections older than this are closed (default 60s)
+	HealthCheckAfter time.Duration // idle connections older than this are checked with NOOP before use (default 15s)
+	DialTimeout      time.Duration // TCP connect timeout (default 10s)
+	CommandTimeout   time.Duration // deadline of each exchange when the context has none (default 30s)
+}
+
+// DefaultConfig returns the default pool configuration
+func DefaultConfig() Config {
+	return Config{
+		MaxConns:         10,
+		MaxMessages:      100,
+		IdleTimeout:      60 * time.Second,
+		HealthCheckAfter: 15 * time.Second,
+		DialTimeout:      10 * time.Second,
+		CommandTimeout:   30 * time.Second,
+	}
+}
+
+// ConfigFromEnv returns DefaultConfig overridden by SMTP_POOL_MAX_CONNS,
+// SMTP_POOL_MAX_MESSAGES and SMTP_POOL_IDLE_TIMEOUT_SECONDS
+func ConfigFromEnv() Config {
+	cfg := DefaultConfig()
+	if n, err := strconv.Atoi(os.Getenv("SMTP_POOL_MAX_CONNS")); err == nil && n > 0 {
+		cfg.MaxConns = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("SMTP_POOL_MAX_MESSAGES")); err == nil && n > 0 {
+		cfg.MaxMessages = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("SMTP_POOL_IDLE_TIMEOUT_SECONDS")); err == nil && n > 0 {
+		cfg.IdleTimeout = time.Duration(n) * time.Second
+	}
+	return cfg
+}
+
+var (
+	sharedOnce sync.Once
+	shared     *Pool
+)
+
+// Shared returns the process-wide pool used by the SMTP senders, created on
+// first use from ConfigFromEnv
+func Shared() *Pool {
+	sharedOnce.Do(func() {
+		shared = New(ConfigFromEnv())
+	})
+	return shared
+}
+
+// Pool is a set of reusable SMTP connections, safe for concurrent use
+type Pool struct {
+	config Config
+	logger zerolog.Logger
+
+	mu      sync.Mutex
+	servers map[Server]*serverPool
+	closed  bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// serverPool holds the connections of one server
+type serverPool struct {
+	slots chan struct{} // one token per open connection, capacity MaxConns
+	idle  chan *conn    // connections ready for reuse
+}
+
+// conn is a pooled SMTP connection
+type conn struct {
+	netConn  net.Conn
+	client   *smtp.Client
+	messages int
+	lastUsed time.Time
+}
+
+// New creates a pool and starts closing idle connections in the background
+func New(config Config) *Pool {
+	defaults := DefaultConfig()
+	if config.MaxConns <= 0 {
+		config.MaxConns = defaults.MaxConns
+	}
+	if config.MaxMessages <= 0 {
+		config.MaxMessages = defaults.MaxMessages
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	if config.HealthCheckAfter <= 0 {
+		config.HealthCheckAfter = defaults.HealthCheckAfter
+	}
+	if config.DialTimeout <= 0 {
+		config.DialTimeout = defaults.DialTimeout
+	}
+	if config.CommandTimeout <= 0 {
+		config.CommandTimeout = defaults.CommandTimeout
+	}
+
+	p := &Pool{
+		config:  config,
+		logger:  zerolog.New(os.Stdout).With().Timestamp().Logger(),
+		servers: make(map[Server]*serverPool),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go p.reapLoop()
+	return p
+}
+
+// Send delivers one message to server, reusing an idle connection when possible.
+// A reused connection that turns out to have been dropped by the server is
+// replaced transparently. Failures are returned as *Error, context errors as is.
+func (p *Pool) Send(ctx context.Context, server Server, from string, to []string, body []byte) error {
+	for {
+		c, reused, err := p.get(ctx, server)
+		if err != nil {
+			return err
+		}
+
+		err = p.transaction(ctx, c, from, to, body)
+		p.put(server, c, err == nil || isReply(err))
+		if err == nil {
+			return nil
+		}
+
+		// Nothing was accepted yet; retry on a fresh connection
+		var poolErr *Error
+		if reused && errors.As(err, &poolErr) && poolErr.Op == OpMail && !isReply(err) && ctx.Err() == nil {
+			p.logger.Debug().
+				Err(err).
+				Str("event", "smtp.pool.stale").
+				Str("host", server.Host).
+				Msg("Pooled SMTP connection was closed by the server, reconnecting")
+			continue
+		}
+		return err
+	}
+}
+
+// Close closes every idle connection; connections in use are closed when released
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	servers := make([]*serverPool, 0, len(p.servers))
+	for _, sp := range p.servers {
+		servers = append(servers, sp)
+	}
+	p.mu.Unlock()
+
+	close(p.stop)
+	<-p.done
+
+	for _, sp := range servers {
+		sp.drain(func(*conn) bool { return false })
+	}
+	return nil
+}
+
+// server returns the pool of server, creating it on first use
+func (p *Pool) server(server Server) (*serverPool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+	sp, ok := p.servers[server]
+	if !ok {
+		sp = &serverPool{
+			slots: make(chan struct{}, p.config.MaxConns),
+			idle:  make(chan *conn, p.config.MaxConns),
+		}
+		p.servers[server] = sp
+	}
+	return sp, nil
+}
+
+// get returns an idle connection that passes its checks, or dials a new one
+// once a slot is free. reused reports whether the connection was idle.
+func (p *Pool) get(ctx context.Context, server Server) (c *conn, reused bool, err error) {
+	sp, err := p.server(server)
+	if err != nil {
+		return nil, false, err
+	}
+
+	for {
+		// Prefer idle connections over dialing
+		select {
+		case c = <-sp.idle:
+		default:
+			select {
+			case c = <-sp.idle:
+			case sp.slots <- struct{}{}:
+				c, err = p.dial(ctx, server)
+				if err != nil {
+					<-sp.slots
+					return nil, false, err
+				}
+				return c, false, nil
+			case <-ctx.Done():
+				return nil, false, ctx.Err()
+			}
+		}
+
+		if p.usable(ctx, c) {
+			return c, true, nil
+		}
+		c.quit()
+		<-sp.slots
+	}
+}
+
+// usable reports whether an idle connection may be reused: it must not have
+// expired, and connections idle for a while must answer NOOP
+func (p *Pool) usable(ctx context.Context, c *conn) bool {
+	idle := time.Since(c.lastUsed)
+	if idle >= p.config.IdleTimeout {
+		return false
+	}
+	if idle < p.config.HealthCheckAfter {
+		return true
+	}
+
+	p.setDeadline(ctx, c)
+	return c.client.Noop() == nil
+}
+
+// put returns a connection to the pool after a send. Broken connections,
+// connections that reached MaxMessages and connections that fail RSET are closed.
+func (p *Pool) put(server Server, c *conn, healthy bool) {
+	p.mu.Lock()
+	sp := p.servers[server]
+	p.mu.Unlock()
+
+	if healthy && c.messages < p.config.MaxMessages {
+		p.setDeadline(context.Background(), c)
+		if err := c.client.Reset(); err == nil {
+			c.netConn.SetDeadline(time.Time{})
+			c.lastUsed = time.Now()
+
+			// Close drains the idle connections after setting closed
+			p.mu.Lock()
+			if !p.closed {
+				sp.idle <- c
+				p.mu.Unlock()
+				return
+			}
+			p.mu.Unlock()
+		}
+	}
+
+	if healthy {
+		c.quit()
+	} else {
+		c.client.Close()
+	}
+	<-sp.slots
+}
+
+// dial opens, encrypts and authenticates a connection to server
+func (p *Pool) dial(ctx context.Context, server Server) (*conn, error) {
+	var tlsConfig *tls.Config
+	if server.Encryption != EncryptionNone {
+		var err error
+		if tlsConfig, err = server.TLSConfig(); err != nil {
+			return nil, &Error{Op: OpConnect, Err: err}
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: p.config.DialTimeout}
+	var netConn net.Conn
+	var err error
+	if server.Encryption == EncryptionImplicit {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: tlsConfig}
+		netConn, err = tlsDialer.DialContext(ctx, "tcp", server.addr())
+	} else {
+		netConn, err = dialer.DialContext(ctx, "tcp", server.addr())
+	}
+	if err != nil {
+		return nil, &Error{Op: OpConnect, Err: err}
+	}
+
+	c := &conn{netConn: netConn}
+	p.setDeadline(ctx, c)
+
+	c.client, err = smtp.NewClient(netConn, server.Host)
+	if err != nil {
+		netConn.Close()
+		return nil, &Error{Op: OpConnect, Err: err}
+	}
+
+	if server.Encryption == "" || server.Encryption == EncryptionSTARTTLS {
+		if err := c.client.StartTLS(tlsConfig); err != nil {
+			c.client.Close()
+			return nil, &Error{Op: OpStartTLS, Err: err}
+		}
+	}
+
+	if server.authenticates() {
+		auth, err := server.auth(c.client)
+		if err == nil {
+			err = c.client.Auth(auth)
+		}
+		if err != nil {
+			c.client.Close()
+			return nil, &Error{Op: OpAuth, Err: err}
+		}
+	}
+
+	p.logger.Debug().
+		Str("event", "smtp.pool.connected").
+		Str("host", server.Host).
+		Int("port", server.Port).
+		Msg("Opened pooled SMTP connection")
+
+	return c, nil
+}
+
+// transaction sends one message on c
+func (p *Pool) transaction(ctx context.Context, c *conn, from string, to []string, body []byte) error {
+	p.setDeadline(ctx, c)
+	c.messages++
+
+	if err := c.client.Mail(from); err != nil {
+		return &Error{Op: OpMail, Err: err}
+	}
+	for _, rcpt := range to {
+		if err := c.client.Rcpt(rcpt); err != nil {
+			return &Error{Op: OpRcpt, Err: err}
+		}
+	}
+
+	writer, err := c.client.Data()
+	if err != nil {
+		return &Error{Op: OpData, Err: err}
+	}
+	if _, err := writer.Write(body); err != nil {
+		writer.Close()
+		return &Error{Op: OpWrite, Err: err}
+	}
+	if err := writer.Close(); err != nil {
+		return &Error{Op: OpClose, Err: err}
+	}
+	return nil
+}
+
+// setDeadline bounds the next exchange on c by the context deadline or CommandTimeout
+func (p *Pool) setDeadline(ctx context.Context, c *conn) {
+	deadline := time.Now().Add(p.config.CommandTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.netConn.SetDeadline(deadline)
+}
+
+// reapLoop closes expired idle connections until Close is called
+func (p *Pool) reapLoop() {
+	defer close(p.done)
+
+	interval := p.config.IdleTimeout / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			p.reap()
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// reap closes the idle connections that exceeded IdleTimeout
+func (p *Pool) reap() {
+	p.mu.Lock()
+	servers := make([]*serverPool, 0, len(p.servers))
+	for _, sp := range p.servers {
+		servers = append(servers, sp)
+	}
+	p.mu.Unlock()
+
+	for _, sp := range servers {
+		sp.drain(func(c *conn) bool {
+			return time.Since(c.lastUsed) < p.config.IdleTimeout
+		})
+	}
+}
+
+// drain takes every idle connection, closing those keep rejects and putting the others back
+func (sp *serverPool) drain(keep func(*conn) bool) {
+	var kept []*conn
+	for {
+		select {
+		case c := <-sp.idle:
+			if keep(c) {
+				kept = append(kept, c)
+				continue
+			}
+			c.quit()
+			<-sp.slots
+			continue
+		default:
+		}
+		break
+	}
+	for _, c := range kept {
+		sp.idle <- c
+	}
+}
+
+// quit ends the session politely and closes the connection
+func (c *conn) quit() {
+	c.netConn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err := c.client.Quit(); err != nil {
+		c.client.Close()
+	}
+}
+
+// isReply reports whether err is an SMTP reply from the server, which leaves
+// the connection usable after RSET
+func isReply(err error) bool {
+	var protoErr *textproto.Error
+	return errors.As(err, &protoErr)
+}
@@ -0,0 +1,237 @@
+package smtppool
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"backend/internal/smtptest"
+)
+
+func newTestPool(t *testing.T, config Config) *Pool {
+	t.Helper()
+	p := New(config)
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func testServer(s *smtptest.Server) Server {
+	return Server{Host: s.Host, Port: s.Port, Encryption: EncryptionNone}
+}
+
+func send(t *testing.T, p *Pool, server Server, to string) {
+	t.Helper()
+	body := []byte("Subject: test\r\n\r\nhello\r\n")
+	if err := p.Send(context.Background(), server, "from@example.com", []string{to}, body); err != nil {
+		t.Fatalf("Send(%s) error = %v", to, err)
+	}
+}
+
+func countCommand(commands []string, verb string) int {
+	n := 0
+	for _, c := range commands {
+		if c == verb {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPool_ReusesConnectionWithRSET(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	p := newTestPool(t, Config{})
+
+	for i := 0; i < 5; i++ {
+		send(t, p, testServer(srv), "user@example.com")
+	}
+
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("connections = %d, want 1", got)
+	}
+	if got := len(srv.Messages()); got != 5 {
+		t.Errorf("messages = %d, want 5", got)
+	}
+	commands := srv.Commands()
+	if got := countCommand(commands, "EHLO"); got != 1 {
+		t.Errorf("EHLO sent %d times, want 1", got)
+	}
+	if got := countCommand(commands, "RSET"); got != 5 {
+		t.Errorf("RSET sent %d times, want 5", got)
+	}
+}
+
+func TestPool_SeparatesServersByCredentials(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	p := newTestPool(t, Config{})
+
+	a := testServer(srv)
+	b := testServer(srv)
+	b.Password = "other"
+
+	send(t, p, a, "user@example.com")
+	send(t, p, a, "user@example.com")
+	send(t, p, b, "user@example.com")
+
+	if got := srv.Connections(); got != 2 {
+		t.Errorf("connections = %d, want 2", got)
+	}
+}
+
+func TestPool_MaxMessagesPerConnection(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	p := newTestPool(t, Config{MaxMessages: 2})
+
+	for i := 0; i < 5; i++ {
+		send(t, p, testServer(srv), "user@example.com")
+	}
+
+	if got := srv.Connections(); got != 3 {
+		t.Errorf("connections = %d, want 3", got)
+	}
+	if got := countCommand(srv.Commands(), "QUIT"); got != 2 {
+		t.Errorf("QUIT sent %d times, want 2", got)
+	}
+}
+
+func TestPool_LimitsConcurrentConnections(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	p := newTestPool(t, Config{MaxConns: 2})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			send(t, p, testServer(srv), "user@example.com")
+		}()
+	}
+	wg.Wait()
+
+	if got := srv.MaxActive(); got > 2 {
+		t.Errorf("max simultaneous connections = %d, want <= 2", got)
+	}
+	if got := len(srv.Messages()); got != 20 {
+		t.Errorf("messages = %d, want 20", got)
+	}
+}
+
+func TestPool_ReconnectsWhenServerDropsIdleConnection(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	p := newTestPool(t, Config{})
+
+	send(t, p, testServer(srv), "user@example.com")
+	srv.DropConnections()
+	send(t, p, testServer(srv), "user@example.com")
+
+	if got := srv.Connections(); got != 2 {
+		t.Errorf("connections = %d, want 2", got)
+	}
+	if got := len(srv.Messages()); got != 2 {
+		t.Errorf("messages = %d, want 2", got)
+	}
+}
+
+func TestPool_HealthCheckDiscardsDeadConnection(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	p := newTestPool(t, Config{HealthCheckAfter: time.Millisecond})
+
+	send(t, p, testServer(srv), "user@example.com")
+	srv.DropConnections()
+	time.Sleep(5 * time.Millisecond)
+	send(t, p, testServer(srv), "user@example.com")
+
+	if got := srv.Connections(); got != 2 {
+		t.Errorf("connections = %d, want 2", got)
+	}
+	if got := countCommand(srv.Commands(), "NOOP"); got != 0 {
+		// The dropped connection never reached the server's command loop
+		t.Errorf("NOOP reached the server %d times, want 0", got)
+	}
+}
+
+func TestPool_HealthCheckSendsNOOP(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	p := newTestPool(t, Config{HealthCheckAfter: time.Millisecond})
+
+	send(t, p, testServer(srv), "user@example.com")
+	time.Sleep(5 * time.Millisecond)
+	send(t, p, testServer(srv), "user@example.com")
+
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("connections = %d, want 1", got)
+	}
+	if got := countCommand(srv.Commands(), "NOOP"); got != 1 {
+		t.Errorf("NOOP sent %d times, want 1", got)
+	}
+}
+
+func TestPool_ClosesIdleConnections(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	p := newTestPool(t, Config{IdleTimeout: 20 * time.Millisecond})
+
+	send(t, p, testServer(srv), "user@example.com")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for countCommand(srv.Commands(), "QUIT") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("idle connection was not closed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	send(t, p, testServer(srv), "user@example.com")
+	if got := srv.Connections(); got != 2 {
+		t.Errorf("connections = %d, want 2", got)
+	}
+}
+
+func TestPool_RejectedRecipientKeepsConnection(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	srv.RejectRecipient = func(addr string) bool { return strings.HasPrefix(addr, "unknown@") }
+	p := newTestPool(t, Config{})
+
+	err := p.Send(context.Background(), testServer(srv), "from@example.com", []string{"unknown@example.com"}, []byte("x\r\n"))
+	var poolErr *Error
+	if !errors.As(err, &poolErr) || poolErr.Op != OpRcpt {
+		t.Fatalf("Send() error = %v, want rcpt *Error", err)
+	}
+	var protoErr *textproto.Error
+	if !errors.As(err, &protoErr) || protoErr.Code != 550 {
+		t.Fatalf("Send() error = %v, want 550 reply", err)
+	}
+
+	send(t, p, testServer(srv), "user@example.com")
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("connections = %d, want 1", got)
+	}
+}
+
+func TestPool_ConnectError(t *testing.T) {
+	p := newTestPool(t, Config{DialTimeout: time.Second})
+
+	err := p.Send(context.Background(), Server{Host: "127.0.0.1", Port: 1}, "from@example.com", []string{"user@example.com"}, []byte("x\r\n"))
+	var poolErr *Error
+	if !errors.As(err, &poolErr) || poolErr.Op != OpConnect {
+		t.Fatalf("Send() error = %v, want connect *Error", err)
+	}
+}
+
+func TestPool_SendAfterClose(t *testing.T) {
+	srv := smtptest.NewServer(t)
+	p := New(Config{})
+
+	send(t, p, testServer(srv), "user@example.com")
+	p.Close()
+
+	err := p.Send(context.Background(), testServer(srv), "from@example.com", []string{"user@example.com"}, []byte("x\r\n"))
+	if !errors.Is(err, ErrPoolClosed) {
+		t.Fatalf("Send() error = %v, want ErrPoolClosed", err)
+	}
+	if got := countCommand(srv.Commands(), "QUIT"); got != 1 {
+		t.Errorf("QUIT sent %d times, want 1", got)
+	}
+}
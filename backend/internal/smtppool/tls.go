@@ -0,0 +1,69 @@
+package smtppool
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Encryption modes of Server.Encryption
+const (
+	EncryptionSTARTTLS = "starttls" // upgrade after EHLO, usually port 587 (the default)
+	EncryptionImplicit = "implicit" // TLS from the first byte, usually port 465
+	EncryptionNone     = "none"     // plaintext, for internal relays
+)
+
+// ParseEncryption maps an encryption setting to an Encryption* mode
+// Empty picks implicit TLS on port 465 and STARTTLS elsewhere. As in most
+// mailer configurations "tls" means STARTTLS and "ssl" implicit TLS.
+func ParseEncryption(value string, port int) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		if port == 465 {
+			return EncryptionImplicit, nil
+		}
+		return EncryptionSTARTTLS, nil
+	case EncryptionSTARTTLS, "tls":
+		return EncryptionSTARTTLS, nil
+	case EncryptionImplicit, "ssl", "smtps":
+		return EncryptionImplicit, nil
+	case EncryptionNone:
+		return EncryptionNone, nil
+	default:
+		return "", fmt.Errorf("unknown SMTP encryption %q (expected starttls, implicit or none)", value)
+	}
+}
+
+// TLSConfig returns the TLS configuration of connections to the server
+// CAFile replaces the system roots; CertFile and KeyFile set the client
+// certificate presented to servers that ask for one.
+func (s Server) TLSConfig() (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: s.Host,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if s.CAFile != "" {
+		data, err := os.ReadFile(s.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SMTP CA file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in SMTP CA file %s", s.CAFile)
+		}
+		config.RootCAs = roots
+	}
+
+	if s.CertFile != "" || s.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(s.CertFile, s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SMTP client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
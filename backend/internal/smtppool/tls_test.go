@@ -0,0 +1,184 @@
+package smtppool
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"backend/internal/smtptest"
+)
+
+// sendErr sends one message and returns the error
+func sendErr(p *Pool, server Server) error {
+	body := []byte("Subject: test\r\n\r\nhello\r\n")
+	return p.Send(context.Background(), server, "from@example.com", []string{"user@example.com"}, body)
+}
+
+// wantOp fails the test unless err is an *Error of op
+func wantOp(t *testing.T, err error, op string) {
+	t.Helper()
+	var poolErr *Error
+	if !errors.As(err, &poolErr) || poolErr.Op != op {
+		t.Fatalf("Send() error = %v, want %s *Error", err, op)
+	}
+}
+
+func TestPool_EncryptionModes(t *testing.T) {
+	ca := smtptest.NewCA(t)
+
+	tests := []struct {
+		name        string
+		encryption  string
+		tls         bool // server offers STARTTLS
+		implicitTLS bool
+		wantTLS     bool
+		wantCommand string // command that must have been sent, if any
+	}{
+		{"default is starttls", "", true, false, true, "STARTTLS"},
+		{"starttls", EncryptionSTARTTLS, true, false, true, "STARTTLS"},
+		{"implicit", EncryptionImplicit, true, true, true, ""},
+		{"none", EncryptionNone, true, false, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := smtptest.NewUnstartedServer(t)
+			if tt.tls {
+				srv.TLSConfig = ca.ServerTLSConfig(t)
+			}
+			srv.ImplicitTLS = tt.implicitTLS
+			srv.Start()
+			p := newTestPool(t, Config{})
+
+			server := Server{Host: srv.Host, Port: srv.Port, Encryption: tt.encryption, CAFile: ca.CertFile}
+			send(t, p, server, "user@example.com")
+			send(t, p, server, "user@example.com")
+
+			messages := srv.Messages()
+			if len(messages) != 2 || messages[1].TLS != tt.wantTLS {
+				t.Fatalf("messages = %+v, want 2 with TLS %v", messages, tt.wantTLS)
+			}
+			commands := srv.Commands()
+			if tt.wantCommand != "" && countCommand(commands, tt.wantCommand) != 1 {
+				t.Errorf("%s sent %d times, want 1: %v", tt.wantCommand, countCommand(commands, tt.wantCommand), commands)
+			}
+			if !tt.wantTLS && countCommand(commands, "STARTTLS") != 0 {
+				t.Errorf("STARTTLS sent without encryption: %v", commands)
+			}
+		})
+	}
+}
+
+func TestPool_VerifiesServerCertificate(t *testing.T) {
+	ca := smtptest.NewCA(t)
+	other := smtptest.NewCA(t)
+
+	for _, implicit := range []bool{false, true} {
+		srv := smtptest.NewUnstartedServer(t)
+		srv.TLSConfig = ca.ServerTLSConfig(t)
+		srv.ImplicitTLS = implicit
+		srv.Start()
+		p := newTestPool(t, Config{})
+
+		server := Server{Host: srv.Host, Port: srv.Port, Encryption: EncryptionSTARTTLS, CAFile: other.CertFile}
+		wantOp := OpStartTLS
+		if implicit {
+			server.Encryption = EncryptionImplicit
+			wantOp = OpConnect
+		}
+
+		err := sendErr(p, server)
+		var poolErr *Error
+		var unknownAuthority interface{ Error() string }
+		if !errors.As(err, &poolErr) || poolErr.Op != wantOp || !errors.As(err, &unknownAuthority) {
+			t.Errorf("implicit=%v: Send() error = %v, want %s error for an untrusted certificate", implicit, err, wantOp)
+		}
+		if len(srv.Messages()) != 0 {
+			t.Errorf("implicit=%v: message sent to an untrusted server", implicit)
+		}
+	}
+}
+
+func TestPool_PresentsClientCertificate(t *testing.T) {
+	ca := smtptest.NewCA(t)
+	srv := smtptest.NewUnstartedServer(t)
+	srv.TLSConfig = ca.ServerTLSConfig(t)
+	srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	srv.Start()
+	p := newTestPool(t, Config{})
+
+	// Without a client certificate the handshake fails
+	server := Server{Host: srv.Host, Port: srv.Port, CAFile: ca.CertFile}
+	wantOp(t, sendErr(p, server), OpStartTLS)
+
+	client := ca.Issue(t, "mailblast")
+	server.CertFile, server.KeyFile = client.CertFile, client.KeyFile
+	send(t, p, server, "user@example.com")
+
+	if got := srv.ClientCertificates(); len(got) != 1 || got[0] != "mailblast" {
+		t.Errorf("client certificates = %v, want [mailblast]", got)
+	}
+}
+
+func TestServer_TLSConfigErrors(t *testing.T) {
+	ca := smtptest.NewCA(t)
+	client := ca.Issue(t, "mailblast")
+	notPEM := filepath.Join(t.TempDir(), "not.pem")
+	os.WriteFile(notPEM, []byte("not a certificate"), 0o600)
+
+	tests := []struct {
+		name   string
+		server Server
+	}{
+		{"missing CA file", Server{CAFile: filepath.Join(t.TempDir(), "missing.pem")}},
+		{"CA file without certificates", Server{CAFile: notPEM}},
+		{"certificate without key", Server{CertFile: client.CertFile}},
+		{"mismatched key", Server{CertFile: client.CertFile, KeyFile: ca.Issue(t, "other").KeyFile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.server.TLSConfig(); err == nil {
+				t.Error("TLSConfig() error = nil")
+			}
+		})
+	}
+
+	config, err := Server{Host: "smtp.example.com", CAFile: ca.CertFile, CertFile: client.CertFile, KeyFile: client.KeyFile}.TLSConfig()
+	if err != nil {
+		t.Fatalf("TLSConfig() error = %v", err)
+	}
+	if config.ServerName != "smtp.example.com" || config.RootCAs == nil || len(config.Certificates) != 1 {
+		t.Errorf("unexpected TLS config: %+v", config)
+	}
+}
+
+func TestParseEncryption(t *testing.T) {
+	tests := []struct {
+		value string
+		port  int
+		want  string
+	}{
+		{"", 587, EncryptionSTARTTLS},
+		{"", 25, EncryptionSTARTTLS},
+		{"", 465, EncryptionImplicit},
+		{"tls", 465, EncryptionSTARTTLS},
+		{"STARTTLS", 587, EncryptionSTARTTLS},
+		{"ssl", 587, EncryptionImplicit},
+		{"implicit", 2465, EncryptionImplicit},
+		{"none", 25, EncryptionNone},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseEncryption(tt.value, tt.port)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseEncryption(%q, %d) = %q, %v, want %q", tt.value, tt.port, got, err, tt.want)
+		}
+	}
+	if _, err := ParseEncryption("plaintext", 25); err == nil {
+		t.Error("ParseEncryption(plaintext) error = nil")
+	}
+}
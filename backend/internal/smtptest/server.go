@@ -0,0 +1,412 @@
+// Package smtptest provides an in-process SMTP server for tests.
+package smtptest
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Message is an email received by the Server
+type Message struct {
+	From string
+	To   []string
+	Data string
+	TLS  bool // received over STARTTLS or implicit TLS
+}
+
+// Login is a successful AUTH exchange
+type Login struct {
+	Mechanism string // PLAIN, LOGIN or CRAM-MD5
+	Username  string
+}
+
+// Server is a minimal SMTP server listening on 127.0.0.1.
+// It accepts every message unless RejectRecipient matches, and records the
+// messages, commands and connections it sees. Options other than
+// RejectRecipient are set between NewUnstartedServer and Start.
+type Server struct {
+	Addr string
+	Host string
+	Port int
+
+	// RejectRecipient, when set, answers 550 to RCPT TO for matching addresses
+	RejectRecipient func(addr string) bool
+
+	// TLSConfig, when set, is offered through STARTTLS, or used from the
+	// first byte when ImplicitTLS is set
+	TLSConfig   *tls.Config
+	ImplicitTLS bool
+
+	// AuthMechanisms are advertised in the EHLO reply (PLAIN, LOGIN, CRAM-MD5)
+	AuthMechanisms []string
+
+	// Users, when set, are the accepted credentials by username, and MAIL is
+	// refused until the client authenticates
+	Users map[string]string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+
+	mu          sync.Mutex
+	messages    []Message
+	commands    []string
+	logins      []Login
+	clientCerts []string
+	conns       map[net.Conn]struct{}
+	accepted    int
+	maxActive   int
+}
+
+// NewServer starts a server that is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := NewUnstartedServer(t)
+	s.Start()
+	return s
+}
+
+// NewUnstartedServer returns a server that listens but does not accept
+// connections until Start, so its options can be set first
+func NewUnstartedServer(t testing.TB) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("smtptest: failed to listen: %v", err)
+	}
+
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &Server{
+		Addr:     addr.String(),
+		Host:     addr.IP.String(),
+		Port:     addr.Port,
+		listener: listener,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Start accepts connections
+func (s *Server) Start() {
+	s.wg.Add(1)
+	go s.serve()
+}
+
+// Close stops the server and closes every open connection
+func (s *Server) Close() {
+	s.listener.Close()
+	s.DropConnections()
+	s.wg.Wait()
+}
+
+// DropConnections closes every open connection, as a server timing out idle clients would
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// Messages returns the messages received so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// Commands returns the verbs of the commands received so far (EHLO, MAIL, RSET, ...)
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Logins returns the successful AUTH exchanges so far
+func (s *Server) Logins() []Login {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Login(nil), s.logins...)
+}
+
+// ClientCertificates returns the common names of the verified client
+// certificates presented in TLS handshakes
+func (s *Server) ClientCertificates() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.clientCerts...)
+}
+
+// Connections returns how many connections were accepted
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+// MaxActive returns the highest number of simultaneously open connections
+func (s *Server) MaxActive() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxActive
+}
+
+// serve accepts connections until the listener is closed
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.accepted++
+		if len(s.conns) > s.maxActive {
+			s.maxActive = len(s.conns)
+		}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+			conn.Close()
+		}()
+	}
+}
+
+// handle runs one SMTP session
+func (s *Server) handle(conn net.Conn) {
+	var tlsConn *tls.Conn
+	if s.ImplicitTLS {
+		if tlsConn = s.handshake(conn); tlsConn == nil {
+			return
+		}
+		conn = tlsConn
+	}
+
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err
+	}
+
+	reply("220 smtptest ready")
+	var msg Message
+	authenticated := false
+	for {
+		line, err := readLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		verb = strings.ToUpper(verb)
+
+		s.mu.Lock()
+		s.commands = append(s.commands, verb)
+		s.mu.Unlock()
+
+		switch verb {
+		case "EHLO":
+			reply("250-smtptest")
+			if s.TLSConfig != nil && tlsConn == nil {
+				reply("250-STARTTLS")
+			}
+			if len(s.AuthMechanisms) > 0 {
+				reply("250-AUTH %s", strings.Join(s.AuthMechanisms, " "))
+			}
+			reply("250 8BITMIME")
+		case "HELO":
+			reply("250 smtptest")
+		case "STARTTLS":
+			if s.TLSConfig == nil || tlsConn != nil {
+				reply("502 5.5.1 STARTTLS not available")
+				continue
+			}
+			reply("220 2.0.0 Ready to start TLS")
+			if tlsConn = s.handshake(conn); tlsConn == nil {
+				return
+			}
+			conn = tlsConn
+			r = bufio.NewReader(conn)
+			msg, authenticated = Message{}, false
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			username, ok := s.authenticate(strings.ToUpper(mechanism), initial, reply, readLine)
+			if !ok {
+				reply("535 5.7.8 Authentication credentials invalid")
+				continue
+			}
+			authenticated = true
+			s.mu.Lock()
+			s.logins = append(s.logins, Login{Mechanism: strings.ToUpper(mechanism), Username: username})
+			s.mu.Unlock()
+			reply("235 2.7.0 Authentication successful")
+		case "MAIL":
+			if s.Users != nil && !authenticated {
+				reply("530 5.7.0 Authentication required")
+				continue
+			}
+			msg = Message{From: address(arg), TLS: tlsConn != nil}
+			reply("250 2.1.0 Ok")
+		case "RCPT":
+			to := address(arg)
+			if s.RejectRecipient != nil && s.RejectRecipient(to) {
+				reply("550 5.1.1 No such user")
+				continue
+			}
+			msg.To = append(msg.To, to)
+			reply("250 2.1.5 Ok")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg.Data = data.String()
+			s.mu.Lock()
+			s.messages = append(s.messages, msg)
+			s.mu.Unlock()
+			msg = Message{TLS: tlsConn != nil}
+			reply("250 2.0.0 Ok: queued")
+		case "RSET":
+			msg = Message{TLS: tlsConn != nil}
+			reply("250 2.0.0 Ok")
+		case "NOOP":
+			reply("250 2.0.0 Ok")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			reply("502 5.5.2 Command not recognized")
+		}
+	}
+}
+
+// handshake runs the server side of a TLS handshake and records the client
+// certificate; it returns nil when the handshake fails
+func (s *Server) handshake(conn net.Conn) *tls.Conn {
+	tlsConn := tls.Server(conn, s.TLSConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return nil
+	}
+	if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+		s.mu.Lock()
+		s.clientCerts = append(s.clientCerts, certs[0].Subject.CommonName)
+		s.mu.Unlock()
+	}
+	return tlsConn
+}
+
+// authenticate runs one AUTH exchange and returns the username when the
+// credentials match Users
+func (s *Server) authenticate(mechanism, initial string, reply func(string, ...interface{}), readLine func() (string, error)) (string, bool) {
+	advertised := false
+	for _, m := range s.AuthMechanisms {
+		advertised = advertised || strings.EqualFold(m, mechanism)
+	}
+	if !advertised {
+		return "", false
+	}
+
+	// challenge sends a base64 challenge and decodes the client's answer
+	challenge := func(prompt string) (string, bool) {
+		reply("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := readLine()
+		if err != nil {
+			return "", false
+		}
+		answer, err := base64.StdEncoding.DecodeString(line)
+		return string(answer), err == nil
+	}
+
+	switch mechanism {
+	case "PLAIN":
+		var response string
+		if initial != "" {
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			if err != nil {
+				return "", false
+			}
+			response = string(decoded)
+		} else {
+			var ok bool
+			if response, ok = challenge(""); !ok {
+				return "", false
+			}
+		}
+		parts := strings.Split(response, "\x00")
+		if len(parts) != 3 {
+			return "", false
+		}
+		return parts[1], s.checkPassword(parts[1], parts[2])
+	case "LOGIN":
+		username, ok := challenge("Username:")
+		if !ok {
+			return "", false
+		}
+		password, ok := challenge("Password:")
+		if !ok {
+			return "", false
+		}
+		return username, s.checkPassword(username, password)
+	case "CRAM-MD5":
+		nonce := fmt.Sprintf("<%d.smtptest@127.0.0.1>", len(s.Logins()))
+		response, ok := challenge(nonce)
+		if !ok {
+			return "", false
+		}
+		username, digest, ok := strings.Cut(response, " ")
+		password, known := s.Users[username]
+		if !ok || !known {
+			return "", false
+		}
+		mac := hmac.New(md5.New, []byte(password))
+		mac.Write([]byte(nonce))
+		return username, hmac.Equal([]byte(digest), []byte(hex.EncodeToString(mac.Sum(nil))))
+	default:
+		return "", false
+	}
+}
+
+// checkPassword reports whether username and password match Users
+func (s *Server) checkPassword(username, password string) bool {
+	expected, ok := s.Users[username]
+	return ok && expected == password
+}
+
+// address extracts the address of a "FROM:<a@b>" or "TO:<a@b>" argument
+func address(arg string) string {
+	if _, value, ok := strings.Cut(arg, ":"); ok {
+		arg = value
+	}
+	if i := strings.IndexByte(arg, ' '); i != -1 {
+		arg = arg[:i]
+	}
+	return strings.Trim(arg, "<>")
+}
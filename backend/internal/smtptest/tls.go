@@ -0,0 +1,144 @@
+package smtptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// CA is a throwaway certificate authority for TLS tests
+type CA struct {
+	// CertFile is the PEM file of the CA certificate, to trust it
+	CertFile string
+
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	dir  string
+}
+
+// Certificate is a certificate issued by a CA
+type Certificate struct {
+	tls.Certificate
+	CertFile string // PEM certificate
+	KeyFile  string // PEM private key
+}
+
+// NewCA creates a CA whose files are removed when the test ends
+func NewCA(t testing.TB) *CA {
+	t.Helper()
+	key := newKey(t)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "smtptest CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("smtptest: failed to create CA: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("smtptest: failed to parse CA: %v", err)
+	}
+
+	ca := &CA{cert: cert, key: key, dir: t.TempDir()}
+	ca.CertFile = ca.writePEM(t, "ca.pem", "CERTIFICATE", der)
+	return ca
+}
+
+// Pool returns a certificate pool holding the CA
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// Issue creates a certificate for commonName, valid for the given IP
+// addresses and host names and for both server and client authentication
+func (ca *CA) Issue(t testing.TB, commonName string, hosts ...string) Certificate {
+	t.Helper()
+	key := newKey(t)
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatalf("smtptest: failed to create serial: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("smtptest: failed to issue certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("smtptest: failed to marshal key: %v", err)
+	}
+
+	cert := Certificate{
+		CertFile: ca.writePEM(t, serial.String()+".pem", "CERTIFICATE", der),
+		KeyFile:  ca.writePEM(t, serial.String()+".key", "PRIVATE KEY", keyDER),
+	}
+	if cert.Certificate, err = tls.LoadX509KeyPair(cert.CertFile, cert.KeyFile); err != nil {
+		t.Fatalf("smtptest: failed to load certificate: %v", err)
+	}
+	return cert
+}
+
+// ServerTLSConfig returns a TLS configuration for a Server on 127.0.0.1 that
+// verifies client certificates issued by the CA when clients present one
+func (ca *CA) ServerTLSConfig(t testing.TB) *tls.Config {
+	t.Helper()
+	return &tls.Config{
+		Certificates: []tls.Certificate{ca.Issue(t, "smtptest", "127.0.0.1", "localhost").Certificate},
+		ClientCAs:    ca.Pool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+}
+
+// writePEM writes one PEM block to a file in the CA's directory
+func (ca *CA) writePEM(t testing.TB, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(ca.dir, name)
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("smtptest: failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// newKey creates an ECDSA P-256 key
+func newKey(t testing.TB) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("smtptest: failed to generate key: %v", err)
+	}
+	return key
+}
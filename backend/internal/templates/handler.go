@@ -0,0 +1,306 @@
+package templates
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"backend/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// Handler handles template HTTP requests
+type Handler struct {
+	service Service
+	logger  zerolog.Logger
+}
+
+// NewHandler creates a new template handler
+func NewHandler(service Service) *Handler {
+	return &Handler{
+		service: service,
+		logger:  zerolog.New(os.Stdout).With().Timestamp().Logger(),
+	}
+}
+
+// HTTPTemplateRequest represents the HTTP request body for creating a template
+type HTTPTemplateRequest struct {
+	TemplateRequest
+	ClientID string `json:"client_id"` // admins only
+}
+
+// RenderRequest represents the HTTP request body for previewing a template
+type RenderRequest struct {
+	Version int                    `json:"version"` // 0 for the latest version
+	Data    map[string]interface{} `json:"data"`
+}
+
+// errNoClient is returned when a non-admin user is not linked to a client
+var errNoClient = errors.New("user is not linked to a client")
+
+// errInvalidID is returned when the :id route parameter is not a UUID
+var errInvalidID = errors.New("invalid id")
+
+// errInvalidVersion is returned when the :version route parameter is not a number
+var errInvalidVersion = errors.New("invalid version")
+
+// clientScope returns the client whose templates the user may access (nil for admins)
+func clientScope(c *fiber.Ctx) (*uuid.UUID, error) {
+	if middleware.IsAdmin(c) {
+		return nil, nil
+	}
+	clientID := middleware.ClientIDFromContext(c)
+	if clientID == nil {
+		return nil, errNoClient
+	}
+	return clientID, nil
+}
+
+// CreateTemplate handles POST /templates
+func (h *Handler) CreateTemplate(c *fiber.Ctx) error {
+	var req HTTPTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	scope, err := clientScope(c)
+	if err != nil {
+		return h.handleError(c, err, "template.create_failed")
+	}
+	var clientID uuid.UUID
+	if scope != nil {
+		clientID = *scope
+	} else {
+		if clientID, err = uuid.Parse(req.ClientID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "client_id is required",
+			})
+		}
+	}
+
+	template, err := h.service.CreateTemplate(c.Context(), clientID, &req.TemplateRequest)
+	if err != nil {
+		return h.handleError(c, err, "template.create_failed")
+	}
+
+	h.logger.Info().
+		Str("event", "template.created").
+		Str("template_id", template.ID.String()).
+		Str("client_id", template.ClientID.String()).
+		Msg("Template created")
+
+	return c.Status(fiber.StatusCreated).JSON(template)
+}
+
+// ListTemplates handles GET /templates?client_id= (client_id for admins only)
+func (h *Handler) ListTemplates(c *fiber.Ctx) error {
+	scope, err := clientScope(c)
+	if err != nil {
+		return h.handleError(c, err, "template.list_failed")
+	}
+	if scope == nil && c.Query("client_id") != "" {
+		clientID, err := uuid.Parse(c.Query("client_id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid client_id",
+			})
+		}
+		scope = &clientID
+	}
+
+	templates, err := h.service.ListTemplates(c.Context(), scope)
+	if err != nil {
+		return h.handleError(c, err, "template.list_failed")
+	}
+
+	return c.JSON(fiber.Map{
+		"templates": templates,
+	})
+}
+
+// GetTemplate handles GET /templates/:id
+func (h *Handler) GetTemplate(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "template.get_failed")
+	}
+
+	template, err := h.service.GetTemplate(c.Context(), id, scope)
+	if err != nil {
+		return h.handleError(c, err, "template.get_failed")
+	}
+	return c.JSON(template)
+}
+
+// UpdateTemplate handles PUT /templates/:id
+func (h *Handler) UpdateTemplate(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "template.update_failed")
+	}
+
+	var req UpdateTemplateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	template, err := h.service.UpdateTemplate(c.Context(), id, scope, &req)
+	if err != nil {
+		return h.handleError(c, err, "template.update_failed")
+	}
+	return c.JSON(template)
+}
+
+// DeleteTemplate handles DELETE /templates/:id
+func (h *Handler) DeleteTemplate(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "template.delete_failed")
+	}
+
+	if err := h.service.DeleteTemplate(c.Context(), id, scope); err != nil {
+		return h.handleError(c, err, "template.delete_failed")
+	}
+
+	h.logger.Info().
+		Str("event", "template.deleted").
+		Str("template_id", id.String()).
+		Msg("Template deleted")
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// CreateVersion handles POST /templates/:id/versions
+func (h *Handler) CreateVersion(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "template.version.create_failed")
+	}
+
+	var req VersionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	version, err := h.service.CreateVersion(c.Context(), id, scope, &req)
+	if err != nil {
+		return h.handleError(c, err, "template.version.create_failed")
+	}
+
+	h.logger.Info().
+		Str("event", "template.version.created").
+		Str("template_id", id.String()).
+		Int("version", version.Version).
+		Msg("Template version created")
+
+	return c.Status(fiber.StatusCreated).JSON(version)
+}
+
+// ListVersions handles GET /templates/:id/versions
+func (h *Handler) ListVersions(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "template.version.list_failed")
+	}
+
+	versions, err := h.service.ListVersions(c.Context(), id, scope)
+	if err != nil {
+		return h.handleError(c, err, "template.version.list_failed")
+	}
+
+	return c.JSON(fiber.Map{
+		"versions": versions,
+	})
+}
+
+// GetVersion handles GET /templates/:id/versions/:version
+func (h *Handler) GetVersion(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "template.version.get_failed")
+	}
+	number, err := strconv.Atoi(c.Params("version"))
+	if err != nil || number < 1 {
+		return h.handleError(c, errInvalidVersion, "template.version.get_failed")
+	}
+
+	version, err := h.service.GetVersion(c.Context(), id, number, scope)
+	if err != nil {
+		return h.handleError(c, err, "template.version.get_failed")
+	}
+	return c.JSON(version)
+}
+
+// RenderTemplate handles POST /templates/:id/render, previewing a version
+// with merge data
+func (h *Handler) RenderTemplate(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "template.render_failed")
+	}
+
+	var req RenderRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	rendered, err := h.service.RenderTemplate(c.Context(), id, req.Version, scope, req.Data)
+	if err != nil {
+		return h.handleError(c, err, "template.render_failed")
+	}
+	return c.JSON(rendered)
+}
+
+// parseRequest returns the :id route parameter and the caller's client scope
+func (h *Handler) parseRequest(c *fiber.Ctx) (uuid.UUID, *uuid.UUID, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, nil, errInvalidID
+	}
+	scope, err := clientScope(c)
+	return id, scope, err
+}
+
+// handleError maps service errors to HTTP responses
+func (h *Handler) handleError(c *fiber.Ctx, err error, event string) error {
+	switch {
+	case errors.Is(err, errInvalidID), errors.Is(err, errInvalidVersion),
+		errors.Is(err, ErrInvalidTemplate), errors.Is(err, ErrInvalidData):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, errNoClient):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrTemplateNotFound), errors.Is(err, ErrVersionNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrNameTaken), errors.Is(err, ErrTemplateInUse):
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.logger.Error().
+		Err(err).
+		Str("event", event).
+		Msg("Template request failed")
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "internal server error",
+	})
+}
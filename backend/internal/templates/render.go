@@ -0,0 +1,201 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"backend/internal/mergetags"
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidTemplate is returned for template content or schemas that do not validate
+	ErrInvalidTemplate = errors.New("invalid template")
+	// ErrInvalidData is returned when merge data does not match a version's variables
+	ErrInvalidData = errors.New("invalid template data")
+)
+
+// BuiltinVariables are provided by every send and need no declaration
+var BuiltinVariables = []string{"email"}
+
+// Rendered is a template version rendered with merge data
+type Rendered struct {
+	TemplateID uuid.UUID `json:"template_id"`
+	Version    int       `json:"version"`
+	Subject    string    `json:"subject"`
+	HTML       string    `json:"html"`
+	Text       string    `json:"text"`
+}
+
+// Render renders a version with data
+// Defaults of the variables schema fill in missing values; missing required
+// variables and values of the wrong type are reported as ErrInvalidData.
+func Render(version *models.TemplateVersion, data map[string]interface{}) (*Rendered, error) {
+	data, err := applySchema(version.Variables, data)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered := &Rendered{TemplateID: version.TemplateID, Version: version.Version}
+	if rendered.Subject, err = mergetags.Render(version.Subject, data, false); err != nil {
+		return nil, fmt.Errorf("%w: subject: %v", ErrInvalidData, err)
+	}
+	if rendered.HTML, err = mergetags.Render(version.HTMLContent, data, true); err != nil {
+		return nil, fmt.Errorf("%w: html: %v", ErrInvalidData, err)
+	}
+	if rendered.Text, err = mergetags.Render(version.TextContent, data, false); err != nil {
+		return nil, fmt.Errorf("%w: text: %v", ErrInvalidData, err)
+	}
+	return rendered, nil
+}
+
+// RequiredVariables returns the variables a version cannot render without
+func RequiredVariables(version *models.TemplateVersion) []string {
+	var names []string
+	for _, variable := range version.Variables {
+		if variable.Required && variable.Default == nil {
+			names = append(names, variable.Name)
+		}
+	}
+	return names
+}
+
+// applySchema returns data with the defaults of vars filled in, checking
+// required variables and value types
+func applySchema(vars models.TemplateVariables, data map[string]interface{}) (map[string]interface{}, error) {
+	merged := make(map[string]interface{}, len(data)+len(vars))
+	for key, value := range data {
+		merged[key] = value
+	}
+
+	var missing []string
+	for _, variable := range vars {
+		value, ok := merged[variable.Name]
+		if !ok || value == nil {
+			switch {
+			case variable.Default != nil:
+				merged[variable.Name] = variable.Default
+			case variable.Required:
+				missing = append(missing, variable.Name)
+			}
+			continue
+		}
+		if !hasType(value, variable.Type) {
+			return nil, fmt.Errorf("%w: %s must be of type %s", ErrInvalidData, variable.Name, typeName(variable.Type))
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing required variables %s", ErrInvalidData, strings.Join(missing, ", "))
+	}
+	return merged, nil
+}
+
+// validateVersion checks the content and variables schema of a version and
+// normalizes variable types
+func validateVersion(version *models.TemplateVersion) error {
+	if strings.TrimSpace(version.Subject) == "" {
+		return fmt.Errorf("%w: subject is required", ErrInvalidTemplate)
+	}
+	if version.HTMLContent == "" && version.TextContent == "" {
+		return fmt.Errorf("%w: html or text is required", ErrInvalidTemplate)
+	}
+
+	declared := make(map[string]models.TemplateVariable, len(version.Variables))
+	for i := range version.Variables {
+		variable := &version.Variables[i]
+		if variable.Type == "" {
+			variable.Type = models.TemplateVariableString
+		}
+		if !mergetags.ValidName(variable.Name) {
+			return fmt.Errorf("%w: invalid variable name %q", ErrInvalidTemplate, variable.Name)
+		}
+		if _, ok := declared[variable.Name]; ok {
+			return fmt.Errorf("%w: variable %s is declared twice", ErrInvalidTemplate, variable.Name)
+		}
+		switch variable.Type {
+		case models.TemplateVariableString, models.TemplateVariableNumber, models.TemplateVariableBoolean, models.TemplateVariableObject:
+		default:
+			return fmt.Errorf("%w: variable %s has unknown type %q", ErrInvalidTemplate, variable.Name, variable.Type)
+		}
+		if variable.Default != nil && !hasType(variable.Default, variable.Type) {
+			return fmt.Errorf("%w: default of %s must be of type %s", ErrInvalidTemplate, variable.Name, typeName(variable.Type))
+		}
+		declared[variable.Name] = *variable
+	}
+
+	used := make(map[string]bool)
+	fields := []struct{ name, content string }{
+		{"subject", version.Subject},
+		{"html", version.HTMLContent},
+		{"text", version.TextContent},
+	}
+	for _, field := range fields {
+		names, _, err := mergetags.Variables(field.content)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidTemplate, field.name, err)
+		}
+		for _, name := range names {
+			used[name] = true
+		}
+	}
+
+	var undeclared []string
+	for name := range used {
+		if !isDeclared(name, declared) {
+			undeclared = append(undeclared, name)
+		}
+	}
+	if len(undeclared) > 0 {
+		sort.Strings(undeclared)
+		return fmt.Errorf("%w: undeclared variables %s", ErrInvalidTemplate, strings.Join(undeclared, ", "))
+	}
+	return nil
+}
+
+// isDeclared reports whether a tag name is a built-in, a declared variable
+// or a path into a declared object
+func isDeclared(name string, declared map[string]models.TemplateVariable) bool {
+	for _, builtin := range BuiltinVariables {
+		if name == builtin {
+			return true
+		}
+	}
+	if _, ok := declared[name]; ok {
+		return true
+	}
+	for i := strings.LastIndex(name, "."); i > 0; i = strings.LastIndex(name[:i], ".") {
+		if variable, ok := declared[name[:i]]; ok && variable.Type == models.TemplateVariableObject {
+			return true
+		}
+	}
+	return false
+}
+
+// hasType reports whether a decoded JSON value is of a variable type
+func hasType(value interface{}, variableType string) bool {
+	switch value.(type) {
+	case string:
+		return variableType == models.TemplateVariableString || variableType == ""
+	case float64, float32, int, int64, int32, json.Number:
+		return variableType == models.TemplateVariableNumber
+	case bool:
+		return variableType == models.TemplateVariableBoolean
+	case map[string]interface{}:
+		return variableType == models.TemplateVariableObject
+	default:
+		return false
+	}
+}
+
+// typeName returns the type of a variable for error messages
+func typeName(variableType string) string {
+	if variableType == "" {
+		return models.TemplateVariableString
+	}
+	return variableType
+}
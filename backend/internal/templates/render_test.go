@@ -0,0 +1,89 @@
+package templates
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"backend/internal/models"
+)
+
+func TestRender(t *testing.T) {
+	version := &models.TemplateVersion{
+		Version:     4,
+		Subject:     "Order {{order.id}} for {{name}}",
+		HTMLContent: "<p>{{name}}</p>",
+		TextContent: "{{name}}: {{total}} {{paid}}",
+		Variables: models.TemplateVariables{
+			{Name: "name", Type: models.TemplateVariableString, Default: "customer"},
+			{Name: "order", Type: models.TemplateVariableObject, Required: true},
+			{Name: "total", Type: models.TemplateVariableNumber, Required: true},
+			{Name: "paid", Type: models.TemplateVariableBoolean, Default: false},
+		},
+	}
+
+	rendered, err := Render(version, map[string]interface{}{
+		"name":  "<Ada>",
+		"order": map[string]interface{}{"id": "A-1"},
+		"total": 9.5,
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	if rendered.Subject != "Order A-1 for <Ada>" || rendered.HTML != "<p>&lt;Ada&gt;</p>" || rendered.Text != "<Ada>: 9.5 false" || rendered.Version != 4 {
+		t.Errorf("unexpected rendering: %+v", rendered)
+	}
+
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want string
+	}{
+		{"missing required", map[string]interface{}{"order": map[string]interface{}{"id": 1}}, "total"},
+		{"wrong type", map[string]interface{}{"order": map[string]interface{}{"id": 1}, "total": "9.5"}, "total must be of type number"},
+		{"object is not a map", map[string]interface{}{"order": "A-1", "total": 1}, "order must be of type object"},
+		{"missing nested value", map[string]interface{}{"order": map[string]interface{}{}, "total": 1}, "order.id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Render(version, tt.data)
+			if !errors.Is(err, ErrInvalidData) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Render() error = %v, want ErrInvalidData mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		version models.TemplateVersion
+		want    string // empty for valid versions
+	}{
+		{"valid", models.TemplateVersion{Subject: "Hi {{email}}", TextContent: "{{user.name}}", Variables: models.TemplateVariables{{Name: "user", Type: models.TemplateVariableObject}}}, ""},
+		{"missing subject", models.TemplateVersion{TextContent: "Hi"}, "subject is required"},
+		{"missing body", models.TemplateVersion{Subject: "Hi"}, "html or text is required"},
+		{"bad syntax", models.TemplateVersion{Subject: "Hi", TextContent: "{{name"}, "text"},
+		{"undeclared variables", models.TemplateVersion{Subject: "Hi {{b}}", HTMLContent: "{{a}} {{user.name}}"}, "undeclared variables a, b, user.name"},
+		{"path into a string", models.TemplateVersion{Subject: "Hi", TextContent: "{{user.name}}", Variables: models.TemplateVariables{{Name: "user"}}}, "undeclared variables user.name"},
+		{"duplicate variable", models.TemplateVersion{Subject: "Hi", TextContent: "x", Variables: models.TemplateVariables{{Name: "a"}, {Name: "a"}}}, "declared twice"},
+		{"invalid name", models.TemplateVersion{Subject: "Hi", TextContent: "x", Variables: models.TemplateVariables{{Name: "a b"}}}, "invalid variable name"},
+		{"unknown type", models.TemplateVersion{Subject: "Hi", TextContent: "x", Variables: models.TemplateVariables{{Name: "a", Type: "date"}}}, "unknown type"},
+		{"default of wrong type", models.TemplateVersion{Subject: "Hi", TextContent: "x", Variables: models.TemplateVariables{{Name: "a", Type: models.TemplateVariableNumber, Default: "1"}}}, "default of a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateVersion(&tt.version)
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("validateVersion() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidTemplate) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("validateVersion() error = %v, want ErrInvalidTemplate mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrTemplateNotFound is returned when a template does not exist
+	ErrTemplateNotFound = errors.New("template not found")
+	// ErrVersionNotFound is returned when a template has no such version
+	ErrVersionNotFound = errors.New("template version not found")
+)
+
+// Repository defines the template repository interface
+type Repository interface {
+	CreateTemplate(ctx context.Context, template *models.Template, version *models.TemplateVersion) error
+	GetTemplate(ctx context.Context, id uuid.UUID) (*models.Template, error)
+	GetTemplateByName(ctx context.Context, clientID uuid.UUID, name string) (*models.Template, error)
+	ListTemplates(ctx context.Context, clientID *uuid.UUID) ([]models.Template, error)
+	UpdateTemplate(ctx context.Context, template *models.Template) error
+	DeleteTemplate(ctx context.Context, id uuid.UUID) error
+	CreateVersion(ctx context.Context, version *models.TemplateVersion) error
+	GetVersion(ctx context.Context, templateID uuid.UUID, version int) (*models.TemplateVersion, error)
+	ListVersions(ctx context.Context, templateID uuid.UUID) ([]models.TemplateVersion, error)
+	CountPendingCampaigns(ctx context.Context, templateID uuid.UUID) (int64, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a new template repository
+func NewRepository() Repository {
+	return &repository{
+		db: db.DB,
+	}
+}
+
+// CreateTemplate stores a template with its first version
+func (r *repository) CreateTemplate(ctx context.Context, template *models.Template, version *models.TemplateVersion) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		template.LatestVersion = 1
+		if err := tx.Create(template).Error; err != nil {
+			return fmt.Errorf("failed to create template: %w", err)
+		}
+
+		version.TemplateID = template.ID
+		version.Version = 1
+		if err := tx.Create(version).Error; err != nil {
+			return fmt.Errorf("failed to create template version: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetTemplate retrieves a template by ID
+func (r *repository) GetTemplate(ctx context.Context, id uuid.UUID) (*models.Template, error) {
+	var template models.Template
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return &template, nil
+}
+
+// GetTemplateByName retrieves the template of a client with the given name
+func (r *repository) GetTemplateByName(ctx context.Context, clientID uuid.UUID, name string) (*models.Template, error) {
+	var template models.Template
+	if err := r.db.WithContext(ctx).Where("client_id = ? AND name = ?", clientID, name).First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return &template, nil
+}
+
+// ListTemplates returns the templates of a client, or of every client when clientID is nil
+func (r *repository) ListTemplates(ctx context.Context, clientID *uuid.UUID) ([]models.Template, error) {
+	query := r.db.WithContext(ctx).Order("name ASC")
+	if clientID != nil {
+		query = query.Where("client_id = ?", *clientID)
+	}
+
+	var templates []models.Template
+	if err := query.Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	return templates, nil
+}
+
+// UpdateTemplate saves the name and description of a template
+func (r *repository) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	template.UpdatedAt = time.Now()
+	result := r.db.WithContext(ctx).Model(&models.Template{}).
+		Where("id = ?", template.ID).
+		Updates(map[string]interface{}{
+			"name":        template.Name,
+			"description": template.Description,
+			"updated_at":  template.UpdatedAt,
+		})
+	if result.Error != nil {
+		return fmt.Errorf("failed to update template: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrTemplateNotFound
+	}
+	return nil
+}
+
+// DeleteTemplate deletes a template and its versions
+func (r *repository) DeleteTemplate(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("template_id = ?", id).Delete(&models.TemplateVersion{}).Error; err != nil {
+			return fmt.Errorf("failed to delete template versions: %w", err)
+		}
+		result := tx.Where("id = ?", id).Delete(&models.Template{})
+		if result.Error != nil {
+			return fmt.Errorf("failed to delete template: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrTemplateNotFound
+		}
+		return nil
+	})
+}
+
+// CreateVersion stores version as the next version of its template
+// The template row is locked so that concurrent versions get distinct numbers.
+func (r *repository) CreateVersion(ctx context.Context, version *models.TemplateVersion) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var template models.Template
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ?", version.TemplateID).
+			First(&template).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrTemplateNotFound
+			}
+			return fmt.Errorf("failed to lock template: %w", err)
+		}
+
+		version.Version = template.LatestVersion + 1
+		if err := tx.Create(version).Error; err != nil {
+			return fmt.Errorf("failed to create template version: %w", err)
+		}
+		if err := tx.Model(&models.Template{}).
+			Where("id = ?", template.ID).
+			Updates(map[string]interface{}{"latest_version": version.Version, "updated_at": time.Now()}).Error; err != nil {
+			return fmt.Errorf("failed to update latest template version: %w", err)
+		}
+		return nil
+	})
+}
+
+// GetVersion retrieves one version of a template
+func (r *repository) GetVersion(ctx context.Context, templateID uuid.UUID, version int) (*models.TemplateVersion, error) {
+	var v models.TemplateVersion
+	if err := r.db.WithContext(ctx).Where("template_id = ? AND version = ?", templateID, version).First(&v).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVersionNotFound
+		}
+		return nil, fmt.Errorf("failed to get template version: %w", err)
+	}
+	return &v, nil
+}
+
+// ListVersions returns the versions of a template, newest first
+func (r *repository) ListVersions(ctx context.Context, templateID uuid.UUID) ([]models.TemplateVersion, error) {
+	var versions []models.TemplateVersion
+	if err := r.db.WithContext(ctx).
+		Where("template_id = ?", templateID).
+		Order("version DESC").
+		Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to list template versions: %w", err)
+	}
+	return versions, nil
+}
+
+// CountPendingCampaigns counts the campaigns that will still render the template
+func (r *repository) CountPendingCampaigns(ctx context.Context, templateID uuid.UUID) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&models.Campaign{}).
+		Where("template_id = ? AND status IN ?", templateID, []string{"draft", "scheduled", "sending"}).
+		Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count template campaigns: %w", err)
+	}
+	return count, nil
+}
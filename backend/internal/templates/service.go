@@ -0,0 +1,254 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrNameTaken is returned when the client already has a template with the name
+	ErrNameTaken = errors.New("template name already in use")
+	// ErrTemplateInUse is returned when deleting a template that campaigns will still send
+	ErrTemplateInUse = errors.New("template is used by draft or scheduled campaigns")
+)
+
+// Service defines the template service interface
+// Methods taking a clientID only see that client's templates; a nil clientID
+// (admins) sees every client.
+type Service interface {
+	CreateTemplate(ctx context.Context, clientID uuid.UUID, req *TemplateRequest) (*TemplateDetail, error)
+	ListTemplates(ctx context.Context, clientID *uuid.UUID) ([]models.Template, error)
+	GetTemplate(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*TemplateDetail, error)
+	UpdateTemplate(ctx context.Context, id uuid.UUID, clientID *uuid.UUID, req *UpdateTemplateRequest) (*models.Template, error)
+	DeleteTemplate(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) error
+	CreateVersion(ctx context.Context, id uuid.UUID, clientID *uuid.UUID, req *VersionRequest) (*models.TemplateVersion, error)
+	ListVersions(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) ([]models.TemplateVersion, error)
+	GetVersion(ctx context.Context, id uuid.UUID, version int, clientID *uuid.UUID) (*models.TemplateVersion, error)
+	RenderTemplate(ctx context.Context, id uuid.UUID, version int, clientID *uuid.UUID, data map[string]interface{}) (*Rendered, error)
+}
+
+// VersionRequest holds the content of a new template version
+type VersionRequest struct {
+	Subject   string                   `json:"subject"`
+	HTML      string                   `json:"html"`
+	Text      string                   `json:"text"`
+	Variables models.TemplateVariables `json:"variables"`
+}
+
+// TemplateRequest holds the fields of a template to create with its first version
+type TemplateRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	VersionRequest
+}
+
+// UpdateTemplateRequest holds the fields of a template that can change
+// Content is changed by creating a version.
+type UpdateTemplateRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// TemplateDetail is a template with the content of its latest version
+type TemplateDetail struct {
+	*models.Template
+	Content *models.TemplateVersion `json:"content"`
+}
+
+type service struct {
+	repo Repository
+}
+
+// NewService creates a new template service
+func NewService(repo Repository) Service {
+	return &service{
+		repo: repo,
+	}
+}
+
+// CreateTemplate creates a template of the client with its first version
+func (s *service) CreateTemplate(ctx context.Context, clientID uuid.UUID, req *TemplateRequest) (*TemplateDetail, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidTemplate)
+	}
+	if err := s.checkName(ctx, clientID, name, uuid.Nil); err != nil {
+		return nil, err
+	}
+
+	version, err := newVersion(&req.VersionRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	template := &models.Template{
+		ID:          uuid.New(),
+		ClientID:    clientID,
+		Name:        name,
+		Description: req.Description,
+	}
+	if err := s.repo.CreateTemplate(ctx, template, version); err != nil {
+		return nil, err
+	}
+	return &TemplateDetail{Template: template, Content: version}, nil
+}
+
+// ListTemplates returns the templates visible to clientID
+func (s *service) ListTemplates(ctx context.Context, clientID *uuid.UUID) ([]models.Template, error) {
+	return s.repo.ListTemplates(ctx, clientID)
+}
+
+// GetTemplate returns a template with its latest version
+func (s *service) GetTemplate(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*TemplateDetail, error) {
+	template, err := s.getTemplate(ctx, id, clientID)
+	if err != nil {
+		return nil, err
+	}
+	version, err := s.repo.GetVersion(ctx, id, template.LatestVersion)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateDetail{Template: template, Content: version}, nil
+}
+
+// UpdateTemplate renames or redescribes a template
+func (s *service) UpdateTemplate(ctx context.Context, id uuid.UUID, clientID *uuid.UUID, req *UpdateTemplateRequest) (*models.Template, error) {
+	template, err := s.getTemplate(ctx, id, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, fmt.Errorf("%w: name is required", ErrInvalidTemplate)
+		}
+		if name != template.Name {
+			if err := s.checkName(ctx, template.ClientID, name, template.ID); err != nil {
+				return nil, err
+			}
+		}
+		template.Name = name
+	}
+	if req.Description != nil {
+		template.Description = *req.Description
+	}
+
+	if err := s.repo.UpdateTemplate(ctx, template); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// DeleteTemplate deletes a template and its versions unless a campaign that
+// has not been sent yet uses it
+func (s *service) DeleteTemplate(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) error {
+	if _, err := s.getTemplate(ctx, id, clientID); err != nil {
+		return err
+	}
+	pending, err := s.repo.CountPendingCampaigns(ctx, id)
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return ErrTemplateInUse
+	}
+	return s.repo.DeleteTemplate(ctx, id)
+}
+
+// CreateVersion adds a version to a template; it becomes the latest version
+func (s *service) CreateVersion(ctx context.Context, id uuid.UUID, clientID *uuid.UUID, req *VersionRequest) (*models.TemplateVersion, error) {
+	if _, err := s.getTemplate(ctx, id, clientID); err != nil {
+		return nil, err
+	}
+	version, err := newVersion(req)
+	if err != nil {
+		return nil, err
+	}
+	version.TemplateID = id
+	if err := s.repo.CreateVersion(ctx, version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
+
+// ListVersions returns the versions of a template, newest first
+func (s *service) ListVersions(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) ([]models.TemplateVersion, error) {
+	if _, err := s.getTemplate(ctx, id, clientID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListVersions(ctx, id)
+}
+
+// GetVersion returns one version of a template, or its latest version when
+// version is 0
+func (s *service) GetVersion(ctx context.Context, id uuid.UUID, version int, clientID *uuid.UUID) (*models.TemplateVersion, error) {
+	if version < 0 {
+		return nil, ErrVersionNotFound
+	}
+	template, err := s.getTemplate(ctx, id, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if version == 0 {
+		version = template.LatestVersion
+	}
+	return s.repo.GetVersion(ctx, id, version)
+}
+
+// RenderTemplate renders a version of a template (0 for the latest) with data
+func (s *service) RenderTemplate(ctx context.Context, id uuid.UUID, version int, clientID *uuid.UUID, data map[string]interface{}) (*Rendered, error) {
+	v, err := s.GetVersion(ctx, id, version, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return Render(v, data)
+}
+
+// getTemplate returns a template; templates of other clients are reported as not found
+func (s *service) getTemplate(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.Template, error) {
+	template, err := s.repo.GetTemplate(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if clientID != nil && template.ClientID != *clientID {
+		return nil, ErrTemplateNotFound
+	}
+	return template, nil
+}
+
+// checkName returns ErrNameTaken when another template of the client than
+// except has the name
+func (s *service) checkName(ctx context.Context, clientID uuid.UUID, name string, except uuid.UUID) error {
+	existing, err := s.repo.GetTemplateByName(ctx, clientID, name)
+	switch {
+	case errors.Is(err, ErrTemplateNotFound):
+		return nil
+	case err != nil:
+		return err
+	case existing.ID != except:
+		return ErrNameTaken
+	}
+	return nil
+}
+
+// newVersion builds and validates an unsaved version from req
+func newVersion(req *VersionRequest) (*models.TemplateVersion, error) {
+	version := &models.TemplateVersion{
+		ID:          uuid.New(),
+		Subject:     req.Subject,
+		HTMLContent: req.HTML,
+		TextContent: req.Text,
+		Variables:   append(models.TemplateVariables{}, req.Variables...),
+	}
+	if err := validateVersion(version); err != nil {
+		return nil, err
+	}
+	return version, nil
+}
@@ -0,0 +1,255 @@
+package templates
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// mockRepository is an in-memory Repository
+type mockRepository struct {
+	mu        sync.Mutex
+	templates map[uuid.UUID]*models.Template
+	versions  map[uuid.UUID][]models.TemplateVersion
+	pending   map[uuid.UUID]int64 // campaigns per template
+}
+
+func newMockRepository() *mockRepository {
+	return &mockRepository{
+		templates: make(map[uuid.UUID]*models.Template),
+		versions:  make(map[uuid.UUID][]models.TemplateVersion),
+		pending:   make(map[uuid.UUID]int64),
+	}
+}
+
+func (m *mockRepository) CreateTemplate(ctx context.Context, template *models.Template, version *models.TemplateVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	template.LatestVersion = 1
+	version.TemplateID = template.ID
+	version.Version = 1
+	copied := *template
+	m.templates[template.ID] = &copied
+	m.versions[template.ID] = []models.TemplateVersion{*version}
+	return nil
+}
+
+func (m *mockRepository) GetTemplate(ctx context.Context, id uuid.UUID) (*models.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	template, ok := m.templates[id]
+	if !ok {
+		return nil, ErrTemplateNotFound
+	}
+	copied := *template
+	return &copied, nil
+}
+
+func (m *mockRepository) GetTemplateByName(ctx context.Context, clientID uuid.UUID, name string) (*models.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, template := range m.templates {
+		if template.ClientID == clientID && template.Name == name {
+			copied := *template
+			return &copied, nil
+		}
+	}
+	return nil, ErrTemplateNotFound
+}
+
+func (m *mockRepository) ListTemplates(ctx context.Context, clientID *uuid.UUID) ([]models.Template, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var templates []models.Template
+	for _, template := range m.templates {
+		if clientID == nil || template.ClientID == *clientID {
+			templates = append(templates, *template)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+func (m *mockRepository) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.templates[template.ID]; !ok {
+		return ErrTemplateNotFound
+	}
+	copied := *template
+	m.templates[template.ID] = &copied
+	return nil
+}
+
+func (m *mockRepository) DeleteTemplate(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.templates[id]; !ok {
+		return ErrTemplateNotFound
+	}
+	delete(m.templates, id)
+	delete(m.versions, id)
+	return nil
+}
+
+func (m *mockRepository) CreateVersion(ctx context.Context, version *models.TemplateVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	template, ok := m.templates[version.TemplateID]
+	if !ok {
+		return ErrTemplateNotFound
+	}
+	template.LatestVersion++
+	version.Version = template.LatestVersion
+	m.versions[template.ID] = append(m.versions[template.ID], *version)
+	return nil
+}
+
+func (m *mockRepository) GetVersion(ctx context.Context, templateID uuid.UUID, version int) (*models.TemplateVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range m.versions[templateID] {
+		if v.Version == version {
+			return &v, nil
+		}
+	}
+	return nil, ErrVersionNotFound
+}
+
+func (m *mockRepository) ListVersions(ctx context.Context, templateID uuid.UUID) ([]models.TemplateVersion, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := append([]models.TemplateVersion(nil), m.versions[templateID]...)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+func (m *mockRepository) CountPendingCampaigns(ctx context.Context, templateID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.pending[templateID], nil
+}
+
+// welcomeRequest is a valid template with a required and an optional variable
+func welcomeRequest() *TemplateRequest {
+	return &TemplateRequest{
+		Name: "welcome",
+		VersionRequest: VersionRequest{
+			Subject: "Welcome {{first_name|there}}",
+			HTML:    "<p>Your plan: {{plan}}</p>",
+			Variables: models.TemplateVariables{
+				{Name: "first_name"},
+				{Name: "plan", Required: true},
+			},
+		},
+	}
+}
+
+func TestService_Versions(t *testing.T) {
+	svc := NewService(newMockRepository())
+	ctx := context.Background()
+	clientID := uuid.New()
+
+	created, err := svc.CreateTemplate(ctx, clientID, welcomeRequest())
+	if err != nil {
+		t.Fatalf("CreateTemplate() error = %v", err)
+	}
+	if created.LatestVersion != 1 || created.Content.Version != 1 || created.Content.Variables[0].Type != models.TemplateVariableString {
+		t.Errorf("unexpected template: %+v %+v", created.Template, created.Content)
+	}
+
+	second, err := svc.CreateVersion(ctx, created.ID, &clientID, &VersionRequest{Subject: "Welcome aboard", Text: "Hi {{email}}"})
+	if err != nil {
+		t.Fatalf("CreateVersion() error = %v", err)
+	}
+	if second.Version != 2 {
+		t.Errorf("second version = %d, want 2", second.Version)
+	}
+
+	latest, err := svc.GetVersion(ctx, created.ID, 0, &clientID)
+	if err != nil || latest.Subject != "Welcome aboard" {
+		t.Errorf("GetVersion(latest) = %+v, %v, want version 2", latest, err)
+	}
+	first, err := svc.GetVersion(ctx, created.ID, 1, nil)
+	if err != nil || first.Subject != "Welcome {{first_name|there}}" {
+		t.Errorf("GetVersion(1) = %+v, %v, want the unchanged first version", first, err)
+	}
+	if _, err := svc.GetVersion(ctx, created.ID, 3, &clientID); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("GetVersion(3) error = %v, want ErrVersionNotFound", err)
+	}
+
+	rendered, err := svc.RenderTemplate(ctx, created.ID, 1, &clientID, map[string]interface{}{"plan": "Pro"})
+	if err != nil {
+		t.Fatalf("RenderTemplate() error = %v", err)
+	}
+	if rendered.Subject != "Welcome there" || rendered.HTML != "<p>Your plan: Pro</p>" || rendered.Version != 1 {
+		t.Errorf("unexpected rendering: %+v", rendered)
+	}
+}
+
+func TestService_ClientOwnership(t *testing.T) {
+	svc := NewService(newMockRepository())
+	ctx := context.Background()
+	owner, other := uuid.New(), uuid.New()
+
+	created, err := svc.CreateTemplate(ctx, owner, welcomeRequest())
+	if err != nil {
+		t.Fatalf("CreateTemplate() error = %v", err)
+	}
+
+	if _, err := svc.GetTemplate(ctx, created.ID, &other); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("GetTemplate() by another client error = %v, want ErrTemplateNotFound", err)
+	}
+	if _, err := svc.CreateVersion(ctx, created.ID, &other, &VersionRequest{Subject: "x", Text: "x"}); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("CreateVersion() by another client error = %v, want ErrTemplateNotFound", err)
+	}
+	if err := svc.DeleteTemplate(ctx, created.ID, &other); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("DeleteTemplate() by another client error = %v, want ErrTemplateNotFound", err)
+	}
+	if _, err := svc.GetTemplate(ctx, created.ID, nil); err != nil {
+		t.Errorf("GetTemplate() by an admin error = %v", err)
+	}
+
+	if _, err := svc.CreateTemplate(ctx, owner, welcomeRequest()); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("CreateTemplate() with a taken name error = %v, want ErrNameTaken", err)
+	}
+	if _, err := svc.CreateTemplate(ctx, other, welcomeRequest()); err != nil {
+		t.Errorf("CreateTemplate() with another client's name error = %v", err)
+	}
+
+	list, err := svc.ListTemplates(ctx, &owner)
+	if err != nil || len(list) != 1 {
+		t.Errorf("ListTemplates() = %d templates, %v, want 1", len(list), err)
+	}
+}
+
+func TestService_DeleteTemplateInUse(t *testing.T) {
+	repo := newMockRepository()
+	svc := NewService(repo)
+	ctx := context.Background()
+	clientID := uuid.New()
+
+	created, err := svc.CreateTemplate(ctx, clientID, welcomeRequest())
+	if err != nil {
+		t.Fatalf("CreateTemplate() error = %v", err)
+	}
+
+	repo.pending[created.ID] = 1
+	if err := svc.DeleteTemplate(ctx, created.ID, &clientID); !errors.Is(err, ErrTemplateInUse) {
+		t.Fatalf("DeleteTemplate() error = %v, want ErrTemplateInUse", err)
+	}
+
+	repo.pending[created.ID] = 0
+	if err := svc.DeleteTemplate(ctx, created.ID, &clientID); err != nil {
+		t.Fatalf("DeleteTemplate() error = %v", err)
+	}
+	if _, err := svc.GetTemplate(ctx, created.ID, &clientID); !errors.Is(err, ErrTemplateNotFound) {
+		t.Errorf("GetTemplate() after delete error = %v, want ErrTemplateNotFound", err)
+	}
+}
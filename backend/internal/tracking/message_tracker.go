@@ -6,15 +6,29 @@ import (
 	"strings"
 
 	"backend/internal/metrics"
+	"backend/internal/models"
 	"backend/internal/repositories"
 	"backend/internal/types"
 
+	"github.com/google/uuid"
 	"github.com/rs/zerolog/log"
 )
 
+// CacheInvalidator drops cached analytics of a client; *cache.AnalyticsCache implements it
+type CacheInvalidator interface {
+	InvalidateClient(ctx context.Context, clientID *uuid.UUID) error
+}
+
+// EventPublisher forwards recorded events to client webhooks; webhooks.Service implements it
+type EventPublisher interface {
+	Publish(ctx context.Context, email *models.EmailMessageRecord, eventType string, meta map[string]interface{}) error
+}
+
 // MessageTracker handles message tracking and event processing
 type MessageTracker struct {
 	emailRepo repositories.EmailRepository
+	cache     CacheInvalidator
+	publisher EventPublisher
 }
 
 // NewMessageTracker creates a new message tracker
@@ -24,6 +38,49 @@ func NewMessageTracker(emailRepo repositories.EmailRepository) *MessageTracker {
 	}
 }
 
+// SetCacheInvalidator invalidates the analytics of an email's client whenever
+// an event is recorded for it
+func (t *MessageTracker) SetCacheInvalidator(cache CacheInvalidator) {
+	t.cache = cache
+}
+
+// SetEventPublisher publishes every recorded event to the email client's webhooks
+func (t *MessageTracker) SetEventPublisher(publisher EventPublisher) {
+	t.publisher = publisher
+}
+
+// recordEvent inserts an event for email, invalidates its client's cached
+// analytics and publishes it to the client's webhooks
+func (t *MessageTracker) recordEvent(ctx context.Context, email *models.EmailMessageRecord, eventType string, meta map[string]interface{}) error {
+	if err := t.emailRepo.CreateEmailEventWithMeta(ctx, email.ID, eventType, meta); err != nil {
+		return err
+	}
+
+	if t.cache != nil {
+		if err := t.cache.InvalidateClient(ctx, email.ClientID); err != nil {
+			// Cached results expire on their own
+			log.Warn().
+				Err(err).
+				Str("email_id", email.ID.String()).
+				Str("event", "tracking.cache.invalidate_failed").
+				Msg("Failed to invalidate analytics cache")
+		}
+	}
+
+	if t.publisher != nil {
+		if err := t.publisher.Publish(ctx, email, eventType, meta); err != nil {
+			// The event itself is recorded; only the webhook notification is lost
+			log.Error().
+				Err(err).
+				Str("email_id", email.ID.String()).
+				Str("event_type", eventType).
+				Str("event", "tracking.webhook.publish_failed").
+				Msg("Failed to publish event to webhooks")
+		}
+	}
+	return nil
+}
+
 // NormalizeMessageID extracts the real RFC Message-ID from SES mail headers
 // SES uses TWO types of message IDs:
 // - mail.messageId — SES internal ID
@@ -96,7 +153,7 @@ func (t *MessageTracker) ProcessDeliveryEvent(ctx context.Context, evt *types.SE
 	}
 
 	// Insert event
-	if err := t.emailRepo.CreateEmailEventWithMeta(ctx, email.ID, "delivered", meta); err != nil {
+	if err := t.recordEvent(ctx, email, "delivered", meta); err != nil {
 		log.Error().
 			Err(err).
 			Str("email_id", email.ID.String()).
@@ -179,7 +236,7 @@ func (t *MessageTracker) ProcessBounceEvent(ctx context.Context, evt *types.SESB
 	}
 
 	// Insert event
-	if err := t.emailRepo.CreateEmailEventWithMeta(ctx, email.ID, "bounce", meta); err != nil {
+	if err := t.recordEvent(ctx, email, "bounce", meta); err != nil {
 		log.Error().
 			Err(err).
 			Str("email_id", email.ID.String()).
@@ -263,7 +320,7 @@ func (t *MessageTracker) ProcessComplaintEvent(ctx context.Context, evt *types.S
 	}
 
 	// Insert event
-	if err := t.emailRepo.CreateEmailEventWithMeta(ctx, email.ID, "complaint", meta); err != nil {
+	if err := t.recordEvent(ctx, email, "complaint", meta); err != nil {
 		log.Error().
 			Err(err).
 			Str("email_id", email.ID.String()).
@@ -340,7 +397,7 @@ func (t *MessageTracker) ProcessRejectEvent(ctx context.Context, evt *types.SESR
 	}
 
 	// Insert event
-	if err := t.emailRepo.CreateEmailEventWithMeta(ctx, email.ID, "reject", meta); err != nil {
+	if err := t.recordEvent(ctx, email, "reject", meta); err != nil {
 		log.Error().
 			Err(err).
 			Str("email_id", email.ID.String()).
@@ -417,7 +474,7 @@ func (t *MessageTracker) ProcessRenderingFailureEvent(ctx context.Context, evt *
 	}
 
 	// Insert event
-	if err := t.emailRepo.CreateEmailEventWithMeta(ctx, email.ID, "rendering_failure", meta); err != nil {
+	if err := t.recordEvent(ctx, email, "rendering_failure", meta); err != nil {
 		log.Error().
 			Err(err).
 			Str("email_id", email.ID.String()).
@@ -486,7 +543,7 @@ func (t *MessageTracker) ProcessOpenEvent(ctx context.Context, messageID string)
 	}
 
 	// Insert event
-	if err := t.emailRepo.CreateEmailEventWithMeta(ctx, email.ID, "open", meta); err != nil {
+	if err := t.recordEvent(ctx, email, "open", meta); err != nil {
 		log.Error().
 			Err(err).
 			Str("email_id", email.ID.String()).
@@ -550,7 +607,7 @@ func (t *MessageTracker) ProcessClickEvent(ctx context.Context, messageID, url s
 	}
 
 	// Insert event
-	if err := t.emailRepo.CreateEmailEventWithMeta(ctx, email.ID, "click", meta); err != nil {
+	if err := t.recordEvent(ctx, email, "click", meta); err != nil {
 		log.Error().
 			Err(err).
 			Str("email_id", email.ID.String()).
@@ -14,12 +14,12 @@ import (
 
 // MockEmailRepository is a simple mock implementation of EmailRepository for testing
 type MockEmailRepository struct {
-	emails              map[string]*models.EmailMessageRecord
-	snsMessageIds       map[string]bool
-	openEventsToday     map[uuid.UUID]bool
-	clickEvents         map[string]bool // key: emailID + "|" + url
-	createEventCalled   bool
-	updateStatusCalled  bool
+	emails             map[string]*models.EmailMessageRecord
+	snsMessageIds      map[string]bool
+	openEventsToday    map[uuid.UUID]bool
+	clickEvents        map[string]bool // key: emailID + "|" + url
+	createEventCalled  bool
+	updateStatusCalled bool
 }
 
 func NewMockEmailRepository() *MockEmailRepository {
@@ -41,6 +41,10 @@ func (m *MockEmailRepository) UpdateEmailStatus(ctx context.Context, id uuid.UUI
 	return nil
 }
 
+func (m *MockEmailRepository) SetProvider(ctx context.Context, id uuid.UUID, provider, providerMessageID string) error {
+	return nil
+}
+
 func (m *MockEmailRepository) AddEmailEvent(ctx context.Context, event models.EmailEventRecord) error {
 	m.createEventCalled = true
 	return nil
@@ -178,3 +182,64 @@ func TestProcessDeliveryEvent_SNSIdempotency(t *testing.T) {
 	}
 }
 
+// recordingInvalidator records the clients whose analytics were invalidated
+type recordingInvalidator struct {
+	clients []*uuid.UUID
+}
+
+func (r *recordingInvalidator) InvalidateClient(ctx context.Context, clientID *uuid.UUID) error {
+	r.clients = append(r.clients, clientID)
+	return nil
+}
+
+func TestProcessOpenEvent_InvalidatesClientCache(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := NewMockEmailRepository()
+	tracker := NewMessageTracker(mockRepo)
+	invalidator := &recordingInvalidator{}
+	tracker.SetCacheInvalidator(invalidator)
+
+	clientID := uuid.New()
+	mockRepo.emails["test-message-id"] = &models.EmailMessageRecord{
+		ID:        uuid.New(),
+		MessageID: "test-message-id",
+		ClientID:  &clientID,
+	}
+
+	if err := tracker.ProcessOpenEvent(ctx, "test-message-id"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(invalidator.clients) != 1 || invalidator.clients[0] == nil || *invalidator.clients[0] != clientID {
+		t.Errorf("Expected cache of client %s to be invalidated, got %v", clientID, invalidator.clients)
+	}
+}
+
+// recordingPublisher records the events published to webhooks
+type recordingPublisher struct {
+	eventTypes []string
+}
+
+func (r *recordingPublisher) Publish(ctx context.Context, email *models.EmailMessageRecord, eventType string, meta map[string]interface{}) error {
+	r.eventTypes = append(r.eventTypes, eventType)
+	return nil
+}
+
+func TestProcessClickEvent_PublishesToWebhooks(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := NewMockEmailRepository()
+	tracker := NewMessageTracker(mockRepo)
+	publisher := &recordingPublisher{}
+	tracker.SetEventPublisher(publisher)
+
+	mockRepo.emails["test-message-id"] = &models.EmailMessageRecord{
+		ID:        uuid.New(),
+		MessageID: "test-message-id",
+	}
+
+	if err := tracker.ProcessClickEvent(ctx, "test-message-id", "https://example.com"); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(publisher.eventTypes) != 1 || publisher.eventTypes[0] != "click" {
+		t.Errorf("Expected one click event to be published, got %v", publisher.eventTypes)
+	}
+}
@@ -0,0 +1,262 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/rs/zerolog"
+)
+
+// maxResponseBody bounds how much of an endpoint's response is kept in the attempt log
+const maxResponseBody = 1024
+
+// Dispatcher POSTs pending webhook deliveries to their endpoints.
+// Each tick (or Notify) it claims as many due deliveries as it sends at once,
+// sends them and records every attempt. Non-2xx answers and network errors are
+// retried with backoff until the retry policy gives up.
+type Dispatcher struct {
+	repo        Repository
+	client      *http.Client
+	targets     *targetChecker
+	retry       RetryPolicy
+	interval    time.Duration
+	concurrency int
+	lease       time.Duration // one request plus loading the endpoint and recording the attempt
+	wake        chan struct{}
+	logger      zerolog.Logger
+	wg          sync.WaitGroup
+	cancel      context.CancelFunc
+}
+
+// NewDispatcher creates a webhook dispatcher polling every interval
+func NewDispatcher(repo Repository, interval time.Duration) *Dispatcher {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	timeout := 10 * time.Second
+	targets := &targetChecker{}
+	return &Dispatcher{
+		repo:        repo,
+		client:      targets.newClient(timeout),
+		targets:     targets,
+		retry:       DefaultRetryPolicy(),
+		interval:    interval,
+		concurrency: 8,
+		lease:       2 * timeout,
+		wake:        make(chan struct{}, 1),
+		logger:      zerolog.New(os.Stdout).With().Timestamp().Logger(),
+	}
+}
+
+// SetRetryPolicy replaces the retry policy; it must be called before Start
+func (d *Dispatcher) SetRetryPolicy(policy RetryPolicy) {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	d.retry = policy
+}
+
+// Start runs the dispatch loop in the background
+func (d *Dispatcher) Start(ctx context.Context) {
+	ctx, d.cancel = context.WithCancel(ctx)
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+			d.RunOnce(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-d.wake:
+			}
+		}
+	}()
+}
+
+// Stop stops the dispatch loop and waits for in-flight requests to finish
+func (d *Dispatcher) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	d.wg.Wait()
+}
+
+// Notify wakes the dispatch loop so new deliveries are sent without waiting for the next tick
+func (d *Dispatcher) Notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOnce sends due deliveries until none are left
+// Only as many deliveries as can be sent at once are claimed, so none waits
+// for a free worker while its lease runs out.
+func (d *Dispatcher) RunOnce(ctx context.Context) {
+	for ctx.Err() == nil {
+		deliveries, err := d.repo.ClaimDueDeliveries(ctx, d.concurrency, d.lease)
+		if err != nil {
+			d.logger.Error().
+				Err(err).
+				Str("event", "webhook.dispatch.claim_failed").
+				Msg("Failed to claim webhook deliveries")
+			return
+		}
+
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			wg.Add(1)
+			go func(delivery *models.WebhookDelivery) {
+				defer wg.Done()
+				d.deliver(ctx, delivery)
+			}(&deliveries[i])
+		}
+		wg.Wait()
+
+		if len(deliveries) < d.concurrency {
+			return
+		}
+	}
+}
+
+// deliver makes one attempt of a delivery and records its outcome
+func (d *Dispatcher) deliver(ctx context.Context, delivery *models.WebhookDelivery) {
+	// Record the outcome even if shutdown interrupts the request
+	recordCtx := context.WithoutCancel(ctx)
+	leasedUntil := *delivery.NextAttemptAt
+
+	endpoint, err := d.repo.GetEndpoint(recordCtx, delivery.EndpointID)
+	if err != nil && !errors.Is(err, ErrEndpointNotFound) {
+		// Retried once the lease expires
+		d.logger.Error().
+			Err(err).
+			Str("event", "webhook.delivery.endpoint_failed").
+			Str("delivery_id", delivery.ID.String()).
+			Msg("Failed to load webhook endpoint")
+		return
+	}
+	if endpoint == nil || !endpoint.Active {
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+		delivery.LastError = "endpoint is disabled"
+		delivery.UpdatedAt = time.Now()
+		d.record(recordCtx, delivery, nil, leasedUntil)
+		return
+	}
+
+	attempt := d.send(ctx, endpoint, delivery)
+	now := time.Now()
+	delivery.Attempts = attempt.Attempt
+	delivery.LastResponseStatus = attempt.ResponseStatus
+	delivery.LastError = attempt.Error
+	delivery.UpdatedAt = now
+
+	switch {
+	case attempt.Error == "":
+		delivery.Status = models.WebhookDeliverySucceeded
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= d.retry.MaxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+		delivery.NextAttemptAt = nil
+	default:
+		next := now.Add(d.retry.Backoff(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	}
+
+	if !d.record(recordCtx, delivery, attempt, leasedUntil) {
+		return
+	}
+
+	logEvent := d.logger.Info()
+	if delivery.Status != models.WebhookDeliverySucceeded {
+		logEvent = d.logger.Warn()
+	}
+	logEvent.
+		Str("event", "webhook.delivery."+delivery.Status).
+		Str("delivery_id", delivery.ID.String()).
+		Str("endpoint_id", endpoint.ID.String()).
+		Str("event_type", delivery.EventType).
+		Int("attempt", attempt.Attempt).
+		Int("response_status", attempt.ResponseStatus).
+		Str("error", attempt.Error).
+		Msg("Webhook delivery attempted")
+}
+
+// send POSTs the signed payload of a delivery to its endpoint
+// A non-empty Error in the returned attempt means the attempt failed.
+func (d *Dispatcher) send(ctx context.Context, endpoint *models.WebhookEndpoint, delivery *models.WebhookDelivery) *models.WebhookDeliveryAttempt {
+	started := time.Now()
+	attempt := &models.WebhookDeliveryAttempt{
+		DeliveryID: delivery.ID,
+		Attempt:    delivery.Attempts + 1,
+		URL:        endpoint.URL,
+		CreatedAt:  started,
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Mailblast-Webhooks/1.0")
+	req.Header.Set(HeaderSignature, Sign(endpoint.Secret, started, delivery.Payload))
+	req.Header.Set(HeaderEventID, delivery.EventID.String())
+	req.Header.Set(HeaderEventType, delivery.EventType)
+	req.Header.Set(HeaderDelivery, delivery.ID.String())
+
+	resp, err := d.client.Do(req)
+	attempt.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	attempt.ResponseStatus = resp.StatusCode
+	attempt.ResponseBody = string(bytes.ToValidUTF8(body, nil))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = "unexpected status " + resp.Status
+	}
+	return attempt
+}
+
+// record stores an attempt (if any) and the new state of its delivery
+// It returns false if nothing was stored.
+func (d *Dispatcher) record(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookDeliveryAttempt, leasedUntil time.Time) bool {
+	err := d.repo.RecordAttempt(ctx, delivery, attempt, leasedUntil)
+	if errors.Is(err, ErrLeaseExpired) {
+		// Another dispatcher claimed the delivery again and records its own attempt
+		d.logger.Warn().
+			Str("event", "webhook.delivery.lease_expired").
+			Str("delivery_id", delivery.ID.String()).
+			Msg("Webhook delivery lease expired before its attempt was recorded")
+		return false
+	}
+	if err != nil {
+		d.logger.Error().
+			Err(err).
+			Str("event", "webhook.delivery.record_failed").
+			Str("delivery_id", delivery.ID.String()).
+			Msg("Failed to record webhook delivery attempt")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,205 @@
+package webhooks
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// publishTo creates an endpoint for url and publishes one open event to it
+// Test endpoints are httptest servers on loopback, so address checks are off.
+func publishTo(t *testing.T, repo *mockRepository, url string) (*models.WebhookEndpoint, *models.WebhookDelivery) {
+	t.Helper()
+	svc := NewService(repo, nil)
+	svc.(*service).targets.allowPrivate = true
+	clientID := uuid.New()
+	endpoint, err := svc.CreateEndpoint(context.Background(), clientID, &EndpointRequest{URL: &url})
+	if err != nil {
+		t.Fatalf("Failed to create endpoint: %v", err)
+	}
+	if err := svc.Publish(context.Background(), &models.EmailMessageRecord{ID: uuid.New(), ClientID: &clientID}, "open", nil); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	for _, delivery := range repo.deliveries {
+		return endpoint, delivery
+	}
+	t.Fatal("Expected a delivery")
+	return nil, nil
+}
+
+// newTestDispatcher creates a dispatcher that delivers to loopback endpoints
+func newTestDispatcher(repo Repository) *Dispatcher {
+	dispatcher := NewDispatcher(repo, time.Second)
+	dispatcher.targets.allowPrivate = true
+	return dispatcher
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	var (
+		gotSignature string
+		gotBody      []byte
+		gotEventType string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSignature = r.Header.Get(HeaderSignature)
+		gotEventType = r.Header.Get(HeaderEventType)
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	repo := newMockRepository()
+	endpoint, delivery := publishTo(t, repo, server.URL)
+
+	newTestDispatcher(repo).RunOnce(context.Background())
+
+	if err := Verify(endpoint.Secret, gotSignature, gotBody, time.Minute); err != nil {
+		t.Errorf("Expected a valid signature, got: %v", err)
+	}
+	if gotEventType != "open" {
+		t.Errorf("Expected event type header open, got %q", gotEventType)
+	}
+
+	stored := repo.deliveries[delivery.ID]
+	if stored.Status != models.WebhookDeliverySucceeded || stored.Attempts != 1 || stored.DeliveredAt == nil {
+		t.Errorf("Expected succeeded delivery after one attempt, got %+v", stored)
+	}
+	if len(repo.attempts) != 1 || repo.attempts[0].ResponseStatus != http.StatusOK || repo.attempts[0].ResponseBody != "ok" {
+		t.Errorf("Expected one logged 200 attempt, got %+v", repo.attempts)
+	}
+}
+
+func TestDispatcher_RetriesFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	repo := newMockRepository()
+	_, delivery := publishTo(t, repo, server.URL)
+
+	dispatcher := newTestDispatcher(repo)
+	dispatcher.SetRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	dispatcher.RunOnce(context.Background())
+
+	stored := repo.deliveries[delivery.ID]
+	if stored.Status != models.WebhookDeliveryPending || stored.Attempts != 1 || stored.LastResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("Expected pending delivery after first failure, got %+v", stored)
+	}
+	if stored.NextAttemptAt == nil || time.Until(*stored.NextAttemptAt) < 10*time.Minute {
+		t.Errorf("Expected next attempt to be backed off, got %v", stored.NextAttemptAt)
+	}
+
+	// Make the retry due and exhaust the policy
+	now := time.Now()
+	stored.NextAttemptAt = &now
+	dispatcher.RunOnce(context.Background())
+
+	stored = repo.deliveries[delivery.ID]
+	if stored.Status != models.WebhookDeliveryFailed || stored.Attempts != 2 || stored.NextAttemptAt != nil {
+		t.Errorf("Expected failed delivery after two attempts, got %+v", stored)
+	}
+	if len(repo.attempts) != 2 {
+		t.Errorf("Expected two logged attempts, got %d", len(repo.attempts))
+	}
+}
+
+func TestDispatcher_FailsDisabledEndpoints(t *testing.T) {
+	repo := newMockRepository()
+	endpoint, delivery := publishTo(t, repo, "https://example.invalid/hooks")
+	repo.endpoints[endpoint.ID].Active = false
+
+	newTestDispatcher(repo).RunOnce(context.Background())
+
+	stored := repo.deliveries[delivery.ID]
+	if stored.Status != models.WebhookDeliveryFailed || len(repo.attempts) != 0 {
+		t.Errorf("Expected failed delivery without attempts, got %+v", stored)
+	}
+}
+
+func TestDispatcher_RefusesPrivateAddresses(t *testing.T) {
+	var called bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer server.Close()
+
+	repo := newMockRepository()
+	_, delivery := publishTo(t, repo, server.URL)
+
+	// The endpoint passed validation, e.g. its DNS record changed afterwards
+	NewDispatcher(repo, time.Second).RunOnce(context.Background())
+
+	if called {
+		t.Error("Expected no request to a loopback endpoint")
+	}
+	stored := repo.deliveries[delivery.ID]
+	if stored.Attempts != 1 || !strings.Contains(stored.LastError, errForbiddenTarget.Error()) {
+		t.Errorf("Expected a refused attempt, got %+v", stored)
+	}
+}
+
+func TestDispatcher_SkipsRecordWhenLeaseExpired(t *testing.T) {
+	repo := newMockRepository()
+	var deliveryID uuid.UUID
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Another dispatcher claims the delivery again while this request is slow
+		repo.mu.Lock()
+		next := time.Now().Add(time.Minute)
+		repo.deliveries[deliveryID].NextAttemptAt = &next
+		repo.mu.Unlock()
+	}))
+	defer server.Close()
+
+	_, delivery := publishTo(t, repo, server.URL)
+	deliveryID = delivery.ID
+
+	newTestDispatcher(repo).RunOnce(context.Background())
+
+	stored := repo.deliveries[delivery.ID]
+	if stored.Status != models.WebhookDeliveryPending || stored.Attempts != 0 || len(repo.attempts) != 0 {
+		t.Errorf("Expected the current lease holder's state to be kept, got %+v and %d attempts", stored, len(repo.attempts))
+	}
+}
+
+// limitRecorder records the limit of every claim
+type limitRecorder struct {
+	*mockRepository
+	limits []int
+}
+
+func (r *limitRecorder) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	r.limits = append(r.limits, limit)
+	return r.mockRepository.ClaimDueDeliveries(ctx, limit, lease)
+}
+
+func TestDispatcher_ClaimsOnlyWhatItSendsAtOnce(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	repo := &limitRecorder{mockRepository: newMockRepository()}
+	for i := 0; i < 5; i++ {
+		publishTo(t, repo.mockRepository, server.URL)
+	}
+
+	dispatcher := newTestDispatcher(repo)
+	dispatcher.concurrency = 2
+	dispatcher.RunOnce(context.Background())
+
+	if len(repo.limits) != 3 || repo.limits[0] != 2 {
+		t.Errorf("Expected three claims of two deliveries, got %v", repo.limits)
+	}
+	for _, delivery := range repo.deliveries {
+		if delivery.Status != models.WebhookDeliverySucceeded {
+			t.Errorf("Expected every delivery to succeed, got %+v", delivery)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package webhooks
+
+import (
+	"errors"
+	"os"
+	"strconv"
+
+	"backend/internal/middleware"
+	"backend/internal/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// Handler handles webhook endpoint and delivery log HTTP requests
+type Handler struct {
+	service Service
+	logger  zerolog.Logger
+}
+
+// NewHandler creates a new webhook handler
+func NewHandler(service Service) *Handler {
+	return &Handler{
+		service: service,
+		logger:  zerolog.New(os.Stdout).With().Timestamp().Logger(),
+	}
+}
+
+// HTTPEndpointRequest represents the HTTP request body for creating or updating an endpoint
+type HTTPEndpointRequest struct {
+	EndpointRequest
+	ClientID string `json:"client_id"` // admins only, on create
+}
+
+// endpointWithSecret is an endpoint response that includes its signing secret
+type endpointWithSecret struct {
+	*models.WebhookEndpoint
+	Secret string `json:"secret"`
+}
+
+// errNoClient is returned when a non-admin user is not linked to a client
+var errNoClient = errors.New("user is not linked to a client")
+
+// clientScope returns the client whose webhooks the user may access (nil for admins)
+func clientScope(c *fiber.Ctx) (*uuid.UUID, error) {
+	if middleware.IsAdmin(c) {
+		return nil, nil
+	}
+	clientID := middleware.ClientIDFromContext(c)
+	if clientID == nil {
+		return nil, errNoClient
+	}
+	return clientID, nil
+}
+
+// CreateEndpoint handles POST /webhook-endpoints
+func (h *Handler) CreateEndpoint(c *fiber.Ctx) error {
+	var req HTTPEndpointRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	scope, err := clientScope(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.create_failed")
+	}
+	var clientID uuid.UUID
+	if scope != nil {
+		clientID = *scope
+	} else {
+		if clientID, err = uuid.Parse(req.ClientID); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "client_id is required",
+			})
+		}
+	}
+
+	endpoint, err := h.service.CreateEndpoint(c.Context(), clientID, &req.EndpointRequest)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.create_failed")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(endpointWithSecret{endpoint, endpoint.Secret})
+}
+
+// ListEndpoints handles GET /webhook-endpoints?client_id= (client_id for admins only)
+func (h *Handler) ListEndpoints(c *fiber.Ctx) error {
+	scope, err := clientScope(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.list_failed")
+	}
+	if scope == nil && c.Query("client_id") != "" {
+		clientID, err := uuid.Parse(c.Query("client_id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid client_id",
+			})
+		}
+		scope = &clientID
+	}
+
+	endpoints, err := h.service.ListEndpoints(c.Context(), scope)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.list_failed")
+	}
+
+	return c.JSON(fiber.Map{
+		"endpoints": endpoints,
+	})
+}
+
+// GetEndpoint handles GET /webhook-endpoints/:id
+func (h *Handler) GetEndpoint(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.get_failed")
+	}
+
+	endpoint, err := h.service.GetEndpoint(c.Context(), id, scope)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.get_failed")
+	}
+
+	return c.JSON(endpoint)
+}
+
+// UpdateEndpoint handles PUT /webhook-endpoints/:id
+func (h *Handler) UpdateEndpoint(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.update_failed")
+	}
+
+	var req HTTPEndpointRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	endpoint, err := h.service.UpdateEndpoint(c.Context(), id, scope, &req.EndpointRequest)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.update_failed")
+	}
+
+	return c.JSON(endpoint)
+}
+
+// RotateSecret handles POST /webhook-endpoints/:id/rotate-secret
+func (h *Handler) RotateSecret(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.rotate_failed")
+	}
+
+	endpoint, err := h.service.RotateSecret(c.Context(), id, scope)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.rotate_failed")
+	}
+
+	return c.JSON(endpointWithSecret{endpoint, endpoint.Secret})
+}
+
+// DeleteEndpoint handles DELETE /webhook-endpoints/:id
+func (h *Handler) DeleteEndpoint(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.delete_failed")
+	}
+
+	if err := h.service.DeleteEndpoint(c.Context(), id, scope); err != nil {
+		return h.handleError(c, err, "webhooks.endpoint.delete_failed")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ListEndpointDeliveries handles GET /webhook-endpoints/:id/deliveries
+func (h *Handler) ListEndpointDeliveries(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.delivery.list_failed")
+	}
+	if _, err := h.service.GetEndpoint(c.Context(), id, scope); err != nil {
+		return h.handleError(c, err, "webhooks.delivery.list_failed")
+	}
+
+	filter := deliveryFilter(c)
+	filter.ClientID = scope
+	filter.EndpointID = &id
+	return h.listDeliveries(c, filter)
+}
+
+// ListDeliveries handles GET /webhook-deliveries?endpoint_id=&event_id=&event_type=&status=&limit=50&offset=0
+func (h *Handler) ListDeliveries(c *fiber.Ctx) error {
+	scope, err := clientScope(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.delivery.list_failed")
+	}
+
+	filter := deliveryFilter(c)
+	filter.ClientID = scope
+	for _, param := range []struct {
+		name string
+		dest **uuid.UUID
+	}{
+		{"endpoint_id", &filter.EndpointID},
+		{"event_id", &filter.EventID},
+	} {
+		value := c.Query(param.name)
+		if value == "" {
+			continue
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "invalid " + param.name,
+			})
+		}
+		*param.dest = &id
+	}
+
+	return h.listDeliveries(c, filter)
+}
+
+// GetDelivery handles GET /webhook-deliveries/:id
+func (h *Handler) GetDelivery(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.delivery.get_failed")
+	}
+
+	delivery, attempts, err := h.service.GetDelivery(c.Context(), id, scope)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.delivery.get_failed")
+	}
+
+	return c.JSON(fiber.Map{
+		"delivery": delivery,
+		"attempts": attempts,
+	})
+}
+
+// Replay handles POST /webhook-deliveries/:id/replay
+func (h *Handler) Replay(c *fiber.Ctx) error {
+	id, scope, err := h.parseRequest(c)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.delivery.replay_failed")
+	}
+
+	delivery, err := h.service.Replay(c.Context(), id, scope)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.delivery.replay_failed")
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(delivery)
+}
+
+// listDeliveries responds with a page of deliveries matching filter
+func (h *Handler) listDeliveries(c *fiber.Ctx, filter DeliveryFilter) error {
+	deliveries, total, err := h.service.ListDeliveries(c.Context(), filter)
+	if err != nil {
+		return h.handleError(c, err, "webhooks.delivery.list_failed")
+	}
+
+	return c.JSON(fiber.Map{
+		"deliveries": deliveries,
+		"total":      total,
+		"limit":      filter.Limit,
+		"offset":     filter.Offset,
+	})
+}
+
+// deliveryFilter reads the status, event_type, limit and offset query parameters
+func deliveryFilter(c *fiber.Ctx) DeliveryFilter {
+	filter := DeliveryFilter{
+		Status:    c.Query("status"),
+		EventType: c.Query("event_type"),
+		Limit:     50,
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil && limit > 0 && limit <= 200 {
+		filter.Limit = limit
+	}
+	if offset, err := strconv.Atoi(c.Query("offset")); err == nil && offset > 0 {
+		filter.Offset = offset
+	}
+	return filter
+}
+
+// errInvalidID is returned when the :id route parameter is not a UUID
+var errInvalidID = errors.New("invalid id")
+
+// parseRequest returns the :id route parameter and the caller's client scope
+func (h *Handler) parseRequest(c *fiber.Ctx) (uuid.UUID, *uuid.UUID, error) {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return uuid.Nil, nil, errInvalidID
+	}
+	scope, err := clientScope(c)
+	return id, scope, err
+}
+
+// handleError maps service errors to HTTP responses
+func (h *Handler) handleError(c *fiber.Ctx, err error, event string) error {
+	switch {
+	case errors.Is(err, errInvalidID), errors.Is(err, ErrInvalidEndpoint):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, errNoClient):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	case errors.Is(err, ErrEndpointNotFound), errors.Is(err, ErrDeliveryNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+
+	h.logger.Error().
+		Err(err).
+		Str("event", event).
+		Msg("Webhook request failed")
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "internal server error",
+	})
+}
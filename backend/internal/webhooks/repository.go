@@ -0,0 +1,254 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backend/internal/db"
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrEndpointNotFound is returned when a webhook endpoint does not exist
+var ErrEndpointNotFound = errors.New("webhook endpoint not found")
+
+// ErrDeliveryNotFound is returned when a webhook delivery does not exist
+var ErrDeliveryNotFound = errors.New("webhook delivery not found")
+
+// ErrLeaseExpired is returned when recording an attempt for a delivery whose
+// lease expired and that another dispatcher may have claimed since
+var ErrLeaseExpired = errors.New("webhook delivery lease expired")
+
+// DeliveryFilter narrows down delivery listings; zero values are ignored
+type DeliveryFilter struct {
+	ClientID   *uuid.UUID
+	EndpointID *uuid.UUID
+	EventID    *uuid.UUID
+	EventType  string
+	Status     string
+	Limit      int
+	Offset     int
+}
+
+// Repository defines the webhook repository interface
+type Repository interface {
+	CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error
+	GetEndpoint(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context, clientID *uuid.UUID) ([]models.WebhookEndpoint, error)
+	GetActiveEndpoints(ctx context.Context, clientID uuid.UUID) ([]models.WebhookEndpoint, error)
+	UpdateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error
+	DeleteEndpoint(ctx context.Context, id uuid.UUID) error
+	CreateDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookDeliveryAttempt, leasedUntil time.Time) error
+	GetDelivery(ctx context.Context, id uuid.UUID) (*models.WebhookDelivery, error)
+	ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]models.WebhookDelivery, int64, error)
+	ListAttempts(ctx context.Context, deliveryID uuid.UUID) ([]models.WebhookDeliveryAttempt, error)
+}
+
+type repository struct {
+	db *gorm.DB
+}
+
+// NewRepository creates a new webhook repository
+func NewRepository() Repository {
+	return &repository{
+		db: db.DB,
+	}
+}
+
+// CreateEndpoint creates a new webhook endpoint
+func (r *repository) CreateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	if err := r.db.WithContext(ctx).Create(endpoint).Error; err != nil {
+		return fmt.Errorf("failed to create webhook endpoint: %w", err)
+	}
+	return nil
+}
+
+// GetEndpoint retrieves a webhook endpoint by ID
+func (r *repository) GetEndpoint(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&endpoint).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEndpointNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook endpoint: %w", err)
+	}
+	return &endpoint, nil
+}
+
+// ListEndpoints returns the endpoints of a client, or of every client when clientID is nil
+func (r *repository) ListEndpoints(ctx context.Context, clientID *uuid.UUID) ([]models.WebhookEndpoint, error) {
+	query := r.db.WithContext(ctx).Order("created_at ASC")
+	if clientID != nil {
+		query = query.Where("client_id = ?", *clientID)
+	}
+
+	var endpoints []models.WebhookEndpoint
+	if err := query.Find(&endpoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhook endpoints: %w", err)
+	}
+	return endpoints, nil
+}
+
+// GetActiveEndpoints returns the active endpoints of a client
+func (r *repository) GetActiveEndpoints(ctx context.Context, clientID uuid.UUID) ([]models.WebhookEndpoint, error) {
+	var endpoints []models.WebhookEndpoint
+	if err := r.db.WithContext(ctx).
+		Where("client_id = ? AND active = ?", clientID, true).
+		Find(&endpoints).Error; err != nil {
+		return nil, fmt.Errorf("failed to get active webhook endpoints: %w", err)
+	}
+	return endpoints, nil
+}
+
+// UpdateEndpoint saves the URL, description, event types, secret and active flag of an endpoint
+func (r *repository) UpdateEndpoint(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	result := r.db.WithContext(ctx).
+		Model(endpoint).
+		Select("url", "description", "event_types", "secret", "active", "updated_at").
+		Updates(endpoint)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update webhook endpoint: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrEndpointNotFound
+	}
+	return nil
+}
+
+// DeleteEndpoint deletes an endpoint and, through the foreign key, its deliveries
+func (r *repository) DeleteEndpoint(ctx context.Context, id uuid.UUID) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.WebhookEndpoint{})
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete webhook endpoint: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrEndpointNotFound
+	}
+	return nil
+}
+
+// CreateDeliveries stores new deliveries
+func (r *repository) CreateDeliveries(ctx context.Context, deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	if err := r.db.WithContext(ctx).Create(&deliveries).Error; err != nil {
+		return fmt.Errorf("failed to create webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+// ClaimDueDeliveries leases up to limit pending deliveries whose next attempt is due
+// Their next_attempt_at is pushed back by lease, so a delivery claimed by an
+// instance that dies mid-request is attempted again once the lease expires.
+// SKIP LOCKED lets several instances claim concurrently without overlap.
+func (r *repository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	now := time.Now()
+
+	var deliveries []models.WebhookDelivery
+	err := r.db.WithContext(ctx).Raw(`UPDATE webhook_deliveries SET next_attempt_at = ?, updated_at = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`, now.Add(lease), now, models.WebhookDeliveryPending, now, limit).
+		Scan(&deliveries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// RecordAttempt stores an attempt and the resulting state of its delivery
+// A nil attempt only updates the delivery. leasedUntil is the next_attempt_at
+// set by ClaimDueDeliveries; if it changed, the lease expired and nothing is
+// stored so the attempt count stays that of the current holder.
+func (r *repository) RecordAttempt(ctx context.Context, delivery *models.WebhookDelivery, attempt *models.WebhookDeliveryAttempt, leasedUntil time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(delivery).
+			Where("status = ? AND next_attempt_at = ?", models.WebhookDeliveryPending, leasedUntil).
+			Select("status", "attempts", "next_attempt_at", "last_response_status", "last_error", "delivered_at", "updated_at").
+			Updates(delivery)
+		if result.Error != nil {
+			return fmt.Errorf("failed to update webhook delivery: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrLeaseExpired
+		}
+
+		if attempt != nil {
+			if err := tx.Create(attempt).Error; err != nil {
+				return fmt.Errorf("failed to create webhook delivery attempt: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// GetDelivery retrieves a webhook delivery by ID
+func (r *repository) GetDelivery(ctx context.Context, id uuid.UUID) (*models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	if err := r.db.WithContext(ctx).Where("id = ?", id).First(&delivery).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDeliveryNotFound
+		}
+		return nil, fmt.Errorf("failed to get webhook delivery: %w", err)
+	}
+	return &delivery, nil
+}
+
+// ListDeliveries returns deliveries matching the filter, newest first, with the total count
+func (r *repository) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]models.WebhookDelivery, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.WebhookDelivery{})
+	if filter.ClientID != nil {
+		query = query.Where("client_id = ?", *filter.ClientID)
+	}
+	if filter.EndpointID != nil {
+		query = query.Where("endpoint_id = ?", *filter.EndpointID)
+	}
+	if filter.EventID != nil {
+		query = query.Where("event_id = ?", *filter.EventID)
+	}
+	if filter.EventType != "" {
+		query = query.Where("event_type = ?", filter.EventType)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count webhook deliveries: %w", err)
+	}
+
+	var deliveries []models.WebhookDelivery
+	query = query.Order("created_at DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit).Offset(filter.Offset)
+	}
+	if err := query.Find(&deliveries).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return deliveries, total, nil
+}
+
+// ListAttempts returns the attempts of a delivery in order
+func (r *repository) ListAttempts(ctx context.Context, deliveryID uuid.UUID) ([]models.WebhookDeliveryAttempt, error) {
+	var attempts []models.WebhookDeliveryAttempt
+	if err := r.db.WithContext(ctx).
+		Where("delivery_id = ?", deliveryID).
+		Order("attempt ASC").
+		Find(&attempts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list webhook delivery attempts: %w", err)
+	}
+	return attempts, nil
+}
@@ -0,0 +1,42 @@
+package webhooks
+
+import (
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy controls how failed deliveries are retried
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first
+	BaseDelay   time.Duration // delay before the second attempt
+	MaxDelay    time.Duration // upper bound for a single delay
+}
+
+// DefaultRetryPolicy returns the retry policy of webhook deliveries
+// Failed requests are retried for roughly two hours before the delivery fails.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 8,
+		BaseDelay:   time.Minute,
+		MaxDelay:    4 * time.Hour,
+	}
+}
+
+// Backoff returns the jittered delay to wait after the given failed attempt (1-based)
+// The delay doubles with every attempt up to MaxDelay; the actual wait is picked
+// from the upper half of that window so endpoints coming back are not flooded.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
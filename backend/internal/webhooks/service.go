@@ -0,0 +1,325 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"backend/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidEndpoint is returned when an endpoint's URL or event types are invalid
+var ErrInvalidEndpoint = errors.New("invalid webhook endpoint")
+
+// Notifier is told when new deliveries are ready; *Dispatcher implements it
+type Notifier interface {
+	Notify()
+}
+
+// Service defines the webhook service interface
+// Methods taking a clientID only see that client's endpoints and deliveries;
+// a nil clientID (admins) sees every client.
+type Service interface {
+	CreateEndpoint(ctx context.Context, clientID uuid.UUID, req *EndpointRequest) (*models.WebhookEndpoint, error)
+	ListEndpoints(ctx context.Context, clientID *uuid.UUID) ([]models.WebhookEndpoint, error)
+	GetEndpoint(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.WebhookEndpoint, error)
+	UpdateEndpoint(ctx context.Context, id uuid.UUID, clientID *uuid.UUID, req *EndpointRequest) (*models.WebhookEndpoint, error)
+	RotateSecret(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.WebhookEndpoint, error)
+	DeleteEndpoint(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) error
+	ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]models.WebhookDelivery, int64, error)
+	GetDelivery(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.WebhookDelivery, []models.WebhookDeliveryAttempt, error)
+	Replay(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.WebhookDelivery, error)
+	Publish(ctx context.Context, email *models.EmailMessageRecord, eventType string, meta map[string]interface{}) error
+}
+
+// EndpointRequest holds the fields of an endpoint to create or update
+// Nil fields are left unchanged on update.
+type EndpointRequest struct {
+	URL         *string   `json:"url"`
+	Description *string   `json:"description"`
+	EventTypes  *[]string `json:"event_types"`
+	Active      *bool     `json:"active"`
+}
+
+type service struct {
+	repo     Repository
+	notifier Notifier
+	targets  *targetChecker
+}
+
+// NewService creates a new webhook service
+// notifier, when not nil, is told about every new delivery.
+func NewService(repo Repository, notifier Notifier) Service {
+	return &service{
+		repo:     repo,
+		notifier: notifier,
+		targets:  &targetChecker{},
+	}
+}
+
+// CreateEndpoint creates an active endpoint with a new signing secret
+func (s *service) CreateEndpoint(ctx context.Context, clientID uuid.UUID, req *EndpointRequest) (*models.WebhookEndpoint, error) {
+	if req.URL == nil {
+		return nil, fmt.Errorf("%w: url is required", ErrInvalidEndpoint)
+	}
+
+	secret, err := NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	endpoint := &models.WebhookEndpoint{
+		ID:         uuid.New(),
+		ClientID:   clientID,
+		EventTypes: models.StringList{},
+		Secret:     secret,
+		Active:     true,
+	}
+	if err := s.applyEndpointRequest(ctx, endpoint, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.CreateEndpoint(ctx, endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// ListEndpoints returns the endpoints visible to clientID
+func (s *service) ListEndpoints(ctx context.Context, clientID *uuid.UUID) ([]models.WebhookEndpoint, error) {
+	return s.repo.ListEndpoints(ctx, clientID)
+}
+
+// GetEndpoint returns an endpoint; endpoints of other clients are reported as not found
+func (s *service) GetEndpoint(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.repo.GetEndpoint(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if clientID != nil && endpoint.ClientID != *clientID {
+		return nil, ErrEndpointNotFound
+	}
+	return endpoint, nil
+}
+
+// UpdateEndpoint changes the URL, description, event types or active flag of an endpoint
+func (s *service) UpdateEndpoint(ctx context.Context, id uuid.UUID, clientID *uuid.UUID, req *EndpointRequest) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.GetEndpoint(ctx, id, clientID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyEndpointRequest(ctx, endpoint, req); err != nil {
+		return nil, err
+	}
+
+	endpoint.UpdatedAt = time.Now()
+	if err := s.repo.UpdateEndpoint(ctx, endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// RotateSecret replaces the signing secret of an endpoint
+func (s *service) RotateSecret(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.GetEndpoint(ctx, id, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Secret = secret
+	endpoint.UpdatedAt = time.Now()
+	if err := s.repo.UpdateEndpoint(ctx, endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// DeleteEndpoint deletes an endpoint and its delivery log
+func (s *service) DeleteEndpoint(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) error {
+	if _, err := s.GetEndpoint(ctx, id, clientID); err != nil {
+		return err
+	}
+	return s.repo.DeleteEndpoint(ctx, id)
+}
+
+// ListDeliveries returns the deliveries matching the filter
+func (s *service) ListDeliveries(ctx context.Context, filter DeliveryFilter) ([]models.WebhookDelivery, int64, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 50 // Default limit
+	}
+	if filter.Limit > 200 {
+		filter.Limit = 200 // Max limit
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.repo.ListDeliveries(ctx, filter)
+}
+
+// GetDelivery returns a delivery and its attempts; deliveries of other clients are reported as not found
+func (s *service) GetDelivery(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.WebhookDelivery, []models.WebhookDeliveryAttempt, error) {
+	delivery, err := s.repo.GetDelivery(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if clientID != nil && delivery.ClientID != *clientID {
+		return nil, nil, ErrDeliveryNotFound
+	}
+
+	attempts, err := s.repo.ListAttempts(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return delivery, attempts, nil
+}
+
+// Replay creates a new delivery of the same event to the same endpoint
+// The original delivery and its attempt log are kept unchanged.
+func (s *service) Replay(ctx context.Context, id uuid.UUID, clientID *uuid.UUID) (*models.WebhookDelivery, error) {
+	original, _, err := s.GetDelivery(ctx, id, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	replay := models.WebhookDelivery{
+		ID:            uuid.New(),
+		EndpointID:    original.EndpointID,
+		ClientID:      original.ClientID,
+		EventID:       original.EventID,
+		EventType:     original.EventType,
+		Payload:       original.Payload,
+		Status:        models.WebhookDeliveryPending,
+		NextAttemptAt: &now,
+		ReplayOf:      &original.ID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := s.repo.CreateDeliveries(ctx, []models.WebhookDelivery{replay}); err != nil {
+		return nil, err
+	}
+
+	s.notify()
+	return &replay, nil
+}
+
+// Publish creates a delivery of an email event for every subscribed endpoint of the email's client
+// Emails without a client have no endpoints.
+func (s *service) Publish(ctx context.Context, email *models.EmailMessageRecord, eventType string, meta map[string]interface{}) error {
+	if email.ClientID == nil {
+		return nil
+	}
+
+	endpoints, err := s.repo.GetActiveEndpoints(ctx, *email.ClientID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	event := Event{
+		ID:        uuid.New(),
+		Type:      eventType,
+		CreatedAt: now,
+		Data: EventData{
+			EmailID:    email.ID,
+			MessageID:  email.MessageID,
+			To:         email.To,
+			Subject:    email.Subject,
+			CampaignID: email.CampaignID,
+			ContactID:  email.ContactID,
+			Meta:       meta,
+		},
+	}
+	var payload []byte
+
+	var deliveries []models.WebhookDelivery
+	for i := range endpoints {
+		if !endpoints[i].Subscribes(eventType) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(event); err != nil {
+				return fmt.Errorf("failed to marshal webhook event: %w", err)
+			}
+		}
+		deliveries = append(deliveries, models.WebhookDelivery{
+			ID:            uuid.New(),
+			EndpointID:    endpoints[i].ID,
+			ClientID:      endpoints[i].ClientID,
+			EventID:       event.ID,
+			EventType:     eventType,
+			Payload:       payload,
+			Status:        models.WebhookDeliveryPending,
+			NextAttemptAt: &now,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+
+	if err := s.repo.CreateDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+
+	s.notify()
+	return nil
+}
+
+// notify wakes the dispatcher, if any
+func (s *service) notify() {
+	if s.notifier != nil {
+		s.notifier.Notify()
+	}
+}
+
+// applyEndpointRequest validates req and copies its fields onto endpoint
+func (s *service) applyEndpointRequest(ctx context.Context, endpoint *models.WebhookEndpoint, req *EndpointRequest) error {
+	if req.URL != nil {
+		if err := s.validateURL(ctx, *req.URL); err != nil {
+			return err
+		}
+		endpoint.URL = *req.URL
+	}
+	if req.Description != nil {
+		endpoint.Description = *req.Description
+	}
+	if req.EventTypes != nil {
+		eventTypes := models.StringList{}
+		for _, eventType := range *req.EventTypes {
+			if !IsEventType(eventType) {
+				return fmt.Errorf("%w: unknown event type %q", ErrInvalidEndpoint, eventType)
+			}
+			eventTypes = append(eventTypes, eventType)
+		}
+		endpoint.EventTypes = eventTypes
+	}
+	if req.Active != nil {
+		endpoint.Active = *req.Active
+	}
+	return nil
+}
+
+// validateURL checks that rawURL is an absolute http(s) URL of a public host
+func (s *service) validateURL(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidEndpoint)
+	}
+	if parsed.User != nil {
+		return fmt.Errorf("%w: url must not contain credentials", ErrInvalidEndpoint)
+	}
+	if err := s.targets.checkHost(ctx, parsed.Hostname()); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEndpoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// errForbiddenTarget is returned for webhook URLs that reach internal networks
+// Without the check a client could make the server POST to its own admin
+// ports, other services on the private network or the cloud metadata endpoint.
+var errForbiddenTarget = errors.New("url must not point to a loopback, private or link-local address")
+
+// targetChecker rejects webhook targets that reach internal networks
+type targetChecker struct {
+	allowPrivate bool // disables the checks; tests serve endpoints on loopback
+}
+
+var (
+	// sharedAddressSpace is the carrier-grade NAT range, also used by some
+	// cloud metadata services
+	sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+	// thisNetwork addresses reach the local host on most systems
+	thisNetwork = netip.MustParsePrefix("0.0.0.0/8")
+	// benchmarking is reserved for testing network devices
+	benchmarking = netip.MustParsePrefix("198.18.0.0/15")
+	// reservedIPv4 is the former class E range, with the broadcast address
+	reservedIPv4 = netip.MustParsePrefix("240.0.0.0/4")
+
+	// IPv6 prefixes that embed an IPv4 address, which such a packet may reach
+	nat64     = netip.MustParsePrefix("64:ff9b::/96") // in its last four bytes
+	sixToFour = netip.MustParsePrefix("2002::/16")    // in bytes 2 to 5
+	teredo    = netip.MustParsePrefix("2001::/32")    // server in bytes 4 to 7, client inverted in the last four
+)
+
+// forbiddenAddr reports whether webhooks must not be delivered to addr
+func forbiddenAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, embedded := range embeddedIPv4(addr) {
+		if forbiddenAddr(embedded) {
+			return true
+		}
+	}
+	return addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr) ||
+		thisNetwork.Contains(addr) ||
+		benchmarking.Contains(addr) ||
+		reservedIPv4.Contains(addr)
+}
+
+// embeddedIPv4 returns the IPv4 addresses embedded in a NAT64, 6to4 or Teredo
+// address
+func embeddedIPv4(addr netip.Addr) []netip.Addr {
+	b := addr.As16()
+	switch {
+	case nat64.Contains(addr):
+		return []netip.Addr{netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]})}
+	case sixToFour.Contains(addr):
+		return []netip.Addr{netip.AddrFrom4([4]byte{b[2], b[3], b[4], b[5]})}
+	case teredo.Contains(addr):
+		return []netip.Addr{
+			netip.AddrFrom4([4]byte{b[4], b[5], b[6], b[7]}),
+			netip.AddrFrom4([4]byte{^b[12], ^b[13], ^b[14], ^b[15]}),
+		}
+	}
+	return nil
+}
+
+// checkHost rejects a URL host that is or resolves to a forbidden address
+// Hosts that do not resolve yet are accepted; the dialer checks every
+// connection again, which also covers DNS records changed after this check.
+func (t *targetChecker) checkHost(ctx context.Context, host string) error {
+	if t.allowPrivate {
+		return nil
+	}
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if forbiddenAddr(addr) {
+			return errForbiddenTarget
+		}
+		return nil
+	}
+
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return errForbiddenTarget
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if forbiddenAddr(addr) {
+			return errForbiddenTarget
+		}
+	}
+	return nil
+}
+
+// dialControl refuses connections to forbidden addresses
+// It runs after name resolution, on the address actually dialed.
+func (t *targetChecker) dialControl(network, address string, _ syscall.RawConn) error {
+	if t.allowPrivate {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("webhook dial %s: %w", address, err)
+	}
+	if forbiddenAddr(addrPort.Addr()) {
+		return fmt.Errorf("webhook dial %s: %w", address, errForbiddenTarget)
+	}
+	return nil
+}
+
+// newClient returns the HTTP client that delivers webhooks
+func (t *targetChecker) newClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control:   t.dialControl,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would connect to the endpoint on our behalf, past dialControl
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// Endpoints must answer themselves; a redirect is a failed attempt
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
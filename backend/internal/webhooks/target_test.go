@@ -0,0 +1,50 @@
+package webhooks
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestForbiddenAddr(t *testing.T) {
+	tests := []struct {
+		addr      string
+		forbidden bool
+	}{
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.0.1", true},
+		{"169.254.169.254", true},
+		{"100.100.100.200", true},
+		{"0.0.0.0", true},
+		{"::", true},
+		{"fe80::1", true},
+		{"fd00:ec2::254", true},
+		{"::ffff:127.0.0.1", true},
+		{"64:ff9b::a00:1", true},
+		{"64:ff9b::5db8:d822", false},
+		{"224.0.0.1", true},
+		{"198.18.0.1", true},
+		{"198.19.255.254", true},
+		{"198.20.0.1", false},
+		{"240.0.0.1", true},
+		{"255.255.255.255", true},
+		{"2002:7f00:1::", true},
+		{"2002:a9fe:a9fe::1", true},
+		{"2002:5db8:d822::1", false},
+		{"2001:0:7f00:1::", true},
+		{"2001:0:5db8:d822:0:0:f5fe:fffe", true},
+		{"2001:0:5db8:d822:0:0:a247:29dd", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			if got := forbiddenAddr(netip.MustParseAddr(tt.addr)); got != tt.forbidden {
+				t.Errorf("forbiddenAddr(%s) = %v, want %v", tt.addr, got, tt.forbidden)
+			}
+		})
+	}
+}
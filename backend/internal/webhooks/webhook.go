@@ -1,5 +1,127 @@
+// Package webhooks delivers email events to client-owned HTTP endpoints.
+//
+// Every event recorded by the message tracker is stored as one delivery per
+// subscribed endpoint. The Dispatcher POSTs each delivery, signed with the
+// endpoint's secret, and retries failures with backoff. Every request is kept
+// in the delivery attempt log, and deliveries can be replayed through the API.
 package webhooks
 
-// TODO: Implement webhook handlers
-// This package will handle incoming webhooks
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/google/uuid"
+)
+
+// Request headers sent with every delivery
+const (
+	HeaderSignature = "X-Mailblast-Signature" // t=<unix>,v1=<hex hmac>
+	HeaderEventID   = "X-Mailblast-Event-Id"
+	HeaderEventType = "X-Mailblast-Event-Type"
+	HeaderDelivery  = "X-Mailblast-Delivery-Id"
+)
+
+// EventTypes are the event types endpoints can subscribe to
+var EventTypes = []string{"delivered", "bounce", "complaint", "reject", "rendering_failure", "open", "click"}
+
+// ErrInvalidSignature is returned when a signature header does not match the payload
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Event is the JSON body POSTed to webhook endpoints
+type Event struct {
+	ID        uuid.UUID `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      EventData `json:"data"`
+}
+
+// EventData describes the email an event happened to
+type EventData struct {
+	EmailID    uuid.UUID              `json:"email_id"`
+	MessageID  string                 `json:"message_id"`
+	To         string                 `json:"to"`
+	Subject    string                 `json:"subject,omitempty"`
+	CampaignID *uuid.UUID             `json:"campaign_id,omitempty"`
+	ContactID  *uuid.UUID             `json:"contact_id,omitempty"`
+	Meta       map[string]interface{} `json:"meta,omitempty"`
+}
+
+// IsEventType reports whether eventType can be subscribed to
+func IsEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret returns a random endpoint signing secret
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// Sign returns the signature header value of body sent at timestamp
+// The signed message is "<unix timestamp>.<body>", so receivers can reject
+// replayed requests by checking the timestamp.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + computeSignature(secret, unix, body)
+}
+
+// Verify checks a signature header against body
+// Signatures older than tolerance are rejected; a zero tolerance disables the check.
+func Verify(secret, header string, body []byte, tolerance time.Duration) error {
+	var unix, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			signature = value
+		}
+	}
+	if unix == "" || signature == "" {
+		return ErrInvalidSignature
+	}
+
+	if tolerance > 0 {
+		seconds, err := strconv.ParseInt(unix, 10, 64)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		if age := time.Since(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+			return ErrInvalidSignature
+		}
+	}
+
+	expected := computeSignature(secret, unix, body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// computeSignature returns the hex HMAC-SHA256 of "<unix>.<body>"
+func computeSignature(secret, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
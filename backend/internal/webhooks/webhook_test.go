@@ -0,0 +1,54 @@
+package webhooks
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignVerify(t *testing.T) {
+	body := []byte(`{"type":"open"}`)
+	header := Sign("whsec_test", time.Now(), body)
+
+	if !strings.HasPrefix(header, "t=") || !strings.Contains(header, ",v1=") {
+		t.Fatalf("Unexpected signature header %q", header)
+	}
+	if err := Verify("whsec_test", header, body, 5*time.Minute); err != nil {
+		t.Errorf("Expected valid signature, got: %v", err)
+	}
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	body := []byte(`{"type":"open"}`)
+	now := time.Now()
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+	}{
+		{"tampered body", "whsec_test", Sign("whsec_test", now, body), []byte(`{"type":"click"}`)},
+		{"wrong secret", "whsec_other", Sign("whsec_test", now, body), body},
+		{"expired timestamp", "whsec_test", Sign("whsec_test", now.Add(-time.Hour), body), body},
+		{"missing signature", "whsec_test", "t=123", body},
+		{"garbage", "whsec_test", "not a signature", body},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, 5*time.Minute)
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("Expected ErrInvalidSignature, got: %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_ZeroToleranceSkipsTimestampCheck(t *testing.T) {
+	body := []byte(`{}`)
+	header := Sign("whsec_test", time.Now().Add(-24*time.Hour), body)
+	if err := Verify("whsec_test", header, body, 0); err != nil {
+		t.Errorf("Expected old signature to verify without tolerance, got: %v", err)
+	}
+}
@@ -3,11 +3,14 @@
 #
 # Usage: ./retry-failed-jobs.sh [hours]
 #
-# Retries jobs that failed in the last N hours (default: 24)
+# Requeues jobs that failed in the last N hours (default: 24) through the
+# admin API. Requires an admin JWT in ADMIN_TOKEN.
 
 set -e
 
 HOURS="${1:-24}"
+API_URL="${API_URL:-http://localhost:8080}"
+TOKEN="${ADMIN_TOKEN:?ADMIN_TOKEN must be set to an admin JWT}"
 
 echo "=========================================="
 echo "Retry Failed Jobs"
@@ -15,13 +18,11 @@ echo "=========================================="
 echo "Retrying jobs failed in last ${HOURS} hours"
 echo "=========================================="
 
-# Query failed jobs
-FAILED_JOBS=$(psql -h "${DB_HOST}" -U "${DB_USER}" -d mailblast -t -c "
-    SELECT id, campaign_id, error_message, created_at
-    FROM failed_jobs
-    WHERE created_at > NOW() - INTERVAL '${HOURS} hours'
-    ORDER BY created_at DESC;
-")
+# Query failed jobs that have not been requeued yet
+RESPONSE=$(curl -f -s -H "Authorization: Bearer ${TOKEN}" \
+  "${API_URL}/api/admin/failed-jobs?hours=${HOURS}&retried=false&limit=500")
+
+FAILED_JOBS=$(echo "$RESPONSE" | jq -r '.failed_jobs[]? | "\(.id) \(.campaign_id // "-") \(.queue) \(.error_message)"')
 
 if [ -z "$FAILED_JOBS" ]; then
     echo "No failed jobs found in last ${HOURS} hours"
@@ -29,7 +30,7 @@ if [ -z "$FAILED_JOBS" ]; then
 fi
 
 echo ""
-echo "Failed jobs to retry:"
+echo "Failed jobs to retry ($(echo "$RESPONSE" | jq -r '.total') total):"
 echo "$FAILED_JOBS" | head -10
 
 echo ""
@@ -49,23 +50,18 @@ echo "$FAILED_JOBS" | while read -r line; do
     if [ -n "$line" ]; then
         JOB_ID=$(echo "$line" | awk '{print $1}')
         CAMPAIGN_ID=$(echo "$line" | awk '{print $2}')
-        
+
         echo "  Retrying job ${JOB_ID} for campaign ${CAMPAIGN_ID}"
-        
-        # Re-queue job
-        redis-cli LPUSH email_queue "{\"job_id\":\"${JOB_ID}\",\"campaign_id\":\"${CAMPAIGN_ID}\",\"type\":\"retry\"}" > /dev/null
-        
-        if [ $? -eq 0 ]; then
-            # Mark as retried in database
-            psql -h "${DB_HOST}" -U "${DB_USER}" -d mailblast -c "
-                UPDATE failed_jobs 
-                SET retried_at = NOW() 
-                WHERE id = '${JOB_ID}';
-            " > /dev/null
-            
+
+        # Requeue job (the API marks it as retried)
+        HTTP_CODE=$(curl -s -o /dev/null -w "%{http_code}" \
+          -X POST "${API_URL}/api/admin/failed-jobs/${JOB_ID}/requeue" \
+          -H "Authorization: Bearer ${TOKEN}")
+
+        if [ "$HTTP_CODE" -ge 200 ] && [ "$HTTP_CODE" -lt 300 ]; then
             echo "    ✅ Queued for retry"
         else
-            echo "    ❌ Failed to queue"
+            echo "    ❌ Failed to queue (HTTP ${HTTP_CODE})"
         fi
     fi
 done
@@ -74,4 +70,3 @@ echo ""
 echo "=========================================="
 echo "✅ Retry completed"
 echo "=========================================="
-